@@ -20,6 +20,7 @@ func init() {
 		Bool("working-dir", false, "Also clear the working directory state.")
 	clearEnvCommand.PersistentFlags().
 		Bool("force", false, "Force clear without confirmation prompt.")
+	addRunFlag(clearEnvCommand)
 }
 
 var clearEnvCommand = &cobra.Command{
@@ -35,12 +36,17 @@ Examples:
   ie clear-env                    # Clear only environment variables
   ie clear-env --working-dir      # Clear env vars and working directory
   ie clear-env --all              # Clear both env vars and working directory
-  ie clear-env --force            # Clear without confirmation`,
+  ie clear-env --force            # Clear without confirmation
+  ie clear-env --run <run ID>     # Clear the state of a specific run`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		force, _ := cmd.Flags().GetBool("force")
 		clearAll, _ := cmd.Flags().GetBool("all")
 		clearWorkingDir, _ := cmd.Flags().GetBool("working-dir")
 
+		if err := useTargetedStateDirectory(cmd); err != nil {
+			return commandError(cmd, err, false, "error resolving the run to clear")
+		}
+
 		// Determine what to clear
 		shouldClearEnv := true // Always clear env vars
 		shouldClearWD := clearAll || clearWorkingDir
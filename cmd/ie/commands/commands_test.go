@@ -14,6 +14,7 @@ import (
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -58,6 +59,7 @@ func runRootWithArgsCapturing(t *testing.T, args ...string) (*bytes.Buffer, *byt
 			"",
 		)
 	resetCommandTreeFlags(rootCommand)
+	useTemporaryStateRoot(t)
 	tempLogPath := filepath.Join(t.TempDir(), "ie.log")
 	if err := rootCommand.PersistentFlags().Set("log-path", tempLogPath); err != nil {
 		t.Fatalf("failed to set log path flag: %v", err)
@@ -72,6 +74,33 @@ func runRootWithArgsCapturing(t *testing.T, args ...string) (*bytes.Buffer, *byt
 	return stdout, stderr, rootCommand.Execute()
 }
 
+// The test whose runs currently keep their state in a temporary directory.
+var stateRootOwner *testing.T
+
+// Keeps the state directories of the runs started by a test in a temporary
+// directory, so that tests neither see nor leave behind real runs.
+func useTemporaryStateRoot(t *testing.T) {
+	t.Helper()
+	if stateRootOwner == t {
+		return
+	}
+
+	originalRoot := lib.StateRoot
+	originalEnv := lib.DefaultEnvironmentStateFile
+	originalWD := lib.DefaultWorkingDirectoryStateFile
+	originalCheckpoint := lib.DefaultCheckpointFile
+	lib.StateRoot = filepath.Join(t.TempDir(), "ie-runs")
+	t.Setenv(lib.StateDirectoryEnvironmentVariable, "")
+	stateRootOwner = t
+	t.Cleanup(func() {
+		lib.StateRoot = originalRoot
+		lib.DefaultEnvironmentStateFile = originalEnv
+		lib.DefaultWorkingDirectoryStateFile = originalWD
+		lib.DefaultCheckpointFile = originalCheckpoint
+		stateRootOwner = nil
+	})
+}
+
 // patchEngineNew swaps engine.NewEngine with a stub for the duration of a test.
 
 func patchEngineNew(t *testing.T) *int {
@@ -187,6 +216,7 @@ func TestCommandsRequireMarkdownArgument(t *testing.T) {
 		{"test", []string{"test"}},
 		{"interactive", []string{"interactive"}},
 		{"inspect", []string{"inspect"}},
+		{"replay", []string{"replay"}},
 	}
 
 	for _, tt := range tests {
@@ -254,19 +284,29 @@ func TestEnvConfigCommand_PrintsExports(t *testing.T) {
 	}
 }
 
-func TestEnvConfigReadsDefaultSnapshotAfterExecute(t *testing.T) {
-	envSnapshot, _ := overrideDefaultStateFiles(t)
+func TestEnvConfigReadsLatestRunAfterExecute(t *testing.T) {
+	useTemporaryStateRoot(t)
 	scenario := writeScenarioWithContent(t, "# Scenario\n\n## Step\n\n```bash\nexport AZ_TEST_VAR=demo\n```\n")
-	if err := runRootWithArgs(t, "clear-env", "--force"); err != nil {
-		t.Fatalf("clear-env failed: %v", err)
-	}
 	if err := runRootWithArgs(t, "execute", scenario); err != nil {
 		t.Fatalf("execute failed: %v", err)
 	}
-	if _, err := os.Stat(envSnapshot); err != nil {
-		t.Fatalf("expected environment snapshot at %s: %v", envSnapshot, err)
+	runs, err := lib.ListRunStateDirectories()
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected execute to create one run directory, got %v (%v)", runs, err)
+	}
+	if _, err := os.Stat(filepath.Join(runs[0], "env-vars")); err != nil {
+		t.Fatalf("expected environment snapshot in %s: %v", runs[0], err)
 	}
-	stdout, _, err := runRootWithArgsCapturing(t, "env-config")
+
+	// Another run should not affect the state of the first one.
+	t.Setenv(lib.StateDirectoryEnvironmentVariable, "")
+	other := writeScenarioWithContent(t, "# Other\n\n## Step\n\n```bash\nexport AZ_TEST_VAR=other\n```\n")
+	if err := runRootWithArgs(t, "execute", other); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+
+	t.Setenv(lib.StateDirectoryEnvironmentVariable, "")
+	stdout, _, err := runRootWithArgsCapturing(t, "env-config", "--run", filepath.Base(runs[0]))
 	if err != nil {
 		t.Fatalf("env-config failed: %v", err)
 	}
@@ -276,6 +316,19 @@ func TestEnvConfigReadsDefaultSnapshotAfterExecute(t *testing.T) {
 	if strings.Contains(stdout.String(), "export PATH=") {
 		t.Fatalf("env-config should not emit baseline variables: %q", stdout.String())
 	}
+
+	t.Setenv(lib.StateDirectoryEnvironmentVariable, "")
+	stdout, _, err = runRootWithArgsCapturing(t, "env-config")
+	if err != nil {
+		t.Fatalf("env-config failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "export AZ_TEST_VAR=\"other\"") {
+		t.Fatalf("expected the latest run to be read, got %q", stdout.String())
+	}
+
+	if _, _, err := runRootWithArgsCapturing(t, "env-config", "--run", "missing"); err == nil {
+		t.Fatalf("expected an error for an unknown run")
+	}
 }
 
 func TestEnvConfigCommand_MissingFileErrors(t *testing.T) {
@@ -324,6 +377,31 @@ func TestExecuteCommand_Succeeds(t *testing.T) {
 	}
 }
 
+func TestExecuteCommandUsesConfigFlag(t *testing.T) {
+	markdown := writeTempScenario(t, "Execute Config Scenario")
+	if err := os.WriteFile(filepath.Join(filepath.Dir(markdown), ".ie.yaml"), []byte("no-such-key: true\n"), 0644); err != nil {
+		t.Fatalf("failed to write the configuration: %v", err)
+	}
+	configs := captureEngineConfigurations(t)
+	patchEngineNew(t)
+
+	_, stderr, err := runRootWithArgsCapturing(t, "execute", markdown)
+	if err == nil || !strings.Contains(stderr.String(), "no-such-key") {
+		t.Fatalf("expected the invalid .ie.yaml to be rejected, got %v: %q", err, stderr.String())
+	}
+
+	config := filepath.Join(t.TempDir(), "ie.yaml")
+	if err := os.WriteFile(config, []byte("destructive:\n  commands:\n    - command: helm delete\n"), 0644); err != nil {
+		t.Fatalf("failed to write the configuration: %v", err)
+	}
+	if _, stderr, err := runRootWithArgsCapturing(t, "execute", "--config", config, markdown); err != nil {
+		t.Fatalf("expected --config to replace the invalid .ie.yaml, got %v: %q", err, stderr.String())
+	}
+	if len(*configs) != 1 || len((*configs)[0].DestructiveCommands) != 1 || (*configs)[0].DestructiveCommands[0].Command != "helm delete" {
+		t.Fatalf("expected the destructive commands of --config, got %+v", *configs)
+	}
+}
+
 func TestExecuteCommandScenarioFailureDoesNotPrintUsage(t *testing.T) {
 	markdown := writeTempScenario(t, "Execute Failure Scenario")
 	original := engineNewEngine
@@ -361,6 +439,62 @@ func TestTestCommand_Succeeds(t *testing.T) {
 	}
 }
 
+// Records the scenario it is asked to test.
+type recordingEngine struct {
+	stubEngine
+	tested **common.Scenario
+}
+
+func (r recordingEngine) TestScenario(scenario *common.Scenario) error {
+	*r.tested = scenario
+	return nil
+}
+
+func TestReplayCommand_TestsScenarioOfReport(t *testing.T) {
+	report := common.BuildReport("Replayed Scenario")
+	report.WithEnvironmentVariables(map[string]string{"MY_RG": "rg-1234"}).
+		WithCodeBlocks([]common.StatefulCodeBlock{{
+			CodeBlock:  parsers.CodeBlock{Language: "bash", Content: "export MY_RG=\"rg-$RANDOM\"\n"},
+			StepName:   "Create a resource group",
+			StepNumber: 0,
+			Success:    true,
+		}})
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	if err := report.WriteToJSONFile(reportPath); err != nil {
+		t.Fatalf("failed to write report: %v", err)
+	}
+
+	var tested *common.Scenario
+	original := engineNewEngine
+	engineNewEngine = func(cfg enginepkg.EngineConfiguration) (engineRunner, error) {
+		return recordingEngine{tested: &tested}, nil
+	}
+	t.Cleanup(func() {
+		engineNewEngine = original
+	})
+
+	if err := runRootWithArgs(t, "replay", reportPath); err != nil {
+		t.Fatalf("replay command should succeed, got %v", err)
+	}
+	if tested == nil {
+		t.Fatalf("expected the scenario of the report to be tested")
+	}
+	if tested.Name != "Replayed Scenario" {
+		t.Fatalf("expected the scenario to be named after the report, got %q", tested.Name)
+	}
+	if content := tested.Steps[0].CodeBlocks[0].Content; !strings.Contains(content, "export MY_RG='rg-1234'") {
+		t.Fatalf("expected the captured value to be pinned, got %q", content)
+	}
+}
+
+func TestReplayCommand_RejectsMarkdown(t *testing.T) {
+	markdown := writeTempScenario(t, "Not A Report")
+	patchEngineNew(t)
+	if err := runRootWithArgs(t, "replay", markdown); err == nil {
+		t.Fatalf("expected replaying markdown to fail")
+	}
+}
+
 func TestInteractiveCommand_Succeeds(t *testing.T) {
 	markdown := writeTempScenario(t, "Interactive Scenario")
 	configs := captureEngineConfigurations(t)
@@ -13,6 +13,16 @@ var buildEngineConfiguration = func(opts *executionOptions, overrides ...func(*e
 		WorkingDirectory: opts.WorkingDirectory,
 		RenderValues:     opts.RenderValues,
 		ReportFile:       opts.ReportFile,
+		ReportFormat:     opts.ReportFormat,
+		SkipTags:         opts.SkipTags,
+		ShellBackend:     opts.ShellBackend,
+		Timeout:          opts.Timeout,
+		Resume:           opts.Resume,
+		Events:           opts.Events,
+		UpdateExpected:   opts.UpdateExpected,
+
+		DestructiveCommands: opts.RepositoryConfig.Destructive.Commands,
+		Policy:              opts.Policy,
 	}
 
 	for _, override := range overrides {
@@ -14,9 +14,10 @@ func init() {
 	rootCommand.AddCommand(envConfigCommand)
 	envConfigCommand.Flags().String(
 		"state-file",
-		lib.DefaultEnvironmentStateFile,
-		"Path to the environment state file to read",
+		"",
+		"Path to the environment state file to read. Overrides --run",
 	)
+	addRunFlag(envConfigCommand)
 	envConfigCommand.Flags().String(
 		"prefix",
 		"",
@@ -27,14 +28,15 @@ func init() {
 var envConfigCommand = &cobra.Command{
 	Use:   "env-config",
 	Short: "Print stored environment variables as source-able exports",
-	Long: `Reads the persisted environment state file (default /tmp/ie-env-vars,
-	override with --state-file) and renders its contents as export statements.
-	Capture the output and source it later to reproduce the environment from a
-	previous Innovation Engine run.
+	Long: `Reads the persisted environment state file of a run (default the most
+	recent run, override with --run or --state-file) and renders its contents
+	as export statements. Capture the output and source it later to reproduce
+	the environment from a previous Innovation Engine run.
 
 Examples:
   ie env-config                            # Dump all persisted variables
   ie env-config --prefix EV_               # Limit output to EV_ prefixed vars
+  ie env-config --run <run ID>             # Read the state of a specific run
   ie env-config --state-file /tmp/custom   # Use a custom state file`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		stateFile, err := cmd.Flags().GetString("state-file")
@@ -47,6 +49,13 @@ Examples:
 			return commandError(cmd, err, false, "error parsing --prefix")
 		}
 
+		if stateFile == "" {
+			if err := useTargetedStateDirectory(cmd); err != nil {
+				return commandError(cmd, err, false, "error resolving the run to read")
+			}
+			stateFile = lib.DefaultEnvironmentStateFile
+		}
+
 		envMap, err := lib.LoadEnvironmentStateFile(stateFile)
 		if err != nil {
 			return commandError(cmd, err, false, "error loading environment state")
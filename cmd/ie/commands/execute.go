@@ -14,6 +14,8 @@ func init() {
 
 	addCommonExecutionFlags(executeCommand)
 	addCorrelationFlag(executeCommand)
+	addResumeFlag(executeCommand)
+	addReportFlags(executeCommand)
 }
 
 var executeCommand = &cobra.Command{
@@ -22,6 +24,14 @@ var executeCommand = &cobra.Command{
 	Short: "Execute the commands in an executable document.",
 	RunE: func(cmd *cobra.Command, args []string) error {
 
+		opts, err := bindExecutionOptions(cmd, args)
+		if err != nil {
+			return handleExecutionOptionError(cmd, err)
+		}
+		if err := prepareStateDirectory(opts); err != nil {
+			return handleExecutionOptionError(cmd, err)
+		}
+
 		// Ensure we are in the original invocation directory before parsing
 		// the first document regardless of any working directory flags that
 		// will be applied later during execution.
@@ -39,11 +49,6 @@ var executeCommand = &cobra.Command{
 			}
 		}
 
-		opts, err := bindExecutionOptions(cmd, args)
-		if err != nil {
-			return handleExecutionOptionError(cmd, err)
-		}
-
 		// Parse the markdown file and create a scenario
 		scenario, err := createScenarioFromOptions(opts, executionRunnerTypes)
 		if err != nil {
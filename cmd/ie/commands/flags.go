@@ -2,8 +2,12 @@ package commands
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/Azure/InnovationEngine/internal/engine/common"
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/spf13/cobra"
 )
 
@@ -13,7 +17,7 @@ func addCommonExecutionFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().
 		Bool("verbose", false, "Show extra console context (working dirs, full command output). For deeper persisted diagnostics use --log-level")
 	cmd.PersistentFlags().
-		Bool("do-not-delete", false, "Do not delete the Azure resources created by the Azure CLI commands executed.")
+		Bool("do-not-delete", false, "Skip the code blocks running destructive commands, like az group delete or rm -rf, so the resources they delete are kept.")
 	cmd.PersistentFlags().
 		Bool("stream-output", true, "Stream command output in real-time as it's generated (default). Use --stream-output=false to show spinner and display output after completion.")
 
@@ -24,6 +28,20 @@ func addCommonExecutionFlags(cmd *cobra.Command) {
 
 	cmd.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	cmd.PersistentFlags().
+		String("shell-backend", string(shells.BackendProcess), "Sets how code blocks are run: 'process' starts a new bash process per code block, 'session' runs every code block in one long lived bash session so functions, aliases and shell options carry over.")
+	cmd.PersistentFlags().
+		Duration("timeout", 0, "Stops the scenario if it runs for longer than the given duration (e.g. 30m). Individual code blocks can set their own timeout with ```bash {timeout=300}.")
+	cmd.PersistentFlags().
+		StringArray("skip-tag", []string{}, "Skips code blocks tagged with the given tag (e.g. ```bash {tags=slow}). Can be repeated.")
+	cmd.PersistentFlags().
+		String("state-dir", "", fmt.Sprintf("Sets the directory holding the state of the run (environment variables, working directory, checkpoints). Defaults to $%s, or a new directory per run under %s.", lib.StateDirectoryEnvironmentVariable, lib.StateRoot))
+	cmd.PersistentFlags().
+		String("events", "", "Writes a JSON Lines stream of execution events to the given destination: a file path, fd:<N> for an inherited file descriptor or unix:<path> for a unix socket.")
+	cmd.PersistentFlags().
+		String("config", "", fmt.Sprintf("The repository configuration holding the inspect rules and destructive commands. Defaults to the first %s found in the directory of the document or its parents, up to the root of the git repository.", strings.Join(common.RepositoryConfigFileNames, " or ")))
+	cmd.PersistentFlags().
+		String("policy", "", "A YAML file declaring the executables, commands and network hosts code blocks may use. The scenario stops before running any code block if one of them violates it; inspect reports every violation.")
 }
 
 // addCorrelationFlag adds the correlation-id flag used by some commands.
@@ -32,6 +50,21 @@ func addCorrelationFlag(cmd *cobra.Command) {
 		String("correlation-id", "", "Adds a correlation ID to the user agent used by a scenarios azure-cli commands.")
 }
 
+// addResumeFlag adds the resume flag used by commands that record checkpoints.
+func addResumeFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().
+		Bool("resume", false, "Continues from the code block that failed in the last run, restoring the environment variables and working directory it left behind. Refuses to resume if the document, --skip-tag or --do-not-delete changed since.")
+}
+
+// addReportFlags adds the flags used by commands that can write a report of
+// the scenario they ran.
+func addReportFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().
+		String("report", "", "The path to generate a report of the scenario execution. The report will only be generated when this flag is set.")
+	cmd.PersistentFlags().
+		String("report-format", string(common.ReportFormatJSON), "The format of the report: json, junit (JUnit XML for CI systems) or html (a single page to share with people).")
+}
+
 // getEnvironmentSetting fetches and validates the --environment flag, returning
 // a typed Environment so callers do not need to duplicate parsing logic.
 func getEnvironmentSetting(cmd *cobra.Command) (environments.Environment, error) {
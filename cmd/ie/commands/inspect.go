@@ -2,10 +2,14 @@ package commands
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/ui"
 	"github.com/spf13/cobra"
 )
@@ -16,15 +20,21 @@ func init() {
 
 	addCommonExecutionFlags(inspectCommand)
 	addCorrelationFlag(inspectCommand)
+	inspectCommand.PersistentFlags().
+		String("format", string(common.InspectFormatText), "How to report the issues found: text (styled messages on stderr), json or sarif (a SARIF 2.1.0 log for GitHub code scanning), both written to stdout.")
+	inspectCommand.PersistentFlags().
+		Bool("fix", false, "Rewrites the document to resolve the issues that can be fixed automatically (missing language tags and descriptions, variable names), leaving the rest of it as it is.")
+	inspectCommand.PersistentFlags().
+		Bool("dry-run", false, "With --fix, prints the changes as a diff instead of writing them.")
 }
 
 func partitionValidationIssues(issues []common.ValidationIssue) (warnings []string, errors []string) {
 	for _, issue := range issues {
 		switch issue.Severity {
 		case common.ValidationSeverityWarning:
-			warnings = append(warnings, issue.Message)
+			warnings = append(warnings, issue.String())
 		case common.ValidationSeverityError:
-			errors = append(errors, issue.Message)
+			errors = append(errors, issue.String())
 		}
 	}
 	return warnings, errors
@@ -54,34 +64,169 @@ func pluralSuffix(count int) string {
 	return "s"
 }
 
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// Parses the document, or the given source of it, and runs the configured
+// checks on it.
+func inspectDocument(cmd *cobra.Command, opts *executionOptions, config common.InspectConfig, source []byte) (*common.Scenario, []common.ValidationIssue, error) {
+	stopCapture := logging.StartWarningCapture()
+	var scenario *common.Scenario
+	var err error
+	if source == nil {
+		scenario, err = createScenarioFromOptions(opts, inspectRunnerTypes)
+	} else {
+		scenario, err = common.CreateScenarioFromMarkdownSource(source, opts.MarkdownPath, inspectRunnerTypes, opts.EnvironmentVariables)
+	}
+	capturedWarnings := stopCapture()
+	if err != nil {
+		writer := cmd.ErrOrStderr()
+		for _, warning := range capturedWarnings {
+			fmt.Fprintln(writer, ui.WarningStyle.Render(warning))
+		}
+		return nil, nil, commandError(cmd, err, false, "error creating scenario")
+	}
+
+	issues := common.ValidateScenarioForInspect(scenario, config)
+	if opts.Policy != nil {
+		issues = append(issues, common.ValidateCommandPolicy(scenario, opts.Policy)...)
+	}
+	document := parsers.SourcePosition{File: scenario.SourcePath}
+	for _, warning := range capturedWarnings {
+		issues = append(issues, common.ValidationIssue{
+			RuleID:   common.RuleParserWarning,
+			Severity: common.ValidationSeverityWarning,
+			Message:  warning,
+			Position: document,
+		})
+	}
+	for _, msg := range common.DrainMissingPrerequisites() {
+		issues = append(issues, common.ValidationIssue{
+			RuleID:     common.RuleMissingPrerequisiteDocument,
+			Severity:   common.ValidationSeverityError,
+			Message:    msg,
+			Position:   document,
+			Suggestion: "Fix the link to the prerequisite document or remove it.",
+		})
+	}
+	for _, msg := range common.DrainIncludeErrors() {
+		issues = append(issues, common.ValidationIssue{
+			RuleID:     common.RuleUnresolvedInclude,
+			Severity:   common.ValidationSeverityError,
+			Message:    msg,
+			Position:   document,
+			Suggestion: "Fix the path of the include or remove the include directive.",
+		})
+	}
+	return scenario, config.Apply(scenario, issues), nil
+}
+
+// Writes the fixed source over the document or, for a dry run, prints the
+// changes it makes as a diff.
+func writeInspectFixes(cmd *cobra.Command, scenario *common.Scenario, source []byte, fixed []common.ValidationIssue, dryRun bool) error {
+	writer := cmd.ErrOrStderr()
+	if len(fixed) == 0 {
+		fmt.Fprintln(writer, "No issues can be fixed automatically.")
+		return nil
+	}
+
+	if dryRun {
+		path := filepath.ToSlash(scenario.SourcePath)
+		diff := lib.UnifiedDiff("a/"+path, "b/"+path, string(scenario.Source), string(source), 3)
+		fmt.Fprintln(cmd.OutOrStdout(), common.RenderDiff(diff))
+		fmt.Fprintf(writer, "%d issue%s can be fixed; run without --dry-run to apply the changes.\n", len(fixed), pluralSuffix(len(fixed)))
+		return nil
+	}
+
+	info, err := os.Stat(scenario.SourcePath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(scenario.SourcePath, source, info.Mode().Perm()); err != nil {
+		return err
+	}
+	fmt.Fprintf(writer, "Fixed %d issue%s in %s.\n", len(fixed), pluralSuffix(len(fixed)), scenario.SourcePath)
+	return nil
+}
+
+// Writes the issues to stdout as JSON or SARIF, failing the command if any of
+// them is an error.
+func writeInspectIssues(cmd *cobra.Command, format common.InspectFormat, issues []common.ValidationIssue) error {
+	var err error
+	switch format {
+	case common.InspectFormatSARIF:
+		err = common.WriteValidationIssuesSARIF(cmd.OutOrStdout(), issues, VERSION)
+	default:
+		err = common.WriteValidationIssuesJSON(cmd.OutOrStdout(), issues)
+	}
+	if err != nil {
+		return commandError(cmd, err, false, "error writing the inspection results")
+	}
+
+	_, errors := partitionValidationIssues(issues)
+	if len(errors) > 0 {
+		return commandError(cmd, nil, false, "document failed inspection checks (%d validation error%s)", len(errors), pluralSuffix(len(errors)))
+	}
+	return nil
+}
+
 var inspectCommand = &cobra.Command{
 	Use:   "inspect [markdown file]",
 	Args:  cobra.MinimumNArgs(1),
 	Short: "Lint an executable document without running code blocks.",
-	Long:  `inspect performs structural linting against a document before you run it. The command validates language tags, prerequisite expected_results blocks (with exceptions for export-only code), environment variable prefixes, and usage (unused exports become warnings, undefined uppercase variables become errors). It never executes the fenced code blocks—use inspect as a safe preflight step before interactive, execute, or test modes.`,
+	Long:  `inspect performs structural linting against a document before you run it. The command validates language tags, prerequisite expected_results blocks (with exceptions for export-only code), environment variable prefixes, and usage (unused exports become warnings, undefined uppercase variables become errors). It never executes the fenced code blocks—use inspect as a safe preflight step before interactive, execute, or test modes. Every issue names the rule that found it; use --format json or --format sarif to get the issues with their rule IDs, positions, snippets and suggested fixes in a machine-readable form.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		opts, err := bindExecutionOptions(cmd, args)
 		if err != nil {
 			return handleExecutionOptionError(cmd, err)
 		}
+		rawFormat, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return commandError(cmd, err, false, "error getting format flag")
+		}
+		format, err := common.ParseInspectFormat(rawFormat)
+		if err != nil {
+			return commandError(cmd, err, true, "invalid --format")
+		}
+		config := opts.RepositoryConfig
 
-		stopCapture := logging.StartWarningCapture()
-		scenario, err := createScenarioFromOptions(opts, inspectRunnerTypes)
-		capturedWarnings := stopCapture()
+		fix, err := cmd.Flags().GetBool("fix")
 		if err != nil {
-			writer := cmd.ErrOrStderr()
-			for _, warning := range capturedWarnings {
-				fmt.Fprintln(writer, ui.WarningStyle.Render(warning))
-			}
-			return commandError(cmd, err, false, "error creating scenario")
+			return commandError(cmd, err, false, "error getting fix flag")
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return commandError(cmd, err, false, "error getting dry-run flag")
+		}
+		if dryRun && !fix {
+			return commandError(cmd, nil, true, "--dry-run can only be used with --fix")
+		}
+		if fix && dryRun && format != common.InspectFormatText {
+			return commandError(cmd, nil, true, "--fix --dry-run writes a diff and cannot be used with --format %s", format)
+		}
+		if fix && isURL(opts.MarkdownPath) {
+			return commandError(cmd, nil, false, "documents fetched from URLs cannot be fixed")
 		}
 
-		issues := common.ValidateScenarioForInspect(scenario)
-		for _, warning := range capturedWarnings {
-			issues = append(issues, common.ValidationIssue{Severity: common.ValidationSeverityWarning, Message: warning})
+		scenario, issues, err := inspectDocument(cmd, opts, config.Inspect, nil)
+		if err != nil {
+			return err
+		}
+		if fix {
+			source, fixed := common.FixValidationIssues(scenario, issues)
+			if err := writeInspectFixes(cmd, scenario, source, fixed, dryRun); err != nil {
+				return commandError(cmd, err, false, "error fixing %s", scenario.SourcePath)
+			}
+			if len(fixed) > 0 {
+				// Report the issues left in the fixed document.
+				if scenario, issues, err = inspectDocument(cmd, opts, config.Inspect, source); err != nil {
+					return err
+				}
+			}
 		}
-		for _, msg := range common.DrainMissingPrerequisites() {
-			issues = append(issues, common.ValidationIssue{Severity: common.ValidationSeverityError, Message: msg})
+		if format != common.InspectFormatText {
+			return writeInspectIssues(cmd, format, issues)
 		}
 		warnings, errors := partitionValidationIssues(issues)
 		writer := cmd.ErrOrStderr()
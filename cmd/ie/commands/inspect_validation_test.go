@@ -1,6 +1,9 @@
 package commands
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -129,6 +132,18 @@ func TestInspectAllowsLowercaseLocalVariables(t *testing.T) {
 	}
 }
 
+func TestInspectFailsWhenIncludeMissing(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\n<!-- include: Common/missing.md -->\n\nPrints a message.\n\n```bash\necho hello\n```\n"
+	path := writeScenarioWithContent(t, content)
+	_, stderr, err := runRootWithArgsCapturing(t, "inspect", path)
+	if err == nil {
+		t.Fatalf("expected inspect to fail when an included document is missing")
+	}
+	if !strings.Contains(stderr.String(), "[unresolved-include]") || strings.Contains(stderr.String(), "[missing-prerequisite-document]") {
+		t.Fatalf("expected the include to be reported as unresolved-include, got %q", stderr.String())
+	}
+}
+
 func TestInspectReportsSuccessMessageWhenNoFindings(t *testing.T) {
 	content := "# Scenario\n\n## Step\n\nSay hello.\n\n```bash\necho hello\n```\n"
 	stdout, stderr, err := runRootWithArgsCapturing(t, "inspect", writeScenarioWithContent(t, content))
@@ -142,3 +157,217 @@ func TestInspectReportsSuccessMessageWhenNoFindings(t *testing.T) {
 		t.Fatalf("expected success message, got stdout=%q stderr=%q", stdout.String(), stderr.String())
 	}
 }
+
+func TestInspectReportsIssuePositions(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\n```bash\necho missing description\n```\n"
+	path := writeScenarioWithContent(t, content)
+	_, stderr, err := runRootWithArgsCapturing(t, "inspect", path)
+	if err == nil {
+		t.Fatalf("expected inspect to fail when code block description is missing")
+	}
+	if !strings.Contains(stderr.String(), path+":5:1: ") {
+		t.Fatalf("expected issue to include the code block position, got %q", stderr.String())
+	}
+}
+
+func TestInspectWritesIssuesAsJSON(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\nUse undefined variable.\n\n```bash\necho $MISSING_VAR\n```\n"
+	path := writeScenarioWithContent(t, content)
+	stdout, _, err := runRootWithArgsCapturing(t, "inspect", "--format", "json", path)
+	if err == nil {
+		t.Fatalf("expected inspect to fail when environment variable is referenced without export")
+	}
+
+	var report struct {
+		Issues []struct {
+			RuleID   string `json:"ruleId"`
+			Severity string `json:"severity"`
+			Position struct {
+				File      string `json:"file"`
+				StartLine int    `json:"startLine"`
+			} `json:"position"`
+			Snippet    string `json:"snippet"`
+			Suggestion string `json:"suggestion"`
+		} `json:"issues"`
+		Errors int `json:"errors"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("expected JSON on stdout, got %q: %v", stdout.String(), err)
+	}
+	if report.Errors != 1 || len(report.Issues) != 1 {
+		t.Fatalf("expected a single error, got %+v", report)
+	}
+	issue := report.Issues[0]
+	if issue.RuleID != "undefined-variable" || issue.Severity != "error" {
+		t.Fatalf("expected an undefined-variable error, got %+v", issue)
+	}
+	if issue.Position.File != path || issue.Position.StartLine != 8 {
+		t.Fatalf("expected the issue at %s:8, got %+v", path, issue.Position)
+	}
+	if issue.Snippet != "echo $MISSING_VAR" || !strings.Contains(issue.Suggestion, "--var MISSING_VAR=") {
+		t.Fatalf("expected the snippet and a suggestion, got %+v", issue)
+	}
+}
+
+func TestInspectWritesIssuesAsSARIF(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\nExport without usage.\n\n```bash\nexport APP_NAME=demo\n```\n"
+	path := writeScenarioWithContent(t, content)
+	stdout, _, err := runRootWithArgsCapturing(t, "inspect", "--format", "sarif", path)
+	if err != nil {
+		t.Fatalf("expected inspect to succeed with warnings, got %v", err)
+	}
+
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Results []struct {
+				RuleID string `json:"ruleId"`
+				Level  string `json:"level"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &log); err != nil {
+		t.Fatalf("expected SARIF on stdout, got %q: %v", stdout.String(), err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 1 {
+		t.Fatalf("expected one run with one result, got %+v", log)
+	}
+	if result := log.Runs[0].Results[0]; result.RuleID != "unused-export" || result.Level != "warning" {
+		t.Fatalf("expected an unused-export warning, got %+v", result)
+	}
+}
+
+func TestInspectRejectsUnknownFormat(t *testing.T) {
+	_, stderr, err := runRootWithArgsCapturing(t, "inspect", "--format", "xml", writeTempScenario(t, "Scenario"))
+	if err == nil || !strings.Contains(stderr.String(), "invalid --format") {
+		t.Fatalf("expected an invalid format error, got %v and %q", err, stderr.String())
+	}
+}
+
+func TestInspectNamesRulesInTextOutput(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\n```bash\necho missing description\n```\n"
+	_, stderr, _ := runRootWithArgsCapturing(t, "inspect", writeScenarioWithContent(t, content))
+	if !strings.Contains(stderr.String(), "[missing-description]") {
+		t.Fatalf("expected the issue to name its rule, got %q", stderr.String())
+	}
+}
+
+func TestInspectUsesRepositoryConfig(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\nUse host variables.\n\n```bash\nexport APP_NAME=demo\necho $APP_NAME\naz group show --subscription $SUBSCRIPTION_ID\n```\n"
+	path := writeScenarioWithContent(t, content)
+	if _, _, err := runRootWithArgsCapturing(t, "inspect", path); err == nil {
+		t.Fatalf("expected inspect to fail without a configuration")
+	}
+
+	config := "inspect:\n  rules:\n    unused-export: \"off\"\n  externalVariables: [SUBSCRIPTION_ID]\n"
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), ".ie.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write the configuration: %v", err)
+	}
+	stdout, stderr, err := runRootWithArgsCapturing(t, "inspect", path)
+	if err != nil {
+		t.Fatalf("expected the configuration to allow the document, got %v: %q", err, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Inspection passed") {
+		t.Fatalf("expected the unused export to be turned off, got stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("inspect:\n  rules:\n    no-such-rule: error\n"), 0644); err != nil {
+		t.Fatalf("failed to write the configuration: %v", err)
+	}
+	_, stderr, err = runRootWithArgsCapturing(t, "inspect", "--config", invalid, path)
+	if err == nil || !strings.Contains(stderr.String(), `unknown rule "no-such-rule"`) {
+		t.Fatalf("expected the --config file to be rejected, got %v: %q", err, stderr.String())
+	}
+}
+
+func TestInspectFixesDocument(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\n```bash\nexport app_name=demo\necho $app_name\n```\n"
+	path := writeScenarioWithContent(t, content)
+
+	stdout, _, err := runRootWithArgsCapturing(t, "inspect", "--fix", "--dry-run", path)
+	if err != nil {
+		t.Fatalf("expected the dry run to leave no errors, got %v", err)
+	}
+	if !strings.Contains(stdout.String(), "-export app_name=demo") || !strings.Contains(stdout.String(), "+export APP_NAME=demo") {
+		t.Fatalf("expected a diff of the fixes, got %q", stdout.String())
+	}
+	if written, _ := os.ReadFile(path); string(written) != content {
+		t.Fatalf("expected the dry run to leave the document as it is, got %q", written)
+	}
+
+	_, stderr, err := runRootWithArgsCapturing(t, "inspect", "--fix", path)
+	if err != nil {
+		t.Fatalf("expected the fixed document to pass, got %v: %q", err, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "Fixed 2 issues") {
+		t.Fatalf("expected the number of fixed issues, got %q", stderr.String())
+	}
+	expected := "# Scenario\n\n## Step\n\nTODO: Describe what the following command does.\n\n```bash\nexport APP_NAME=demo\necho $APP_NAME\n```\n"
+	if written, _ := os.ReadFile(path); string(written) != expected {
+		t.Fatalf("expected the fixed document, got %q", written)
+	}
+}
+
+func TestInspectDryRunRequiresFix(t *testing.T) {
+	_, stderr, err := runRootWithArgsCapturing(t, "inspect", "--dry-run", writeTempScenario(t, "Scenario"))
+	if err == nil || !strings.Contains(stderr.String(), "--dry-run can only be used with --fix") {
+		t.Fatalf("expected --dry-run to require --fix, got %v: %q", err, stderr.String())
+	}
+}
+
+func TestInspectFailsOnShellSyntaxErrors(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\nCreates the file.\n\n```bash\necho start\ncat <<EOF > out.txt\nhello\n```\n"
+	path := writeScenarioWithContent(t, content)
+	_, stderr, err := runRootWithArgsCapturing(t, "inspect", path)
+	if err == nil {
+		t.Fatalf("expected inspect to fail when a code block is not valid bash")
+	}
+	if !strings.Contains(stderr.String(), path+":9:") || !strings.Contains(stderr.String(), "[shell-syntax]") {
+		t.Fatalf("expected a shell syntax error on line 9, got %q", stderr.String())
+	}
+}
+
+func TestInspectWarnsWhenDestructiveCommandUsesEmptyVariable(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\nRemoves the release.\n\n```bash\nrelease=$(helm list -q | head -n 1)\nhelm delete $release\n```\n"
+	path := writeScenarioWithContent(t, content)
+	_, stderr, _ := runRootWithArgsCapturing(t, "inspect", path)
+	if strings.Contains(stderr.String(), "[destructive-empty-variable]") {
+		t.Fatalf("expected helm delete not to be destructive without a configuration, got %q", stderr.String())
+	}
+
+	config := "destructive:\n  commands:\n    - command: helm delete\n"
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), ".ie.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write the configuration: %v", err)
+	}
+	_, stderr, _ = runRootWithArgsCapturing(t, "inspect", path)
+	if !strings.Contains(stderr.String(), path+":9:13: helm delete uses $release") {
+		t.Fatalf("expected a warning about $release, got %q", stderr.String())
+	}
+}
+
+func TestInspectReportsPolicyViolations(t *testing.T) {
+	content := "# Scenario\n\n## Step\n\nInstalls the tools.\n\n```bash\necho installing\ncurl -sSL https://example.com/install.sh -o install.sh\n```\n"
+	path := writeScenarioWithContent(t, content)
+	policy := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policy, []byte("network:\n  allowedHosts: [github.com]\n"), 0644); err != nil {
+		t.Fatalf("failed to write the policy: %v", err)
+	}
+
+	_, stderr, err := runRootWithArgsCapturing(t, "inspect", "--policy", policy, path)
+	if err == nil {
+		t.Fatalf("expected inspect to fail when a code block violates the policy")
+	}
+	if !strings.Contains(stderr.String(), path+":9:") || !strings.Contains(stderr.String(), "[policy-violation]") ||
+		!strings.Contains(stderr.String(), "example.com") {
+		t.Fatalf("expected a policy violation on line 9, got %q", stderr.String())
+	}
+
+	if err := os.WriteFile(policy, []byte("network:\n  allowedHost: [github.com]\n"), 0644); err != nil {
+		t.Fatalf("failed to write the policy: %v", err)
+	}
+	_, stderr, err = runRootWithArgsCapturing(t, "inspect", "--policy", policy, path)
+	if err == nil || !strings.Contains(stderr.String(), "invalid --policy") {
+		t.Fatalf("expected the invalid policy to be rejected, got %v: %q", err, stderr.String())
+	}
+}
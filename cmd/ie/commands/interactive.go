@@ -23,6 +23,14 @@ var interactiveCommand = &cobra.Command{
 	Short: "Execute a document in interactive mode.",
 	RunE: func(cmd *cobra.Command, args []string) error {
 
+		opts, err := bindExecutionOptions(cmd, args)
+		if err != nil {
+			return handleExecutionOptionError(cmd, err)
+		}
+		if err := prepareStateDirectory(opts); err != nil {
+			return handleExecutionOptionError(cmd, err)
+		}
+
 		// Ensure we are in the original invocation directory before parsing
 		// the first document.
 		if OriginalInvocationDirectory != "" {
@@ -36,10 +44,6 @@ var interactiveCommand = &cobra.Command{
 			}
 		}
 
-		opts, err := bindExecutionOptions(cmd, args)
-		if err != nil {
-			return handleExecutionOptionError(cmd, err)
-		}
 		// Parse the markdown file and create a scenario
 		scenario, err := createScenarioFromOptions(opts, executionRunnerTypes)
 		if err != nil {
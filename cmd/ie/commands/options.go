@@ -3,9 +3,14 @@ package commands
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
+	"time"
 
+	"github.com/Azure/InnovationEngine/internal/engine/common"
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
 	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/spf13/cobra"
 )
 
@@ -23,6 +28,18 @@ type executionOptions struct {
 	RenderValues         bool
 	EnvironmentVariables map[string]string
 	ReportFile           string
+	ReportFormat         common.ReportFormat
+	SkipTags             []string
+	ShellBackend         shells.Backend
+	Timeout              time.Duration
+	Resume               bool
+	StateDirectory       string
+	Events               string
+	UpdateExpected       bool
+	// The configuration of the repository the document is in, if any.
+	RepositoryConfig common.RepositoryConfig
+	// The commands code blocks may run, nil if there is no policy.
+	Policy *common.CommandPolicy
 }
 
 type optionBindingError struct {
@@ -82,6 +99,39 @@ func bindExecutionOptions(cmd *cobra.Command, args []string) (*executionOptions,
 		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
 	}
 
+	rawReportFormat, err := getOptionalStringFlag(cmd, "report-format")
+	if err != nil {
+		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
+	}
+
+	reportFormat, err := common.ParseReportFormat(rawReportFormat)
+	if err != nil {
+		return nil, newOptionBindingError(true, "invalid --report-format", err)
+	}
+
+	resume, err := getOptionalBoolFlag(cmd, "resume")
+	if err != nil {
+		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
+	}
+
+	stateDirectory, err := getOptionalStringFlag(cmd, "state-dir")
+	if err != nil {
+		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
+	}
+
+	eventDestination, err := getOptionalStringFlag(cmd, "events")
+	if err != nil {
+		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
+	}
+
+	updateExpected, err := getOptionalBoolFlag(cmd, "update-expected")
+	if err != nil {
+		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
+	}
+	if updateExpected && reportFile != "" {
+		return nil, newOptionBindingError(true, "--update-expected cannot be combined with --report", nil)
+	}
+
 	environmentSetting, err := getEnvironmentSetting(cmd)
 	if err != nil {
 		return nil, newOptionBindingError(false, "error resolving environment", err)
@@ -97,6 +147,29 @@ func bindExecutionOptions(cmd *cobra.Command, args []string) (*executionOptions,
 		return nil, newOptionBindingError(true, "invalid --var assignment", err)
 	}
 
+	skipTags, err := cmd.Flags().GetStringArray("skip-tag")
+	if err != nil {
+		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
+	}
+
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
+	}
+	if timeout < 0 {
+		return nil, newOptionBindingError(true, "invalid --timeout", fmt.Errorf("timeout must not be negative"))
+	}
+
+	rawShellBackend, err := getOptionalStringFlag(cmd, "shell-backend")
+	if err != nil {
+		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
+	}
+
+	shellBackend, err := shells.ParseBackend(rawShellBackend)
+	if err != nil {
+		return nil, newOptionBindingError(true, "invalid --shell-backend", err)
+	}
+
 	features, err := cmd.Flags().GetStringArray("feature")
 	if err != nil {
 		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
@@ -107,6 +180,23 @@ func bindExecutionOptions(cmd *cobra.Command, args []string) (*executionOptions,
 		return nil, err
 	}
 
+	repositoryConfig, err := loadRepositoryConfig(cmd, args[0])
+	if err != nil {
+		return nil, newOptionBindingError(true, "error loading the repository configuration", err)
+	}
+
+	policyPath, err := getOptionalStringFlag(cmd, "policy")
+	if err != nil {
+		return nil, newOptionBindingError(false, optionBindingFailureMessage, err)
+	}
+	var policy *common.CommandPolicy
+	if policyPath != "" {
+		policy, err = common.LoadCommandPolicy(policyPath)
+		if err != nil {
+			return nil, newOptionBindingError(true, "invalid --policy", err)
+		}
+	}
+
 	return &executionOptions{
 		MarkdownPath:         args[0],
 		Verbose:              verbose,
@@ -119,9 +209,47 @@ func bindExecutionOptions(cmd *cobra.Command, args []string) (*executionOptions,
 		RenderValues:         renderValues,
 		EnvironmentVariables: parsedVariables,
 		ReportFile:           reportFile,
+		ReportFormat:         reportFormat,
+		SkipTags:             skipTags,
+		ShellBackend:         shellBackend,
+		Timeout:              timeout,
+		Resume:               resume,
+		StateDirectory:       stateDirectory,
+		Events:               eventDestination,
+		UpdateExpected:       updateExpected,
+		RepositoryConfig:     repositoryConfig,
+		Policy:               policy,
 	}, nil
 }
 
+// Loads the configuration given with --config or, failing that, the one found
+// next to the document. Documents fetched from URLs use the configuration of
+// the working directory.
+func loadRepositoryConfig(cmd *cobra.Command, markdownPath string) (common.RepositoryConfig, error) {
+	path, err := getOptionalStringFlag(cmd, "config")
+	if err != nil {
+		return common.RepositoryConfig{}, err
+	}
+	if path == "" {
+		directory := filepath.Dir(markdownPath)
+		if isURL(markdownPath) {
+			directory = "."
+		}
+		found, ok := common.FindRepositoryConfig(directory)
+		if !ok {
+			return common.RepositoryConfig{}, nil
+		}
+		path = found
+	}
+
+	config, err := common.LoadRepositoryConfig(path)
+	if err != nil {
+		return common.RepositoryConfig{}, err
+	}
+	logging.GlobalLogger.Infof("Using the configuration in %s", path)
+	return config, nil
+}
+
 func handleExecutionOptionError(cmd *cobra.Command, err error) error {
 	if err == nil {
 		return nil
@@ -141,6 +269,14 @@ func getOptionalStringFlag(cmd *cobra.Command, name string) (string, error) {
 	return cmd.Flags().GetString(name)
 }
 
+func getOptionalBoolFlag(cmd *cobra.Command, name string) (bool, error) {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		return false, nil
+	}
+	return cmd.Flags().GetBool(name)
+}
+
 func shouldRenderValues(features []string) (bool, error) {
 	renderValues := false
 	for _, feature := range features {
@@ -16,9 +16,12 @@ func newExecutionTestCommand(t *testing.T) *cobra.Command {
 	cmd := &cobra.Command{Use: "test"}
 	addCommonExecutionFlags(cmd)
 	addCorrelationFlag(cmd)
+	addResumeFlag(cmd)
 	cmd.PersistentFlags().String("environment", string(environments.EnvironmentsLocal), "")
 	cmd.PersistentFlags().StringArray("feature", []string{}, "")
 	cmd.PersistentFlags().String("report", "", "")
+	cmd.PersistentFlags().String("report-format", "json", "")
+	cmd.PersistentFlags().Bool("update-expected", false, "")
 	cmd.Flags().AddFlagSet(cmd.PersistentFlags())
 	return cmd
 }
@@ -77,6 +80,79 @@ func TestBindExecutionOptions(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "resume",
+			args: []string{"scenario.md"},
+			configure: func(t *testing.T, cmd *cobra.Command) {
+				mustSetFlag(t, cmd, "resume", "true")
+			},
+			assert: func(t *testing.T, opts *executionOptions) {
+				if !opts.Resume {
+					t.Fatalf("expected resume to be set")
+				}
+				if !buildEngineConfiguration(opts).Resume {
+					t.Fatalf("expected resume to be passed to the engine")
+				}
+			},
+		},
+		{
+			name: "events",
+			args: []string{"scenario.md"},
+			configure: func(t *testing.T, cmd *cobra.Command) {
+				mustSetFlag(t, cmd, "events", "unix:/tmp/ie-events.sock")
+			},
+			assert: func(t *testing.T, opts *executionOptions) {
+				if buildEngineConfiguration(opts).Events != "unix:/tmp/ie-events.sock" {
+					t.Fatalf("expected the event destination to be passed to the engine, got %q", opts.Events)
+				}
+			},
+		},
+		{
+			name: "report format",
+			args: []string{"scenario.md"},
+			configure: func(t *testing.T, cmd *cobra.Command) {
+				mustSetFlag(t, cmd, "report", "report.xml")
+				mustSetFlag(t, cmd, "report-format", "junit")
+			},
+			assert: func(t *testing.T, opts *executionOptions) {
+				if buildEngineConfiguration(opts).ReportFormat != common.ReportFormatJUnit {
+					t.Fatalf("expected the junit report format to be passed to the engine, got %q", opts.ReportFormat)
+				}
+			},
+		},
+		{
+			name: "invalid report format",
+			args: []string{"scenario.md"},
+			configure: func(t *testing.T, cmd *cobra.Command) {
+				mustSetFlag(t, cmd, "report-format", "yaml")
+			},
+			expectErr:   true,
+			errUser:     true,
+			errContains: "invalid --report-format",
+		},
+		{
+			name: "update expected",
+			args: []string{"scenario.md"},
+			configure: func(t *testing.T, cmd *cobra.Command) {
+				mustSetFlag(t, cmd, "update-expected", "true")
+			},
+			assert: func(t *testing.T, opts *executionOptions) {
+				if !opts.UpdateExpected {
+					t.Fatalf("expected update expected to be set")
+				}
+			},
+		},
+		{
+			name: "update expected with report",
+			args: []string{"scenario.md"},
+			configure: func(t *testing.T, cmd *cobra.Command) {
+				mustSetFlag(t, cmd, "update-expected", "true")
+				mustSetFlag(t, cmd, "report", "report.json")
+			},
+			expectErr:   true,
+			errUser:     true,
+			errContains: "--update-expected cannot be combined with --report",
+		},
 		{
 			name: "invalid environment variable format",
 			args: []string{"scenario.md"},
@@ -165,12 +241,22 @@ func TestBuildEngineConfiguration(t *testing.T) {
 		RenderValues:         true,
 		EnvironmentVariables: map[string]string{"k": "v"},
 		ReportFile:           "report.json",
+		RepositoryConfig: common.RepositoryConfig{
+			Destructive: common.DestructiveConfig{Commands: []common.DestructiveCommand{{Command: "helm delete"}}},
+		},
+		Policy: &common.CommandPolicy{Path: "policy.yaml"},
 	}
 
 	cfg := buildEngineConfiguration(base)
 	if cfg.CorrelationId != base.CorrelationID || cfg.Subscription != base.Subscription {
 		t.Fatalf("config fields did not match execution options: %+v", cfg)
 	}
+	if len(cfg.DestructiveCommands) != 1 || cfg.DestructiveCommands[0].Command != "helm delete" {
+		t.Fatalf("expected the destructive commands of the repository configuration, got %+v", cfg.DestructiveCommands)
+	}
+	if cfg.Policy != base.Policy {
+		t.Fatalf("expected the command policy to be passed to the engine, got %+v", cfg.Policy)
+	}
 	if !cfg.RenderValues || cfg.DoNotDelete != base.DoNotDelete {
 		t.Fatalf("expected render values true and do not delete true, got %+v", cfg)
 	}
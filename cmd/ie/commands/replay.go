@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"github.com/Azure/InnovationEngine/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+// / Register the command with our command runner.
+func init() {
+	rootCommand.AddCommand(replayCommand)
+
+	addCommonExecutionFlags(replayCommand)
+	addResumeFlag(replayCommand)
+	addReportFlags(replayCommand)
+}
+
+var replayCommand = &cobra.Command{
+	Use:   "replay [report file]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Test the code blocks of a JSON test report again, with the variable values it captured.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := bindExecutionOptions(cmd, args)
+		if err != nil {
+			return handleExecutionOptionError(cmd, err)
+		}
+		if err := prepareStateDirectory(opts); err != nil {
+			return handleExecutionOptionError(cmd, err)
+		}
+
+		cfg := buildEngineConfiguration(
+			opts,
+			func(cfg *engine.EngineConfiguration) {
+				cfg.DoNotDelete = false
+				cfg.CorrelationId = ""
+			},
+		)
+
+		innovationEngine, err := engineNewEngine(cfg)
+		if err != nil {
+			return commandError(cmd, err, false, "error creating engine")
+		}
+
+		scenario, err := commonCreateScenarioFromReport(opts.MarkdownPath, opts.EnvironmentVariables)
+		if err != nil {
+			return commandError(cmd, err, false, "error creating scenario from report")
+		}
+
+		err = innovationEngine.TestScenario(scenario)
+		if err != nil {
+			return commandError(cmd, err, false, "scenario did not finish successfully")
+		}
+
+		return nil
+	},
+}
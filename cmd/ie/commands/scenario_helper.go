@@ -6,10 +6,11 @@ import (
 	"github.com/Azure/InnovationEngine/internal/engine/common"
 )
 
-var executionRunnerTypes = []string{"bash", "azurecli", "azurecli-interactive", "terraform"}
+var executionRunnerTypes = common.ExecutableLanguages
 var inspectRunnerTypes = []string{"bash", "azurecli", "azurecli-inspect", "terraform"}
 
 var commonCreateScenarioFromMarkdown = common.CreateScenarioFromMarkdown
+var commonCreateScenarioFromReport = common.CreateScenarioFromReport
 
 func createScenarioFromOptions(opts *executionOptions, runners []string) (*common.Scenario, error) {
 	if opts == nil {
@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// Selects the state directory of a run so that concurrent runs do not share
+// environment variables, working directories or checkpoints. The directory is
+// taken from --state-dir, then IE_STATE_DIR, then the run being resumed, and
+// otherwise a new directory is created for the run. Run directories that have
+// not been used for a while are removed along the way.
+func prepareStateDirectory(opts *executionOptions) error {
+	directory := opts.StateDirectory
+	if directory == "" {
+		directory = os.Getenv(lib.StateDirectoryEnvironmentVariable)
+	}
+	if directory == "" && opts.Resume {
+		resumable, err := common.FindResumableRun(opts.MarkdownPath)
+		if err != nil {
+			return newOptionBindingError(false, "error finding the run to resume", err)
+		}
+		if resumable == "" {
+			return newOptionBindingError(
+				false,
+				"cannot resume",
+				fmt.Errorf("no previous run of %s left a checkpoint behind", opts.MarkdownPath),
+			)
+		}
+		directory = resumable
+	}
+	if directory == "" {
+		directory = lib.RunStateDirectory(lib.NewRunID())
+	}
+
+	if err := lib.UseStateDirectory(directory); err != nil {
+		return newOptionBindingError(false, "error preparing the state directory", err)
+	}
+	logging.GlobalLogger.Infof("Using state directory %s", lib.StateDirectory())
+
+	removed, err := lib.RemoveStaleStateDirectories(lib.StateDirectoryMaxAge)
+	if err != nil {
+		logging.GlobalLogger.Warnf("Failed to remove stale state directories: %s", err)
+	}
+	for _, directory := range removed {
+		logging.GlobalLogger.Infof("Removed stale state directory %s", directory)
+	}
+	return nil
+}
+
+// addRunFlag adds the run flag used by commands that inspect the state of a
+// previous run.
+func addRunFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().
+		String("run", "", fmt.Sprintf("The ID of the run to target, i.e. the name of its directory under %s. Defaults to $%s, then the most recent run.", lib.StateRoot, lib.StateDirectoryEnvironmentVariable))
+}
+
+// Switches to the state directory of the run targeted by --run, IE_STATE_DIR
+// or, failing both, the most recently used run. The state files in /tmp are
+// used when there is no run to target.
+func useTargetedStateDirectory(cmd *cobra.Command) error {
+	runID, err := getOptionalStringFlag(cmd, "run")
+	if err != nil {
+		return err
+	}
+
+	directory := os.Getenv(lib.StateDirectoryEnvironmentVariable)
+	if runID != "" {
+		directory = lib.RunStateDirectory(runID)
+		if !fs.FileExists(directory) {
+			return fmt.Errorf("no run with the ID %q was found in %s", runID, lib.StateRoot)
+		}
+	}
+	if directory == "" {
+		directory, err = lib.LatestRunStateDirectory()
+		if err != nil {
+			return err
+		}
+	}
+	if directory == "" {
+		return nil
+	}
+
+	logging.GlobalLogger.Debugf("Targeting state directory %s", directory)
+	return lib.UseStateDirectory(directory)
+}
@@ -10,8 +10,11 @@ func init() {
 	rootCommand.AddCommand(testCommand)
 
 	addCommonExecutionFlags(testCommand)
+	addResumeFlag(testCommand)
+	addReportFlags(testCommand)
+
 	testCommand.PersistentFlags().
-		String("report", "", "The path to generate a report of the scenario execution. The contents of the report are in JSON and will only be generated when this flag is set.")
+		Bool("update-expected", false, "Replaces the expected outputs that the actual outputs no longer match in the markdown instead of failing, asking for each one when run from a terminal. Regex expectations are left as they are.")
 }
 
 var testCommand = &cobra.Command{
@@ -23,6 +26,9 @@ var testCommand = &cobra.Command{
 		if err != nil {
 			return handleExecutionOptionError(cmd, err)
 		}
+		if err := prepareStateDirectory(opts); err != nil {
+			return handleExecutionOptionError(cmd, err)
+		}
 
 		cfg := buildEngineConfiguration(
 			opts,
@@ -0,0 +1,178 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// Reads the values declared by the capture attribute of a code block from its
+// output. Every capture must find a value, otherwise an error describing the
+// first one that did not is returned.
+func CaptureOutputs(codeBlock parsers.CodeBlock, stdout string) (map[string]string, error) {
+	captures := codeBlock.Attributes.Captures
+	if len(captures) == 0 {
+		return nil, nil
+	}
+
+	output := normalizeOutput(stdout)
+	values := make(map[string]string, len(captures))
+	var document interface{}
+	var documentErr error
+	documentParsed := false
+	for _, capture := range captures {
+		var value string
+		var err error
+		switch capture.Source {
+		case parsers.CaptureJSON:
+			if !documentParsed {
+				decoder := json.NewDecoder(strings.NewReader(output))
+				// Keeps large numbers, such as IDs, as they were printed.
+				decoder.UseNumber()
+				documentErr = decoder.Decode(&document)
+				documentParsed = true
+			}
+			if documentErr != nil {
+				err = fmt.Errorf("the output is not valid JSON: %w", documentErr)
+				break
+			}
+			value, err = queryJSONPath(document, capture.Query)
+		case parsers.CaptureRegex:
+			value, err = captureRegexGroup(output, codeBlock.ExpectedOutput.ExpectedRegexPattern, capture.Query)
+		case parsers.CaptureLine:
+			value, err = captureLine(output, capture.Query)
+		default:
+			err = fmt.Errorf("unknown capture source %q", capture.Source)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to capture %s: %w", capture.Variable, err)
+		}
+		values[capture.Variable] = value
+	}
+	return values, nil
+}
+
+func captureRegexGroup(output string, pattern string, group string) (string, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return "", fmt.Errorf("the result block has no regex to read the group %q from", group)
+	}
+	_, compiled, _, err := compileRegexWithEnv(pattern)
+	if err != nil {
+		return "", err
+	}
+	index := compiled.SubexpIndex(group)
+	if index == -1 {
+		return "", fmt.Errorf("the regex %q has no group named %q", pattern, group)
+	}
+	match := compiled.FindStringSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("the regex %q does not match the output", pattern)
+	}
+	return match[index], nil
+}
+
+func captureLine(output string, query string) (string, error) {
+	line, err := strconv.Atoi(query)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a line number", query)
+	}
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	index := line - 1
+	if line < 0 {
+		index = len(lines) + line
+	}
+	if index < 0 || index >= len(lines) {
+		return "", fmt.Errorf("the output has %d lines, there is no line %d", len(lines), line)
+	}
+	return strings.TrimSpace(lines[index]), nil
+}
+
+// Reads the value at a JSON path made of keys (.name or ['name']) and array
+// indices ([0], negative indices count from the end). Strings are returned
+// as they are, other values as compact JSON.
+func queryJSONPath(document interface{}, path string) (string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return "", fmt.Errorf("the JSON path %q does not start with $", path)
+	}
+
+	value := document
+	rest := path[1:]
+	walked := "$"
+	for rest != "" {
+		var key string
+		index, isIndex := 0, false
+		switch {
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			key, rest = rest[1:end+1], rest[end+1:]
+			if key == "" {
+				return "", fmt.Errorf("the JSON path %q has an empty key after %s", path, walked)
+			}
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, `["`):
+			quote := rest[1:2]
+			end := strings.Index(rest[2:], quote+"]")
+			if end == -1 {
+				return "", fmt.Errorf("the JSON path %q has an unterminated key after %s", path, walked)
+			}
+			key, rest = rest[2:end+2], rest[end+4:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return "", fmt.Errorf("the JSON path %q has an unterminated index after %s", path, walked)
+			}
+			parsed, err := strconv.Atoi(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return "", fmt.Errorf("the JSON path %q has an invalid index %q after %s", path, rest[1:end], walked)
+			}
+			index, isIndex, rest = parsed, true, rest[end+1:]
+		default:
+			return "", fmt.Errorf("the JSON path %q is invalid after %s", path, walked)
+		}
+
+		if isIndex {
+			items, ok := value.([]interface{})
+			if !ok {
+				return "", fmt.Errorf("%s is not an array", walked)
+			}
+			position := index
+			if index < 0 {
+				position = len(items) + index
+			}
+			if position < 0 || position >= len(items) {
+				return "", fmt.Errorf("%s has %d items, there is no item %d", walked, len(items), index)
+			}
+			value = items[position]
+			walked += fmt.Sprintf("[%d]", index)
+			continue
+		}
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("%s is not an object", walked)
+		}
+		value, ok = object[key]
+		if !ok {
+			return "", fmt.Errorf("%s has no key %q", walked, key)
+		}
+		walked += "." + key
+	}
+
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case nil:
+		return "", nil
+	default:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}
+}
@@ -0,0 +1,144 @@
+package common
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func capturing(captures ...parsers.OutputCapture) parsers.CodeBlock {
+	return parsers.CodeBlock{Attributes: parsers.CodeBlockAttributes{Captures: captures}}
+}
+
+func TestCaptureOutputs(t *testing.T) {
+	vm := `{
+  "name": "vm1",
+  "id": 12345678901234567890,
+  "network": {"publicIps": ["20.1.2.3", "20.1.2.4"], "dns name": null},
+  "tags": {"env": "test"}
+}`
+
+	t.Run("JSON paths", func(t *testing.T) {
+		values, err := CaptureOutputs(capturing(
+			parsers.OutputCapture{Variable: "NAME", Source: parsers.CaptureJSON, Query: "$.name"},
+			parsers.OutputCapture{Variable: "ID", Source: parsers.CaptureJSON, Query: "$.id"},
+			parsers.OutputCapture{Variable: "FIRST_IP", Source: parsers.CaptureJSON, Query: "$.network.publicIps[0]"},
+			parsers.OutputCapture{Variable: "LAST_IP", Source: parsers.CaptureJSON, Query: "$['network'][\"publicIps\"][-1]"},
+			parsers.OutputCapture{Variable: "DNS", Source: parsers.CaptureJSON, Query: "$.network['dns name']"},
+			parsers.OutputCapture{Variable: "TAGS", Source: parsers.CaptureJSON, Query: "$.tags"},
+		), vm)
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"NAME":     "vm1",
+			"ID":       "12345678901234567890",
+			"FIRST_IP": "20.1.2.3",
+			"LAST_IP":  "20.1.2.4",
+			"DNS":      "",
+			"TAGS":     `{"env":"test"}`,
+		}, values)
+	})
+
+	t.Run("Regex groups", func(t *testing.T) {
+		codeBlock := capturing(parsers.OutputCapture{Variable: "ID", Source: parsers.CaptureRegex, Query: "id"})
+		codeBlock.ExpectedOutput.ExpectedRegexPattern = `Created (?P<id>[0-9]+)`
+
+		values, err := CaptureOutputs(codeBlock, "Created 42\n")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"ID": "42"}, values)
+	})
+
+	t.Run("Lines", func(t *testing.T) {
+		values, err := CaptureOutputs(capturing(
+			parsers.OutputCapture{Variable: "FIRST", Source: parsers.CaptureLine, Query: "1"},
+			parsers.OutputCapture{Variable: "LAST", Source: parsers.CaptureLine, Query: "-1"},
+		), "  first \r\nsecond\nlast\n")
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"FIRST": "first", "LAST": "last"}, values)
+	})
+
+	t.Run("Values that cannot be found", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			codeBlock parsers.CodeBlock
+			output    string
+			message   string
+		}{
+			"invalid JSON": {
+				capturing(parsers.OutputCapture{Variable: "X", Source: parsers.CaptureJSON, Query: "$.name"}),
+				"vm1",
+				"failed to capture X: the output is not valid JSON",
+			},
+			"missing keys": {
+				capturing(parsers.OutputCapture{Variable: "X", Source: parsers.CaptureJSON, Query: "$.network.privateIps"}),
+				vm,
+				`$.network has no key "privateIps"`,
+			},
+			"indices out of range": {
+				capturing(parsers.OutputCapture{Variable: "X", Source: parsers.CaptureJSON, Query: "$.network.publicIps[2]"}),
+				vm,
+				"$.network.publicIps has 2 items, there is no item 2",
+			},
+			"indexing objects": {
+				capturing(parsers.OutputCapture{Variable: "X", Source: parsers.CaptureJSON, Query: "$.tags[0]"}),
+				vm,
+				"$.tags is not an array",
+			},
+			"result blocks without a regex": {
+				capturing(parsers.OutputCapture{Variable: "X", Source: parsers.CaptureRegex, Query: "id"}),
+				"Created 42",
+				`the result block has no regex to read the group "id" from`,
+			},
+			"missing lines": {
+				capturing(parsers.OutputCapture{Variable: "X", Source: parsers.CaptureLine, Query: "3"}),
+				"one\ntwo\n",
+				"the output has 2 lines, there is no line 3",
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := CaptureOutputs(test.codeBlock, test.output)
+				assert.ErrorContains(t, err, test.message)
+			})
+		}
+	})
+}
+
+func TestExecuteCodeBlockExportsCapturedValues(t *testing.T) {
+	original := lib.DefaultEnvironmentStateFile
+	lib.DefaultEnvironmentStateFile = filepath.Join(t.TempDir(), "env-vars")
+	t.Cleanup(func() {
+		lib.DefaultEnvironmentStateFile = original
+	})
+
+	capture := ExecuteCodeBlock(context.Background(), parsers.CodeBlock{
+		Language:   "bash",
+		Content:    `echo '{"ip": "20.1.2.3"}'`,
+		Attributes: parsers.CodeBlockAttributes{Captures: []parsers.OutputCapture{{Variable: "IE_CAPTURED_IP", Source: parsers.CaptureJSON, Query: "$.ip"}}},
+	}, map[string]string{})
+	assert.IsType(t, SuccessfulCommandMessage{}, capture)
+
+	env, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "20.1.2.3", env["IE_CAPTURED_IP"])
+
+	use := ExecuteCodeBlock(context.Background(), parsers.CodeBlock{
+		Language: "bash",
+		Content:  `echo "ip=$IE_CAPTURED_IP"`,
+	}, map[string]string{})
+	if assert.IsType(t, SuccessfulCommandMessage{}, use) {
+		assert.Equal(t, "ip=20.1.2.3\n", use.(SuccessfulCommandMessage).StdOut)
+	}
+
+	failed := ExecuteCodeBlock(context.Background(), parsers.CodeBlock{
+		Language:   "bash",
+		Content:    `echo not json`,
+		Attributes: parsers.CodeBlockAttributes{Captures: []parsers.OutputCapture{{Variable: "IE_CAPTURED_IP", Source: parsers.CaptureJSON, Query: "$.ip"}}},
+	}, map[string]string{})
+	if assert.IsType(t, FailedCommandMessage{}, failed) {
+		assert.ErrorContains(t, failed.(FailedCommandMessage).Error, "failed to capture IE_CAPTURED_IP")
+	}
+}
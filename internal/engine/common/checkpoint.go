@@ -0,0 +1,273 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// Returned when there is no checkpoint to resume a scenario from.
+var ErrNoCheckpoint = errors.New("no checkpoint to resume from")
+
+// The progress of a scenario run. A checkpoint is written before every code
+// block runs, so after a failure it points at the code block that failed.
+type Checkpoint struct {
+	DocumentPath string `json:"documentPath"`
+	// SHA-256 of the markdown source, used to detect changes to the document.
+	DocumentHash string `json:"documentHash"`
+	// The filters that removed code blocks before the steps and code blocks
+	// were numbered, so the numbers only hold for runs using the same filters.
+	Filters CodeBlockFilters `json:"filters"`
+	// The step and code block that run next, numbered the same way as the
+	// steps in test reports.
+	StepNumber      int `json:"stepNumber"`
+	CodeBlockNumber int `json:"codeBlockNumber"`
+	// The environment variables and working directory left behind by the
+	// code blocks that already ran.
+	EnvironmentVariables map[string]string `json:"environmentVariables"`
+	WorkingDirectory     string            `json:"workingDirectory"`
+	UpdatedAt            time.Time         `json:"updatedAt"`
+}
+
+// Checks if the given code block ran successfully before the checkpoint was
+// taken.
+func (checkpoint Checkpoint) Completed(stepNumber, codeBlockNumber int) bool {
+	if stepNumber != checkpoint.StepNumber {
+		return stepNumber < checkpoint.StepNumber
+	}
+	return codeBlockNumber < checkpoint.CodeBlockNumber
+}
+
+// Loads a checkpoint from a file.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	if !fs.FileExists(path) {
+		return nil, ErrNoCheckpoint
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint '%s': %w", path, err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(content, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint '%s': %w", path, err)
+	}
+	return &checkpoint, nil
+}
+
+// The options that filter the code blocks of a scenario before it runs.
+type CodeBlockFilters struct {
+	// Whether destructive code blocks were skipped, see --do-not-delete.
+	DoNotDelete bool `json:"doNotDelete,omitempty"`
+	// The commands that made code blocks destructive. Only set when
+	// DoNotDelete is.
+	DestructiveCommands []DestructiveCommand `json:"destructiveCommands,omitempty"`
+	// The tags of the code blocks that were skipped, see --skip-tag.
+	SkipTags []string `json:"skipTags,omitempty"`
+}
+
+// Creates the filters recorded in checkpoints for the given options.
+func NewCodeBlockFilters(doNotDelete bool, destructiveCommands []DestructiveCommand, skipTags []string) CodeBlockFilters {
+	filters := CodeBlockFilters{DoNotDelete: doNotDelete}
+	if doNotDelete {
+		filters.DestructiveCommands = destructiveCommands
+	}
+	for _, tag := range skipTags {
+		if tag != "" && !containsString(filters.SkipTags, tag) {
+			filters.SkipTags = append(filters.SkipTags, tag)
+		}
+	}
+	sort.Strings(filters.SkipTags)
+	return filters
+}
+
+func (filters CodeBlockFilters) String() string {
+	description := fmt.Sprintf("--do-not-delete=%t", filters.DoNotDelete)
+	if len(filters.SkipTags) > 0 {
+		description += " --skip-tag " + strings.Join(filters.SkipTags, " --skip-tag ")
+	}
+	return description
+}
+
+// Compares filters by their JSON encoding, as that is how checkpoints store
+// them.
+func (filters CodeBlockFilters) equal(other CodeBlockFilters) bool {
+	encoded, err := json.Marshal(filters)
+	if err != nil {
+		return false
+	}
+	otherEncoded, err := json.Marshal(other)
+	return err == nil && bytes.Equal(encoded, otherEncoded)
+}
+
+// Computes the hash stored in checkpoints for a markdown document.
+func HashDocument(source []byte) string {
+	sum := sha256.Sum256(source)
+	return hex.EncodeToString(sum[:])
+}
+
+// Records the progress of a scenario run and restores it when the run is
+// resumed. A nil Checkpointer records nothing.
+type Checkpointer struct {
+	path         string
+	documentPath string
+	documentHash string
+	filters      CodeBlockFilters
+	resumeFrom   *Checkpoint
+}
+
+// Creates a checkpointer for the scenario that stores its checkpoints at path.
+// Relative document paths are resolved against the current directory.
+func NewCheckpointer(path string, scenario *Scenario, filters CodeBlockFilters) *Checkpointer {
+	return &Checkpointer{
+		path:         path,
+		documentPath: checkpointDocumentPath(scenario.SourcePath),
+		documentHash: HashDocument(scenario.Source),
+		filters:      filters,
+	}
+}
+
+// Finds the state directory of the most recent run of the given document
+// that left a checkpoint behind. Returns an empty string if there is none.
+func FindResumableRun(documentPath string) (string, error) {
+	directories, err := lib.ListRunStateDirectories()
+	if err != nil {
+		return "", err
+	}
+
+	documentPath = checkpointDocumentPath(documentPath)
+	for _, directory := range directories {
+		checkpoint, err := LoadCheckpoint(filepath.Join(directory, lib.CheckpointFileName))
+		if err != nil {
+			continue
+		}
+		if checkpoint.DocumentPath == documentPath {
+			return directory, nil
+		}
+	}
+	return "", nil
+}
+
+// Documents are identified by their absolute path, or their URL if remote.
+func checkpointDocumentPath(path string) string {
+	if path == "" || isRemotePath(path) {
+		return path
+	}
+	if absolute, err := filepath.Abs(path); err == nil {
+		return absolute
+	}
+	return path
+}
+
+// Loads the checkpoint left behind by a previous run of the scenario and
+// restores its environment variables and working directory. Resuming is
+// refused if the document or the code block filters changed since the
+// checkpoint was taken, as the checkpoint would point at another code block.
+func (c *Checkpointer) Resume() (*Checkpoint, error) {
+	checkpoint, err := LoadCheckpoint(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if checkpoint.DocumentHash != c.documentHash {
+		return nil, fmt.Errorf(
+			"cannot resume, %s changed since the checkpoint was taken at %s",
+			checkpoint.DocumentPath,
+			checkpoint.UpdatedAt.Format(time.RFC3339),
+		)
+	}
+	if !checkpoint.Filters.equal(c.filters) {
+		return nil, fmt.Errorf(
+			"cannot resume, the checkpoint was taken with %s but this run uses %s; resume with the same flags",
+			checkpoint.Filters,
+			c.filters,
+		)
+	}
+
+	if err := lib.SaveEnvironmentStateFile(lib.DefaultEnvironmentStateFile, checkpoint.EnvironmentVariables); err != nil {
+		return nil, fmt.Errorf("failed to restore environment variables: %w", err)
+	}
+	if checkpoint.WorkingDirectory != "" {
+		if err := lib.SaveWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile, checkpoint.WorkingDirectory); err != nil {
+			return nil, fmt.Errorf("failed to restore working directory: %w", err)
+		}
+	}
+
+	logging.GlobalLogger.Infof(
+		"Resuming %s from code block %d on step %d",
+		checkpoint.DocumentPath,
+		checkpoint.CodeBlockNumber,
+		checkpoint.StepNumber,
+	)
+	c.resumeFrom = checkpoint
+	return checkpoint, nil
+}
+
+// Checks if the given code block completed in the run being resumed, in which
+// case it should not run again.
+func (c *Checkpointer) Completed(stepNumber, codeBlockNumber int) bool {
+	if c == nil || c.resumeFrom == nil {
+		return false
+	}
+	return c.resumeFrom.Completed(stepNumber, codeBlockNumber)
+}
+
+// Records that the given code block is about to run, along with the state
+// left behind by the code blocks before it. Failures are logged rather than
+// returned, so that they never stop the scenario.
+func (c *Checkpointer) Record(stepNumber, codeBlockNumber int) {
+	if c == nil {
+		return
+	}
+
+	env, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	if err != nil {
+		env = map[string]string{}
+	}
+	workingDirectory, err := lib.LoadWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile)
+	if err != nil || workingDirectory == "" {
+		workingDirectory, _ = os.Getwd()
+	}
+
+	checkpoint := Checkpoint{
+		DocumentPath:         c.documentPath,
+		DocumentHash:         c.documentHash,
+		Filters:              c.filters,
+		StepNumber:           stepNumber,
+		CodeBlockNumber:      codeBlockNumber,
+		EnvironmentVariables: env,
+		WorkingDirectory:     workingDirectory,
+		UpdatedAt:            time.Now().UTC(),
+	}
+
+	content, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err == nil {
+		err = os.WriteFile(c.path, content, 0600)
+	}
+	if err != nil {
+		logging.GlobalLogger.Warnf("Failed to write checkpoint %s: %v", c.path, err)
+	}
+}
+
+// Removes the checkpoint once the scenario has completed.
+func (c *Checkpointer) Clear() {
+	if c == nil {
+		return
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.GlobalLogger.Warnf("Failed to remove checkpoint %s: %v", c.path, err)
+	}
+}
@@ -0,0 +1,119 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	originalEnv, originalDir := lib.DefaultEnvironmentStateFile, lib.DefaultWorkingDirectoryStateFile
+	lib.DefaultEnvironmentStateFile = filepath.Join(dir, "env-vars")
+	lib.DefaultWorkingDirectoryStateFile = filepath.Join(dir, "working-dir")
+	t.Cleanup(func() {
+		lib.DefaultEnvironmentStateFile = originalEnv
+		lib.DefaultWorkingDirectoryStateFile = originalDir
+	})
+
+	path := filepath.Join(dir, "checkpoint.json")
+	scenario := &Scenario{SourcePath: "scenario.md", Source: []byte("# Scenario\n")}
+
+	t.Run("Resuming without a checkpoint fails", func(t *testing.T) {
+		_, err := NewCheckpointer(path, scenario, CodeBlockFilters{}).Resume()
+		assert.True(t, errors.Is(err, ErrNoCheckpoint))
+	})
+
+	t.Run("Resuming restores the recorded state", func(t *testing.T) {
+		require.NoError(t, lib.SaveEnvironmentStateFile(lib.DefaultEnvironmentStateFile, map[string]string{"MY_RG": "rg-1"}))
+		require.NoError(t, lib.SaveWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile, "/tmp"))
+		NewCheckpointer(path, scenario, CodeBlockFilters{}).Record(2, 1)
+
+		require.NoError(t, lib.SaveEnvironmentStateFile(lib.DefaultEnvironmentStateFile, map[string]string{}))
+		require.NoError(t, lib.SaveWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile, dir))
+
+		checkpoints := NewCheckpointer(path, scenario, CodeBlockFilters{})
+		checkpoint, err := checkpoints.Resume()
+		require.NoError(t, err)
+		assert.Equal(t, 2, checkpoint.StepNumber)
+		assert.Equal(t, 1, checkpoint.CodeBlockNumber)
+
+		env, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		require.NoError(t, err)
+		assert.Equal(t, "rg-1", env["MY_RG"])
+		workingDirectory, err := lib.LoadWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile)
+		require.NoError(t, err)
+		assert.Equal(t, "/tmp", workingDirectory)
+
+		assert.True(t, checkpoints.Completed(1, 5))
+		assert.True(t, checkpoints.Completed(2, 0))
+		assert.False(t, checkpoints.Completed(2, 1))
+		assert.False(t, checkpoints.Completed(3, 0))
+	})
+
+	t.Run("Resuming a changed document is refused", func(t *testing.T) {
+		changed := &Scenario{SourcePath: "scenario.md", Source: []byte("# Changed scenario\n")}
+		_, err := NewCheckpointer(path, changed, CodeBlockFilters{}).Resume()
+		assert.ErrorContains(t, err, "changed since the checkpoint")
+	})
+
+	t.Run("Resuming with other filters is refused", func(t *testing.T) {
+		filters := NewCodeBlockFilters(true, DestructiveCommands(nil), []string{"slow", "gpu", "slow"})
+		NewCheckpointer(path, scenario, filters).Record(1, 0)
+
+		_, err := NewCheckpointer(path, scenario, NewCodeBlockFilters(true, DestructiveCommands(nil), []string{"gpu"})).Resume()
+		assert.ErrorContains(t, err, "--do-not-delete=true --skip-tag gpu --skip-tag slow but this run uses --do-not-delete=true --skip-tag gpu")
+		_, err = NewCheckpointer(path, scenario, NewCodeBlockFilters(false, DestructiveCommands(nil), []string{"slow", "gpu"})).Resume()
+		assert.ErrorContains(t, err, "resume with the same flags")
+		extra := DestructiveCommands([]DestructiveCommand{{Command: "helm delete"}})
+		_, err = NewCheckpointer(path, scenario, NewCodeBlockFilters(true, extra, []string{"slow", "gpu"})).Resume()
+		assert.ErrorContains(t, err, "resume with the same flags")
+
+		_, err = NewCheckpointer(path, scenario, NewCodeBlockFilters(true, DestructiveCommands(nil), []string{"gpu", "slow"})).Resume()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Clearing removes the checkpoint", func(t *testing.T) {
+		checkpoints := NewCheckpointer(path, scenario, CodeBlockFilters{})
+		checkpoints.Clear()
+		_, err := checkpoints.Resume()
+		assert.True(t, errors.Is(err, ErrNoCheckpoint))
+	})
+
+	t.Run("A nil checkpointer records nothing", func(t *testing.T) {
+		var checkpoints *Checkpointer
+		checkpoints.Record(0, 0)
+		checkpoints.Clear()
+		assert.False(t, checkpoints.Completed(0, 0))
+	})
+}
+
+func TestFindResumableRun(t *testing.T) {
+	originalRoot := lib.StateRoot
+	lib.StateRoot = t.TempDir()
+	t.Cleanup(func() { lib.StateRoot = originalRoot })
+
+	document := filepath.Join(t.TempDir(), "scenario.md")
+	scenario := &Scenario{SourcePath: document, Source: []byte("# Scenario\n")}
+	run := lib.RunStateDirectory("20240101T000000-aaaaaa")
+	other := lib.RunStateDirectory("20240101T000000-bbbbbb")
+	require.NoError(t, os.MkdirAll(run, 0o700))
+	require.NoError(t, os.MkdirAll(other, 0o700))
+
+	NewCheckpointer(filepath.Join(run, lib.CheckpointFileName), scenario, CodeBlockFilters{}).Record(1, 0)
+	otherScenario := &Scenario{SourcePath: "other.md", Source: []byte("# Other\n")}
+	NewCheckpointer(filepath.Join(other, lib.CheckpointFileName), otherScenario, CodeBlockFilters{}).Record(1, 0)
+
+	found, err := FindResumableRun(document)
+	require.NoError(t, err)
+	assert.Equal(t, run, found)
+
+	found, err = FindResumableRun(filepath.Join(t.TempDir(), "missing.md"))
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
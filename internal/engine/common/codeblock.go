@@ -1,6 +1,23 @@
 package common
 
-import "github.com/Azure/InnovationEngine/internal/parsers"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/events"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// A single run of a code block. Code blocks with a retry policy may be run
+// several times before they succeed or give up.
+type CodeBlockAttempt struct {
+	Number   int           `json:"number"`
+	Reason   string        `json:"reason,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
 
 // State for the codeblock in interactive mode. Used to keep track of the
 // state of each codeblock.
@@ -10,10 +27,66 @@ type StatefulCodeBlock struct {
 	Error           error             `json:"error"`
 	StdErr          string            `json:"stdErr"`
 	StdOut          string            `json:"stdOut"`
-	StepName        string            `json:"stepName"`
-	StepNumber      int               `json:"stepNumber"`
-	Success         bool              `json:"success"`
-	SimilarityScore float64           `json:"similarityScore"`
+	// The exit code of the last attempt, -1 if it did not run to completion.
+	ExitCode        int                `json:"exitCode"`
+	StepName        string             `json:"stepName"`
+	StepNumber      int                `json:"stepNumber"`
+	Success         bool               `json:"success"`
+	SimilarityScore float64            `json:"similarityScore"`
+	TimedOut        bool               `json:"timedOut"`
+	Attempts        []CodeBlockAttempt `json:"attempts,omitempty"`
+	// How the output of a failed codeblock differs from its result block, as
+	// returned by OutputDiff.
+	Diff string `json:"diff,omitempty"`
+	// How long the codeblock took to run, including retries.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// The JSON form of a StatefulCodeBlock, with the error as its message.
+type statefulCodeBlockJSON struct {
+	statefulCodeBlockFields
+	Error json.RawMessage `json:"error"`
+}
+
+// Has the fields of StatefulCodeBlock but not its JSON methods.
+type statefulCodeBlockFields StatefulCodeBlock
+
+// Writes the error of the codeblock as its message, so that reports can be
+// read back.
+func (s StatefulCodeBlock) MarshalJSON() ([]byte, error) {
+	encoded := statefulCodeBlockJSON{
+		statefulCodeBlockFields: statefulCodeBlockFields(s),
+		Error:                   json.RawMessage("null"),
+	}
+	if s.Error != nil {
+		message, err := json.Marshal(s.Error.Error())
+		if err != nil {
+			return nil, err
+		}
+		encoded.Error = message
+	}
+	return json.Marshal(encoded)
+}
+
+// Reads a codeblock written by MarshalJSON. Reports written before errors
+// were kept as messages have an empty object instead, which is read as an
+// error without a message.
+func (s *StatefulCodeBlock) UnmarshalJSON(data []byte) error {
+	var decoded statefulCodeBlockJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*s = StatefulCodeBlock(decoded.statefulCodeBlockFields)
+	s.Error = nil
+	if len(decoded.Error) == 0 || string(decoded.Error) == "null" {
+		return nil
+	}
+	var message string
+	if err := json.Unmarshal(decoded.Error, &message); err != nil {
+		message = "the code block failed"
+	}
+	s.Error = errors.New(message)
+	return nil
 }
 
 // Checks if a codeblock was executed by looking at the
@@ -21,3 +94,12 @@ type StatefulCodeBlock struct {
 func (s StatefulCodeBlock) WasExecuted() bool {
 	return s.StdOut != "" || s.StdErr != "" || s.Error != nil || s.Success
 }
+
+// Returns a copy of ctx that identifies the codeblock in the events it emits.
+func (s StatefulCodeBlock) EventContext(ctx context.Context) context.Context {
+	return events.WithCodeBlock(
+		ctx,
+		events.Step{Number: s.StepNumber, Name: s.StepName},
+		s.CodeBlockNumber,
+	)
+}
@@ -1,43 +1,195 @@
 package common
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"strings"
+	"time"
 
-	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/events"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/shells"
-	tea "github.com/charmbracelet/bubbletea"
 )
 
 // Emitted when a command has been executed successfully.
 type SuccessfulCommandMessage struct {
 	StdOut          string
 	StdErr          string
+	ExitCode        int
 	SimilarityScore float64
+	Attempts        []CodeBlockAttempt
+	// How long the code block took to run, including retries.
+	Duration time.Duration
 }
 
 // Emitted when a command has failed to execute.
 type FailedCommandMessage struct {
 	StdOut          string
 	StdErr          string
+	ExitCode        int
 	Error           error
 	SimilarityScore float64
+	Attempts        []CodeBlockAttempt
+	// How long the code block took to run, including retries.
+	Duration time.Duration
 }
 
-type ExitMessage struct {
-	EncounteredFailure bool
+// Executes a code block, honouring the timeout, retry policy and exit code and
+// stderr expectations declared in its attributes. An attempt is retried when
+// the command exits with an unexpected status or when its output does not
+// match the expected output of the code block, as allowed by the policy. The
+// output and error of the last attempt are returned together with a record of
+// every attempt, leaving the output comparison to the caller. Once the code
+// block succeeds, the values declared by its capture attribute are exported to
+// the code blocks that follow. The code block is reported to the event stream
+// as it runs.
+func ExecuteCodeBlockWithAttributes(
+	codeBlock parsers.CodeBlock,
+	config shells.BashCommandConfiguration,
+) (shells.CommandOutput, []CodeBlockAttempt, error) {
+	run := events.StartBlock(config.Context, codeBlock.Language, codeBlock.Content)
+	if events.Enabled() {
+		config.OutputObserver = run.Output
+	}
+
+	output, attempts, err := executeWithRetries(codeBlock, config, run, true)
+
+	// Output mismatches are only recorded on the attempts.
+	endErr := err
+	if endErr == nil && len(attempts) > 0 && attempts[len(attempts)-1].Error != "" {
+		endErr = errors.New(attempts[len(attempts)-1].Error)
+	}
+	if endErr == nil {
+		err = captureOutputs(codeBlock, output.StdOut)
+		endErr = err
+	}
+	run.End(endErr, len(attempts))
+	return output, attempts, err
+}
+
+// Executes an interactive code block, whose input and output are forwarded to
+// the terminal, honouring the timeout and exit code expectation declared in its
+// attributes. As its output is not captured, it is not compared and only the
+// exit code half of the retry policy applies. The code block is reported to
+// the event stream as it runs.
+func ExecuteInteractiveCodeBlock(
+	codeBlock parsers.CodeBlock,
+	config shells.BashCommandConfiguration,
+) (shells.CommandOutput, []CodeBlockAttempt, error) {
+	config.InteractiveCommand = true
+	run := events.StartBlock(config.Context, codeBlock.Language, codeBlock.Content)
+	output, attempts, err := executeWithRetries(codeBlock, config, run, false)
+	run.End(err, len(attempts))
+	return output, attempts, err
+}
+
+// Runs a code block until it succeeds or its retry policy gives up, comparing
+// the output of each attempt when compareOutput is set.
+func executeWithRetries(
+	codeBlock parsers.CodeBlock,
+	config shells.BashCommandConfiguration,
+	run *events.BlockRun,
+	compareOutput bool,
+) (shells.CommandOutput, []CodeBlockAttempt, error) {
+	config.Timeout = codeBlock.Attributes.Timeout
+	policy := codeBlock.Attributes.Retry
+	maxAttempts := policy.Attempts()
+
+	var output shells.CommandOutput
+	var attempts []CodeBlockAttempt
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		start := time.Now()
+		output, err = shells.ExecuteBashCommand(codeBlock.Content, config)
+		err = CheckExitCode(codeBlock, output, err)
+		record := CodeBlockAttempt{Number: attempt}
+
+		reason := parsers.RetryOnExitCode
+		if err == nil && compareOutput {
+			score, comparisonErr := CompareCodeBlockOutputs(codeBlock, output)
+			if hasExpectedOutput(codeBlock) || codeBlock.Attributes.ExpectedStdErr != "" {
+				run.Compared(attempt, score, comparisonErr)
+			}
+			err = comparisonErr
+			reason = parsers.RetryOnOutput
+		}
+		record.Duration = time.Since(start)
+		if err != nil {
+			record.Reason = reason
+			record.Error = err.Error()
+		}
+		attempts = append(attempts, record)
+
+		if err == nil {
+			return output, attempts, nil
+		}
+
+		// There is no point retrying once the scenario itself has been stopped.
+		stopped := config.Context != nil && config.Context.Err() != nil
+		if stopped || attempt == maxAttempts || !policy.RetriesOn(reason) {
+			// Output mismatches are reported by the caller when it compares
+			// the output itself.
+			if reason == parsers.RetryOnOutput {
+				return output, attempts, nil
+			}
+			return output, attempts, err
+		}
+
+		delay := policy.DelayAfter(attempt)
+		logging.GlobalLogger.Warnf(
+			"Attempt %d of %d failed, retrying in %s: %s",
+			attempt,
+			maxAttempts,
+			delay,
+			err,
+		)
+		if !waitForRetry(config.Context, delay) {
+			break
+		}
+	}
+
+	return output, attempts, err
 }
 
-func Exit(encounteredFailure bool) tea.Cmd {
-	return func() tea.Msg {
-		return ExitMessage{EncounteredFailure: encounteredFailure}
+// Stores the values captured from the output of a code block in the
+// environment of the code blocks that follow.
+func captureOutputs(codeBlock parsers.CodeBlock, stdout string) error {
+	values, err := CaptureOutputs(codeBlock, stdout)
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		logging.GlobalLogger.Infof("Captured %s=%s", name, value)
+	}
+	return shells.ExportEnvironmentVariables(values)
+}
+
+// Checks if a code block declares the output it is expected to produce.
+func hasExpectedOutput(codeBlock parsers.CodeBlock) bool {
+	return codeBlock.ExpectedOutput.Content != "" ||
+		strings.TrimSpace(codeBlock.ExpectedOutput.ExpectedRegexPattern) != ""
+}
+
+// Waits for the given delay, returning false if ctx is done first.
+func waitForRetry(ctx context.Context, delay time.Duration) bool {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
-// Executes a bash command and returns a tea message with the output. This function
-// will be executed asycnhronously.
-func ExecuteCodeBlockAsync(codeBlock parsers.CodeBlock, env map[string]string) tea.Cmd {
+// Executes a code block and compares its output with the expected output,
+// returning a SuccessfulCommandMessage or a FailedCommandMessage. The command
+// is stopped when ctx is done.
+func ExecuteCodeBlock(ctx context.Context, codeBlock parsers.CodeBlock, env map[string]string) interface{} {
 	blockType, autoMeta, hasAutoMeta := ParseAutoPrereqMetadata(codeBlock.Content)
 	isVerificationBlock := hasAutoMeta && blockType == "verification"
 	markerValue := ""
@@ -47,151 +199,93 @@ func ExecuteCodeBlockAsync(codeBlock parsers.CodeBlock, env map[string]string) t
 		display = autoMeta["display"]
 	}
 
-	return func() tea.Msg {
-		logging.GlobalLogger.Infof(
-			"Executing command asynchronously:\n %s", codeBlock.Content)
+	logging.GlobalLogger.Infof("Executing command:\n %s", codeBlock.Content)
+	start := time.Now()
 
-		if isVerificationBlock && markerValue != "" {
-			if err := RemovePrereqMarker(markerValue); err != nil {
-				logging.GlobalLogger.Warnf("Failed to clear verification marker %s: %v", markerValue, err)
-			}
+	if isVerificationBlock && markerValue != "" {
+		if err := RemovePrereqMarker(markerValue); err != nil {
+			logging.GlobalLogger.Warnf("Failed to clear verification marker %s: %v", markerValue, err)
 		}
+	}
 
-		output, err := shells.ExecuteBashCommand(codeBlock.Content, shells.BashCommandConfiguration{
-			EnvironmentVariables: env,
-			InheritEnvironment:   true,
-			InteractiveCommand:   false,
-			WriteToHistory:       true,
-		})
-		if err != nil {
-			if isVerificationBlock {
-				logging.GlobalLogger.Warnf("Verification command failed for %s: %v", display, err)
-				return SuccessfulCommandMessage{
-					StdOut:          output.StdOut,
-					StdErr:          output.StdErr,
-					SimilarityScore: 0,
-				}
-			}
-
-			logging.GlobalLogger.Errorf("Error executing command:\n %s", err.Error())
-			return FailedCommandMessage{
+	output, attempts, err := ExecuteCodeBlockWithAttributes(codeBlock, shells.BashCommandConfiguration{
+		EnvironmentVariables: env,
+		InheritEnvironment:   true,
+		InteractiveCommand:   false,
+		WriteToHistory:       true,
+		Context:              ctx,
+	})
+	if err != nil {
+		if isVerificationBlock {
+			logging.GlobalLogger.Warnf("Verification command failed for %s: %v", display, err)
+			return SuccessfulCommandMessage{
 				StdOut:          output.StdOut,
 				StdErr:          output.StdErr,
-				Error:           err,
+				ExitCode:        output.ExitCode,
 				SimilarityScore: 0,
+				Attempts:        attempts,
+				Duration:        time.Since(start),
 			}
 		}
 
-		// Check command output against the expected output.
-		actualOutput := output.StdOut
-		expectedOutput := codeBlock.ExpectedOutput.Content
-		expectedSimilarity := codeBlock.ExpectedOutput.ExpectedSimilarity
-		expectedRegexPattern := codeBlock.ExpectedOutput.ExpectedRegexPattern
-		expectedOutputLanguage := codeBlock.ExpectedOutput.Language
-
-		score, outputComparisonError := CompareCommandOutputs(
-			actualOutput,
-			expectedOutput,
-			expectedSimilarity,
-			expectedRegexPattern,
-			expectedOutputLanguage,
-		)
-
-		if outputComparisonError != nil {
-			if isVerificationBlock {
-				logging.GlobalLogger.Warnf("Verification output mismatch for %s: %v", display, outputComparisonError)
-				return SuccessfulCommandMessage{
-					StdOut:          output.StdOut,
-					StdErr:          output.StdErr,
-					SimilarityScore: score,
-				}
-			}
+		logging.GlobalLogger.Errorf("Error executing command:\n %s", err.Error())
+		return FailedCommandMessage{
+			StdOut:          output.StdOut,
+			StdErr:          output.StdErr,
+			ExitCode:        output.ExitCode,
+			Error:           err,
+			SimilarityScore: 0,
+			Attempts:        attempts,
+			Duration:        time.Since(start),
+		}
+	}
 
-			logging.GlobalLogger.Errorf(
-				"Error comparing command outputs: %s",
-				outputComparisonError.Error(),
-			)
+	// Check command output against the expected output.
+	score, outputComparisonError := CompareCodeBlockOutputs(codeBlock, output)
 
-			return FailedCommandMessage{
+	if outputComparisonError != nil {
+		if isVerificationBlock {
+			logging.GlobalLogger.Warnf("Verification output mismatch for %s: %v", display, outputComparisonError)
+			return SuccessfulCommandMessage{
 				StdOut:          output.StdOut,
 				StdErr:          output.StdErr,
-				Error:           outputComparisonError,
+				ExitCode:        output.ExitCode,
 				SimilarityScore: score,
+				Attempts:        attempts,
+				Duration:        time.Since(start),
 			}
-
 		}
 
-		if isVerificationBlock && markerValue != "" {
-			if err := WritePrereqMarker(markerValue, display); err != nil {
-				logging.GlobalLogger.Warnf("Failed to write verification marker %s: %v", markerValue, err)
-			}
-		}
+		logging.GlobalLogger.Errorf(
+			"Error comparing command outputs: %s",
+			outputComparisonError.Error(),
+		)
 
-		logging.GlobalLogger.Infof("Command output to stdout:\n %s", output.StdOut)
-		return SuccessfulCommandMessage{
+		return FailedCommandMessage{
 			StdOut:          output.StdOut,
 			StdErr:          output.StdErr,
+			ExitCode:        output.ExitCode,
+			Error:           outputComparisonError,
 			SimilarityScore: score,
+			Attempts:        attempts,
+			Duration:        time.Since(start),
 		}
-	}
-}
-
-// Executes a bash command syncrhonously. This function will block until the command
-// finishes executing.
-func ExecuteCodeBlockSync(codeBlock parsers.CodeBlock, env map[string]string) tea.Msg {
-	logging.GlobalLogger.Info("Executing command synchronously: ", codeBlock.Content)
-	Program.ReleaseTerminal()
 
-	output, err := shells.ExecuteBashCommand(
-		codeBlock.Content,
-		shells.BashCommandConfiguration{
-			EnvironmentVariables: env,
-			InheritEnvironment:   true,
-			InteractiveCommand:   true,
-			WriteToHistory:       true,
-		},
-	)
-
-	Program.RestoreTerminal()
+	}
 
-	if err != nil {
-		return FailedCommandMessage{
-			StdOut: output.StdOut,
-			StdErr: output.StdErr,
-			Error:  err,
+	if isVerificationBlock && markerValue != "" {
+		if err := WritePrereqMarker(markerValue, display); err != nil {
+			logging.GlobalLogger.Warnf("Failed to write verification marker %s: %v", markerValue, err)
 		}
 	}
 
 	logging.GlobalLogger.Infof("Command output to stdout:\n %s", output.StdOut)
 	return SuccessfulCommandMessage{
-		StdOut: output.StdOut,
-		StdErr: output.StdErr,
+		StdOut:          output.StdOut,
+		StdErr:          output.StdErr,
+		ExitCode:        output.ExitCode,
+		SimilarityScore: score,
+		Attempts:        attempts,
+		Duration:        time.Since(start),
 	}
 }
-
-// clearScreen returns a command that clears the terminal screen and positions the cursor at the top-left corner
-func ClearScreen() tea.Cmd {
-	return func() tea.Msg {
-		fmt.Print(
-			"\033[H\033[2J",
-		) // ANSI escape codes for clearing the screen and repositioning the cursor
-		return nil
-	}
-}
-
-// Updates the azure status with the current state of the interactive mode
-// model.
-func UpdateAzureStatus(azureStatus environments.AzureDeploymentStatus, environment string) tea.Cmd {
-	return func() tea.Msg {
-		logging.GlobalLogger.Tracef(
-			"Attempting to update the azure status: %+v",
-			azureStatus,
-		)
-		environments.ReportAzureStatus(azureStatus, environment)
-		return AzureStatusUpdatedMessage{}
-	}
-}
-
-// Empty struct used to indicate that the azure status has been updated so
-// that we can respond to it within the Update() function.
-type AzureStatusUpdatedMessage struct{}
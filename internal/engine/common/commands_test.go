@@ -1,16 +1,23 @@
 package common
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Azure/InnovationEngine/internal/events"
 	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
 )
 
-func TestExecuteCodeBlockAsync_VerificationMismatchDoesNotFail(t *testing.T) {
+func TestExecuteCodeBlock_VerificationMismatchDoesNotFail(t *testing.T) {
 	t.Parallel()
 
 	tmp := t.TempDir()
@@ -24,8 +31,7 @@ func TestExecuteCodeBlockAsync_VerificationMismatchDoesNotFail(t *testing.T) {
 		},
 	}
 
-	cmd := ExecuteCodeBlockAsync(block, map[string]string{})
-	msg := cmd()
+	msg := ExecuteCodeBlock(context.Background(), block, map[string]string{})
 
 	if _, ok := msg.(SuccessfulCommandMessage); !ok {
 		t.Fatalf("expected verification mismatch to be treated as success, got %T", msg)
@@ -36,7 +42,7 @@ func TestExecuteCodeBlockAsync_VerificationMismatchDoesNotFail(t *testing.T) {
 	}
 }
 
-func TestExecuteCodeBlockAsync_VerificationSuccessCreatesMarker(t *testing.T) {
+func TestExecuteCodeBlock_VerificationSuccessCreatesMarker(t *testing.T) {
 	t.Parallel()
 
 	tmp := t.TempDir()
@@ -51,8 +57,7 @@ func TestExecuteCodeBlockAsync_VerificationSuccessCreatesMarker(t *testing.T) {
 		},
 	}
 
-	cmd := ExecuteCodeBlockAsync(block, map[string]string{})
-	msg := cmd()
+	msg := ExecuteCodeBlock(context.Background(), block, map[string]string{})
 	if _, ok := msg.(SuccessfulCommandMessage); !ok {
 		t.Fatalf("expected verification success to be treated as success, got %T", msg)
 	}
@@ -67,7 +72,7 @@ func TestExecuteCodeBlockAsync_VerificationSuccessCreatesMarker(t *testing.T) {
 	}
 }
 
-func TestExecuteCodeBlockAsync_VerificationCommandErrorDoesNotFail(t *testing.T) {
+func TestExecuteCodeBlock_VerificationCommandErrorDoesNotFail(t *testing.T) {
 	t.Parallel()
 
 	tmp := t.TempDir()
@@ -78,8 +83,7 @@ func TestExecuteCodeBlockAsync_VerificationCommandErrorDoesNotFail(t *testing.T)
 		Content:  fmt.Sprintf("# ie:auto-prereq-verification marker=\"%s\" display=\"Broken\"\nfalse\n", markerPath),
 	}
 
-	cmd := ExecuteCodeBlockAsync(block, map[string]string{})
-	msg := cmd()
+	msg := ExecuteCodeBlock(context.Background(), block, map[string]string{})
 
 	if _, ok := msg.(SuccessfulCommandMessage); !ok {
 		t.Fatalf("expected verification command failures to be treated as success, got %T", msg)
@@ -89,3 +93,167 @@ func TestExecuteCodeBlockAsync_VerificationCommandErrorDoesNotFail(t *testing.T)
 		t.Fatalf("expected marker %s to be absent when verification failed", markerPath)
 	}
 }
+
+func TestExecuteCodeBlockWithAttributes_RetriesUntilOutputMatches(t *testing.T) {
+	tmp := t.TempDir()
+	counter := filepath.Join(tmp, "attempts")
+
+	block := parsers.CodeBlock{
+		Language: "bash",
+		Content:  fmt.Sprintf("echo x >> %s\nwc -l < %s\n", counter, counter),
+		ExpectedOutput: parsers.ExpectedOutputBlock{
+			ExpectedRegexPattern: "^3",
+		},
+		Attributes: parsers.CodeBlockAttributes{
+			Retry: parsers.RetryPolicy{MaxAttempts: 4},
+		},
+	}
+
+	output, attempts, err := ExecuteCodeBlockWithAttributes(block, shells.BashCommandConfiguration{})
+	if err != nil {
+		t.Fatalf("expected retries to succeed, got %v", err)
+	}
+	if strings.TrimSpace(output.StdOut) != "3" {
+		t.Fatalf("expected the third attempt to succeed, got %q", output.StdOut)
+	}
+	if len(attempts) != 3 {
+		t.Fatalf("expected 3 attempts to be recorded, got %d", len(attempts))
+	}
+	if attempts[0].Reason != parsers.RetryOnOutput || attempts[2].Reason != "" {
+		t.Fatalf("unexpected attempt reasons: %+v", attempts)
+	}
+}
+
+func TestExecuteCodeBlockWithAttributes_RetryOnLimitsRetries(t *testing.T) {
+	tmp := t.TempDir()
+	counter := filepath.Join(tmp, "attempts")
+
+	block := parsers.CodeBlock{
+		Language: "bash",
+		Content:  fmt.Sprintf("echo x >> %s\nexit 1\n", counter),
+		Attributes: parsers.CodeBlockAttributes{
+			Retry: parsers.RetryPolicy{
+				MaxAttempts: 3,
+				RetryOn:     []string{parsers.RetryOnOutput},
+			},
+		},
+	}
+
+	_, attempts, err := ExecuteCodeBlockWithAttributes(block, shells.BashCommandConfiguration{})
+	if err == nil {
+		t.Fatalf("expected the command to fail")
+	}
+	if len(attempts) != 1 || attempts[0].Reason != parsers.RetryOnExitCode {
+		t.Fatalf("expected a single failed attempt, got %+v", attempts)
+	}
+}
+
+func TestExecuteInteractiveCodeBlock_RetriesOnExitCodeOnly(t *testing.T) {
+	tmp := t.TempDir()
+	counter := filepath.Join(tmp, "attempts")
+
+	block := parsers.CodeBlock{
+		Language: "bash",
+		Content:  fmt.Sprintf("echo x >> %s\n[ $(wc -l < %s) -ge 2 ]\n", counter, counter),
+		ExpectedOutput: parsers.ExpectedOutputBlock{
+			ExpectedRegexPattern: "^never printed",
+		},
+		Attributes: parsers.CodeBlockAttributes{
+			Retry: parsers.RetryPolicy{MaxAttempts: 3},
+		},
+	}
+
+	_, attempts, err := ExecuteInteractiveCodeBlock(block, shells.BashCommandConfiguration{})
+	if err != nil {
+		t.Fatalf("expected the second attempt to succeed without comparing the output, got %v", err)
+	}
+	if len(attempts) != 2 || attempts[0].Reason != parsers.RetryOnExitCode || attempts[1].Error != "" {
+		t.Fatalf("expected a failed and a successful attempt, got %+v", attempts)
+	}
+}
+
+func TestExecuteCodeBlockWithAttributes_BackoffStopsWithContext(t *testing.T) {
+	block := parsers.CodeBlock{
+		Language: "bash",
+		Content:  "exit 1\n",
+		Attributes: parsers.CodeBlockAttributes{
+			Retry: parsers.RetryPolicy{MaxAttempts: 3, Delay: time.Minute},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, attempts, err := ExecuteCodeBlockWithAttributes(block, shells.BashCommandConfiguration{Context: ctx})
+	if err == nil {
+		t.Fatalf("expected the command to fail")
+	}
+	if len(attempts) != 1 {
+		t.Fatalf("expected the backoff to be interrupted after 1 attempt, got %d", len(attempts))
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("expected the backoff to stop with the context")
+	}
+}
+
+func TestExecuteCodeBlockWithAttributes_TimeoutFailsCommand(t *testing.T) {
+	block := parsers.CodeBlock{
+		Language:   "bash",
+		Content:    "sleep 5\n",
+		Attributes: parsers.CodeBlockAttributes{Timeout: 100 * time.Millisecond},
+	}
+
+	_, _, err := ExecuteCodeBlockWithAttributes(block, shells.BashCommandConfiguration{})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestExecuteCodeBlockWithAttributes_EmitsEvents(t *testing.T) {
+	var stream bytes.Buffer
+	defer events.Use(events.NewEmitter(&stream))()
+
+	block := parsers.CodeBlock{
+		Language: "bash",
+		Content:  "printf nope\n",
+		ExpectedOutput: parsers.ExpectedOutputBlock{
+			ExpectedRegexPattern: "^ok",
+		},
+	}
+	state := StatefulCodeBlock{StepNumber: 2, StepName: "Deploy", CodeBlockNumber: 1}
+
+	_, _, err := ExecuteCodeBlockWithAttributes(block, shells.BashCommandConfiguration{
+		Context: state.EventContext(context.Background()),
+	})
+	if err != nil {
+		t.Fatalf("expected output mismatches to be left to the caller, got %v", err)
+	}
+
+	var emitted []events.Event
+	for _, line := range strings.Split(strings.TrimSpace(stream.String()), "\n") {
+		var event events.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("expected a JSON event, got %q: %v", line, err)
+		}
+		emitted = append(emitted, event)
+	}
+
+	var types []events.Type
+	for _, event := range emitted {
+		types = append(types, event.Type)
+	}
+	expected := []events.Type{events.StepStart, events.BlockStart, events.BlockOutput, events.BlockCompare, events.BlockEnd}
+	if fmt.Sprint(types) != fmt.Sprint(expected) {
+		t.Fatalf("expected events %v, got %v", expected, types)
+	}
+	if emitted[1].Step.Number != 2 || emitted[1].CodeBlock.Number != 1 {
+		t.Fatalf("expected the code block to be located, got %+v %+v", emitted[1].Step, emitted[1].CodeBlock)
+	}
+	if emitted[2].Output.Data != "nope" {
+		t.Fatalf("expected the output to be emitted, got %q", emitted[2].Output.Data)
+	}
+	if emitted[3].Comparison.Success || emitted[4].Result.Success {
+		t.Fatalf("expected the mismatch to fail the code block")
+	}
+}
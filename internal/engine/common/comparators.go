@@ -0,0 +1,260 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/ui"
+	"github.com/xrash/smetrics"
+)
+
+// The expected output of a code block, as given to comparators.
+type Expectation struct {
+	// The content of the result block, with line endings normalized.
+	Output string
+	// The language of the result block, e.g. json.
+	Language string
+	// The expected_similarity of the result block, between 0 and 1.
+	Similarity float64
+	// The attributes of the result block other than compare, e.g.
+	// ```json {compare=json-subset ignore=id,etag}
+	Options map[string]string
+}
+
+// Compares the actual output of a code block with its expected output.
+// Compare returns a score between 0 and 1 describing how close the outputs
+// are, and an error describing the difference when the actual output does not
+// match.
+type Comparator interface {
+	Compare(actual string, expected Expectation) (float64, error)
+}
+
+// Adapts a function to the Comparator interface.
+type ComparatorFunc func(actual string, expected Expectation) (float64, error)
+
+func (f ComparatorFunc) Compare(actual string, expected Expectation) (float64, error) {
+	return f(actual, expected)
+}
+
+// Names of the built-in comparators.
+const (
+	ComparatorSimilarity     = "similarity"
+	ComparatorJSONSimilarity = "json-similarity"
+	ComparatorExact          = "exact"
+	ComparatorContains       = "contains"
+	ComparatorLineSet        = "line-set"
+	ComparatorJSON           = "json"
+	ComparatorJSONSubset     = "json-subset"
+	ComparatorJSONStructure  = "json-structure"
+	ComparatorYAML           = "yaml"
+	ComparatorTable          = "table"
+)
+
+var comparatorRegistry = struct {
+	sync.RWMutex
+	comparators map[string]Comparator
+}{
+	comparators: map[string]Comparator{
+		ComparatorSimilarity:     ComparatorFunc(compareSimilarity),
+		ComparatorJSONSimilarity: ComparatorFunc(compareJSONSimilarity),
+		ComparatorExact:          ComparatorFunc(compareExact),
+		ComparatorContains:       ComparatorFunc(compareContains),
+		ComparatorLineSet:        ComparatorFunc(compareLineSet),
+		ComparatorJSON:           structuredComparator{format: formatJSON},
+		ComparatorJSONSubset:     structuredComparator{format: formatJSON, match: matchSubset},
+		ComparatorJSONStructure:  structuredComparator{format: formatJSON, match: matchStructure},
+		ComparatorYAML:           structuredComparator{format: formatYAML},
+		ComparatorTable:          ComparatorFunc(compareTables),
+	},
+}
+
+// Registers a comparator that result blocks select by name with the compare
+// attribute. Names are case insensitive and cannot be registered twice.
+func RegisterComparator(name string, comparator Comparator) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return fmt.Errorf("comparators must have a name")
+	}
+	if comparator == nil {
+		return fmt.Errorf("the comparator %q is nil", name)
+	}
+
+	comparatorRegistry.Lock()
+	defer comparatorRegistry.Unlock()
+	if _, exists := comparatorRegistry.comparators[name]; exists {
+		return fmt.Errorf("a comparator named %q is already registered", name)
+	}
+	comparatorRegistry.comparators[name] = comparator
+	return nil
+}
+
+// Returns the names of the registered comparators in alphabetical order.
+func ComparatorNames() []string {
+	comparatorRegistry.RLock()
+	defer comparatorRegistry.RUnlock()
+	names := make([]string, 0, len(comparatorRegistry.comparators))
+	for name := range comparatorRegistry.comparators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Finds the comparator registered under name. An empty name selects the
+// default comparator for the language of the result block.
+func lookupComparator(name string, language string) (Comparator, error) {
+	name = comparatorName(name, language)
+	comparatorRegistry.RLock()
+	comparator, ok := comparatorRegistry.comparators[name]
+	comparatorRegistry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf(
+			"unknown comparator %q (available: %s)",
+			name,
+			strings.Join(ComparatorNames(), ", "),
+		)
+	}
+	return comparator, nil
+}
+
+// Returns the name of the comparator selected by a result block, resolving an
+// empty name to the default comparator for its language.
+func comparatorName(name string, language string) string {
+	if name != "" {
+		return name
+	}
+	if strings.ToLower(language) == "json" {
+		return ComparatorJSONSimilarity
+	}
+	return ComparatorSimilarity
+}
+
+// An actual output that does not match the expected output, for a reason
+// given by the comparator.
+type outputMismatch struct {
+	expected string
+	actual   string
+	reason   string
+}
+
+// Describes the mismatch in the format of the similarity comparators.
+func (err *outputMismatch) Error() string {
+	return fmt.Sprintf(
+		ui.ErrorMessageStyle.Render("Expected output does not match actual output: %s\n%s"),
+		err.reason,
+		describeOutputDifference(err.expected, err.actual, ""),
+	)
+}
+
+func outputMismatchError(expected string, actual string, reason string) error {
+	return &outputMismatch{expected: expected, actual: actual, reason: reason}
+}
+
+// Describes an actual output that is not similar enough to the expected
+// output.
+func similarityMismatchError(expected Expectation, actual string, score float64) error {
+	return fmt.Errorf(
+		ui.ErrorMessageStyle.Render(
+			"Expected output does not match actual output.\n%s\nExpected Score:%s\nActual Score:%s",
+		),
+		describeOutputDifference(expected.Output, actual, expected.Language),
+		ui.VerboseStyle.Render(fmt.Sprintf("%f", expected.Similarity)),
+		ui.VerboseStyle.Render(fmt.Sprintf("%f", score)),
+	)
+}
+
+// Scores the outputs with Jaro-Winkler, failing below the expected similarity.
+func compareSimilarity(actual string, expected Expectation) (float64, error) {
+	score := smetrics.JaroWinkler(expected.Output, actual, 0.7, 4)
+
+	if expected.Similarity > score {
+		return score, similarityMismatchError(expected, actual, score)
+	}
+
+	return score, nil
+}
+
+// Scores JSON outputs with Jaro on their serialization with ordered keys,
+// failing below the expected similarity.
+func compareJSONSimilarity(actual string, expected Expectation) (float64, error) {
+	results, err := lib.CompareJsonStrings(actual, expected.Output, expected.Similarity)
+	if err != nil {
+		return results.Score, err
+	}
+
+	if !results.AboveThreshold {
+		return results.Score, similarityMismatchError(expected, actual, results.Score)
+	}
+
+	return results.Score, nil
+}
+
+// Requires the outputs to be identical, apart from trailing whitespace.
+func compareExact(actual string, expected Expectation) (float64, error) {
+	if strings.TrimRight(actual, " \t\n") != strings.TrimRight(expected.Output, " \t\n") {
+		return 0, outputMismatchError(expected.Output, actual, "the outputs are not identical")
+	}
+	return 1, nil
+}
+
+// Requires the actual output to contain the expected output.
+func compareContains(actual string, expected Expectation) (float64, error) {
+	if !strings.Contains(actual, strings.TrimSpace(expected.Output)) {
+		return 0, outputMismatchError(expected.Output, actual, "the actual output does not contain the expected output")
+	}
+	return 1, nil
+}
+
+// Returns the distinct non blank lines of output, without surrounding
+// whitespace.
+func lineSet(output string) map[string]bool {
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			lines[trimmed] = true
+		}
+	}
+	return lines
+}
+
+// Requires both outputs to have the same lines, in any order. The score is
+// the share of lines found in both outputs.
+func compareLineSet(actual string, expected Expectation) (float64, error) {
+	expectedLines := lineSet(expected.Output)
+	actualLines := lineSet(actual)
+
+	var missing, unexpected []string
+	for line := range expectedLines {
+		if !actualLines[line] {
+			missing = append(missing, line)
+		}
+	}
+	for line := range actualLines {
+		if !expectedLines[line] {
+			unexpected = append(unexpected, line)
+		}
+	}
+
+	union := len(expectedLines) + len(unexpected)
+	if union == 0 {
+		return 1, nil
+	}
+	score := float64(union-len(missing)-len(unexpected)) / float64(union)
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return score, nil
+	}
+
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+	var reasons []string
+	if len(missing) > 0 {
+		reasons = append(reasons, fmt.Sprintf("missing lines %q", missing))
+	}
+	if len(unexpected) > 0 {
+		reasons = append(reasons, fmt.Sprintf("unexpected lines %q", unexpected))
+	}
+	return score, outputMismatchError(expected.Output, actual, strings.Join(reasons, ", "))
+}
@@ -0,0 +1,215 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func compareWith(comparator string, actual string, expected string, options map[string]string) (float64, error) {
+	return CompareExpectedOutput(actual, parsers.ExpectedOutputBlock{
+		Content:    expected,
+		Comparator: comparator,
+		Options:    options,
+	})
+}
+
+func TestComparatorRegistry(t *testing.T) {
+	assert.Subset(t, ComparatorNames(), []string{
+		"contains", "exact", "json", "json-similarity", "json-structure",
+		"json-subset", "line-set", "similarity", "table", "yaml",
+	})
+
+	noop := ComparatorFunc(func(string, Expectation) (float64, error) { return 1, nil })
+	assert.Error(t, RegisterComparator(" ", noop))
+	assert.Error(t, RegisterComparator("noop", nil))
+	assert.ErrorContains(t, RegisterComparator("EXACT", noop), "already registered")
+
+	_, err := compareWith("missing", "hello", "hello", nil)
+	assert.ErrorContains(t, err, `unknown comparator "missing" (available: contains, exact,`)
+}
+
+func TestCompareExpectedOutput(t *testing.T) {
+	t.Run("Regex patterns take precedence over comparators", func(t *testing.T) {
+		_, err := CompareExpectedOutput("id-42\n", parsers.ExpectedOutputBlock{
+			Content:              "something else",
+			Comparator:           ComparatorExact,
+			ExpectedRegexPattern: "id-[0-9]+",
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Outputs are normalized before they are compared", func(t *testing.T) {
+		score, err := compareWith(ComparatorExact, "\x1b[32mhello\x1b[0m\r\nworld\r\n", "hello\nworld\n", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, score)
+	})
+
+	t.Run("JSON result blocks default to the JSON similarity", func(t *testing.T) {
+		score, err := CompareExpectedOutput(`{"b": 2, "a": 1}`, parsers.ExpectedOutputBlock{
+			Content:            `{"a": 1, "b": 2}`,
+			Language:           "json",
+			ExpectedSimilarity: 1,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, score)
+	})
+}
+
+func TestTextComparators(t *testing.T) {
+	t.Run("exact", func(t *testing.T) {
+		_, err := compareWith(ComparatorExact, "hello\n\n", "hello", nil)
+		assert.NoError(t, err)
+
+		score, err := compareWith(ComparatorExact, "hello world", "hello", nil)
+		assert.ErrorContains(t, err, "the outputs are not identical")
+		assert.Equal(t, 0.0, score)
+	})
+
+	t.Run("contains", func(t *testing.T) {
+		_, err := compareWith(ComparatorContains, "Provisioning state: Succeeded\nDone\n", "\nSucceeded\n", nil)
+		assert.NoError(t, err)
+
+		_, err = compareWith(ComparatorContains, "Provisioning state: Failed\n", "Succeeded", nil)
+		assert.ErrorContains(t, err, "does not contain the expected output")
+	})
+
+	t.Run("line-set", func(t *testing.T) {
+		score, err := compareWith(ComparatorLineSet, "  westus\neastus\n\n", "eastus\nwestus\n", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, score)
+
+		score, err = compareWith(ComparatorLineSet, "eastus\ncentralus\n", "eastus\nwestus\n", nil)
+		assert.ErrorContains(t, err, `missing lines ["westus"], unexpected lines ["centralus"]`)
+		assert.InDelta(t, 1.0/3.0, score, 0.0001)
+	})
+}
+
+func TestStructuredComparators(t *testing.T) {
+	expected := `{
+  "name": "vm1",
+  "location": "eastus",
+  "tags": {"env": "test"},
+  "disks": [{"name": "os", "sizeGb": 30}]
+}`
+
+	t.Run("json", func(t *testing.T) {
+		_, err := compareWith(ComparatorJSON, `{"disks": [{"sizeGb": 30, "name": "os"}], "tags": {"env": "test"}, "location": "eastus", "name": "vm1"}`, expected, nil)
+		assert.NoError(t, err)
+
+		_, err = compareWith(ComparatorJSON, `{"name": "vm1", "location": "westus", "tags": {"env": "test"}, "disks": [{"name": "os", "sizeGb": 30}], "id": "/subscriptions/1"}`, expected, nil)
+		assert.ErrorContains(t, err, `$.id: not in the expected output`)
+		assert.ErrorContains(t, err, `$.location: expected "eastus", got "westus"`)
+
+		_, err = compareWith(ComparatorJSON, `{"name": "vm1", "location": "westus", "tags": {"env": "prod"}, "disks": [{"name": "os", "sizeGb": 30}]}`, expected, map[string]string{"ignore": "$.location,tags.*"})
+		assert.NoError(t, err)
+
+		_, err = compareWith(ComparatorJSON, "not json", expected, nil)
+		assert.ErrorContains(t, err, "the actual output is not valid JSON")
+
+		_, err = compareWith(ComparatorJSON, expected, "not json", nil)
+		assert.ErrorContains(t, err, "the expected output is not valid JSON")
+	})
+
+	t.Run("json-subset", func(t *testing.T) {
+		actual := `{"id": "/subscriptions/1", "name": "vm1", "location": "eastus", "tags": {"env": "test", "owner": "me"}, "disks": [{"name": "data", "sizeGb": 64}, {"name": "os", "sizeGb": 30, "caching": "ReadWrite"}]}`
+		_, err := compareWith(ComparatorJSONSubset, actual, expected, nil)
+		assert.NoError(t, err)
+
+		_, err = compareWith(ComparatorJSONSubset, `{"name": "vm1", "location": "eastus", "tags": {}, "disks": [{"name": "os", "sizeGb": 32}]}`, expected, nil)
+		assert.ErrorContains(t, err, "$.disks[0]: no matching item in the actual output")
+		assert.ErrorContains(t, err, "$.tags.env: missing from the actual output")
+
+		_, err = compareWith(ComparatorJSON, actual, expected, map[string]string{"match": "subset"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("json-structure", func(t *testing.T) {
+		_, err := compareWith(ComparatorJSONStructure, `{"name": "vm2", "location": "westus", "tags": {"env": "prod"}, "disks": [{"name": "os", "sizeGb": 128}, {"name": "data", "sizeGb": 64}]}`, expected, nil)
+		assert.NoError(t, err)
+
+		_, err = compareWith(ComparatorJSONStructure, `{"name": "vm2", "location": 1, "tags": {"env": "prod"}, "disks": [{"name": "os"}]}`, expected, nil)
+		assert.ErrorContains(t, err, "$.location: expected \"eastus\", got 1")
+		assert.ErrorContains(t, err, "$.disks[0]: does not have the structure of any expected item")
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		actual := "disks:\n- name: os\n  sizeGb: 30\ntags:\n  env: test\nlocation: eastus\nname: vm1\n"
+		_, err := compareWith(ComparatorYAML, actual, "name: vm1\nlocation: eastus\ntags:\n  env: test\ndisks:\n  - {name: os, sizeGb: 30}\n", nil)
+		assert.NoError(t, err)
+
+		_, err = compareWith(ComparatorYAML, actual, "name: vm1\n", map[string]string{"match": "subset"})
+		assert.NoError(t, err)
+
+		_, err = compareWith(ComparatorYAML, actual, "name: vm1\n", map[string]string{"match": "partial"})
+		assert.ErrorContains(t, err, `unknown match "partial"`)
+	})
+}
+
+func TestTableComparator(t *testing.T) {
+	expected := `Name    ResourceGroup    Location    Zones
+------  ---------------  ----------  -------
+vm1     my-rg            eastus      1
+vm2     my-rg            eastus
+`
+
+	t.Run("Rows match in any order", func(t *testing.T) {
+		actual := `Name    ResourceGroup    Location    Zones    PowerState
+------  ---------------  ----------  -------  ------------
+vm2     my-rg            eastus               VM running
+vm1     my-rg            eastus      1        VM running
+`
+		score, err := compareWith(ComparatorTable, actual, expected, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, score)
+	})
+
+	t.Run("Only the selected columns are compared", func(t *testing.T) {
+		actual := `Name    ResourceGroup    Location
+------  ---------------  ----------
+vm1     other-rg         eastus
+vm2     other-rg         eastus
+`
+		_, err := compareWith(ComparatorTable, actual, expected, map[string]string{"columns": "name, location"})
+		assert.NoError(t, err)
+
+		_, err = compareWith(ComparatorTable, actual, expected, nil)
+		assert.ErrorContains(t, err, `the table has no "Zones" column`)
+	})
+
+	t.Run("Rows that differ are reported", func(t *testing.T) {
+		actual := `Name    ResourceGroup    Location    Zones
+------  ---------------  ----------  -------
+vm1     my-rg            eastus      1
+vm3     my-rg            westus
+`
+		score, err := compareWith(ComparatorTable, actual, expected, nil)
+		assert.ErrorContains(t, err, `missing rows ["vm2 | my-rg | eastus | "], unexpected rows ["vm3 | my-rg | westus | "]`)
+		assert.Equal(t, 0.5, score)
+	})
+
+	t.Run("Tables without a separator line", func(t *testing.T) {
+		actual := "NAME    READY   STATUS    RESTARTS\nweb-1   1/1     Running   0\n"
+		_, err := compareWith(ComparatorTable, actual, "NAME   STATUS\nweb-1  Running\n", nil)
+		assert.NoError(t, err)
+	})
+}
+
+func TestPartialComparatorsAreNotReplaceable(t *testing.T) {
+	for comparator, replaceable := range map[string]bool{
+		"":                      true,
+		ComparatorExact:         true,
+		ComparatorContains:      false,
+		ComparatorJSONSubset:    false,
+		ComparatorJSONStructure: false,
+		ComparatorTable:         false,
+	} {
+		codeBlock := parsers.CodeBlock{ExpectedOutput: parsers.ExpectedOutputBlock{
+			Content:    "hello\n",
+			Comparator: comparator,
+			Position:   parsers.SourcePosition{File: "scenario.md", StartLine: 3, EndLine: 5},
+		}}
+		assert.Equal(t, replaceable, hasReplaceableExpectedOutput(codeBlock), comparator)
+	}
+}
@@ -0,0 +1,182 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The names of the files configuring Innovation Engine for a repository, in
+// the order they are looked up in a directory.
+var RepositoryConfigFileNames = []string{".ie.yaml", ".ieconfig"}
+
+// RepositoryConfig is the configuration read from .ie.yaml or .ieconfig.
+type RepositoryConfig struct {
+	Inspect     InspectConfig     `yaml:"inspect"`
+	Destructive DestructiveConfig `yaml:"destructive"`
+	// The file the configuration was read from, empty for the defaults.
+	Path string `yaml:"-"`
+}
+
+// DestructiveConfig adds to the commands that ie execute asks to confirm and
+// --do-not-delete skips.
+type DestructiveConfig struct {
+	// Commands classified as destructive on top of the built-in ones.
+	Commands []DestructiveCommand `yaml:"commands"`
+}
+
+// RuleSetting turns a rule run by ie inspect off or sets the severity of the
+// issues it reports.
+type RuleSetting string
+
+const (
+	RuleSettingOff     RuleSetting = "off"
+	RuleSettingWarning RuleSetting = "warning"
+	RuleSettingError   RuleSetting = "error"
+)
+
+// InspectConfig adjusts the checks run by ie inspect to the conventions of a
+// repository.
+type InspectConfig struct {
+	// Maps rule IDs to their setting. Rules that are not listed run with their
+	// default severity.
+	Rules map[string]RuleSetting `yaml:"rules"`
+	// Variables the host provides, e.g. SUBSCRIPTION_ID, that documents may
+	// reference without exporting them.
+	ExternalVariables []string `yaml:"externalVariables"`
+	// The prefixes exported variables must start with, e.g. AKS for
+	// AKS_CLUSTER_NAME. Any uppercase prefix is allowed when empty.
+	AllowedPrefixes []string `yaml:"allowedPrefixes"`
+	// Commands classified as destructive on top of the built-in ones, taken
+	// from the destructive section of the configuration.
+	DestructiveCommands []DestructiveCommand `yaml:"-"`
+}
+
+// Reads the repository configuration from a file, rejecting unknown keys,
+// rules and settings so that typos do not silently change the checks.
+func LoadRepositoryConfig(path string) (RepositoryConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return RepositoryConfig{}, err
+	}
+
+	var config RepositoryConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return RepositoryConfig{}, fmt.Errorf("invalid configuration in %s: %w", path, err)
+	}
+	if err := config.Inspect.validate(); err != nil {
+		return RepositoryConfig{}, fmt.Errorf("invalid configuration in %s: %w", path, err)
+	}
+	for _, command := range config.Destructive.Commands {
+		if err := command.Validate(); err != nil {
+			return RepositoryConfig{}, fmt.Errorf("invalid configuration in %s: %w", path, err)
+		}
+	}
+	config.Inspect.DestructiveCommands = config.Destructive.Commands
+	config.Path = path
+	return config, nil
+}
+
+// Looks for a repository configuration file in the given directory and its
+// parents, stopping at the root of the git repository the directory is in.
+// Returns false if there is none.
+func FindRepositoryConfig(directory string) (string, bool) {
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return "", false
+	}
+	for {
+		for _, name := range RepositoryConfigFileNames {
+			path := filepath.Join(directory, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, true
+			}
+		}
+		if _, err := os.Stat(filepath.Join(directory, ".git")); err == nil {
+			return "", false
+		}
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return "", false
+		}
+		directory = parent
+	}
+}
+
+func (config InspectConfig) validate() error {
+	for id, setting := range config.Rules {
+		if !isValidationRule(id) {
+			return fmt.Errorf("unknown rule %q", id)
+		}
+		switch setting {
+		case RuleSettingOff, RuleSettingWarning, RuleSettingError:
+		default:
+			return fmt.Errorf(
+				"invalid setting %q for rule %q (expected %q, %q or %q)",
+				setting,
+				id,
+				RuleSettingOff,
+				RuleSettingWarning,
+				RuleSettingError,
+			)
+		}
+	}
+	for _, prefix := range config.AllowedPrefixes {
+		if prefix == "" || prefix != strings.ToUpper(prefix) || strings.Contains(prefix, "_") {
+			return fmt.Errorf("allowed prefix %q must be uppercase and not contain '_'", prefix)
+		}
+	}
+	return nil
+}
+
+// Apply drops the issues of rules that are turned off and those suppressed by
+// comments in the documents they were found in, then applies the configured
+// severities to the rest.
+func (config InspectConfig) Apply(s *Scenario, issues []ValidationIssue) []ValidationIssue {
+	return config.applyRuleSettings(suppressValidationIssues(s, issues))
+}
+
+func (config InspectConfig) applyRuleSettings(issues []ValidationIssue) []ValidationIssue {
+	configured := make([]ValidationIssue, 0, len(issues))
+	for _, issue := range issues {
+		switch config.Rules[issue.RuleID] {
+		case RuleSettingOff:
+			continue
+		case RuleSettingWarning:
+			issue.Severity = ValidationSeverityWarning
+		case RuleSettingError:
+			issue.Severity = ValidationSeverityError
+		}
+		configured = append(configured, issue)
+	}
+	return configured
+}
+
+func (config InspectConfig) isExternalVariable(name string) bool {
+	for _, variable := range config.ExternalVariables {
+		if variable == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (config InspectConfig) isAllowedPrefix(prefix string) bool {
+	if len(config.AllowedPrefixes) == 0 {
+		return true
+	}
+	for _, allowed := range config.AllowedPrefixes {
+		if allowed == prefix {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, directory string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(directory, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadRepositoryConfig(t *testing.T) {
+	directory := t.TempDir()
+
+	path := writeConfigFile(t, directory, ".ie.yaml", `
+inspect:
+  rules:
+    unused-export: "off"
+    env-prefix: warning
+  externalVariables: [SUBSCRIPTION_ID]
+  allowedPrefixes: [AKS, MY]
+`)
+	config, err := LoadRepositoryConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, path, config.Path)
+	assert.Equal(t, map[string]RuleSetting{RuleUnusedExport: RuleSettingOff, RuleEnvPrefix: RuleSettingWarning}, config.Inspect.Rules)
+	assert.Equal(t, []string{"SUBSCRIPTION_ID"}, config.Inspect.ExternalVariables)
+	assert.Equal(t, []string{"AKS", "MY"}, config.Inspect.AllowedPrefixes)
+
+	invalid := map[string]string{
+		"inspect:\n  rule: {}\n":                               "field rule not found",
+		"inspect:\n  rules:\n    unused-exports: off\n":        `unknown rule "unused-exports"`,
+		"inspect:\n  rules:\n    unused-export: info\n":        `invalid setting "info"`,
+		"inspect:\n  allowedPrefixes: [aks]\n":                 `allowed prefix "aks"`,
+		"inspect:\n  allowedPrefixes: [AKS_]\n":                `allowed prefix "AKS_"`,
+		"inspect:\n  externalVariables: SUBSCRIPTION_ID\n":     "cannot unmarshal",
+		"inspect:\n  rules:\n    missing-description: [off]\n": "cannot unmarshal",
+	}
+	for content, message := range invalid {
+		_, err := LoadRepositoryConfig(writeConfigFile(t, directory, ".ie.yaml", content))
+		assert.ErrorContains(t, err, message, content)
+	}
+}
+
+func TestFindRepositoryConfig(t *testing.T) {
+	root := t.TempDir()
+	repository := filepath.Join(root, "repository")
+	documents := filepath.Join(repository, "docs", "aks")
+	require.NoError(t, os.MkdirAll(documents, 0755))
+	require.NoError(t, os.Mkdir(filepath.Join(repository, ".git"), 0755))
+
+	// Configurations outside of the repository are not used.
+	writeConfigFile(t, root, ".ie.yaml", "")
+	_, ok := FindRepositoryConfig(documents)
+	assert.False(t, ok)
+
+	expected := writeConfigFile(t, repository, ".ieconfig", "")
+	path, ok := FindRepositoryConfig(documents)
+	assert.True(t, ok)
+	assert.Equal(t, expected, path)
+
+	expected = writeConfigFile(t, filepath.Join(repository, "docs"), ".ie.yaml", "")
+	path, ok = FindRepositoryConfig(documents)
+	assert.True(t, ok)
+	assert.Equal(t, expected, path)
+}
+
+func TestInspectConfig(t *testing.T) {
+	source := "# Scenario\n\n## Step\n\nCreate the cluster.\n\n```bash\nexport APP_NAME=demo\naz aks create --name $APP_NAME --subscription $SUBSCRIPTION_ID\n```\n"
+	scenario, err := CreateScenarioFromMarkdownSource([]byte(source), "scenario.md", []string{"bash"}, nil)
+	require.NoError(t, err)
+
+	issues := ValidateScenarioForInspect(scenario, InspectConfig{})
+	require.Len(t, issues, 1)
+	assert.Equal(t, RuleUndefinedVariable, issues[0].RuleID)
+
+	config := InspectConfig{ExternalVariables: []string{"SUBSCRIPTION_ID"}, AllowedPrefixes: []string{"AKS"}}
+	issues = ValidateScenarioForInspect(scenario, config)
+	require.Len(t, issues, 1)
+	assert.Equal(t, RuleEnvPrefix, issues[0].RuleID)
+	assert.Contains(t, issues[0].Message, "must use one of the allowed prefixes AKS_")
+	assert.Equal(t, "Rename the variable to AKS_APP_NAME.", issues[0].Suggestion)
+
+	config.Rules = map[string]RuleSetting{RuleEnvPrefix: RuleSettingWarning}
+	issues = config.Apply(scenario, issues)
+	require.Len(t, issues, 1)
+	assert.Equal(t, ValidationSeverityWarning, issues[0].Severity)
+
+	config.Rules[RuleEnvPrefix] = RuleSettingOff
+	assert.Empty(t, config.Apply(scenario, issues))
+}
+
+func TestLoadRepositoryConfigDestructiveCommands(t *testing.T) {
+	directory := t.TempDir()
+	path := writeConfigFile(t, directory, ".ie.yaml", `
+destructive:
+  commands:
+    - command: helm delete
+    - command: git clean
+      flags: [-x, -d]
+      description: Deletes untracked files.
+`)
+	config, err := LoadRepositoryConfig(path)
+	require.NoError(t, err)
+	expected := []DestructiveCommand{
+		{Command: "helm delete"},
+		{Command: "git clean", Flags: []string{"-x", "-d"}, Description: "Deletes untracked files."},
+	}
+	assert.Equal(t, expected, config.Destructive.Commands)
+	assert.Equal(t, expected, config.Inspect.DestructiveCommands)
+
+	invalid := map[string]string{
+		"destructive:\n  commands:\n    - command: \" \"\n":                       "must not be empty",
+		"destructive:\n  commands:\n    - command: git clean\n      flags: [x]\n": `flag "x"`,
+	}
+	for content, message := range invalid {
+		_, err := LoadRepositoryConfig(writeConfigFile(t, directory, ".ie.yaml", content))
+		assert.ErrorContains(t, err, message, content)
+	}
+}
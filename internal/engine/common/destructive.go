@@ -0,0 +1,192 @@
+package common
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// DestructiveCommand describes a command that deletes resources or data, which
+// ie execute asks to confirm and --do-not-delete skips.
+type DestructiveCommand struct {
+	// The words the command starts with, e.g. "az group delete".
+	Command string `yaml:"command" json:"command"`
+	// Flags of which the command must pass at least one to be destructive,
+	// e.g. -r for rm. Single letter flags also match when combined with
+	// others, like -rf. Any use of the command is destructive when empty.
+	Flags []string `yaml:"flags,omitempty" json:"flags,omitempty"`
+	// What the command destroys, shown when asking to confirm it.
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+var builtinDestructiveCommands = []DestructiveCommand{
+	{Command: "rm", Flags: []string{"-r", "-R", "--recursive"}, Description: "Deletes directories and everything in them."},
+	{Command: "find", Flags: []string{"-delete"}, Description: "Deletes the files it finds."},
+	{Command: "az group delete", Description: "Deletes a resource group and every resource in it."},
+	{Command: "az resource delete", Description: "Deletes Azure resources."},
+	{Command: "az ad app delete", Description: "Deletes a Microsoft Entra application."},
+	{Command: "az ad sp delete", Description: "Deletes a service principal."},
+	{Command: "az keyvault purge", Description: "Permanently deletes a key vault."},
+	{Command: "kubectl delete namespace", Description: "Deletes a namespace and everything in it."},
+	{Command: "kubectl delete ns", Description: "Deletes a namespace and everything in it."},
+	{Command: "helm uninstall", Description: "Deletes a Helm release."},
+	{Command: "terraform destroy", Description: "Destroys the infrastructure managed by Terraform."},
+	{Command: "terraform apply", Flags: []string{"-destroy"}, Description: "Destroys the infrastructure managed by Terraform."},
+}
+
+// DestructiveCommands returns the built-in destructive commands followed by the
+// given ones.
+func DestructiveCommands(extra []DestructiveCommand) []DestructiveCommand {
+	commands := make([]DestructiveCommand, 0, len(builtinDestructiveCommands)+len(extra))
+	commands = append(commands, builtinDestructiveCommands...)
+	return append(commands, extra...)
+}
+
+// Validate checks that the command names a command and that its flags are
+// flags.
+func (command DestructiveCommand) Validate() error {
+	if len(strings.Fields(command.Command)) == 0 {
+		return fmt.Errorf("destructive command must not be empty")
+	}
+	for _, flag := range command.Flags {
+		if !strings.HasPrefix(flag, "-") || len(flag) < 2 {
+			return fmt.Errorf("flag %q of destructive command %q must start with '-'", flag, command.Command)
+		}
+	}
+	return nil
+}
+
+// Checks if the arguments of a simple command, starting with its name, run the
+// destructive command.
+func (command DestructiveCommand) matches(args []string) bool {
+	if len(args) > 0 && args[0] == "sudo" {
+		args = args[1:]
+	}
+	words := strings.Fields(command.Command)
+	if len(args) < len(words) {
+		return false
+	}
+	for index, word := range words {
+		arg := args[index]
+		if index == 0 {
+			arg = path.Base(arg)
+		}
+		if arg != word {
+			return false
+		}
+	}
+	if len(command.Flags) == 0 {
+		return true
+	}
+	for _, arg := range args[len(words):] {
+		for _, flag := range command.Flags {
+			if matchesFlag(arg, flag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesFlag(arg string, flag string) bool {
+	if arg == flag || strings.HasPrefix(arg, flag+"=") {
+		return true
+	}
+	// Single letter flags can be combined, e.g. -rf passes both -r and -f.
+	return len(flag) == 2 && flag[0] == '-' && flag[1] != '-' &&
+		len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.ContainsRune(arg[1:], rune(flag[1]))
+}
+
+// Returns the first of the commands that the arguments of a simple command run.
+func matchDestructiveCommand(args []string, commands []DestructiveCommand) (DestructiveCommand, bool) {
+	for _, command := range commands {
+		if command.matches(args) {
+			return command, true
+		}
+	}
+	return DestructiveCommand{}, false
+}
+
+// DestructiveMatch is a destructive command found in a code block.
+type DestructiveMatch struct {
+	Command DestructiveCommand
+	// The line of the code block the command starts on, counted from 1.
+	Line int
+	// The text of that line.
+	Text string
+}
+
+// FindDestructiveCommands returns the destructive commands run by the content of
+// a code block. Content that is not valid bash is searched line by line.
+func FindDestructiveCommands(content string, commands []DestructiveCommand) []DestructiveMatch {
+	lines := strings.Split(content, "\n")
+	newMatch := func(command DestructiveCommand, line int) DestructiveMatch {
+		return DestructiveMatch{Command: command, Line: line, Text: strings.TrimSpace(lines[line-1])}
+	}
+
+	var matches []DestructiveMatch
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(content), "")
+	if err != nil {
+		logging.GlobalLogger.Debugf("Searching unparsable code block for destructive commands: %s", err)
+		for index, line := range lines {
+			fields := strings.Fields(line)
+			for start := range fields {
+				if command, ok := matchDestructiveCommand(fields[start:], commands); ok {
+					matches = append(matches, newMatch(command, index+1))
+					break
+				}
+			}
+		}
+		return matches
+	}
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok {
+			if command, ok := matchDestructiveCommand(literalArguments(call), commands); ok {
+				matches = append(matches, newMatch(command, int(call.Pos().Line())))
+			}
+		}
+		return true
+	})
+	return matches
+}
+
+// Returns the arguments of a simple command, with those that are not literals,
+// e.g. because they expand variables, replaced by empty strings.
+func literalArguments(call *syntax.CallExpr) []string {
+	args := make([]string, len(call.Args))
+	for index, arg := range call.Args {
+		args[index] = arg.Lit()
+	}
+	return args
+}
+
+// FilterDestructiveCodeBlocks removes the code blocks running any of the
+// destructive commands from the steps when skip is set, e.g. by the
+// --do-not-delete flag.
+func FilterDestructiveCodeBlocks(steps []Step, skip bool, commands []DestructiveCommand) []Step {
+	if !skip {
+		return steps
+	}
+	filteredSteps := make([]Step, 0, len(steps))
+	for _, step := range steps {
+		newBlocks := []parsers.CodeBlock{}
+		for _, block := range step.CodeBlocks {
+			if matches := FindDestructiveCommands(block.Content, commands); len(matches) > 0 {
+				logging.GlobalLogger.Infof("Skipping destructive code block (%s):\n %s", matches[0].Command.Command, block.Content)
+				continue
+			}
+			newBlocks = append(newBlocks, block)
+		}
+		filteredSteps = append(filteredSteps, Step{
+			Name:       step.Name,
+			CodeBlocks: newBlocks,
+			Section:    step.Section,
+		})
+	}
+	return filteredSteps
+}
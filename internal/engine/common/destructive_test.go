@@ -0,0 +1,69 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDestructiveCommands(t *testing.T) {
+	commands := DestructiveCommands([]DestructiveCommand{{Command: "az storage account delete"}})
+	cases := map[string]string{
+		"rm -rf \"$WORK_DIR\"":                            "rm",
+		"sudo /bin/rm -r build":                           "rm",
+		"rm --recursive=true build":                       "rm",
+		"find . -name '*.tmp' -delete":                    "find",
+		"echo done && az group delete --name $RG --yes":   "az group delete",
+		"if true; then\n  az ad app delete --id $APP\nfi": "az ad app delete",
+		"kubectl delete ns demo":                          "kubectl delete ns",
+		"terraform apply -destroy -auto-approve":          "terraform apply",
+		"az storage account delete -n $ACCOUNT":           "az storage account delete",
+		// Code that is not valid bash is searched line by line.
+		"az group delete --name <name>": "az group delete",
+	}
+	for content, command := range cases {
+		matches := FindDestructiveCommands(content, commands)
+		if assert.Len(t, matches, 1, content) {
+			assert.Equal(t, command, matches[0].Command.Command, content)
+		}
+	}
+
+	matches := FindDestructiveCommands("echo start\n  terraform destroy -auto-approve\nrm -rf out", commands)
+	assert.Equal(t, []DestructiveMatch{
+		{Command: builtinDestructiveCommands[10], Line: 2, Text: "terraform destroy -auto-approve"},
+		{Command: builtinDestructiveCommands[0], Line: 3, Text: "rm -rf out"},
+	}, matches)
+
+	safe := []string{
+		"rm file.txt",
+		"rm -f file.txt",
+		"echo \"az group delete\"",
+		"az group show --name delete",
+		"kubectl delete pod demo",
+		"terraform apply -auto-approve",
+		"az storage account delete -n demo",
+	}
+	for _, content := range safe {
+		assert.Empty(t, FindDestructiveCommands(content, DestructiveCommands(nil)), content)
+	}
+}
+
+func TestFilterDestructiveCodeBlocks(t *testing.T) {
+	steps := []Step{
+		{
+			Name: "Clean up",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "echo cleaning"},
+				{Content: "rm -rf $WORK_DIR"},
+				{Content: "az group delete --name $RG --yes --no-wait"},
+			},
+		},
+	}
+
+	filtered := FilterDestructiveCodeBlocks(steps, true, DestructiveCommands(nil))
+	assert.Len(t, filtered, 1)
+	assert.Equal(t, []parsers.CodeBlock{{Content: "echo cleaning"}}, filtered[0].CodeBlocks)
+
+	assert.Equal(t, steps, FilterDestructiveCodeBlocks(steps, false, DestructiveCommands(nil)))
+}
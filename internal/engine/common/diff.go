@@ -0,0 +1,142 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/ui"
+)
+
+// The number of unchanged lines shown around every change of a diff.
+const diffContextLines = 3
+
+// The maximum number of diff lines shown in the terminal. Reports keep the
+// whole diff.
+const maxDiffLines = 60
+
+// Describes how the actual output of a code block differs from its result
+// block, comparing the outputs the way they are compared when the code block
+// runs. JSON outputs are diffed by path, e.g. `$.tags.env: expected "dev",
+// got "prod"`, and other outputs as a unified diff. Result blocks selecting a
+// structured comparator, like json-subset, are diffed by path with the match
+// and ignore options of the block, and those selecting other comparators,
+// like contains, are described by the comparator. Returns an empty string
+// when the outputs do not differ or the result block is a regex.
+func OutputDiff(expected parsers.ExpectedOutputBlock, actualOutput string) string {
+	if strings.TrimSpace(expected.ExpectedRegexPattern) != "" {
+		return ""
+	}
+	actualNormalized, expectedNormalized := NormalizeOutputs(actualOutput, expected)
+
+	switch comparatorName(expected.Comparator, expected.Language) {
+	case ComparatorSimilarity, ComparatorJSONSimilarity, ComparatorExact:
+		return diffOutputs(expectedNormalized, actualNormalized, expected.Language)
+	}
+	comparator, err := lookupComparator(expected.Comparator, expected.Language)
+	if err != nil {
+		return ""
+	}
+	expectation := newExpectation(expected, expectedNormalized)
+	if structured, ok := comparator.(structuredComparator); ok {
+		if _, differences, err := structured.differences(actualNormalized, expectation); err == nil {
+			return strings.Join(differences, "\n")
+		}
+	}
+	_, err = comparator.Compare(actualNormalized, expectation)
+	return describeComparatorError(err)
+}
+
+// Describes why a comparator rejected an output: the reason of an output
+// mismatch, without the line diff that ignores how the comparator compares,
+// or the message of any other error.
+func describeComparatorError(err error) string {
+	if err == nil {
+		return ""
+	}
+	var mismatch *outputMismatch
+	if errors.As(err, &mismatch) {
+		return mismatch.reason
+	}
+	return normalizeOutput(err.Error())
+}
+
+func diffOutputs(expected string, actual string, language string) string {
+	if strings.ToLower(language) == "json" {
+		if differences, ok := diffJSONOutputs(expected, actual); ok {
+			return strings.Join(differences, "\n")
+		}
+	}
+	return lib.UnifiedDiff("expected", "actual", expected, actual, diffContextLines)
+}
+
+// Lists the paths at which two JSON documents differ. Returns false if either
+// output is not JSON.
+func diffJSONOutputs(expected string, actual string) ([]string, bool) {
+	expectedDocument, err := parseStructuredDocument(formatJSON, expected)
+	if err != nil {
+		return nil, false
+	}
+	actualDocument, err := parseStructuredDocument(formatJSON, actual)
+	if err != nil {
+		return nil, false
+	}
+	comparison := structuredComparison{match: matchEqual}
+	comparison.compare("$", nil, expectedDocument, actualDocument)
+	return comparison.differences, true
+}
+
+// Colors the lines of a diff for the terminal.
+func RenderDiff(diff string) string {
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	for index, line := range lines {
+		switch {
+		case index < 2 && (strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ")):
+			lines[index] = ui.DiffHeaderStyle.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[index] = ui.DiffHunkStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			lines[index] = ui.DiffRemovedStyle.Render(line)
+		case strings.HasPrefix(line, "+"):
+			lines[index] = ui.DiffAddedStyle.Render(line)
+		default:
+			lines[index] = ui.VerboseStyle.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Formats a diff returned by OutputDiff for the terminal: a title naming the
+// kind of diff followed by its colored lines, of which only the first
+// maxDiffLines are kept.
+func FormatOutputDiff(diff string) string {
+	return fmt.Sprintf("%s:\n%s", diffTitle(diff), RenderDiff(summarizeOutput(diff, maxDiffLines)))
+}
+
+// Describes how the actual output differs from the expected output for error
+// messages, falling back to both outputs if the diff is empty.
+func describeOutputDifference(expected string, actual string, language string) string {
+	diff := diffOutputs(expected, actual, language)
+	if diff == "" {
+		return fmt.Sprintf(
+			"Expected:\n%s\nActual:\n%s",
+			ui.VerboseStyle.Render(summarizeOutput(expected, 20)),
+			ui.VerboseStyle.Render(summarizeOutput(actual, 20)),
+		)
+	}
+	return FormatOutputDiff(diff)
+}
+
+// Names the kind of diff returned by OutputDiff.
+func diffTitle(diff string) string {
+	switch {
+	case strings.HasPrefix(diff, "--- "):
+		return "Difference (-expected +actual)"
+	case strings.HasPrefix(diff, "$"):
+		return "Differences by JSON path"
+	default:
+		return "Difference"
+	}
+}
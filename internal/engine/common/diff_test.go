@@ -0,0 +1,115 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputDiff(t *testing.T) {
+	t.Run("Text outputs are diffed line by line after normalization", func(t *testing.T) {
+		expected := parsers.ExpectedOutputBlock{
+			Content:       "Created 5f1d2e6a-3b4c-4d5e-8f9a-0b1c2d3e4f5a\nState: Running\nDone\n",
+			Normalization: &parsers.OutputNormalization{Masks: []string{parsers.MaskUUID}},
+		}
+
+		diff := OutputDiff(expected, "Created 0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d\r\nState: Stopped\r\nDone\r\n")
+		assert.Equal(t, strings.Join([]string{
+			"--- expected",
+			"+++ actual",
+			"@@ -1,3 +1,3 @@",
+			" Created <uuid>",
+			"-State: Running",
+			"+State: Stopped",
+			" Done",
+			"",
+		}, "\n"), diff)
+	})
+
+	t.Run("JSON outputs are diffed by path", func(t *testing.T) {
+		expected := parsers.ExpectedOutputBlock{
+			Language: "json",
+			Content:  `{"name": "vm1", "tags": {"env": "dev"}, "disks": [1, 2]}`,
+		}
+
+		diff := OutputDiff(expected, `{"name": "vm1", "tags": {"owner": "me"}, "disks": [1, 3]}`)
+		assert.Equal(t, strings.Join([]string{
+			"$.disks[1]: expected 2, got 3",
+			"$.tags.env: missing from the actual output",
+			"$.tags.owner: not in the expected output",
+		}, "\n"), diff)
+	})
+
+	t.Run("Invalid JSON falls back to a line diff", func(t *testing.T) {
+		diff := OutputDiff(parsers.ExpectedOutputBlock{Language: "json", Content: `{"a": 1}`}, "error\n")
+		assert.True(t, strings.HasPrefix(diff, "--- expected\n"), diff)
+	})
+
+	t.Run("Structured comparators are diffed with the options of the result block", func(t *testing.T) {
+		expected := parsers.ExpectedOutputBlock{
+			Language:   "json",
+			Comparator: ComparatorJSONSubset,
+			Options:    map[string]string{"ignore": "id,etag"},
+			Content:    `{"id": "1", "etag": "a", "name": "vm1", "tags": {"env": "dev"}}`,
+		}
+
+		diff := OutputDiff(expected, `{"id": "2", "etag": "b", "name": "vm1", "location": "westus", "tags": {"env": "prod", "owner": "me"}}`)
+		assert.Equal(t, `$.tags.env: expected "dev", got "prod"`, diff)
+		assert.Empty(t, OutputDiff(expected, `{"id": "2", "name": "vm1", "extra": true, "tags": {"env": "dev"}}`))
+
+		yaml := parsers.ExpectedOutputBlock{
+			Language:   "yaml",
+			Comparator: ComparatorYAML,
+			Options:    map[string]string{"match": "structure"},
+			Content:    "name: vm1\ncount: 1\n",
+		}
+		assert.Equal(t, `$.count: expected 1, got "two"`, OutputDiff(yaml, "name: vm2\ncount: two\n"))
+	})
+
+	t.Run("Other comparators describe the difference themselves", func(t *testing.T) {
+		contains := parsers.ExpectedOutputBlock{Comparator: ComparatorContains, Content: "Succeeded\n"}
+		assert.Equal(t, "the actual output does not contain the expected output", OutputDiff(contains, "Failed\n"))
+		assert.Empty(t, OutputDiff(contains, "Provisioning Succeeded\n"))
+
+		table := parsers.ExpectedOutputBlock{Comparator: ComparatorTable, Content: "Name  State\nvm1   Running\n"}
+		assert.Empty(t, OutputDiff(table, "Name  State    Location\nvm1   Running  westus\n"))
+		assert.Contains(t, OutputDiff(table, "Name  State\nvm1   Stopped\n"), `missing rows`)
+	})
+
+	t.Run("Outputs that do not differ and regexes have no diff", func(t *testing.T) {
+		assert.Empty(t, OutputDiff(parsers.ExpectedOutputBlock{Content: "same\n"}, "same"))
+		assert.Empty(t, OutputDiff(parsers.ExpectedOutputBlock{ExpectedRegexPattern: "^a"}, "b"))
+	})
+}
+
+func TestMismatchErrorsShowTheDiff(t *testing.T) {
+	_, err := CompareExpectedOutput("hello\nthere\n", parsers.ExpectedOutputBlock{
+		Content:            "hello\nworld\n",
+		ExpectedSimilarity: 1,
+	})
+	assert.ErrorContains(t, err, "Difference (-expected +actual):")
+	assert.ErrorContains(t, err, "-world\n+there")
+	assert.ErrorContains(t, err, "Expected Score:")
+
+	_, err = CompareExpectedOutput(`{"id": 2}`, parsers.ExpectedOutputBlock{
+		Language:           "json",
+		Content:            `{"id": 1}`,
+		ExpectedSimilarity: 1,
+	})
+	assert.ErrorContains(t, err, "Differences by JSON path:\n$.id: expected 1, got 2")
+}
+
+func TestReportRecordsDiffsOfFailedCodeBlocks(t *testing.T) {
+	expected := parsers.ExpectedOutputBlock{Content: "one\n", ExpectedSimilarity: 1}
+	report := BuildReport("scenario")
+	report.WithCodeBlocks([]StatefulCodeBlock{
+		{CodeBlock: parsers.CodeBlock{ExpectedOutput: expected}, StdOut: "one\n", Success: true},
+		{CodeBlock: parsers.CodeBlock{ExpectedOutput: expected}, StdOut: "two\n", Error: errors.New("mismatch")},
+	})
+
+	assert.Empty(t, report.CodeBlocks[0].Diff)
+	assert.Equal(t, "--- expected\n+++ actual\n@@ -1 +1 @@\n-one\n+two\n", report.CodeBlocks[1].Diff)
+}
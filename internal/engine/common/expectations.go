@@ -0,0 +1,88 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/Azure/InnovationEngine/internal/ui"
+)
+
+// Checks the exit code of a command against the expect-exit attribute of its
+// code block, given the error the command was run with. Returns nil when the
+// command exited as expected, and otherwise an error describing the exit code.
+// Commands that did not run to completion keep their error, as do code blocks
+// without an expectation.
+func CheckExitCode(codeBlock parsers.CodeBlock, output shells.CommandOutput, err error) error {
+	expected := codeBlock.Attributes.ExpectedExitCode
+	if expected == "" || output.ExitCode < 0 {
+		return err
+	}
+
+	if expected.Matches(output.ExitCode) {
+		if err != nil {
+			logging.GlobalLogger.Infof("The command exited with %d as expected", output.ExitCode)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("expected %s: %w", describeExitCodeExpectation(expected), err)
+	}
+	return fmt.Errorf(
+		"expected %s, but the command exited with 0",
+		describeExitCodeExpectation(expected),
+	)
+}
+
+func describeExitCodeExpectation(expected parsers.ExitCodeExpectation) string {
+	switch expected {
+	case parsers.ExitCodeNonZero:
+		return "a non-zero exit code"
+	case parsers.ExitCodeAny:
+		return "any exit code"
+	default:
+		return "exit code " + string(expected)
+	}
+}
+
+// Compares the stdout of a code block with its result block and its stderr
+// with the regex of its expect-stderr attribute.
+func CompareCodeBlockOutputs(codeBlock parsers.CodeBlock, output shells.CommandOutput) (float64, error) {
+	score, err := CompareExpectedOutput(output.StdOut, codeBlock.ExpectedOutput)
+	if err != nil {
+		return score, err
+	}
+	return score, CompareExpectedStdErr(codeBlock, output.StdErr)
+}
+
+// Checks that the stderr of a code block matches the regex of its
+// expect-stderr attribute, if it declares one.
+func CompareExpectedStdErr(codeBlock parsers.CodeBlock, stderr string) error {
+	pattern := codeBlock.Attributes.ExpectedStdErr
+	if strings.TrimSpace(pattern) == "" {
+		return nil
+	}
+
+	_, compiled, usedEnvValues, err := compileRegexWithEnv(pattern)
+	if err != nil {
+		return err
+	}
+	stderr = normalizeOutput(stderr)
+	if compiled.MatchString(stderr) {
+		return nil
+	}
+
+	patternDisplay := pattern
+	if details := formatRegexEnvDetails(usedEnvValues); details != "" {
+		patternDisplay = fmt.Sprintf("%s\n%s", patternDisplay, details)
+	}
+	return fmt.Errorf(
+		ui.ErrorMessageStyle.Render(
+			"Expected stderr does not match actual stderr.\nExpected Pattern:\n%s\nActual:\n%s",
+		),
+		ui.VerboseStyle.Render(patternDisplay),
+		ui.VerboseStyle.Render(summarizeOutput(stderr, 20)),
+	)
+}
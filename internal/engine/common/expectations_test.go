@@ -0,0 +1,77 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckExitCode(t *testing.T) {
+	failed := errors.New("command exited with 'exit status 3'")
+	expecting := func(expectation parsers.ExitCodeExpectation) parsers.CodeBlock {
+		return parsers.CodeBlock{Attributes: parsers.CodeBlockAttributes{ExpectedExitCode: expectation}}
+	}
+
+	assert.Equal(t, failed, CheckExitCode(parsers.CodeBlock{}, shells.CommandOutput{ExitCode: 3}, failed))
+	assert.NoError(t, CheckExitCode(expecting("3"), shells.CommandOutput{ExitCode: 3}, failed))
+	assert.NoError(t, CheckExitCode(expecting(parsers.ExitCodeAny), shells.CommandOutput{ExitCode: 0}, nil))
+
+	err := CheckExitCode(expecting("1"), shells.CommandOutput{ExitCode: 3}, failed)
+	assert.ErrorIs(t, err, failed)
+	assert.ErrorContains(t, err, "expected exit code 1")
+
+	assert.EqualError(
+		t,
+		CheckExitCode(expecting(parsers.ExitCodeNonZero), shells.CommandOutput{ExitCode: 0}, nil),
+		"expected a non-zero exit code, but the command exited with 0",
+	)
+
+	// Commands that were stopped fail regardless of the expectation.
+	stopped := shells.ErrTimeout
+	assert.Equal(t, stopped, CheckExitCode(expecting(parsers.ExitCodeAny), shells.CommandOutput{ExitCode: -1}, stopped))
+}
+
+func TestExecuteCodeBlockChecksExitCodeAndStdErr(t *testing.T) {
+	original := lib.DefaultEnvironmentStateFile
+	lib.DefaultEnvironmentStateFile = filepath.Join(t.TempDir(), "env-vars")
+	t.Cleanup(func() {
+		lib.DefaultEnvironmentStateFile = original
+	})
+
+	execute := func(content string, attributes parsers.CodeBlockAttributes) interface{} {
+		return ExecuteCodeBlock(context.Background(), parsers.CodeBlock{
+			Language:   "bash",
+			Content:    content,
+			Attributes: attributes,
+		}, map[string]string{})
+	}
+
+	expectedFailure := execute(
+		"echo 'AuthorizationFailed: 403' >&2; exit 3",
+		parsers.CodeBlockAttributes{ExpectedExitCode: parsers.ExitCodeNonZero, ExpectedStdErr: "Authorization(Failed)?"},
+	)
+	if assert.IsType(t, SuccessfulCommandMessage{}, expectedFailure) {
+		assert.Equal(t, 3, expectedFailure.(SuccessfulCommandMessage).ExitCode)
+	}
+
+	unexpectedSuccess := execute("echo ok", parsers.CodeBlockAttributes{ExpectedExitCode: "1"})
+	if assert.IsType(t, FailedCommandMessage{}, unexpectedSuccess) {
+		assert.ErrorContains(t, unexpectedSuccess.(FailedCommandMessage).Error, "expected exit code 1, but the command exited with 0")
+	}
+
+	unexpectedStdErr := execute(
+		"echo 'ResourceNotFound' >&2; exit 3",
+		parsers.CodeBlockAttributes{ExpectedExitCode: "3", ExpectedStdErr: "AuthorizationFailed"},
+	)
+	if assert.IsType(t, FailedCommandMessage{}, unexpectedStdErr) {
+		message := unexpectedStdErr.(FailedCommandMessage)
+		assert.Equal(t, 3, message.ExitCode)
+		assert.ErrorContains(t, message.Error, "Expected stderr does not match actual stderr")
+	}
+}
@@ -0,0 +1,171 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// An expected output block that the actual output of its code block no
+// longer matches.
+type ExpectedOutputUpdate struct {
+	StepNumber      int
+	StepName        string
+	CodeBlockNumber int
+	Expected        parsers.ExpectedOutputBlock
+	// The output the code block produced.
+	Actual string
+}
+
+// Comparators whose expected output is the whole actual output. The other
+// comparators expect a part or the shape of the actual output, which is
+// written by hand.
+var replaceableComparators = map[string]bool{
+	"":                       true,
+	ComparatorSimilarity:     true,
+	ComparatorJSONSimilarity: true,
+	ComparatorExact:          true,
+	ComparatorLineSet:        true,
+}
+
+// Checks if the expected output of a code block can be replaced with its
+// actual output. Regex expectations and partial comparisons are written by
+// hand, and the expected outputs of prerequisite verifications decide whether
+// prerequisites run.
+func hasReplaceableExpectedOutput(codeBlock parsers.CodeBlock) bool {
+	if strings.TrimSpace(codeBlock.ExpectedOutput.ExpectedRegexPattern) != "" {
+		return false
+	}
+	if !replaceableComparators[codeBlock.ExpectedOutput.Comparator] {
+		return false
+	}
+	if blockType, _, ok := ParseAutoPrereqMetadata(codeBlock.Content); ok && blockType == "verification" {
+		return false
+	}
+	return codeBlock.ExpectedOutput.Position.IsKnown()
+}
+
+// Returns a copy of the steps in which code blocks with replaceable expected
+// outputs do not compare their output, so that running them collects the
+// actual outputs instead of stopping at the first mismatch.
+func WithoutReplaceableExpectedOutputs(steps []Step) []Step {
+	stripped := make([]Step, len(steps))
+	for stepNumber, step := range steps {
+		stripped[stepNumber] = step
+		stripped[stepNumber].CodeBlocks = make([]parsers.CodeBlock, len(step.CodeBlocks))
+		for blockNumber, codeBlock := range step.CodeBlocks {
+			if hasReplaceableExpectedOutput(codeBlock) {
+				codeBlock.ExpectedOutput = parsers.ExpectedOutputBlock{}
+			}
+			stripped[stepNumber].CodeBlocks[blockNumber] = codeBlock
+		}
+	}
+	return stripped
+}
+
+// Lists the replaceable expected outputs of steps that the code blocks which
+// ran successfully did not produce, as allowed by their expected similarity.
+func FindOutdatedExpectedOutputs(steps []Step, codeBlocks []StatefulCodeBlock) []ExpectedOutputUpdate {
+	var updates []ExpectedOutputUpdate
+	for _, codeBlock := range codeBlocks {
+		if !codeBlock.Success ||
+			codeBlock.StepNumber >= len(steps) ||
+			codeBlock.CodeBlockNumber >= len(steps[codeBlock.StepNumber].CodeBlocks) {
+			continue
+		}
+		original := steps[codeBlock.StepNumber].CodeBlocks[codeBlock.CodeBlockNumber]
+		if !hasReplaceableExpectedOutput(original) {
+			continue
+		}
+
+		expected := original.ExpectedOutput
+		_, err := CompareExpectedOutput(codeBlock.StdOut, expected)
+		if err == nil {
+			continue
+		}
+		updates = append(updates, ExpectedOutputUpdate{
+			StepNumber:      codeBlock.StepNumber,
+			StepName:        codeBlock.StepName,
+			CodeBlockNumber: codeBlock.CodeBlockNumber,
+			Expected:        expected,
+			Actual:          normalizeOutput(codeBlock.StdOut),
+		})
+	}
+	return updates
+}
+
+// Describes how the actual output differs from the expected output as a
+// unified diff.
+func (update ExpectedOutputUpdate) Diff() string {
+	return lib.UnifiedDiff("expected", "actual", update.Expected.Content, update.Actual, diffContextLines)
+}
+
+// Replaces the expected output blocks with the actual outputs in the markdown
+// files they were read from. Documents loaded from URLs are left alone, and
+// expected outputs that cannot be replaced are reported without stopping the
+// others from being replaced. Returns the number of expected outputs replaced
+// in each file.
+func ApplyExpectedOutputUpdates(updates []ExpectedOutputUpdate) (map[string]int, error) {
+	updatesByFile := make(map[string][]ExpectedOutputUpdate)
+	seen := make(map[parsers.SourcePosition]bool)
+	for _, update := range updates {
+		position := update.Expected.Position
+		if isRemotePath(position.File) {
+			logging.GlobalLogger.Warnf("Not updating the expected output at %s, the document was loaded from a URL", position)
+			continue
+		}
+		// Documents included more than once share their expected outputs.
+		if seen[position] {
+			continue
+		}
+		seen[position] = true
+		updatesByFile[position.File] = append(updatesByFile[position.File], update)
+	}
+
+	updated := make(map[string]int)
+	var errs []error
+	for file, fileUpdates := range updatesByFile {
+		info, err := os.Stat(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// Later code blocks are replaced first so that the positions of
+		// earlier ones stay valid.
+		sort.Slice(fileUpdates, func(i, j int) bool {
+			return fileUpdates[i].Expected.Position.StartLine > fileUpdates[j].Expected.Position.StartLine
+		})
+		replaced := 0
+		for _, update := range fileUpdates {
+			rewritten, err := parsers.ReplaceFencedCodeBlockContent(source, update.Expected.Position, update.Actual)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to update the expected output at %s: %w", update.Expected.Position, err))
+				continue
+			}
+			source = rewritten
+			replaced++
+		}
+		if replaced == 0 {
+			continue
+		}
+
+		if err := os.WriteFile(file, source, info.Mode().Perm()); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		updated[file] = replaced
+	}
+	return updated, errors.Join(errs...)
+}
@@ -0,0 +1,143 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+const expectedOutputsMarkdown = `# Expected outputs
+
+## Literal
+
+` + "```bash" + `
+echo hello
+` + "```" + `
+
+<!-- expected_similarity=1.0 -->
+
+` + "```text" + `
+goodbye
+` + "```" + `
+
+## Regex
+
+` + "```bash" + `
+echo id-42
+` + "```" + `
+
+<!-- expected_similarity="id-[0-9]+" -->
+
+` + "```text" + `
+id-1
+` + "```" + `
+
+## Similar
+
+` + "```bash" + `
+echo "hello world"
+` + "```" + `
+
+<!-- expected_similarity=0.5 -->
+
+` + "```text" + `
+hello there
+` + "```" + `
+`
+
+func loadExpectedOutputsScenario(t *testing.T) (*Scenario, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.md")
+	assert.NoError(t, os.WriteFile(path, []byte(expectedOutputsMarkdown), 0o644))
+	scenario, err := CreateScenarioFromMarkdown(path, []string{"bash"}, nil)
+	assert.NoError(t, err)
+	return scenario, path
+}
+
+func ranSuccessfully(step int, name string, stdOut string) StatefulCodeBlock {
+	return StatefulCodeBlock{StepNumber: step, StepName: name, StdOut: stdOut, Success: true}
+}
+
+func TestWithoutReplaceableExpectedOutputs(t *testing.T) {
+	scenario, _ := loadExpectedOutputsScenario(t)
+
+	stripped := WithoutReplaceableExpectedOutputs(scenario.Steps)
+
+	assert.Empty(t, stripped[0].CodeBlocks[0].ExpectedOutput.Content)
+	assert.Equal(t, "id-[0-9]+", stripped[1].CodeBlocks[0].ExpectedOutput.ExpectedRegexPattern)
+	assert.Empty(t, stripped[2].CodeBlocks[0].ExpectedOutput.Content)
+	// The steps of the scenario are left as they are.
+	assert.Equal(t, "goodbye\n", scenario.Steps[0].CodeBlocks[0].ExpectedOutput.Content)
+}
+
+func TestFindOutdatedExpectedOutputs(t *testing.T) {
+	scenario, _ := loadExpectedOutputsScenario(t)
+
+	t.Run("Only mismatching literal expectations are outdated", func(t *testing.T) {
+		updates := FindOutdatedExpectedOutputs(scenario.Steps, []StatefulCodeBlock{
+			ranSuccessfully(0, "Literal", "hello\n"),
+			ranSuccessfully(1, "Regex", "something else\n"),
+			ranSuccessfully(2, "Similar", "hello world\n"),
+		})
+
+		assert.Len(t, updates, 1)
+		assert.Equal(t, "Literal", updates[0].StepName)
+		assert.Equal(t, "hello\n", updates[0].Actual)
+		assert.Equal(t, "--- expected\n+++ actual\n@@ -1 +1 @@\n-goodbye\n+hello\n", updates[0].Diff())
+	})
+
+	t.Run("Code blocks that failed are not outdated", func(t *testing.T) {
+		failed := ranSuccessfully(0, "Literal", "hello\n")
+		failed.Success = false
+
+		assert.Empty(t, FindOutdatedExpectedOutputs(scenario.Steps, []StatefulCodeBlock{failed}))
+	})
+
+	t.Run("Prerequisite verifications are not outdated", func(t *testing.T) {
+		steps := []Step{{
+			Name: "Prerequisites",
+			CodeBlocks: []parsers.CodeBlock{{
+				Content: "# ie:auto-prereq-verification marker=\"/tmp/marker\" display=\"Login\" source=\"login.md\"\necho hello\n",
+				ExpectedOutput: parsers.ExpectedOutputBlock{
+					Content:            "goodbye\n",
+					ExpectedSimilarity: 1,
+					Position:           parsers.SourcePosition{File: "login.md", StartLine: 5, EndLine: 7},
+				},
+			}},
+		}}
+
+		assert.Empty(t, FindOutdatedExpectedOutputs(steps, []StatefulCodeBlock{ranSuccessfully(0, "Prerequisites", "hello\n")}))
+	})
+}
+
+func TestApplyExpectedOutputUpdates(t *testing.T) {
+	scenario, path := loadExpectedOutputsScenario(t)
+	literal := scenario.Steps[0].CodeBlocks[0].ExpectedOutput
+	similar := scenario.Steps[2].CodeBlocks[0].ExpectedOutput
+
+	updated, err := ApplyExpectedOutputUpdates([]ExpectedOutputUpdate{
+		{Expected: literal, Actual: "hello\nagain\n"},
+		{Expected: similar, Actual: "hello world\n"},
+		// Included documents may report the same expected output twice.
+		{Expected: literal, Actual: "hello\nagain\n"},
+		{Expected: parsers.ExpectedOutputBlock{
+			Position: parsers.SourcePosition{File: "https://example.com/scenario.md", StartLine: 3, EndLine: 5},
+		}, Actual: "remote\n"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{path: 2}, updated)
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	rewritten, err := CreateScenarioFromMarkdown(path, []string{"bash"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\nagain\n", rewritten.Steps[0].CodeBlocks[0].ExpectedOutput.Content)
+	assert.Equal(t, 1.0, rewritten.Steps[0].CodeBlocks[0].ExpectedOutput.ExpectedSimilarity)
+	assert.Equal(t, "id-1\n", rewritten.Steps[1].CodeBlocks[0].ExpectedOutput.Content)
+	assert.Equal(t, "hello world\n", rewritten.Steps[2].CodeBlocks[0].ExpectedOutput.Content)
+	assert.Contains(t, string(content), "<!-- expected_similarity=0.5 -->")
+}
@@ -0,0 +1,249 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The paragraph inserted before code blocks that are missing a description.
+const descriptionPlaceholder = "TODO: Describe what the following command does."
+
+// A replacement of the bytes [start, end) of a document.
+type textEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+func (edit textEdit) overlaps(other textEdit) bool {
+	if edit.start == edit.end && other.start == other.end {
+		return edit.start == other.start
+	}
+	return edit.start < other.end && other.start < edit.end
+}
+
+// Computes the edits resolving an issue in the source of the document it was
+// found in. Returns no edits if the issue cannot be resolved automatically.
+type issueFixer func(source []byte) []textEdit
+
+// Marks the issue as one that FixValidationIssues can resolve.
+func (issue ValidationIssue) withFix(fix issueFixer) ValidationIssue {
+	issue.Fixable = true
+	issue.fix = fix
+	return issue
+}
+
+// FixValidationIssues resolves the fixable issues found in the document of the
+// scenario, leaving every other byte of its source as it is. Issues found in
+// prerequisites and includes are not fixed. Returns the fixed source and the
+// issues it resolves.
+func FixValidationIssues(s *Scenario, issues []ValidationIssue) ([]byte, []ValidationIssue) {
+	var edits []textEdit
+	var fixed []ValidationIssue
+	for _, issue := range issues {
+		if issue.fix == nil || issue.Position.File != s.SourcePath {
+			continue
+		}
+
+		issueEdits := issue.fix(s.Source)
+		if len(issueEdits) == 0 {
+			continue
+		}
+
+		// Issues are fixed in order, skipping those whose edits conflict with
+		// the fixes of earlier issues. Fixes making the same edit, like those
+		// of issues reported twice, do not conflict.
+		var newEdits []textEdit
+		conflicts := false
+		for _, edit := range issueEdits {
+			duplicate := false
+			for _, accepted := range edits {
+				if accepted == edit {
+					duplicate = true
+				} else if accepted.overlaps(edit) {
+					conflicts = true
+				}
+			}
+			if !duplicate {
+				newEdits = append(newEdits, edit)
+			}
+		}
+		if conflicts {
+			continue
+		}
+		edits = append(edits, newEdits...)
+		fixed = append(fixed, issue)
+	}
+	return applyTextEdits(s.Source, edits), fixed
+}
+
+func applyTextEdits(source []byte, edits []textEdit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	var fixed bytes.Buffer
+	offset := 0
+	for _, edit := range edits {
+		fixed.Write(source[offset:edit.start])
+		fixed.WriteString(edit.text)
+		offset = edit.end
+	}
+	fixed.Write(source[offset:])
+	return fixed.Bytes()
+}
+
+// Returns the offsets of the first byte of a line and of its newline, or the
+// end of the source for the last line. Lines are numbered from 1.
+func lineBounds(source []byte, line int) (int, int, bool) {
+	start := 0
+	for current := 1; current < line; current++ {
+		next := bytes.IndexByte(source[start:], '\n')
+		if next < 0 {
+			return 0, 0, false
+		}
+		start += next + 1
+	}
+	end := bytes.IndexByte(source[start:], '\n')
+	if end < 0 {
+		return start, len(source), true
+	}
+	return start, start + end, true
+}
+
+func sourceLine(source []byte, line int) (string, bool) {
+	start, end, ok := lineBounds(source, line)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSuffix(string(source[start:end]), "\r"), true
+}
+
+// Splits a line opening a code block into its indentation and fence.
+func splitFence(line string) (string, string) {
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	rest := line[len(indent):]
+	if rest == "" || (rest[0] != '`' && rest[0] != '~') {
+		return indent, ""
+	}
+	fence := rest[:len(rest)-len(strings.TrimLeft(rest, rest[:1]))]
+	if len(fence) < 3 {
+		return indent, ""
+	}
+	return indent, fence
+}
+
+// Adds a language to the code block opening on the given line: text for the
+// result of the code block before it and bash otherwise.
+func insertLanguageTag(line int) issueFixer {
+	return func(source []byte) []textEdit {
+		text, ok := sourceLine(source, line)
+		if !ok {
+			return nil
+		}
+		indent, fence := splitFence(text)
+		if fence == "" {
+			return nil
+		}
+		language := "bash"
+		if isResultBlock(source, line) {
+			language = "text"
+		}
+		if rest := text[len(indent)+len(fence):]; rest != "" && !strings.HasPrefix(rest, " ") {
+			language += " "
+		}
+		start, _, _ := lineBounds(source, line)
+		offset := start + len(indent) + len(fence)
+		return []textEdit{{start: offset, end: offset, text: language}}
+	}
+}
+
+// Checks if the code block opening on the given line directly follows another
+// code block or an expected_similarity comment, i.e. holds the output of a
+// code block.
+func isResultBlock(source []byte, line int) bool {
+	for previous := line - 1; previous > 0; previous-- {
+		text, _ := sourceLine(source, previous)
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "<!--") && strings.HasSuffix(trimmed, "-->"):
+			if strings.Contains(trimmed, "expected_similarity") {
+				return true
+			}
+			continue
+		default:
+			_, fence := splitFence(text)
+			return fence != ""
+		}
+	}
+	return false
+}
+
+// Inserts a placeholder paragraph before the code block opening on the given
+// line.
+func insertDescriptionPlaceholder(line int) issueFixer {
+	return func(source []byte) []textEdit {
+		text, ok := sourceLine(source, line)
+		if !ok {
+			return nil
+		}
+		indent, fence := splitFence(text)
+		if fence == "" {
+			return nil
+		}
+		start, end, _ := lineBounds(source, line)
+		newline := "\n"
+		if end > start && source[end-1] == '\r' {
+			newline = "\r\n"
+		}
+		paragraph := indent + descriptionPlaceholder + newline + newline
+		if line > 1 {
+			if previous, _ := sourceLine(source, line-1); strings.TrimSpace(previous) != "" {
+				paragraph = newline + paragraph
+			}
+		}
+		return []textEdit{{start: start, end: start, text: paragraph}}
+	}
+}
+
+// Renames a variable where code blocks assign, export or expand it. Returns no
+// edits if the document already uses the new name.
+func renameVariable(name string, newName string) issueFixer {
+	return func(source []byte) []textEdit {
+		if variableUsageRegex(newName).Match(source) {
+			return nil
+		}
+		pattern := regexp.MustCompile(fmt.Sprintf(
+			`(?:\$\{?|\b(?:export|unset|readonly|local)\s+)(%[1]s)\b|(?:^|[\s;&|(])(%[1]s)=`,
+			regexp.QuoteMeta(name),
+		))
+
+		var edits []textEdit
+		for _, block := range fencedCodeBlockLines(source) {
+			for line := block.StartLine + 1; line < block.EndLine; line++ {
+				text, _ := sourceLine(source, line)
+				start, _, _ := lineBounds(source, line)
+				for _, match := range pattern.FindAllStringSubmatchIndex(text, -1) {
+					group := 2
+					if match[group] < 0 {
+						group = 4
+					}
+					edits = append(edits, textEdit{
+						start: start + match[group],
+						end:   start + match[group+1],
+						text:  newName,
+					})
+				}
+			}
+		}
+		return edits
+	}
+}
+
+func variableUsageRegex(name string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`\$\{?%[1]s\b|\b%[1]s=`, regexp.QuoteMeta(name)))
+}
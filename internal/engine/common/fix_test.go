@@ -0,0 +1,65 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fixDocument(t *testing.T, source string, config InspectConfig) (string, []ValidationIssue) {
+	t.Helper()
+	scenario, err := CreateScenarioFromMarkdownSource([]byte(source), "scenario.md", []string{"bash"}, nil)
+	require.NoError(t, err)
+	fixed, issues := FixValidationIssues(scenario, ValidateScenarioForInspect(scenario, config))
+	return string(fixed), issues
+}
+
+func TestFixValidationIssues(t *testing.T) {
+	source := "# Scenario\r\n\r\n## Step\r\n```bash {timeout=60}\r\nexport app_name=demo  # keep this comment\r\necho \"$app_name\" ${app_name:-none} app_name\r\n```\r\n\r\nShows the output.\r\n\r\n  ~~~~\r\n  echo hi\r\n  ~~~~\r\n\r\n<!-- expected_similarity=0.8 -->\r\n```{trim=true}\r\nhi\r\n```\r\n"
+	fixed, issues := fixDocument(t, source, InspectConfig{})
+
+	assert.Equal(t, "# Scenario\r\n\r\n## Step\r\n\r\nTODO: Describe what the following command does.\r\n\r\n```bash {timeout=60}\r\nexport APP_NAME=demo  # keep this comment\r\necho \"$APP_NAME\" ${APP_NAME:-none} app_name\r\n```\r\n\r\nShows the output.\r\n\r\n  ~~~~bash\r\n  echo hi\r\n  ~~~~\r\n\r\n<!-- expected_similarity=0.8 -->\r\n```text {trim=true}\r\nhi\r\n```\r\n", fixed)
+
+	var rules []string
+	for _, issue := range issues {
+		rules = append(rules, issue.RuleID)
+	}
+	assert.ElementsMatch(t, []string{RuleMissingDescription, RuleMissingLanguage, RuleMissingLanguage, RuleEnvPrefix}, rules)
+}
+
+func TestFixValidationIssuesRenamesToAllowedPrefix(t *testing.T) {
+	source := "# Scenario\n\n## Step\n\nCreates the group.\n\n```bash\nexport APP_GROUP=demo\naz group create --name $APP_GROUP\n```\n"
+	fixed, issues := fixDocument(t, source, InspectConfig{AllowedPrefixes: []string{"AKS"}})
+	assert.Len(t, issues, 1)
+	assert.Contains(t, fixed, "export AKS_APP_GROUP=demo\naz group create --name $AKS_APP_GROUP\n")
+}
+
+func TestFixValidationIssuesKeepsExistingNames(t *testing.T) {
+	// Renaming would merge the two variables, so the issue is left alone.
+	source := "# Scenario\n\n## Step\n\nCreates the group.\n\n```bash\nexport app_name=one\nexport APP_NAME=two\necho $app_name $APP_NAME\n```\n"
+	fixed, issues := fixDocument(t, source, InspectConfig{})
+	assert.Empty(t, issues)
+	assert.Equal(t, source, fixed)
+}
+
+func TestFixValidationIssuesDoesNotInventPrefixes(t *testing.T) {
+	// Without allowed prefixes, NAME can only be renamed to the placeholder
+	// PREFIX_NAME, which is left to the author.
+	source := "# Scenario\n\n## Step\n\nCreates the group.\n\n```bash\nexport NAME=demo\naz group create --name $NAME\n```\n"
+	fixed, issues := fixDocument(t, source, InspectConfig{})
+	assert.Empty(t, issues)
+	assert.Equal(t, source, fixed)
+
+	scenario, err := CreateScenarioFromMarkdownSource([]byte(source), "scenario.md", []string{"bash"}, nil)
+	require.NoError(t, err)
+	var prefixIssues []ValidationIssue
+	for _, issue := range ValidateScenarioForInspect(scenario, InspectConfig{}) {
+		if issue.RuleID == RuleEnvPrefix {
+			prefixIssues = append(prefixIssues, issue)
+		}
+	}
+	require.Len(t, prefixIssues, 1)
+	assert.Equal(t, "Rename the variable to PREFIX_NAME.", prefixIssues[0].Suggestion)
+	assert.False(t, prefixIssues[0].Fixable)
+}
@@ -0,0 +1,314 @@
+package common
+
+import (
+	"html/template"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// The data rendered by the HTML report template.
+type htmlReport struct {
+	Name                 string
+	Success              bool
+	Error                string
+	Introduction         template.HTML
+	Duration             string
+	Passed               int
+	Failed               int
+	Skipped              int
+	EnvironmentVariables []htmlVariable
+	Prerequisites        []htmlPrerequisite
+	Steps                []htmlStep
+}
+
+type htmlVariable struct {
+	Name  string
+	Value string
+}
+
+// A prerequisite document run before the scenario, with the code blocks that
+// verify whether it is needed and the code blocks that carry it out.
+type htmlPrerequisite struct {
+	Name         string
+	Status       string
+	Verification []htmlCodeBlock
+	Execution    []htmlCodeBlock
+}
+
+type htmlStep struct {
+	Number     int
+	Name       string
+	Status     string
+	CodeBlocks []htmlCodeBlock
+}
+
+type htmlCodeBlock struct {
+	Number      int
+	Status      string
+	Description template.HTML
+	Language    string
+	Command     string
+	// The expected output, or the pattern it must match.
+	Expected           string
+	ExpectedRegex      bool
+	ExpectedSimilarity float64
+	SimilarityScore    float64
+	Diff               []htmlDiffLine
+	StdOut             string
+	StdErr             string
+	ExitCode           int
+	ExpectedExitCode   string
+	ExpectedStdErr     string
+	Error              string
+	Duration           string
+	Attempts           int
+}
+
+// A line of the difference between the expected and actual output. Kind is
+// one of "same", "removed" (only expected), "added" (only actual), "hunk" (the
+// lines a part of a unified diff covers) or "path" (a JSON path that
+// differs).
+type htmlDiffLine struct {
+	Kind string
+	Text string
+}
+
+const (
+	htmlStatusPassed  = "passed"
+	htmlStatusFailed  = "failed"
+	htmlStatusSkipped = "skipped"
+)
+
+// Renders markdown for the report, falling back to the escaped text if it
+// cannot be rendered.
+func renderReportMarkdown(markdown string) template.HTML {
+	if strings.TrimSpace(markdown) == "" {
+		return ""
+	}
+	rendered, err := parsers.RenderMarkdownToHTML([]byte(markdown))
+	if err != nil {
+		logging.GlobalLogger.Warnf("Failed to render markdown for the report: %v", err)
+		return template.HTML(template.HTMLEscapeString(markdown))
+	}
+	// Raw HTML is left out by the renderer, so the result is safe to embed.
+	return template.HTML(rendered)
+}
+
+// Splits a diff returned by OutputDiff into the lines shown by the report,
+// leaving out the headers of unified diffs.
+func htmlDiffLines(diff string) []htmlDiffLine {
+	if diff == "" {
+		return nil
+	}
+	var diffLines []htmlDiffLine
+	for index, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		unified := strings.HasPrefix(diff, "--- ")
+		switch {
+		case unified && index < 2:
+			continue
+		case !unified:
+			diffLines = append(diffLines, htmlDiffLine{Kind: "path", Text: line})
+		case strings.HasPrefix(line, "@@"):
+			diffLines = append(diffLines, htmlDiffLine{Kind: "hunk", Text: line})
+		case strings.HasPrefix(line, "-"):
+			diffLines = append(diffLines, htmlDiffLine{Kind: "removed", Text: line[1:]})
+		case strings.HasPrefix(line, "+"):
+			diffLines = append(diffLines, htmlDiffLine{Kind: "added", Text: line[1:]})
+		default:
+			diffLines = append(diffLines, htmlDiffLine{Kind: "same", Text: strings.TrimPrefix(line, " ")})
+		}
+	}
+	return diffLines
+}
+
+func formatReportDuration(duration time.Duration) string {
+	if duration < time.Second {
+		return duration.Round(time.Millisecond).String()
+	}
+	return duration.Round(100 * time.Millisecond).String()
+}
+
+func newHTMLCodeBlock(codeBlock StatefulCodeBlock, command string) htmlCodeBlock {
+	block := htmlCodeBlock{
+		Number:          codeBlock.CodeBlockNumber + 1,
+		Status:          htmlStatusPassed,
+		Description:     renderReportMarkdown(codeBlock.CodeBlock.Description),
+		Language:        codeBlock.CodeBlock.Language,
+		Command:         command,
+		SimilarityScore: codeBlock.SimilarityScore,
+		StdOut:          codeBlock.StdOut,
+		StdErr:          codeBlock.StdErr,
+		ExitCode:        codeBlock.ExitCode,
+		Duration:        formatReportDuration(codeBlock.Duration),
+		Attempts:        len(codeBlock.Attempts),
+	}
+
+	switch {
+	case !codeBlock.WasExecuted():
+		block.Status = htmlStatusSkipped
+	case !codeBlock.Success:
+		block.Status = htmlStatusFailed
+		if codeBlock.Error != nil {
+			block.Error = codeBlock.Error.Error()
+		}
+	}
+
+	block.ExpectedExitCode = string(codeBlock.CodeBlock.Attributes.ExpectedExitCode)
+	block.ExpectedStdErr = codeBlock.CodeBlock.Attributes.ExpectedStdErr
+
+	expectedOutput := codeBlock.CodeBlock.ExpectedOutput
+	if expectedOutput.Content != "" {
+		block.Expected = expectedOutput.Content
+		block.ExpectedSimilarity = expectedOutput.ExpectedSimilarity
+		if codeBlock.WasExecuted() {
+			block.Diff = htmlDiffLines(OutputDiff(expectedOutput, codeBlock.StdOut))
+		}
+	} else if strings.TrimSpace(expectedOutput.ExpectedRegexPattern) != "" {
+		block.Expected = expectedOutput.ExpectedRegexPattern
+		block.ExpectedRegex = true
+	}
+	return block
+}
+
+// Combines the status of several code blocks: failed if any failed, skipped
+// if none ran, passed otherwise.
+func combinedStatus(codeBlocks ...[]htmlCodeBlock) string {
+	status := htmlStatusSkipped
+	for _, blocks := range codeBlocks {
+		for _, block := range blocks {
+			switch block.Status {
+			case htmlStatusFailed:
+				return htmlStatusFailed
+			case htmlStatusPassed:
+				status = htmlStatusPassed
+			}
+		}
+	}
+	return status
+}
+
+// Builds the data of the HTML report. Code blocks injected to run
+// prerequisite documents are shown as a tree of prerequisites rather than as
+// part of the steps, and code blocks that did not run are shown as skipped.
+func (report *Report) toHTML() htmlReport {
+	codeBlocks := make([]StatefulCodeBlock, len(report.CodeBlocks))
+	copy(codeBlocks, report.CodeBlocks)
+	sort.SliceStable(codeBlocks, func(i, j int) bool {
+		if codeBlocks[i].StepNumber != codeBlocks[j].StepNumber {
+			return codeBlocks[i].StepNumber < codeBlocks[j].StepNumber
+		}
+		return codeBlocks[i].CodeBlockNumber < codeBlocks[j].CodeBlockNumber
+	})
+
+	page := htmlReport{
+		Name:         report.Name,
+		Success:      report.Success,
+		Error:        report.Error,
+		Introduction: renderReportMarkdown(report.Introduction),
+	}
+
+	names := make([]string, 0, len(report.EnvironmentVariables))
+	for name := range report.EnvironmentVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		page.EnvironmentVariables = append(page.EnvironmentVariables, htmlVariable{
+			Name:  name,
+			Value: report.EnvironmentVariables[name],
+		})
+	}
+
+	var total time.Duration
+	prerequisites := make(map[string]int)
+	for _, codeBlock := range codeBlocks {
+		total += codeBlock.Duration
+		blockType, metadata, isPrerequisite := ParseAutoPrereqMetadata(codeBlock.CodeBlock.Content)
+		if isPrerequisite {
+			// Banners only announce prerequisites in the terminal.
+			if blockType != "verification" && blockType != "body" {
+				continue
+			}
+			command := StripPrereqBodyWrapper(StripAutoPrereqComment(codeBlock.CodeBlock.Content))
+			block := newHTMLCodeBlock(codeBlock, command)
+			page.count(block)
+
+			index, seen := prerequisites[metadata["display"]]
+			if !seen {
+				index = len(page.Prerequisites)
+				prerequisites[metadata["display"]] = index
+				page.Prerequisites = append(page.Prerequisites, htmlPrerequisite{Name: metadata["display"]})
+			}
+			prerequisite := &page.Prerequisites[index]
+			if blockType == "verification" {
+				prerequisite.Verification = append(prerequisite.Verification, block)
+			} else {
+				prerequisite.Execution = append(prerequisite.Execution, block)
+			}
+			continue
+		}
+
+		block := newHTMLCodeBlock(codeBlock, codeBlock.CodeBlock.Content)
+		page.count(block)
+		if len(page.Steps) == 0 || page.Steps[len(page.Steps)-1].Number != codeBlock.StepNumber+1 {
+			page.Steps = append(page.Steps, htmlStep{Number: codeBlock.StepNumber + 1, Name: codeBlock.StepName})
+		}
+		step := &page.Steps[len(page.Steps)-1]
+		step.CodeBlocks = append(step.CodeBlocks, block)
+	}
+
+	for i := range page.Prerequisites {
+		page.Prerequisites[i].Status = combinedStatus(page.Prerequisites[i].Verification, page.Prerequisites[i].Execution)
+	}
+	for i := range page.Steps {
+		page.Steps[i].Status = combinedStatus(page.Steps[i].CodeBlocks)
+	}
+	page.Duration = formatReportDuration(total)
+	return page
+}
+
+func (page *htmlReport) count(block htmlCodeBlock) {
+	switch block.Status {
+	case htmlStatusPassed:
+		page.Passed++
+	case htmlStatusFailed:
+		page.Failed++
+	default:
+		page.Skipped++
+	}
+}
+
+// Writes the report as a single HTML page with no external resources, so it
+// can be attached to CI runs and shared as is.
+func (report *Report) WriteToHTMLFile(outputPath string) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := htmlReportTemplate.Execute(file, report.toHTML()); err != nil {
+		return err
+	}
+
+	logging.GlobalLogger.Infof("Wrote the HTML test report to %s", outputPath)
+	return nil
+}
+
+// Formats a similarity score between 0 and 1 as a percentage.
+func formatPercent(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1000)/10, 'f', -1, 64) + "%"
+}
+
+var htmlReportTemplate = template.Must(
+	template.New("report").
+		Funcs(template.FuncMap{"percent": formatPercent}).
+		Parse(htmlReportSource),
+)
@@ -0,0 +1,142 @@
+package common
+
+// The page of HTML reports. Styles are inlined and collapsible sections use
+// <details>, so the page works without scripts or network access.
+const htmlReportSource = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}} - Innovation Engine report</title>
+<style>
+  :root {
+    --passed: #1a7f37;
+    --failed: #cf222e;
+    --skipped: #6e7781;
+    --border: #d0d7de;
+    --muted: #f6f8fa;
+  }
+  body {
+    font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif;
+    line-height: 1.5;
+    color: #1f2328;
+    max-width: 1100px;
+    margin: 0 auto;
+    padding: 2rem 1.5rem;
+  }
+  h1 { margin-bottom: 0.25rem; }
+  pre {
+    background: var(--muted);
+    border: 1px solid var(--border);
+    border-radius: 6px;
+    padding: 0.75rem;
+    overflow-x: auto;
+    white-space: pre-wrap;
+    word-break: break-word;
+  }
+  table { border-collapse: collapse; }
+  th, td { border: 1px solid var(--border); padding: 0.25rem 0.75rem; text-align: left; }
+  details { border: 1px solid var(--border); border-radius: 6px; margin: 0.75rem 0; padding: 0 1rem; }
+  details[open] { padding-bottom: 0.75rem; }
+  summary { cursor: pointer; padding: 0.5rem 0; font-weight: 600; }
+  .badge { border-radius: 1rem; color: #fff; font-size: 0.8rem; padding: 0.1rem 0.6rem; margin-right: 0.5rem; }
+  .badge.passed { background: var(--passed); }
+  .badge.failed { background: var(--failed); }
+  .badge.skipped { background: var(--skipped); }
+  .summary { display: flex; gap: 1.5rem; flex-wrap: wrap; margin: 1rem 0; }
+  .meta { color: var(--skipped); font-size: 0.9rem; }
+  .error { color: var(--failed); }
+  .diff .line { display: block; }
+  .diff .removed { background: #ffebe9; }
+  .diff .removed::before { content: "- "; }
+  .diff .added { background: #dafbe1; }
+  .diff .added::before { content: "+ "; }
+  .diff .same::before { content: "  "; }
+  .diff .hunk { color: var(--skipped); }
+  .codeblock { border-top: 1px solid var(--border); padding-top: 0.5rem; margin-top: 0.75rem; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<div class="summary">
+  <div>{{if .Success}}<span class="badge passed">Passed</span>{{else}}<span class="badge failed">Failed</span>{{end}}</div>
+  <div><strong>{{.Passed}}</strong> passed</div>
+  <div><strong>{{.Failed}}</strong> failed</div>
+  <div><strong>{{.Skipped}}</strong> skipped</div>
+  <div>Duration <strong>{{.Duration}}</strong></div>
+</div>
+{{if .Error}}<pre class="error">{{.Error}}</pre>{{end}}
+{{if .Introduction}}<section>{{.Introduction}}</section>{{end}}
+
+{{if .EnvironmentVariables}}
+<details>
+<summary>Environment variables ({{len .EnvironmentVariables}})</summary>
+<table>
+<tr><th>Name</th><th>Value</th></tr>
+{{range .EnvironmentVariables}}<tr><td><code>{{.Name}}</code></td><td><code>{{.Value}}</code></td></tr>
+{{end}}</table>
+</details>
+{{end}}
+
+{{if .Prerequisites}}
+<h2>Prerequisites</h2>
+{{range .Prerequisites}}
+<details{{if eq .Status "failed"}} open{{end}}>
+<summary><span class="badge {{.Status}}">{{.Status}}</span>{{.Name}}</summary>
+{{if .Verification}}
+<details>
+<summary>Verification</summary>
+{{range .Verification}}{{template "codeblock" .}}{{end}}
+</details>
+{{end}}
+{{if .Execution}}
+<details{{if eq .Status "failed"}} open{{end}}>
+<summary>Execution</summary>
+{{range .Execution}}{{template "codeblock" .}}{{end}}
+</details>
+{{end}}
+</details>
+{{end}}
+{{end}}
+
+<h2>Steps</h2>
+{{range .Steps}}
+<details{{if ne .Status "skipped"}} open{{end}}>
+<summary><span class="badge {{.Status}}">{{.Status}}</span>Step {{.Number}}: {{.Name}}</summary>
+{{range .CodeBlocks}}{{template "codeblock" .}}{{end}}
+</details>
+{{end}}
+</body>
+</html>
+{{define "codeblock"}}
+<div class="codeblock">
+<div class="meta">
+  <span class="badge {{.Status}}">{{.Status}}</span>Code block {{.Number}}
+  {{if ne .Status "skipped"}} &middot; {{.Duration}}{{if gt .Attempts 1}} &middot; {{.Attempts}} attempts{{end}}{{end}}
+  {{if and (ne .Status "skipped") (or .ExitCode .ExpectedExitCode)}} &middot; exit code {{.ExitCode}}{{if .ExpectedExitCode}} (expected {{.ExpectedExitCode}}){{end}}{{end}}
+  {{if and .Expected (not .ExpectedRegex) (ne .Status "skipped")}} &middot; similarity {{percent .SimilarityScore}} (expected {{percent .ExpectedSimilarity}}){{end}}
+</div>
+{{.Description}}
+<pre><code>{{.Command}}</code></pre>
+{{if .Error}}<pre class="error">{{.Error}}</pre>{{end}}
+{{if .Diff}}
+<p><strong>Expected vs. actual output</strong></p>
+<pre class="diff">{{range .Diff}}<span class="line {{.Kind}}">{{.Text}}</span>{{end}}</pre>
+{{else if .Expected}}
+<p><strong>{{if .ExpectedRegex}}Expected output matching{{else}}Expected output{{end}}</strong></p>
+<pre>{{.Expected}}</pre>
+{{end}}
+{{if and .StdOut (not .Diff)}}
+<p><strong>Output</strong></p>
+<pre>{{.StdOut}}</pre>
+{{end}}
+{{if .ExpectedStdErr}}
+<p><strong>Expected standard error matching</strong></p>
+<pre>{{.ExpectedStdErr}}</pre>
+{{end}}
+{{if .StdErr}}
+<p><strong>Standard error</strong></p>
+<pre>{{.StdErr}}</pre>
+{{end}}
+</div>
+{{end}}`
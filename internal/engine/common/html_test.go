@@ -0,0 +1,88 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteToHTMLFile(t *testing.T) {
+	verification := "# ie:auto-prereq-verification marker=\"/tmp/marker\" display=\"Create a VM [vm.md]\" source=\"vm.md\" index=\"1\" total=\"1\"\naz vm show\n"
+	body := "# ie:auto-prereq-body marker=\"/tmp/marker\" display=\"Create a VM [vm.md]\" source=\"vm.md\"\nif [ ! -f \"/tmp/marker\" ]; then\naz vm create\nfi\n"
+	banner := "# ie:auto-prereq-banner marker=\"/tmp/marker\" display=\"Create a VM [vm.md]\" source=\"vm.md\"\necho \"Validating Prerequisite\"\n"
+
+	report := BuildReport("Deploy <an> app")
+	report.WithIntroduction("Deploys an **app**.\n\n<script>alert(1)</script>").
+		WithEnvironmentVariables(map[string]string{"MY_RG": "rg-1"}).
+		WithError(errors.New("failed to execute code block 0 on step 1")).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{StepName: "Prerequisites", CodeBlock: parsers.CodeBlock{Content: banner}, StdOut: "Validating\n", Success: true},
+			{StepName: "Prerequisites", CodeBlockNumber: 1, CodeBlock: parsers.CodeBlock{Content: verification}, StdOut: "{}\n", Success: true},
+			{StepName: "Prerequisites", CodeBlockNumber: 2, CodeBlock: parsers.CodeBlock{Content: body}, StdOut: "created\n", Success: true},
+			{
+				StepName:   "Check the app",
+				StepNumber: 1,
+				CodeBlock: parsers.CodeBlock{
+					Language:    "bash",
+					Content:     "curl localhost\n",
+					Description: "Calls the *app*.",
+					ExpectedOutput: parsers.ExpectedOutputBlock{
+						Content:            "hello\nworld\n",
+						ExpectedSimilarity: 0.9,
+					},
+				},
+				StdOut:          "hello\nthere\n",
+				Error:           errors.New("expected output does not match"),
+				SimilarityScore: 0.5,
+				Duration:        1200 * time.Millisecond,
+			},
+			{StepName: "Check the app", StepNumber: 1, CodeBlockNumber: 1, CodeBlock: parsers.CodeBlock{Content: "echo never\n"}},
+		})
+
+	page := report.toHTML()
+	assert.Equal(t, 2, page.Passed)
+	assert.Equal(t, 1, page.Failed)
+	assert.Equal(t, 1, page.Skipped)
+
+	require.Len(t, page.Prerequisites, 1)
+	prerequisite := page.Prerequisites[0]
+	assert.Equal(t, "Create a VM [vm.md]", prerequisite.Name)
+	assert.Equal(t, "passed", prerequisite.Status)
+	require.Len(t, prerequisite.Verification, 1)
+	assert.Equal(t, "az vm show\n", prerequisite.Verification[0].Command)
+	require.Len(t, prerequisite.Execution, 1)
+	assert.Equal(t, "az vm create", prerequisite.Execution[0].Command)
+
+	require.Len(t, page.Steps, 1)
+	step := page.Steps[0]
+	assert.Equal(t, 2, step.Number)
+	assert.Equal(t, "failed", step.Status)
+	assert.Equal(t, []htmlDiffLine{
+		{Kind: "hunk", Text: "@@ -1,2 +1,2 @@"},
+		{Kind: "same", Text: "hello"},
+		{Kind: "removed", Text: "world"},
+		{Kind: "added", Text: "there"},
+	}, step.CodeBlocks[0].Diff)
+	assert.Equal(t, "skipped", step.CodeBlocks[1].Status)
+
+	path := filepath.Join(t.TempDir(), "report.html")
+	require.NoError(t, report.WriteToHTMLFile(path))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	html := string(content)
+
+	assert.Contains(t, html, "<title>Deploy &lt;an&gt; app")
+	assert.Contains(t, html, "<strong>app</strong>")
+	assert.Contains(t, html, "<em>app</em>")
+	assert.NotContains(t, html, "<script>")
+	assert.Contains(t, html, "<code>MY_RG</code>")
+	assert.Contains(t, html, `<span class="line removed">world</span>`)
+	assert.Contains(t, html, "similarity 50% (expected 90%)")
+	assert.Contains(t, html, "expected output does not match")
+}
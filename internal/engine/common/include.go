@@ -0,0 +1,136 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// includeResolutionContext carries the state needed to splice included
+// documents into the code blocks of the document that includes them. The
+// includeChain holds the documents currently being expanded so that cycles can
+// be detected without preventing the same document from being included more
+// than once in different places.
+type includeResolutionContext struct {
+	languagesToExecute   []string
+	properties           map[string]interface{}
+	environmentVariables map[string]string
+	includeChain         map[string]bool
+}
+
+func newIncludeResolutionContext(
+	languagesToExecute []string,
+	properties map[string]interface{},
+	environmentVariables map[string]string,
+) *includeResolutionContext {
+	return &includeResolutionContext{
+		languagesToExecute:   languagesToExecute,
+		properties:           properties,
+		environmentVariables: environmentVariables,
+		includeChain:         make(map[string]bool),
+	}
+}
+
+// expand splices the code blocks of every included document into codeBlocks
+// at the position its include directive appeared. path is the location of
+// the document that owns codeBlocks and is used to resolve relative includes.
+func (ctx *includeResolutionContext) expand(
+	codeBlocks []parsers.CodeBlock,
+	includes []parsers.IncludeDirective,
+	path string,
+) []parsers.CodeBlock {
+	if len(includes) == 0 {
+		return codeBlocks
+	}
+
+	chainKey := includeChainKey(path)
+	ctx.includeChain[chainKey] = true
+	defer delete(ctx.includeChain, chainKey)
+
+	expanded := make([]parsers.CodeBlock, 0, len(codeBlocks))
+	next := 0
+	for _, include := range includes {
+		expanded = append(expanded, codeBlocks[next:include.Position]...)
+		next = include.Position
+		expanded = append(expanded, ctx.loadInclude(include, path)...)
+	}
+	expanded = append(expanded, codeBlocks[next:]...)
+
+	return expanded
+}
+
+// loadInclude parses the included document, recursively expands its own
+// includes and returns its code blocks adjusted to the position of the include
+// directive in the parent document.
+func (ctx *includeResolutionContext) loadInclude(include parsers.IncludeDirective, parentPath string) []parsers.CodeBlock {
+	resolvedPath := resolveIncludePath(include.Path, parentPath)
+	if ctx.includeChain[includeChainKey(resolvedPath)] {
+		msg := fmt.Sprintf("Include '%s' in '%s' creates a cycle (skipping it)", resolvedPath, parentPath)
+		RegisterIncludeError(msg)
+		return nil
+	}
+
+	logging.GlobalLogger.Infof("Including document: %s", resolvedPath)
+	source, err := resolveMarkdownSource(resolvedPath)
+	if err != nil {
+		msg := fmt.Sprintf("Include '%s' could not be loaded: %v (continuing without it)", resolvedPath, err)
+		RegisterIncludeError(msg)
+		return nil
+	}
+
+	markdown := parsers.ParseMarkdownIntoAst(source)
+
+	// Metadata declared by the including document takes precedence, included
+	// documents only fill in keys that are not already set.
+	for key, value := range parsers.ExtractYamlMetadataFromAst(markdown) {
+		if _, exists := ctx.properties[key]; !exists {
+			ctx.properties[key] = value
+		}
+	}
+	for key, value := range parsers.ExtractScenarioVariablesFromAst(markdown, source) {
+		ctx.environmentVariables[key] = value
+	}
+
+	blocks, nestedIncludes := parsers.ExtractCodeBlocksAndIncludesFromAst(markdown, source, ctx.languagesToExecute, resolvedPath)
+	blocks = ctx.expand(blocks, nestedIncludes, resolvedPath)
+
+	// Included blocks are treated as if they were written where the include
+	// directive appears, so they belong to the including step and section.
+	for i := range blocks {
+		blocks[i].Header = include.Header
+		blocks[i].Section = include.Section
+		blocks[i].InPrerequisiteSection = include.InPrerequisiteSection
+	}
+
+	return blocks
+}
+
+// resolveIncludePath resolves an include path relative to the document that
+// declared it. Remote parents resolve relative includes against their URL.
+func resolveIncludePath(includePath, parentPath string) string {
+	if isRemotePath(includePath) || filepath.IsAbs(includePath) {
+		return includePath
+	}
+
+	if isRemotePath(parentPath) {
+		base, err := url.Parse(parentPath)
+		if err == nil {
+			if ref, refErr := url.Parse(strings.ReplaceAll(includePath, "\\", "/")); refErr == nil {
+				return base.ResolveReference(ref).String()
+			}
+		}
+	}
+
+	return filepath.Join(filepath.Dir(parentPath), includePath)
+}
+
+func includeChainKey(path string) string {
+	if isRemotePath(path) {
+		return path
+	}
+	return filepath.Clean(path)
+}
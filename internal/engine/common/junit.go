@@ -0,0 +1,182 @@
+package common
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// The elements of a JUnit XML report, limited to what CI systems such as
+// Azure DevOps, Jenkins and GitHub show in their test tabs.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// Formats a duration the way JUnit expects it, in seconds.
+func junitTime(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
+
+// Builds the JUnit XML document of the report. The scenario is a test suite
+// and every code block is a test case, grouped by the step it belongs to.
+// Code blocks that did not run because an earlier one failed are skipped.
+func (report *Report) toJUnit() junitTestSuites {
+	codeBlocks := make([]StatefulCodeBlock, len(report.CodeBlocks))
+	copy(codeBlocks, report.CodeBlocks)
+	sort.SliceStable(codeBlocks, func(i, j int) bool {
+		if codeBlocks[i].StepNumber != codeBlocks[j].StepNumber {
+			return codeBlocks[i].StepNumber < codeBlocks[j].StepNumber
+		}
+		return codeBlocks[i].CodeBlockNumber < codeBlocks[j].CodeBlockNumber
+	})
+
+	suite := junitTestSuite{Name: report.Name}
+
+	propertyNames := make([]string, 0, len(report.Properties))
+	for name := range report.Properties {
+		propertyNames = append(propertyNames, name)
+	}
+	sort.Strings(propertyNames)
+	for _, name := range propertyNames {
+		suite.Properties = append(suite.Properties, junitProperty{
+			Name:  name,
+			Value: fmt.Sprintf("%v", report.Properties[name]),
+		})
+	}
+
+	var total time.Duration
+	for _, codeBlock := range codeBlocks {
+		total += codeBlock.Duration
+		testCase := junitTestCase{
+			Name: fmt.Sprintf(
+				"Step %d, code block %d",
+				codeBlock.StepNumber+1,
+				codeBlock.CodeBlockNumber+1,
+			),
+			ClassName: report.Name + "." + codeBlock.StepName,
+			Time:      junitTime(codeBlock.Duration),
+			SystemOut: codeBlock.StdOut,
+			SystemErr: codeBlock.StdErr,
+		}
+
+		switch {
+		case !codeBlock.WasExecuted():
+			testCase.Skipped = &junitSkipped{Message: "Not run, an earlier code block failed"}
+			suite.Skipped++
+		case !codeBlock.Success:
+			testCase.Failure = report.junitFailure(codeBlock)
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Tests = len(suite.TestCases)
+	suite.Time = junitTime(total)
+
+	return junitTestSuites{
+		Name:     report.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+}
+
+// Describes why a code block failed, with the command, its expected and
+// actual output and its standard error.
+func (report *Report) junitFailure(codeBlock StatefulCodeBlock) *junitFailure {
+	message := report.Error
+	if codeBlock.Error != nil {
+		message = codeBlock.Error.Error()
+	}
+	failureType := "failure"
+	if codeBlock.TimedOut {
+		failureType = "timeout"
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Command:\n%s\n", codeBlock.CodeBlock.Content)
+	if hasExpectedOutput(codeBlock.CodeBlock) {
+		expected := codeBlock.CodeBlock.ExpectedOutput.Content
+		if expected == "" {
+			expected = codeBlock.CodeBlock.ExpectedOutput.ExpectedRegexPattern
+		}
+		fmt.Fprintf(&body, "Expected output:\n%s\n", expected)
+	}
+	fmt.Fprintf(&body, "Actual output:\n%s\n", codeBlock.StdOut)
+	if expected := codeBlock.CodeBlock.Attributes.ExpectedExitCode; expected != "" {
+		fmt.Fprintf(&body, "Expected exit code: %s\n", expected)
+	}
+	fmt.Fprintf(&body, "Exit code: %d\n", codeBlock.ExitCode)
+	if expected := codeBlock.CodeBlock.Attributes.ExpectedStdErr; expected != "" {
+		fmt.Fprintf(&body, "Expected standard error matching:\n%s\n", expected)
+	}
+	if codeBlock.StdErr != "" {
+		fmt.Fprintf(&body, "Standard error:\n%s\n", codeBlock.StdErr)
+	}
+
+	return &junitFailure{Message: message, Type: failureType, Body: body.String()}
+}
+
+// Writes the report as JUnit XML.
+func (report *Report) WriteToJUnitFile(outputPath string) error {
+	junitReport, err := xml.MarshalIndent(report.toJUnit(), "", "    ")
+	if err != nil {
+		return err
+	}
+
+	content := append([]byte(xml.Header), junitReport...)
+	content = append(content, '\n')
+	if err := os.WriteFile(outputPath, content, 0o644); err != nil {
+		return err
+	}
+
+	logging.GlobalLogger.Infof("Wrote the JUnit test report to %s", outputPath)
+	return nil
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteToJUnitFile(t *testing.T) {
+	report := BuildReport("Deploy a VM")
+	report.WithProperties(map[string]interface{}{"ms.author": "someone"}).
+		WithError(errors.New("failed to execute code block 0 on step 1")).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{
+				StepName:   "Check the VM",
+				StepNumber: 1,
+				CodeBlock: parsers.CodeBlock{
+					Content:        "echo running\n",
+					ExpectedOutput: parsers.ExpectedOutputBlock{Content: "stopped\n"},
+				},
+				StdOut:   "running\n",
+				StdErr:   "warning\n",
+				Error:    errors.New("expected output does not match"),
+				Duration: 2500 * time.Millisecond,
+			},
+			{
+				StepName:   "Create the VM",
+				StepNumber: 0,
+				CodeBlock:  parsers.CodeBlock{Content: "echo created\n"},
+				StdOut:     "created\n",
+				Success:    true,
+				Duration:   1500 * time.Millisecond,
+			},
+			{
+				StepName:        "Check the VM",
+				StepNumber:      1,
+				CodeBlockNumber: 1,
+				CodeBlock:       parsers.CodeBlock{Content: "echo never\n"},
+			},
+		})
+
+	path := filepath.Join(t.TempDir(), "report.xml")
+	require.NoError(t, report.WriteToJUnitFile(path))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal(content, &suites))
+
+	assert.Equal(t, 3, suites.Tests)
+	assert.Equal(t, 1, suites.Failures)
+	assert.Equal(t, 1, suites.Skipped)
+	assert.Equal(t, "4.000", suites.Time)
+	require.Len(t, suites.Suites, 1)
+
+	suite := suites.Suites[0]
+	assert.Equal(t, "Deploy a VM", suite.Name)
+	assert.Equal(t, []junitProperty{{Name: "ms.author", Value: "someone"}}, suite.Properties)
+	require.Len(t, suite.TestCases, 3)
+
+	created := suite.TestCases[0]
+	assert.Equal(t, "Step 1, code block 1", created.Name)
+	assert.Equal(t, "Deploy a VM.Create the VM", created.ClassName)
+	assert.Equal(t, "1.500", created.Time)
+	assert.Nil(t, created.Failure)
+	assert.Equal(t, "created\n", created.SystemOut)
+
+	failed := suite.TestCases[1]
+	require.NotNil(t, failed.Failure)
+	assert.Equal(t, "expected output does not match", failed.Failure.Message)
+	assert.Contains(t, failed.Failure.Body, "Expected output:\nstopped\n")
+	assert.Contains(t, failed.Failure.Body, "Actual output:\nrunning\n")
+	assert.Contains(t, failed.Failure.Body, "Standard error:\nwarning\n")
+
+	assert.NotNil(t, suite.TestCases[2].Skipped)
+}
+
+func TestParseReportFormat(t *testing.T) {
+	format, err := ParseReportFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, ReportFormatJSON, format)
+
+	format, err = ParseReportFormat("junit")
+	require.NoError(t, err)
+	assert.Equal(t, ReportFormatJUnit, format)
+
+	format, err = ParseReportFormat("html")
+	require.NoError(t, err)
+	assert.Equal(t, ReportFormatHTML, format)
+
+	_, err = ParseReportFormat("yaml")
+	assert.ErrorContains(t, err, "invalid report format")
+}
@@ -9,8 +9,8 @@ import (
 
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/ui"
-	"github.com/xrash/smetrics"
 )
 
 // Compares the actual output of a command to the expected output of a command.
@@ -21,83 +21,89 @@ func CompareCommandOutputs(
 	expectedRegexPattern string,
 	expectedOutputLanguage string,
 ) (float64, error) {
-	actualNormalized := normalizeOutput(actualOutput)
-	expectedNormalized := normalizeOutput(expectedOutput)
-
-	if strings.TrimSpace(expectedRegexPattern) != "" {
-		expandedPattern, compiledRegex, usedEnvValues, err := compileRegexWithEnv(expectedRegexPattern)
-		if err != nil {
-			return 0.0, err
-		}
-
-		if !compiledRegex.MatchString(actualNormalized) {
-			patternDisplay := strings.TrimSpace(expectedRegexPattern)
-			if patternDisplay == "" {
-				patternDisplay = expandedPattern
-			}
-			if details := formatRegexEnvDetails(usedEnvValues); details != "" {
-				patternDisplay = fmt.Sprintf("%s\n%s", patternDisplay, details)
-			}
-			return 0.0, fmt.Errorf(
-				ui.ErrorMessageStyle.Render(
-					"Expected output does not match actual output.\nExpected Pattern:\n%s\nActual:\n%s",
-				),
-				ui.VerboseStyle.Render(patternDisplay),
-				ui.VerboseStyle.Render(summarizeOutput(actualNormalized, 20)),
-			)
-		}
+	return CompareExpectedOutput(actualOutput, parsers.ExpectedOutputBlock{
+		Content:              expectedOutput,
+		ExpectedSimilarity:   expectedSimilarity,
+		ExpectedRegexPattern: expectedRegexPattern,
+		Language:             expectedOutputLanguage,
+	})
+}
 
-		return 0.0, nil
+// Compares the actual output of a code block to its expected output block. A
+// regex pattern takes precedence, then the comparator selected by the compare
+// attribute, and otherwise the default comparator for the language of the
+// block. Both outputs are normalized before they are compared.
+func CompareExpectedOutput(actualOutput string, expected parsers.ExpectedOutputBlock) (float64, error) {
+	if strings.TrimSpace(expected.ExpectedRegexPattern) != "" {
+		return compareRegex(normalizeOutput(actualOutput), expected.ExpectedRegexPattern)
 	}
 
-	if strings.ToLower(expectedOutputLanguage) == "json" {
-		logging.GlobalLogger.Debugf(
-			"Comparing JSON strings:\nExpected: %s\nActual%s",
-			expectedNormalized,
-			actualNormalized,
-		)
-		results, err := lib.CompareJsonStrings(actualNormalized, expectedNormalized, expectedSimilarity)
-		if err != nil {
-			return results.Score, err
-		}
+	actualNormalized, expectedNormalized := NormalizeOutputs(actualOutput, expected)
 
-		logging.GlobalLogger.Debugf(
-			"Expected Similarity: %f, Actual Similarity: %f",
-			expectedSimilarity,
-			results.Score,
-		)
+	comparator, err := lookupComparator(expected.Comparator, expected.Language)
+	if err != nil {
+		return 0.0, err
+	}
 
-		if !results.AboveThreshold {
-			return results.Score, fmt.Errorf(
-				ui.ErrorMessageStyle.Render(
-					"Expected output does not match actual output.\nExpected:\n%s\nActual:\n%s\nExpected Score:%s\nActual Score:%s",
-				),
-				ui.VerboseStyle.Render(summarizeOutput(expectedNormalized, 20)),
-				ui.VerboseStyle.Render(summarizeOutput(actualNormalized, 20)),
-				ui.VerboseStyle.Render(fmt.Sprintf("%f", expectedSimilarity)),
-				ui.VerboseStyle.Render(fmt.Sprintf("%f", results.Score)),
-			)
-		}
+	logging.GlobalLogger.Debugf(
+		"Comparing outputs with the %q comparator:\nExpected: %s\nActual: %s",
+		expected.Comparator,
+		expectedNormalized,
+		actualNormalized,
+	)
+	score, err := comparator.Compare(actualNormalized, newExpectation(expected, expectedNormalized))
+	logging.GlobalLogger.Debugf(
+		"Expected Similarity: %f, Actual Similarity: %f",
+		expected.ExpectedSimilarity,
+		score,
+	)
+	return score, err
+}
 
-		return results.Score, nil
+// Creates the expectation given to comparators for a result block whose
+// normalized content is output.
+func newExpectation(expected parsers.ExpectedOutputBlock, output string) Expectation {
+	return Expectation{
+		Output:     output,
+		Language:   expected.Language,
+		Similarity: expected.ExpectedSimilarity,
+		Options:    lib.CopyMap(expected.Options),
 	}
+}
 
-	// Default case, using similarity on non JSON block.
-	score := smetrics.JaroWinkler(expectedNormalized, actualNormalized, 0.7, 4)
+func compareRegex(actualNormalized string, expectedRegexPattern string) (float64, error) {
+	expandedPattern, compiledRegex, usedEnvValues, err := compileRegexWithEnv(expectedRegexPattern)
+	if err != nil {
+		return 0.0, err
+	}
 
-	if expectedSimilarity > score {
-		return score, fmt.Errorf(
+	if !compiledRegex.MatchString(actualNormalized) {
+		patternDisplay := strings.TrimSpace(expectedRegexPattern)
+		if patternDisplay == "" {
+			patternDisplay = expandedPattern
+		}
+		if details := formatRegexEnvDetails(usedEnvValues); details != "" {
+			patternDisplay = fmt.Sprintf("%s\n%s", patternDisplay, details)
+		}
+		return 0.0, fmt.Errorf(
 			ui.ErrorMessageStyle.Render(
-				"Expected output does not match actual output.\nExpected:\n%s\nActual:\n%s\nExpected Score:%s\nActual Score:%s",
+				"Expected output does not match actual output.\nExpected Pattern:\n%s\nActual:\n%s",
 			),
-			ui.VerboseStyle.Render(summarizeOutput(expectedNormalized, 20)),
+			ui.VerboseStyle.Render(patternDisplay),
 			ui.VerboseStyle.Render(summarizeOutput(actualNormalized, 20)),
-			ui.VerboseStyle.Render(fmt.Sprintf("%f", expectedSimilarity)),
-			ui.VerboseStyle.Render(fmt.Sprintf("%f", score)),
 		)
 	}
 
-	return score, nil
+	return 0.0, nil
+}
+
+// Returns the actual and expected outputs as they are compared: without
+// color codes, with \n line endings, and with the normalization of the result
+// block applied. Regex expectations match the actual output without the
+// normalization of the result block.
+func NormalizeOutputs(actualOutput string, expected parsers.ExpectedOutputBlock) (string, string) {
+	return expected.Normalization.Apply(normalizeOutput(actualOutput)),
+		expected.Normalization.Apply(normalizeOutput(expected.Content))
 }
 
 func normalizeOutput(value string) string {
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 )
 
 func TestCompareCommandOutputsRegexExpandsOsEnv(t *testing.T) {
@@ -82,3 +83,31 @@ func unsetEnv(t *testing.T, key string) {
 		os.Unsetenv(key)
 	})
 }
+
+func TestCompareExpectedOutputNormalizesVolatileValues(t *testing.T) {
+	expected := parsers.ExpectedOutputBlock{
+		Content:            "Created rg-k3j9x2 (5f1d2e6a-3b4c-4d5e-8f9a-0b1c2d3e4f5a) at 2024-05-01T12:34:56Z\n",
+		ExpectedSimilarity: 1,
+		Normalization: &parsers.OutputNormalization{
+			Masks:        []string{parsers.MaskUUID, parsers.MaskTimestamp},
+			Replacements: []parsers.OutputReplacement{{Pattern: `rg-[a-z0-9]{6}`, With: "rg-random"}},
+		},
+	}
+
+	score, err := CompareExpectedOutput(
+		"Created rg-a8b7c6 (0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d) at 2024-06-11T08:00:01Z\n",
+		expected,
+	)
+	if err != nil || score != 1 {
+		t.Fatalf("expected the normalized outputs to match, got score %f and error: %v", score, err)
+	}
+
+	_, err = CompareExpectedOutput("Deleted rg-a8b7c6 (0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d)\n", expected)
+	if err == nil {
+		t.Fatalf("expected the comparison to fail")
+	}
+	if !strings.Contains(err.Error(), "Created rg-random (<uuid>) at <timestamp>") ||
+		!strings.Contains(err.Error(), "Deleted rg-random (<uuid>)") {
+		t.Errorf("expected the error to show the normalized outputs, got: %v", err)
+	}
+}
@@ -0,0 +1,716 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"gopkg.in/yaml.v3"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// CommandPolicy restricts the commands that code blocks may run, e.g. for
+// documents fetched from URLs or prerequisites from repositories that are not
+// trusted. Deny rules win over allow rules. Policies built in code must be
+// validated with Validate.
+type CommandPolicy struct {
+	// Executables by name, e.g. az or sudo.
+	Executables PolicyRules `yaml:"executables"`
+	// Regular expressions matched against each command as it is written in
+	// the code block, e.g. ^az group delete.
+	Commands PolicyRules   `yaml:"commands"`
+	Network  NetworkPolicy `yaml:"network"`
+	// The file the policy was read from.
+	Path string `yaml:"-"`
+
+	allowedCommands []*regexp.Regexp
+	deniedCommands  []*regexp.Regexp
+}
+
+// PolicyRules lists what a policy allows and denies. When anything is
+// allowed, a command must be allowed by the executables or the commands rules.
+type PolicyRules struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// NetworkPolicy restricts the hosts that curl and wget may connect to.
+type NetworkPolicy struct {
+	// Host names, or *.example.com for the subdomains of example.com. Any host
+	// is allowed when empty.
+	AllowedHosts []string `yaml:"allowedHosts"`
+}
+
+// The names of the rules of a policy, as reported in violations.
+const (
+	PolicyRuleAllowedExecutables = "executables.allow"
+	PolicyRuleDeniedExecutables  = "executables.deny"
+	PolicyRuleAllowedCommands    = "commands.allow"
+	PolicyRuleDeniedCommands     = "commands.deny"
+	PolicyRuleAllowedHosts       = "network.allowedHosts"
+	// Code that cannot be parsed cannot be checked, so it violates every
+	// policy.
+	PolicyRuleSyntax = "syntax"
+)
+
+// Builtins that do not run other commands, which every policy allows.
+var policyBuiltins = map[string]bool{
+	":": true, "[": true, "cd": true, "declare": true, "echo": true, "exit": true,
+	"export": true, "false": true, "local": true, "printf": true, "pwd": true,
+	"read": true, "readonly": true, "return": true, "set": true, "shift": true,
+	"test": true, "true": true, "typeset": true, "unset": true,
+}
+
+// Commands that connect to the URLs they are given.
+var networkCommands = map[string]policyOptions{
+	"curl": {
+		short: "AbcCdDeEFHKmoPQrtTuUwxXyYz",
+		long: []string{
+			"cacert", "capath", "cert", "config", "connect-timeout", "connect-to", "continue-at", "cookie",
+			"cookie-jar", "data", "data-ascii", "data-binary", "data-raw", "data-urlencode", "dump-header",
+			"form", "form-string", "header", "interface", "json", "key", "limit-rate", "local-port",
+			"max-filesize", "max-redirs", "max-time", "oauth2-bearer", "output", "output-dir", "preproxy",
+			"proxy", "proxy-user", "range", "referer", "request", "resolve", "retry", "retry-delay",
+			"retry-max-time", "speed-limit", "speed-time", "time-cond", "upload-file", "url", "user",
+			"user-agent", "write-out",
+		},
+		hosts: []string{"url", "x", "proxy", "preproxy", "connect-to", "resolve"},
+	},
+	"wget": {
+		short: "aABDeiIloOPQRtTUwX",
+		long: []string{
+			"accept", "append-output", "base", "body-data", "body-file", "ca-certificate", "certificate",
+			"directory-prefix", "domains", "execute", "header", "http-password", "http-user", "input-file",
+			"level", "limit-rate", "load-cookies", "method", "output-document", "output-file", "password",
+			"post-data", "post-file", "private-key", "quota", "referer", "reject", "save-cookies", "timeout",
+			"tries", "user", "user-agent", "wait",
+		},
+	},
+}
+
+// Stands for the parts of words that are only known when the code block runs.
+const unknownWordPart = "\x00"
+
+// Reads a command policy from a file, rejecting unknown keys and invalid
+// regular expressions.
+func LoadCommandPolicy(path string) (*CommandPolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &CommandPolicy{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid policy in %s: %w", path, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy in %s: %w", path, err)
+	}
+	policy.Path = path
+	return policy, nil
+}
+
+// Validate checks the command patterns and allowed hosts of a policy built in
+// code and prepares its patterns for matching. LoadCommandPolicy validates the
+// policies it reads.
+func (policy *CommandPolicy) Validate() error {
+	allowedCommands, err := compilePolicyPatterns(policy.Commands.Allow)
+	if err != nil {
+		return err
+	}
+	deniedCommands, err := compilePolicyPatterns(policy.Commands.Deny)
+	if err != nil {
+		return err
+	}
+	for _, host := range policy.Network.AllowedHosts {
+		if strings.TrimPrefix(host, "*.") == "" || strings.ContainsAny(host, "/: ") {
+			return fmt.Errorf("allowed host %q must be a host name", host)
+		}
+	}
+	policy.allowedCommands = allowedCommands
+	policy.deniedCommands = deniedCommands
+	return nil
+}
+
+func compilePolicyPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid command pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, expression)
+	}
+	return compiled, nil
+}
+
+// PolicyViolation is a command of a code block that a policy does not allow.
+type PolicyViolation struct {
+	// The rule that the command breaks, one of the PolicyRule* constants.
+	Rule    string
+	Message string
+	// The line of the code block the command starts on, counted from 1.
+	Line int
+	// The command as it is written in the code block.
+	Command string
+}
+
+// Check returns the commands of the content of a code block that the policy
+// does not allow. Functions declared in the code block may be called.
+func (policy *CommandPolicy) Check(content string) []PolicyViolation {
+	return policy.check(content, nil)
+}
+
+// Checks a script, which may call the given functions as well as those it
+// declares.
+func (policy *CommandPolicy) check(content string, declared map[string]bool) []PolicyViolation {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(content), "")
+	if err != nil {
+		line := 1
+		var parseError syntax.ParseError
+		if errors.As(err, &parseError) && parseError.Pos.IsValid() {
+			line = int(parseError.Pos.Line())
+		}
+		return []PolicyViolation{{
+			Rule:    PolicyRuleSyntax,
+			Message: fmt.Sprintf("the code block is not valid bash, so its commands cannot be checked: %s", err),
+			Line:    line,
+		}}
+	}
+
+	functions := make(map[string]bool)
+	for name := range declared {
+		functions[name] = true
+	}
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if function, ok := node.(*syntax.FuncDecl); ok && function.Name != nil {
+			functions[function.Name.Value] = true
+		}
+		return true
+	})
+
+	var violations []PolicyViolation
+	syntax.Walk(file, func(node syntax.Node) bool {
+		call, ok := node.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		command := content[call.Pos().Offset():call.End().Offset()]
+		for _, violation := range policy.checkCommand(call, command, functions) {
+			violation.Line = int(call.Pos().Line())
+			violation.Command = command
+			violations = append(violations, violation)
+		}
+		return true
+	})
+	return violations
+}
+
+func (policy *CommandPolicy) checkCommand(call *syntax.CallExpr, command string, functions map[string]bool) []PolicyViolation {
+	args := make([]string, len(call.Args))
+	for index, arg := range call.Args {
+		args[index] = policyWord(arg)
+	}
+	executables := policyExecutables(args)
+
+	var violations []PolicyViolation
+	restrictsExecutables := len(policy.Executables.Allow) > 0 || len(policy.Executables.Deny) > 0 ||
+		len(policy.allowedCommands) > 0
+	for _, index := range executables {
+		executable := path.Base(args[index])
+		switch {
+		case strings.Contains(args[index], unknownWordPart):
+			if !restrictsExecutables {
+				continue
+			}
+			rule := PolicyRuleDeniedExecutables
+			if len(policy.Executables.Allow) > 0 {
+				rule = PolicyRuleAllowedExecutables
+			}
+			violations = append(violations, PolicyViolation{
+				Rule:    rule,
+				Message: "the executable is only known when the code block runs",
+			})
+		case containsString(policy.Executables.Deny, executable):
+			violations = append(violations, PolicyViolation{
+				Rule:    PolicyRuleDeniedExecutables,
+				Message: fmt.Sprintf("%s is a denied executable", executable),
+			})
+		}
+	}
+
+	for index, pattern := range policy.deniedCommands {
+		if pattern.MatchString(command) {
+			violations = append(violations, PolicyViolation{
+				Rule:    PolicyRuleDeniedCommands,
+				Message: fmt.Sprintf("the command matches the denied pattern %q", policy.Commands.Deny[index]),
+			})
+		}
+	}
+
+	for _, index := range executables {
+		executable := path.Base(args[index])
+		if strings.Contains(args[index], unknownWordPart) || policy.allows(executable, command, functions) {
+			continue
+		}
+		rule := PolicyRuleAllowedCommands
+		message := "the command matches no allowed pattern"
+		if len(policy.Executables.Allow) > 0 {
+			rule = PolicyRuleAllowedExecutables
+			message = fmt.Sprintf("%s is not an allowed executable", executable)
+			if len(policy.allowedCommands) > 0 {
+				message += " and the command matches no allowed pattern"
+			}
+		}
+		violations = append(violations, PolicyViolation{Rule: rule, Message: message})
+		break
+	}
+
+	for _, index := range executables {
+		if strings.Contains(args[index], unknownWordPart) {
+			continue
+		}
+		executable := path.Base(args[index])
+		script, known, ok := policyScript(executable, args[index+1:])
+		switch {
+		case !ok:
+		case !known:
+			if rule := policy.unknownCommandRule(); rule != "" {
+				violations = append(violations, PolicyViolation{
+					Rule:    rule,
+					Message: fmt.Sprintf("the command %s runs is only known when the code block runs", executable),
+				})
+			}
+		case executable == "eval":
+			violations = append(violations, policy.check(script, functions)...)
+		default:
+			// Shells run the script in a new process, without the functions
+			// of the code block.
+			violations = append(violations, policy.check(script, nil)...)
+		}
+	}
+
+	if len(policy.Network.AllowedHosts) > 0 {
+		for _, index := range executables {
+			executable := path.Base(args[index])
+			options, ok := networkCommands[executable]
+			if !ok {
+				continue
+			}
+			for _, target := range options.targets(args[index+1:]) {
+				host := urlHost(target)
+				switch {
+				case strings.Contains(host, unknownWordPart):
+					violations = append(violations, PolicyViolation{
+						Rule:    PolicyRuleAllowedHosts,
+						Message: fmt.Sprintf("the host %s connects to is only known when the code block runs", executable),
+					})
+				case host != "" && !policy.allowsHost(host):
+					violations = append(violations, PolicyViolation{
+						Rule:    PolicyRuleAllowedHosts,
+						Message: fmt.Sprintf("%s is not an allowed host", host),
+					})
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// Returns the rule that a command only known when the code block runs
+// violates, or nothing when the policy restricts no commands.
+func (policy *CommandPolicy) unknownCommandRule() string {
+	switch {
+	case len(policy.Executables.Allow) > 0:
+		return PolicyRuleAllowedExecutables
+	case len(policy.allowedCommands) > 0:
+		return PolicyRuleAllowedCommands
+	case len(policy.Executables.Deny) > 0:
+		return PolicyRuleDeniedExecutables
+	case len(policy.deniedCommands) > 0:
+		return PolicyRuleDeniedCommands
+	case len(policy.Network.AllowedHosts) > 0:
+		return PolicyRuleAllowedHosts
+	}
+	return ""
+}
+
+// Shells that run the script given with -c.
+var policyShells = map[string]bool{"bash": true, "dash": true, "ksh": true, "sh": true, "zsh": true}
+
+// Returns the script that eval, or a shell given -c, runs with the arguments
+// and whether it is known before the code block runs. ok is false for other
+// commands.
+func policyScript(executable string, args []string) (script string, known bool, ok bool) {
+	if executable == "eval" {
+		script = strings.Join(args, " ")
+		return script, !strings.Contains(script, unknownWordPart), true
+	}
+	if !policyShells[executable] {
+		return "", false, false
+	}
+	command := false
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch {
+		case arg == "--":
+			if command && index+1 < len(args) {
+				return args[index+1], !strings.Contains(args[index+1], unknownWordPart), true
+			}
+			return "", false, false
+		case strings.HasPrefix(arg, "--"):
+		case strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "+"):
+			command = command || strings.HasPrefix(arg, "-") && strings.Contains(arg, "c")
+			// -o and -O take the name of an option, like -euo pipefail.
+			if strings.ContainsAny(arg, "oO") {
+				index++
+			}
+		default:
+			return arg, !strings.Contains(arg, unknownWordPart), command
+		}
+	}
+	return "", false, false
+}
+
+// Returns the indices of the arguments of a simple command that name the
+// executables it runs: its first argument, and the commands run by the
+// wrappers before them, e.g. rm for sudo -u root rm -rf /tmp/demo.
+func policyExecutables(args []string) []int {
+	var executables []int
+	for index := 0; index < len(args); {
+		executables = append(executables, index)
+		wrapper, ok := policyWrappers[path.Base(args[index])]
+		if !ok {
+			break
+		}
+		for index++; index < len(args); {
+			option, value, next := wrapper.options.read(args, index)
+			if option == "" && !(wrapper.assignments && isPolicyAssignment(value)) {
+				break
+			}
+			index = next
+			if option == "--" {
+				break
+			}
+		}
+		index += wrapper.operands
+	}
+	return executables
+}
+
+func isPolicyAssignment(arg string) bool {
+	name, _, ok := strings.Cut(arg, "=")
+	return ok && syntax.ValidName(name)
+}
+
+// Returns the arguments of curl or wget that name what they connect to: their
+// operands, which may be URLs without a scheme, and the values of the options
+// that name hosts. Options whose names are only known when the code block
+// runs are returned too, since they may be either.
+func (options policyOptions) targets(args []string) []string {
+	var targets []string
+	for index := 0; index < len(args); {
+		option, value, next := options.read(args, index)
+		index = next
+		switch {
+		case option == "--":
+			return append(targets, args[index:]...)
+		case option == "" || containsString(options.hosts, option):
+			targets = append(targets, value)
+		case strings.Contains(option, unknownWordPart):
+			targets = append(targets, option)
+		}
+	}
+	return targets
+}
+
+// The options of a command that take a value.
+type policyOptions struct {
+	// The letters of the short options, e.g. o for curl -o file.
+	short string
+	// The names of the long options, e.g. output for curl --output file.
+	long []string
+	// The options, short or long, whose values name hosts.
+	hosts []string
+}
+
+// Reads the argument of a command at index, returning the name of the option
+// it is with its value, or no name and the argument for operands, and the
+// index of the next argument. -- and - are returned as options.
+func (options policyOptions) read(args []string, index int) (option string, value string, next int) {
+	arg := args[index]
+	next = index + 1
+	switch {
+	case arg == "--" || arg == "-":
+		return arg, "", next
+	case !strings.HasPrefix(arg, "-"):
+		return "", arg, next
+	case strings.HasPrefix(arg, "--"):
+		option, value, hasValue := strings.Cut(arg[2:], "=")
+		if !hasValue && containsString(options.long, option) && next < len(args) {
+			value, next = args[next], next+1
+		}
+		return option, value, next
+	}
+	// Short options may be combined, like -sSLo file, the first one taking
+	// a value ending them.
+	for position := 1; position < len(arg); position++ {
+		if strings.IndexByte(options.short, arg[position]) < 0 {
+			continue
+		}
+		value = arg[position+1:]
+		if value == "" && next < len(args) {
+			value, next = args[next], next+1
+		}
+		return arg[position : position+1], value, next
+	}
+	return arg[1:], "", next
+}
+
+// A command that runs the command given in its arguments, like sudo.
+type policyWrapper struct {
+	options policyOptions
+	// Whether variable assignments, like FOO=bar, may precede the command.
+	assignments bool
+	// The number of operands before the command, like the duration of timeout.
+	operands int
+}
+
+// Commands that run the commands given in their arguments, whose executables
+// are checked as well.
+var policyWrappers = map[string]policyWrapper{
+	"builtin": {},
+	"command": {},
+	"env": {
+		options:     policyOptions{short: "uC", long: []string{"unset", "chdir"}},
+		assignments: true,
+	},
+	"exec":  {options: policyOptions{short: "a"}},
+	"nice":  {options: policyOptions{short: "n", long: []string{"adjustment"}}},
+	"nohup": {},
+	"sudo": {
+		options: policyOptions{
+			short: "CDghpRrTtUu",
+			long:  []string{"chdir", "chroot", "close-from", "command-timeout", "group", "host", "other-user", "prompt", "role", "type", "user"},
+		},
+		assignments: true,
+	},
+	"timeout": {
+		options:  policyOptions{short: "ks", long: []string{"kill-after", "signal"}},
+		operands: 1,
+	},
+	"xargs": {
+		options: policyOptions{
+			short: "adEILnPs",
+			long:  []string{"arg-file", "delimiter", "max-args", "max-chars", "max-procs", "process-slot-var"},
+		},
+	},
+}
+
+// Checks if the allow rules, if any, allow the command.
+func (policy *CommandPolicy) allows(executable string, command string, functions map[string]bool) bool {
+	if len(policy.Executables.Allow) == 0 && len(policy.allowedCommands) == 0 {
+		return true
+	}
+	if policyBuiltins[executable] || functions[executable] || containsString(policy.Executables.Allow, executable) {
+		return true
+	}
+	for _, pattern := range policy.allowedCommands {
+		if pattern.MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *CommandPolicy) allowsHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range policy.Network.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the text of a word as bash reads it, with the parts that are only
+// known when the code block runs, like expansions, replaced by
+// unknownWordPart.
+func policyWord(word *syntax.Word) string {
+	return policyWordParts(word.Parts, false)
+}
+
+func policyWordParts(parts []syntax.WordPart, doubleQuoted bool) string {
+	var text strings.Builder
+	for _, part := range parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			text.WriteString(unescapePolicyLiteral(part.Value, doubleQuoted))
+		case *syntax.SglQuoted:
+			if part.Dollar {
+				text.WriteString(unknownWordPart)
+			} else {
+				text.WriteString(part.Value)
+			}
+		case *syntax.DblQuoted:
+			text.WriteString(policyWordParts(part.Parts, true))
+		default:
+			text.WriteString(unknownWordPart)
+		}
+	}
+	return text.String()
+}
+
+// Removes the backslashes quoting the characters of a literal, like \rm.
+// Within double quotes, backslashes only quote $, `, ", \ and newlines.
+func unescapePolicyLiteral(value string, doubleQuoted bool) string {
+	var text strings.Builder
+	for index := 0; index < len(value); index++ {
+		if value[index] == '\\' && index+1 < len(value) &&
+			(!doubleQuoted || strings.IndexByte("$`\"\\\n", value[index+1]) >= 0) {
+			index++
+			if value[index] == '\n' {
+				continue
+			}
+		}
+		text.WriteByte(value[index])
+	}
+	return text.String()
+}
+
+// Returns the host of a URL, e.g. example.com for https://example.com/file
+// or example.com:8080/file.
+func urlHost(url string) string {
+	authority := url
+	if index := strings.Index(url, "://"); index >= 0 {
+		authority = url[index+3:]
+	}
+	if end := strings.IndexAny(authority, "/?#"); end >= 0 {
+		authority = authority[:end]
+	}
+	if at := strings.LastIndex(authority, "@"); at >= 0 {
+		authority = authority[at+1:]
+	}
+	if host, _, err := net.SplitHostPort(authority); err == nil {
+		authority = host
+	}
+	return strings.Trim(authority, "[]")
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the commands of a code block written by the author of the document,
+// without those that the engine adds to prerequisites.
+func policyContent(block parsers.CodeBlock) (string, bool) {
+	blockType, _, hasAutoMeta := ParseAutoPrereqMetadata(block.Content)
+	if !hasAutoMeta {
+		return block.Content, true
+	}
+	if blockType == "banner" {
+		return "", false
+	}
+	return StripPrereqBodyWrapper(StripAutoPrereqComment(block.Content)), true
+}
+
+// PolicyViolationError reports a code block that violates a command policy.
+type PolicyViolationError struct {
+	StepNumber      int
+	StepName        string
+	CodeBlockNumber int
+	Position        parsers.SourcePosition
+	PolicyPath      string
+	Violation       PolicyViolation
+}
+
+func (err *PolicyViolationError) Error() string {
+	location := fmt.Sprintf("code block %d of step %d (%s)", err.CodeBlockNumber+1, err.StepNumber+1, err.StepName)
+	if err.Position.IsKnown() {
+		location += " at " + err.Position.String()
+	}
+	message := fmt.Sprintf("%s violates the %s rule of the policy", location, err.Violation.Rule)
+	if err.PolicyPath != "" {
+		message += " in " + err.PolicyPath
+	}
+	message += ": " + err.Violation.Message
+	if err.Violation.Command != "" {
+		message += fmt.Sprintf(" (%s)", err.Violation.Command)
+	}
+	return message
+}
+
+// CheckSteps returns an error for the first code block of the steps that
+// violates the policy, so that a scenario stops before running any of them.
+func (policy *CommandPolicy) CheckSteps(steps []Step) error {
+	for stepNumber, step := range steps {
+		for blockNumber, block := range step.CodeBlocks {
+			content, ok := policyContent(block)
+			if !ok {
+				continue
+			}
+			if violations := policy.Check(content); len(violations) > 0 {
+				return &PolicyViolationError{
+					StepNumber:      stepNumber,
+					StepName:        step.Name,
+					CodeBlockNumber: blockNumber,
+					Position:        block.Position.ContentLine(violations[0].Line - 1),
+					PolicyPath:      policy.Path,
+					Violation:       violations[0],
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateCommandPolicy reports the commands of the scenario that the policy
+// does not allow, for ie inspect --policy.
+func ValidateCommandPolicy(s *Scenario, policy *CommandPolicy) []ValidationIssue {
+	var issues []ValidationIssue
+	for _, step := range s.Steps {
+		for _, block := range step.CodeBlocks {
+			if !shellLanguages[strings.ToLower(block.Language)] {
+				continue
+			}
+			content, ok := policyContent(block)
+			if !ok {
+				continue
+			}
+			lines := strings.Split(content, "\n")
+			for _, violation := range policy.Check(content) {
+				snippet := ""
+				if violation.Line <= len(lines) {
+					snippet = strings.TrimSpace(lines[violation.Line-1])
+				}
+				issues = append(issues, ValidationIssue{
+					RuleID:     RulePolicyViolation,
+					Severity:   ValidationSeverityError,
+					Message:    fmt.Sprintf("The command breaks the %s rule of the policy: %s.", violation.Rule, violation.Message),
+					Position:   block.Position.ContentLine(violation.Line - 1),
+					Snippet:    snippet,
+					Suggestion: "Change the command or, if it is safe, allow it in the policy.",
+				})
+			}
+		}
+	}
+	return issues
+}
@@ -0,0 +1,184 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadPolicy(t *testing.T, content string) *CommandPolicy {
+	t.Helper()
+	policy, err := LoadCommandPolicy(writeConfigFile(t, t.TempDir(), "policy.yaml", content))
+	require.NoError(t, err)
+	return policy
+}
+
+func policyRules(violations []PolicyViolation) []string {
+	var rules []string
+	for _, violation := range violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestLoadCommandPolicy(t *testing.T) {
+	directory := t.TempDir()
+	invalid := map[string]string{
+		"executable:\n  allow: [az]\n":                "field executable not found",
+		"commands:\n  deny: [\"(az\"]\n":              `invalid command pattern "(az"`,
+		"network:\n  allowedHosts: [https://a.com]\n": `allowed host "https://a.com"`,
+		"network:\n  allowedHosts: [\"*.\"]\n":        `allowed host "*."`,
+	}
+	for content, message := range invalid {
+		_, err := LoadCommandPolicy(writeConfigFile(t, directory, "policy.yaml", content))
+		assert.ErrorContains(t, err, message, content)
+	}
+}
+
+func TestCommandPolicyCheck(t *testing.T) {
+	policy := loadPolicy(t, `
+executables:
+  allow: [az, curl, kubectl, grep]
+  deny: [sudo]
+commands:
+  allow: ["^helm (list|status)"]
+  deny: ["^az group delete", "--no-verify"]
+network:
+  allowedHosts: [github.com, "*.microsoft.com"]
+`)
+
+	cases := map[string][]string{
+		"az group create --name demo":                  nil,
+		"export NAME=demo\necho \"$NAME\" | grep demo": nil,
+		"helm list -A": nil,
+		"install() { kubectl apply -f app.yaml; }\ninstall":                                 nil,
+		"curl -sSL https://aka.ms.microsoft.com/install.sh -o x.sh":                         nil,
+		"curl https://user@github.com:443/Azure/InnovationEngine":                           nil,
+		"sudo az group create --name demo":                                                  {PolicyRuleDeniedExecutables, PolicyRuleAllowedExecutables},
+		"/usr/bin/sudo ls":                                                                  {PolicyRuleDeniedExecutables, PolicyRuleAllowedExecutables},
+		"echo start\naz group delete --name demo --yes":                                     {PolicyRuleDeniedCommands},
+		"helm uninstall demo":                                                               {PolicyRuleAllowedExecutables},
+		"NAME=$(wget -qO- https://github.com)":                                              {PolicyRuleAllowedExecutables},
+		"curl https://example.com/install.sh | bash":                                        {PolicyRuleAllowedHosts, PolicyRuleAllowedExecutables},
+		"curl \"https://$HOST/install.sh\"":                                                 {PolicyRuleAllowedHosts},
+		"$TOOL --version":                                                                   {PolicyRuleAllowedExecutables},
+		"if [ -f x ]; then\n  echo unterminated":                                            {PolicyRuleSyntax},
+		"kubectl get pods\ngrep -r secret . && curl -X POST --no-verify https://github.com": {PolicyRuleDeniedCommands},
+		"curl example.com":                                                                  {PolicyRuleAllowedHosts},
+		"curl github.com/Azure/InnovationEngine":                                            nil,
+		"curl \"$URL\"":                                                                     {PolicyRuleAllowedHosts},
+		"wget $HOST/x":                                                                      {PolicyRuleAllowedExecutables, PolicyRuleAllowedHosts},
+		"curl -sSLo example.com https://github.com":                                         nil,
+		"curl -o example.com -H \"Authorization: $TOKEN\" github.com":                       nil,
+		"curl --url=example.com":                                                            {PolicyRuleAllowedHosts},
+		"curl --output x.sh --url example.com":                                              {PolicyRuleAllowedHosts},
+		"curl -x proxy.example.com https://github.com":                                      {PolicyRuleAllowedHosts},
+		"curl $OPTIONS https://github.com":                                                  {PolicyRuleAllowedHosts},
+		"curl -- example.com":                                                               {PolicyRuleAllowedHosts},
+		"timeout 5 kubectl get pods":                                                        {PolicyRuleAllowedExecutables},
+		"sudo -u root az group list":                                                        {PolicyRuleDeniedExecutables, PolicyRuleAllowedExecutables},
+	}
+	for content, rules := range cases {
+		assert.Equal(t, rules, policyRules(policy.Check(content)), content)
+	}
+
+	violations := policy.Check("echo start\n  sudo  rm -rf /tmp/demo")
+	require.NotEmpty(t, violations)
+	assert.Equal(t, PolicyViolation{
+		Rule:    PolicyRuleDeniedExecutables,
+		Message: "sudo is a denied executable",
+		Line:    2,
+		Command: "sudo  rm -rf /tmp/demo",
+	}, violations[0])
+
+	// Wrappers are checked along with the commands they run.
+	denyRm := loadPolicy(t, "executables:\n  deny: [rm]\nnetwork:\n  allowedHosts: [github.com]\n")
+	for _, content := range []string{
+		"\\rm -rf /tmp/demo",
+		"\"rm\" -rf /tmp/demo",
+		"/bin/r\\m -rf /tmp/demo",
+		"env -u HOME FOO=bar rm -rf /tmp/demo",
+		"command rm -rf /tmp/demo",
+		"exec rm -rf /tmp/demo",
+		"nohup rm -rf /tmp/demo &",
+		"timeout 5 rm -rf /tmp/demo",
+		"timeout -s KILL --preserve-status 5m rm -rf /tmp/demo",
+		"find . -name '*.tmp' | xargs -n 1 rm",
+		"sudo -u root -E rm -rf /tmp/demo",
+		"sudo nice -n 10 rm -rf /tmp/demo",
+	} {
+		violations := denyRm.Check(content)
+		require.Len(t, violations, 1, content)
+		assert.Equal(t, "rm is a denied executable", violations[0].Message, content)
+	}
+	assert.Empty(t, denyRm.Check("timeout 5 echo rm\nenv rmdir /tmp/demo\nxargs"))
+	assert.Equal(t, []string{PolicyRuleAllowedHosts}, policyRules(denyRm.Check("sudo curl example.com")))
+
+	// Scripts run by eval and shells given -c are checked as well.
+	denyShells := loadPolicy(t, "executables:\n  deny: [rm]\nnetwork:\n  allowedHosts: [example.com]\n")
+	shellCases := map[string][]string{
+		"eval 'rm -rf /tmp/x'":                           {PolicyRuleDeniedExecutables},
+		"bash -c 'rm -rf /tmp/x'":                        {PolicyRuleDeniedExecutables},
+		"sh -c \"rm -rf /\"":                             {PolicyRuleDeniedExecutables},
+		"bash -c 'curl https://evil.com'":                {PolicyRuleAllowedHosts},
+		"sudo bash -euo pipefail -c 'rm -rf /tmp/x'":     {PolicyRuleDeniedExecutables},
+		"eval \"$COMMAND\"":                              {PolicyRuleDeniedExecutables},
+		"bash -c \"$COMMAND\"":                           {PolicyRuleDeniedExecutables},
+		"bash -c 'echo ok' && eval echo ok":              nil,
+		"bash install.sh\ncurl https://example.com | sh": nil,
+	}
+	for content, rules := range shellCases {
+		assert.Equal(t, rules, policyRules(denyShells.Check(content)), content)
+	}
+	assert.Equal(t, []string{PolicyRuleAllowedHosts}, policyRules(loadPolicy(t, "network:\n  allowedHosts: [example.com]\n").Check("eval $(cat cmd)")))
+	assert.Empty(t, loadPolicy(t, "executables:\n  allow: [az, eval]\n").Check("create() { az group create -n demo; }\neval create"))
+
+	// Without allow rules, everything that is not denied is allowed.
+	denyOnly := loadPolicy(t, "executables:\n  deny: [ssh]\n")
+	assert.Empty(t, denyOnly.Check("terraform apply -auto-approve\ncurl https://example.com"))
+	assert.Equal(t, []string{PolicyRuleDeniedExecutables}, policyRules(denyOnly.Check("ssh azureuser@$IP")))
+}
+
+func TestCommandPolicyCheckSteps(t *testing.T) {
+	policy := loadPolicy(t, "executables:\n  deny: [sudo]\n")
+	steps := []Step{
+		{Name: "Setup", CodeBlocks: []parsers.CodeBlock{{Content: "echo setup"}}},
+		{
+			Name: "Install",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "echo installing"},
+				{
+					Content:  "apt-get update\nsudo apt-get install -y jq",
+					Position: parsers.SourcePosition{File: "doc.md", StartLine: 12, StartColumn: 1, EndLine: 15},
+				},
+			},
+		},
+	}
+
+	err := policy.CheckSteps(steps)
+	var violation *PolicyViolationError
+	require.ErrorAs(t, err, &violation)
+	assert.Equal(t, 1, violation.StepNumber)
+	assert.Equal(t, 1, violation.CodeBlockNumber)
+	assert.Equal(t, 14, violation.Position.StartLine)
+	assert.Equal(t, "code block 2 of step 2 (Install) at doc.md:14:1 violates the executables.deny rule of the policy in "+
+		policy.Path+": sudo is a denied executable (sudo apt-get install -y jq)", err.Error())
+
+	assert.NoError(t, policy.CheckSteps(steps[:1]))
+}
+
+func TestValidateCommandPolicy(t *testing.T) {
+	source := "# Scenario\n\n## Step\n\nInstalls the tools.\n\n```bash\necho installing\nsudo apt-get install -y jq\n```\n\nShows the output.\n\n```text\nsudo is fine here\n```\n"
+	scenario, err := CreateScenarioFromMarkdownSource([]byte(source), "scenario.md", []string{"bash", "text"}, nil)
+	require.NoError(t, err)
+
+	issues := ValidateCommandPolicy(scenario, loadPolicy(t, "executables:\n  deny: [sudo]\n"))
+	require.Len(t, issues, 1)
+	assert.Equal(t, RulePolicyViolation, issues[0].RuleID)
+	assert.Equal(t, ValidationSeverityError, issues[0].Severity)
+	assert.Equal(t, 9, issues[0].Position.StartLine)
+	assert.Equal(t, "sudo apt-get install -y jq", issues[0].Snippet)
+	assert.Contains(t, issues[0].Message, "executables.deny")
+}
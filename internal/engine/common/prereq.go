@@ -53,6 +53,26 @@ func StripAutoPrereqComment(content string) string {
 	return parts[1]
 }
 
+// StripPrereqBodyWrapper removes the marker check that the prerequisite
+// injector wraps around body blocks with a verification, leaving the commands
+// written by the author.
+func StripPrereqBodyWrapper(content string) string {
+	trimmedContent := strings.TrimSuffix(content, "\n")
+	lines := strings.Split(trimmedContent, "\n")
+	if len(lines) < 3 {
+		return content
+	}
+
+	first := strings.TrimSpace(lines[0])
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if !strings.HasPrefix(first, "if [ ! -f ") || !strings.HasSuffix(first, "]; then") || last != "fi" {
+		return content
+	}
+
+	inner := strings.Join(lines[1:len(lines)-1], "\n")
+	return inner
+}
+
 // WritePrereqMarker persists a marker file that signals the prerequisite body
 // should be skipped because verification passed.
 func WritePrereqMarker(markerPath, display string) error {
@@ -0,0 +1,108 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// Reads a report written by WriteToJSONFile, along with its content.
+func readJSONReport(path string) (*Report, []byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var report Report
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, nil, fmt.Errorf("'%s' is not a JSON test report: %w", path, err)
+	}
+	return &report, content, nil
+}
+
+// Creates a scenario that runs the code blocks of a JSON report again with
+// the values the report captured for its environment variables. The export
+// statements of the code blocks are rewritten to those values, so that
+// variables generated from $RANDOM or the current time get the same values as
+// in the reported run. environmentVariableOverrides take precedence over the
+// captured values, as `--var` does for markdown.
+//
+// Only the code blocks listed by the report are run. Reports of `ie test`
+// list every code block of the scenario, reports of `ie execute` stop at the
+// code block that failed.
+func CreateScenarioFromReport(
+	path string,
+	environmentVariableOverrides map[string]string,
+) (*Scenario, error) {
+	report, source, err := readJSONReport(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(report.CodeBlocks) == 0 {
+		return nil, fmt.Errorf("the report '%s' has no code blocks to replay", path)
+	}
+
+	codeBlocks := make([]StatefulCodeBlock, len(report.CodeBlocks))
+	copy(codeBlocks, report.CodeBlocks)
+	sort.SliceStable(codeBlocks, func(i, j int) bool {
+		if codeBlocks[i].StepNumber != codeBlocks[j].StepNumber {
+			return codeBlocks[i].StepNumber < codeBlocks[j].StepNumber
+		}
+		return codeBlocks[i].CodeBlockNumber < codeBlocks[j].CodeBlockNumber
+	})
+
+	environmentVariables := lib.CopyMap(report.EnvironmentVariables)
+	if environmentVariables == nil {
+		environmentVariables = make(map[string]string)
+	}
+	for key, value := range environmentVariableOverrides {
+		environmentVariables[key] = value
+	}
+
+	var steps []Step
+	for index, codeBlock := range codeBlocks {
+		if index == 0 || codeBlock.StepNumber != codeBlocks[index-1].StepNumber {
+			steps = append(steps, Step{
+				Name:    codeBlock.StepName,
+				Section: codeBlock.CodeBlock.Section,
+			})
+		}
+		step := &steps[len(steps)-1]
+		step.CodeBlocks = append(step.CodeBlocks, codeBlock.CodeBlock)
+	}
+
+	pinnedValues := make(map[string]string, len(environmentVariables))
+	for key, value := range environmentVariables {
+		pinnedValues[key] = lib.QuoteForShell(value)
+	}
+	for index := range steps {
+		overrideExportedVariables(steps[index].CodeBlocks, pinnedValues)
+	}
+
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		absolutePath = path
+	}
+
+	logging.GlobalLogger.Infof(
+		"Rebuilt the scenario '%s' from the report '%s' with %d code blocks",
+		report.Name,
+		path,
+		len(codeBlocks),
+	)
+
+	return &Scenario{
+		Name:        report.Name,
+		IntroText:   report.Introduction,
+		Steps:       steps,
+		Properties:  report.Properties,
+		Environment: environmentVariables,
+		Source:      source,
+		SourcePath:  absolutePath,
+	}, nil
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestReport(t *testing.T, report Report) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := report.WriteToJSONFile(path); err != nil {
+		t.Fatalf("failed to write report: %v", err)
+	}
+	return path
+}
+
+func TestCreateScenarioFromReport(t *testing.T) {
+	report := BuildReport("Deploy a VM")
+	report.WithIntroduction("Deploys a VM.").
+		WithProperties(map[string]interface{}{"author": "someone"}).
+		WithEnvironmentVariables(map[string]string{
+			"MY_RG":       "rg-1234",
+			"MY_LOCATION": "eastus",
+			"MY_VM":       "vm 'one'",
+		}).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{
+				CodeBlock:       parsers.CodeBlock{Language: "bash", Content: "az vm create -n $MY_VM -g $MY_RG\n"},
+				StepName:        "Create a VM",
+				StepNumber:      1,
+				CodeBlockNumber: 0,
+				Error:           errors.New("command exited with 'exit status 1'"),
+			},
+			{
+				CodeBlock:       parsers.CodeBlock{Language: "bash", Content: "az group create -n $MY_RG -l $MY_LOCATION\n"},
+				StepName:        "Create a resource group",
+				StepNumber:      0,
+				CodeBlockNumber: 1,
+				Success:         true,
+			},
+			{
+				CodeBlock: parsers.CodeBlock{
+					Language: "bash",
+					Content:  "export MY_RG=\"rg-$RANDOM\" && export MY_LOCATION=eastus\nexport MY_VM=\"vm $(whoami)\"\n",
+				},
+				StepName:        "Create a resource group",
+				StepNumber:      0,
+				CodeBlockNumber: 0,
+				Success:         true,
+			},
+		})
+	path := writeTestReport(t, report)
+
+	t.Run("Code blocks are grouped into steps in order", func(t *testing.T) {
+		scenario, err := CreateScenarioFromReport(path, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Deploy a VM", scenario.Name)
+		assert.Equal(t, "Deploys a VM.", scenario.IntroText)
+		assert.Equal(t, "someone", scenario.Properties["author"])
+		assert.Len(t, scenario.Steps, 2)
+		assert.Equal(t, "Create a resource group", scenario.Steps[0].Name)
+		assert.Len(t, scenario.Steps[0].CodeBlocks, 2)
+		assert.Contains(t, scenario.Steps[0].CodeBlocks[1].Content, "az group create")
+		assert.Equal(t, "Create a VM", scenario.Steps[1].Name)
+		assert.True(t, filepath.IsAbs(scenario.SourcePath))
+	})
+
+	t.Run("Exports are pinned to the captured values", func(t *testing.T) {
+		scenario, err := CreateScenarioFromReport(path, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "rg-1234", scenario.Environment["MY_RG"])
+		assert.Equal(
+			t,
+			"export MY_RG='rg-1234' && export MY_LOCATION='eastus' \nexport MY_VM='vm '\\''one'\\''' \n",
+			scenario.Steps[0].CodeBlocks[0].Content,
+		)
+	})
+
+	t.Run("Overrides take precedence over captured values", func(t *testing.T) {
+		scenario, err := CreateScenarioFromReport(path, map[string]string{"MY_LOCATION": "westus"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "westus", scenario.Environment["MY_LOCATION"])
+		assert.Contains(t, scenario.Steps[0].CodeBlocks[0].Content, "export MY_LOCATION='westus'")
+	})
+}
+
+func TestCreateScenarioFromReportErrors(t *testing.T) {
+	t.Run("Markdown is not a report", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scenario.md")
+		assert.NoError(t, os.WriteFile(path, []byte("# Scenario\n"), 0o644))
+
+		_, err := CreateScenarioFromReport(path, nil)
+		assert.ErrorContains(t, err, "is not a JSON test report")
+	})
+
+	t.Run("Reports without code blocks", func(t *testing.T) {
+		path := writeTestReport(t, BuildReport("Empty"))
+
+		_, err := CreateScenarioFromReport(path, nil)
+		assert.ErrorContains(t, err, "has no code blocks to replay")
+	})
+}
+
+func TestStatefulCodeBlockJSON(t *testing.T) {
+	t.Run("Errors are written as their message", func(t *testing.T) {
+		encoded, err := json.Marshal(StatefulCodeBlock{StepName: "Step", Error: errors.New("boom")})
+		assert.NoError(t, err)
+
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal(encoded, &decoded))
+		assert.Equal(t, "boom", decoded["error"])
+		assert.Equal(t, "Step", decoded["stepName"])
+
+		var codeBlock StatefulCodeBlock
+		assert.NoError(t, json.Unmarshal(encoded, &codeBlock))
+		assert.EqualError(t, codeBlock.Error, "boom")
+		assert.Equal(t, "Step", codeBlock.StepName)
+	})
+
+	t.Run("Code blocks without errors", func(t *testing.T) {
+		encoded, err := json.Marshal(StatefulCodeBlock{Success: true})
+		assert.NoError(t, err)
+
+		var codeBlock StatefulCodeBlock
+		assert.NoError(t, json.Unmarshal(encoded, &codeBlock))
+		assert.NoError(t, codeBlock.Error)
+		assert.True(t, codeBlock.Success)
+	})
+
+	t.Run("Errors of older reports", func(t *testing.T) {
+		var codeBlock StatefulCodeBlock
+		assert.NoError(t, json.Unmarshal([]byte(`{"error": {}, "stdOut": "out"}`), &codeBlock))
+		assert.Error(t, codeBlock.Error)
+		assert.Equal(t, "out", codeBlock.StdOut)
+	})
+}
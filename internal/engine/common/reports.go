@@ -2,19 +2,26 @@ package common
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
 )
 
 type Report struct {
-	Name                 string                 `json:"name"`
-	Properties           map[string]interface{} `json:"properties"`
-	EnvironmentVariables map[string]string      `json:"environmentVariables"`
-	Success              bool                   `json:"success"`
-	Error                string                 `json:"error"`
-	FailedAtStep         int                    `json:"failedAtStep"`
-	CodeBlocks           []StatefulCodeBlock    `json:"steps"`
+	Name                 string                  `json:"name"`
+	Introduction         string                  `json:"introduction,omitempty"`
+	Properties           map[string]interface{}  `json:"properties"`
+	EnvironmentVariables map[string]string       `json:"environmentVariables"`
+	Success              bool                    `json:"success"`
+	Error                string                  `json:"error"`
+	TimedOut             bool                    `json:"timedOut"`
+	FailedAtStep         int                     `json:"failedAtStep"`
+	FailedAt             *parsers.SourcePosition `json:"failedAt,omitempty"`
+	CodeBlocks           []StatefulCodeBlock     `json:"steps"`
 }
 
 func (report *Report) WithProperties(properties map[string]interface{}) *Report {
@@ -22,13 +29,27 @@ func (report *Report) WithProperties(properties map[string]interface{}) *Report
 	return report
 }
 
+// Records the markdown introducing the scenario, shown by HTML reports.
+func (report *Report) WithIntroduction(introduction string) *Report {
+	report.Introduction = introduction
+	return report
+}
+
 func (report *Report) WithEnvironmentVariables(envVars map[string]string) *Report {
 	report.EnvironmentVariables = envVars
 	return report
 }
 
+// Records the code blocks of the scenario, along with how the output of those
+// that failed differs from their result blocks.
 func (report *Report) WithCodeBlocks(codeBlocks []StatefulCodeBlock) *Report {
-	report.CodeBlocks = codeBlocks
+	report.CodeBlocks = make([]StatefulCodeBlock, len(codeBlocks))
+	for index, codeBlock := range codeBlocks {
+		if !codeBlock.Success && codeBlock.WasExecuted() && hasExpectedOutput(codeBlock.CodeBlock) {
+			codeBlock.Diff = OutputDiff(codeBlock.CodeBlock.ExpectedOutput, codeBlock.StdOut)
+		}
+		report.CodeBlocks[index] = codeBlock
+	}
 	return report
 }
 
@@ -39,6 +60,22 @@ func (report *Report) WithError(err error) *Report {
 
 	report.Error = err.Error()
 	report.Success = false
+	report.TimedOut = errors.Is(err, shells.ErrTimeout)
+	return report
+}
+
+// Records the code block the scenario failed on, including where it is
+// declared in the markdown source.
+func (report *Report) WithFailedCodeBlock(codeBlock *StatefulCodeBlock) *Report {
+	if codeBlock == nil {
+		return report
+	}
+
+	report.FailedAtStep = codeBlock.StepNumber
+	if codeBlock.CodeBlock.Position.IsKnown() {
+		position := codeBlock.CodeBlock.Position
+		report.FailedAt = &position
+	}
 	return report
 }
 
@@ -67,6 +104,53 @@ func (report *Report) WriteToJSONFile(outputPath string) error {
 	return nil
 }
 
+// ReportFormat identifies how a report is written to a file.
+type ReportFormat string
+
+const (
+	// The report as JSON, see docs/specs/test-reporting.md.
+	ReportFormatJSON ReportFormat = "json"
+	// The report as JUnit XML, for CI systems that show test results.
+	ReportFormatJUnit ReportFormat = "junit"
+	// The report as a single HTML page, for people who do not read JSON.
+	ReportFormatHTML ReportFormat = "html"
+)
+
+// ParseReportFormat converts a raw string into a typed ReportFormat. An empty
+// string selects JSON.
+func ParseReportFormat(format string) (ReportFormat, error) {
+	switch ReportFormat(format) {
+	case "", ReportFormatJSON:
+		return ReportFormatJSON, nil
+	case ReportFormatJUnit:
+		return ReportFormatJUnit, nil
+	case ReportFormatHTML:
+		return ReportFormatHTML, nil
+	default:
+		return "", fmt.Errorf(
+			"invalid report format %q (expected %q, %q or %q)",
+			format,
+			ReportFormatJSON,
+			ReportFormatJUnit,
+			ReportFormatHTML,
+		)
+	}
+}
+
+// Writes the report to a file in the given format.
+func (report *Report) WriteToFile(outputPath string, format ReportFormat) error {
+	switch format {
+	case "", ReportFormatJSON:
+		return report.WriteToJSONFile(outputPath)
+	case ReportFormatJUnit:
+		return report.WriteToJUnitFile(outputPath)
+	case ReportFormatHTML:
+		return report.WriteToHTMLFile(outputPath)
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
+
 func BuildReport(name string) Report {
 	return Report{
 		Name:                 name,
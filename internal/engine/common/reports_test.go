@@ -0,0 +1,40 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportRecordsFailures(t *testing.T) {
+	t.Run("Timeouts are flagged", func(t *testing.T) {
+		report := BuildReport("scenario")
+		report.WithError(fmt.Errorf("failed to execute code block 0 on step 0.\nError: %w", shells.ErrTimeout))
+
+		assert.False(t, report.Success)
+		assert.True(t, report.TimedOut)
+	})
+
+	t.Run("Other failures are not timeouts", func(t *testing.T) {
+		report := BuildReport("scenario")
+		report.WithError(fmt.Errorf("command exited with 'exit status 1'"))
+
+		assert.False(t, report.Success)
+		assert.False(t, report.TimedOut)
+	})
+
+	t.Run("Failed code block position", func(t *testing.T) {
+		position := parsers.SourcePosition{File: "scenario.md", StartLine: 12, StartColumn: 1, EndLine: 14}
+		report := BuildReport("scenario")
+		report.WithFailedCodeBlock(&StatefulCodeBlock{
+			CodeBlock:  parsers.CodeBlock{Position: position},
+			StepNumber: 2,
+		})
+
+		assert.Equal(t, 2, report.FailedAtStep)
+		assert.Equal(t, &position, report.FailedAt)
+	})
+}
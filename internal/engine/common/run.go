@@ -0,0 +1,71 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// Runs the code blocks of the given steps one after the other without any
+// user interface, stopping at the first code block that fails. Code blocks
+// are stopped once ctx is done. Progress is recorded with checkpoints, and
+// code blocks completed by a resumed run are skipped. The state of every code
+// block that ran is returned in order, the last one being the code block that
+// failed if any.
+func RunCodeBlocks(
+	ctx context.Context,
+	steps []Step,
+	env map[string]string,
+	checkpoints *Checkpointer,
+) ([]StatefulCodeBlock, error) {
+	var codeBlocks []StatefulCodeBlock
+	for stepNumber, step := range steps {
+		for blockNumber, block := range step.CodeBlocks {
+			if checkpoints.Completed(stepNumber, blockNumber) {
+				continue
+			}
+
+			state := StatefulCodeBlock{
+				StepName:        step.Name,
+				CodeBlock:       block,
+				StepNumber:      stepNumber,
+				CodeBlockNumber: blockNumber,
+			}
+			checkpoints.Record(stepNumber, blockNumber)
+
+			switch message := ExecuteCodeBlock(state.EventContext(ctx), block, lib.CopyMap(env)).(type) {
+			case SuccessfulCommandMessage:
+				state.StdOut = message.StdOut
+				state.StdErr = message.StdErr
+				state.ExitCode = message.ExitCode
+				state.Success = true
+				state.SimilarityScore = message.SimilarityScore
+				state.Attempts = message.Attempts
+				state.Duration = message.Duration
+				codeBlocks = append(codeBlocks, state)
+				logging.GlobalLogger.Infof("Finished executing:\n %s", block.Content)
+			case FailedCommandMessage:
+				state.StdOut = message.StdOut
+				state.StdErr = message.StdErr
+				state.ExitCode = message.ExitCode
+				state.Error = message.Error
+				state.SimilarityScore = message.SimilarityScore
+				state.TimedOut = errors.Is(message.Error, shells.ErrTimeout)
+				state.Attempts = message.Attempts
+				state.Duration = message.Duration
+				codeBlocks = append(codeBlocks, state)
+				return codeBlocks, fmt.Errorf(
+					"failed to execute code block %d on step %d: %w",
+					blockNumber,
+					stepNumber,
+					message.Error,
+				)
+			}
+		}
+	}
+	return codeBlocks, nil
+}
@@ -44,6 +44,7 @@ func injectPrerequisitesRecursively(
 		environmentVariables:    environmentVariables,
 		seenPrereqs:             seenPrereqs,
 		prerequisiteSectionUsed: prerequisiteSectionUsed,
+		includes:                newIncludeResolutionContext(languagesToExecute, properties, environmentVariables),
 	}
 
 	return ctx.inject(codeBlocks, markdown, source, path)
@@ -57,6 +58,7 @@ type prerequisiteInjectionContext struct {
 	environmentVariables    map[string]string
 	seenPrereqs             map[string]bool
 	prerequisiteSectionUsed *bool
+	includes                *includeResolutionContext
 }
 
 func (ctx *prerequisiteInjectionContext) inject(
@@ -111,7 +113,8 @@ func (ctx *prerequisiteInjectionContext) processPrerequisite(
 		resolvedURL,
 	)
 
-	prerequisiteCodeBlocks := parsers.ExtractCodeBlocksFromAst(prerequisiteMarkdown, prerequisiteSource, ctx.languagesToExecute, resolvedURL)
+	prerequisiteCodeBlocks, prerequisiteIncludes := parsers.ExtractCodeBlocksAndIncludesFromAst(prerequisiteMarkdown, prerequisiteSource, ctx.languagesToExecute, resolvedURL)
+	prerequisiteCodeBlocks = ctx.includes.expand(prerequisiteCodeBlocks, prerequisiteIncludes, resolvedURL)
 	verificationBlocks, bodyBlocks := partitionPrerequisiteBlocks(prerequisiteCodeBlocks)
 
 	beforePrereqs, afterPrereqs := splitScenarioBlocks(codeBlocks)
@@ -311,7 +314,7 @@ func wrapPrerequisiteBodyBlocks(markerFile, display, source string, bodyBlocks [
 func (ctx *prerequisiteInjectionContext) markerFile(prereqTitle string) string {
 	slug := strings.ToLower(prereqTitle)
 	slug = prerequisiteSlugRegex.ReplaceAllString(slug, "_")
-	return fmt.Sprintf("/tmp/prereq_%s_skip", slug)
+	return filepath.Join(lib.StateDirectory(), fmt.Sprintf("prereq_%s_skip", slug))
 }
 
 func formatAutoPrereqSectionAttribute(section string) string {
@@ -344,6 +347,8 @@ type Scenario struct {
 	Properties  map[string]interface{}
 	Environment map[string]string
 	Source      []byte
+	// The path or URL the scenario was loaded from.
+	SourcePath string
 }
 
 // Get the markdown source for the scenario as a string.
@@ -388,10 +393,11 @@ func RegisterMissingPrerequisite(msg string) {
 	missingPrereqMessages = append(missingPrereqMessages, msg)
 }
 
-// SummarizeMissingPrerequisites logs a consolidated, de-duplicated summary of any missing prerequisites.
+// SummarizeMissingPrerequisites logs a consolidated, de-duplicated summary of any missing prerequisites
+// and skipped includes.
 // Intended to be called once at the end of scenario execution.
 func SummarizeMissingPrerequisites() {
-	unique := drainMissingPrerequisites()
+	unique := append(drainMissingPrerequisites(), DrainIncludeErrors()...)
 	for _, m := range unique {
 		logging.GlobalLogger.Warn(m)
 	}
@@ -406,20 +412,40 @@ func DrainMissingPrerequisites() []string {
 }
 
 func drainMissingPrerequisites() []string {
-	if len(missingPrereqMessages) == 0 {
+	return drainMessages(&missingPrereqMessages)
+}
+
+// includeErrorMessages holds the includes that could not be spliced into the
+// scenario, because they could not be loaded or would include themselves.
+var includeErrorMessages []string
+
+// RegisterIncludeError records a warning message about an include that was
+// skipped, for later summarization alongside missing prerequisites.
+func RegisterIncludeError(msg string) {
+	includeErrorMessages = append(includeErrorMessages, msg)
+}
+
+// DrainIncludeErrors returns the de-duplicated include errors recorded since
+// the last call and clears them.
+func DrainIncludeErrors() []string {
+	return drainMessages(&includeErrorMessages)
+}
+
+func drainMessages(messages *[]string) []string {
+	if len(*messages) == 0 {
 		return nil
 	}
 
 	seen := make(map[string]bool)
-	unique := make([]string, 0, len(missingPrereqMessages))
-	for _, m := range missingPrereqMessages {
+	unique := make([]string, 0, len(*messages))
+	for _, m := range *messages {
 		if !seen[m] {
 			seen[m] = true
 			unique = append(unique, m)
 		}
 	}
 	sort.Strings(unique)
-	missingPrereqMessages = nil
+	*messages = nil
 	return unique
 }
 
@@ -524,6 +550,9 @@ func resolveMarkdownSource(path string) ([]byte, error) {
 	return os.ReadFile(path)
 }
 
+// The languages of the code blocks run when executing or testing a scenario.
+var ExecutableLanguages = []string{"bash", "azurecli", "azurecli-interactive", "terraform"}
+
 // Creates a scenario object from a given markdown file. languagesToExecute is
 // used to filter out code blocks that should not be parsed out of the markdown
 // file.
@@ -537,12 +566,27 @@ func CreateScenarioFromMarkdown(
 		return nil, err
 	}
 
+	return CreateScenarioFromMarkdownSource(source, path, languagesToExecute, environmentVariableOverrides)
+}
+
+// Creates a scenario object from markdown that has already been read. path is
+// where the markdown came from, used to find its INI file and resolve the
+// documents it links to. It may be empty for markdown that does not come from
+// a file.
+func CreateScenarioFromMarkdownSource(
+	source []byte,
+	path string,
+	languagesToExecute []string,
+	environmentVariableOverrides map[string]string,
+) (*Scenario, error) {
+	var err error
+
 	// Load environment variables
 	markdownINI := strings.TrimSuffix(path, filepath.Ext(path)) + ".ini"
 	environmentVariables := make(map[string]string)
 
 	// Check if the INI file exists & load it.
-	if !fs.FileExists(markdownINI) {
+	if path == "" || !fs.FileExists(markdownINI) {
 		logging.GlobalLogger.Infof("INI file '%s' does not exist, skipping...", markdownINI)
 	} else {
 		logging.GlobalLogger.Infof("INI file '%s' exists, loading...", markdownINI)
@@ -564,8 +608,11 @@ func CreateScenarioFromMarkdown(
 		environmentVariables[key] = value
 	}
 
-	// Extract the code blocks from the markdown file.
-	codeBlocks := parsers.ExtractCodeBlocksFromAst(markdown, source, languagesToExecute, path)
+	// Extract the code blocks from the markdown file and splice in the code
+	// blocks of any included documents.
+	codeBlocks, includes := parsers.ExtractCodeBlocksAndIncludesFromAst(markdown, source, languagesToExecute, path)
+	codeBlocks = newIncludeResolutionContext(languagesToExecute, properties, environmentVariables).
+		expand(codeBlocks, includes, path)
 	logging.GlobalLogger.WithField("CodeBlocks", codeBlocks).
 		Debugf("Found %d code blocks", len(codeBlocks))
 
@@ -578,40 +625,12 @@ func CreateScenarioFromMarkdown(
 	// Use a recursive helper so that prerequisites of prerequisites are also processed.
 	codeBlocks = injectPrerequisitesRecursively(codeBlocks, markdown, source, path, languagesToExecute, introText, prerequisiteSectionText, properties, environmentVariables, make(map[string]bool), &prerequisiteSectionUsed)
 
-	varsToExport := lib.CopyMap(environmentVariableOverrides)
+	applyDocumentNormalization(codeBlocks, properties, path)
+
 	for key, value := range environmentVariableOverrides {
 		environmentVariables[key] = value
-		logging.GlobalLogger.Debugf("Attempting to override %s with %s", key, value)
-		exportRegex := patterns.ExportVariableRegex(key)
-
-		for index, codeBlock := range codeBlocks {
-			matches := exportRegex.FindAllStringSubmatch(codeBlock.Content, -1)
-
-			if len(matches) != 0 {
-				logging.GlobalLogger.Debugf(
-					"Found %d matches for %s, deleting from varsToExport",
-					len(matches),
-					key,
-				)
-				delete(varsToExport, key)
-			} else {
-				logging.GlobalLogger.Debugf("Found no matches for %s inside of %s", key, codeBlock.Content)
-			}
-
-			for _, match := range matches {
-				oldLine := match[0]
-				oldValue := match[1]
-
-				// Replace the old export with the new export statement
-				newLine := strings.Replace(oldLine, oldValue, value+" ", 1)
-				logging.GlobalLogger.Debugf("Replacing '%s' with '%s'", oldLine, newLine)
-
-				// Update the code block with the new export statement
-				codeBlocks[index].Content = strings.Replace(codeBlock.Content, oldLine, newLine, 1)
-			}
-
-		}
 	}
+	varsToExport := overrideExportedVariables(codeBlocks, environmentVariableOverrides)
 
 	// If there are some variables left after going through each of the codeblocks,
 	// do not update the scenario
@@ -646,6 +665,9 @@ func CreateScenarioFromMarkdown(
 			err,
 		)
 		title = filepath.Base(path)
+		if path == "" {
+			title = "Untitled scenario"
+		}
 	}
 
 	logging.GlobalLogger.Infof("Successfully built out the scenario: %s", title)
@@ -658,9 +680,71 @@ func CreateScenarioFromMarkdown(
 		Properties:  properties,
 		MarkdownAst: markdown,
 		Source:      source,
+		SourcePath:  path,
 	}, nil
 }
 
+// Applies the normalize key of the front matter to the result blocks. The
+// masks and replacements of the document run before those declared by a
+// result block.
+func applyDocumentNormalization(codeBlocks []parsers.CodeBlock, properties map[string]interface{}, path string) {
+	value, ok := properties["normalize"]
+	if !ok {
+		return
+	}
+	normalization, err := parsers.ParseOutputNormalization(value)
+	if err != nil {
+		logging.GlobalLogger.Warnf("The normalize front matter of %s is invalid: %s", path, err)
+		return
+	}
+
+	for index := range codeBlocks {
+		if hasExpectedOutput(codeBlocks[index]) {
+			codeBlocks[index].ExpectedOutput.Normalization = normalization.Merge(
+				codeBlocks[index].ExpectedOutput.Normalization,
+			)
+		}
+	}
+}
+
+// Replaces the values exported by the code blocks for the overridden
+// variables. Returns the overrides that no code block exports.
+func overrideExportedVariables(codeBlocks []parsers.CodeBlock, overrides map[string]string) map[string]string {
+	notExported := lib.CopyMap(overrides)
+	for key, value := range overrides {
+		logging.GlobalLogger.Debugf("Attempting to override %s with %s", key, value)
+		exportRegex := patterns.ExportVariableRegex(key)
+
+		for index := range codeBlocks {
+			matches := exportRegex.FindAllStringSubmatch(codeBlocks[index].Content, -1)
+
+			if len(matches) != 0 {
+				logging.GlobalLogger.Debugf(
+					"Found %d matches for %s, deleting from varsToExport",
+					len(matches),
+					key,
+				)
+				delete(notExported, key)
+			} else {
+				logging.GlobalLogger.Debugf("Found no matches for %s inside of %s", key, codeBlocks[index].Content)
+			}
+
+			for _, match := range matches {
+				oldLine := match[0]
+				oldValue := match[1]
+
+				// Replace the old export with the new export statement
+				newLine := strings.Replace(oldLine, oldValue, value+" ", 1)
+				logging.GlobalLogger.Debugf("Replacing '%s' with '%s'", oldLine, newLine)
+
+				// Update the code block with the new export statement
+				codeBlocks[index].Content = strings.Replace(codeBlocks[index].Content, oldLine, newLine, 1)
+			}
+		}
+	}
+	return notExported
+}
+
 // Convert a scenario into a shell script
 func (s *Scenario) ToShellScript() string {
 	var script strings.Builder
@@ -227,6 +227,25 @@ func TestVariableOverrides(t *testing.T) {
 			`export VAR2=var2_value`,
 		)
 	})
+
+	t.Run("Override every export of a variable in a code block", func(t *testing.T) {
+		source := "# Scenario\n\n## Step\n\n```bash\nexport MY_VAR=first\necho $MY_VAR\nexport MY_VAR=second\n```\n"
+		scenario, err := CreateScenarioFromMarkdownSource(
+			[]byte(source),
+			"",
+			[]string{"bash"},
+			map[string]string{
+				"MY_VAR": "my_value",
+			},
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(
+			t,
+			"export MY_VAR=my_value \necho $MY_VAR\nexport MY_VAR=my_value \n",
+			scenario.Steps[0].CodeBlocks[0].Content,
+		)
+	})
 }
 
 func TestMissingPrerequisiteDoesNotFailScenarioCreation(t *testing.T) {
@@ -323,3 +342,87 @@ func TestPrerequisiteVerificationSkipWrapping(t *testing.T) {
 		t.Fatalf("expected setup block to be conditionally wrapped to allow skipping")
 	}
 }
+
+func TestIncludesAreSplicedAtDirectivePosition(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	writeFile("Common/login.md", "---\nms.author: included\nshared.key: fromInclude\n---\n# Login\n\nLog in to Azure.\n\n```bash\necho \"login\"\n```\n\n<!-- include: group.md -->\n")
+	writeFile("Common/group.md", "# Group\n\n<!--\n```variables\nexport GROUP_NAME=myGroup\n```\n-->\n\nCreate a resource group.\n\n```bash\necho \"group\"\n```\n")
+	scenarioPath := writeFile("scenario.md", "---\nms.author: main\n---\n# Scenario\n\n## Setup\n\nBefore the include.\n\n```bash\necho \"before\"\n```\n\n<!-- include: Common/login.md -->\n\nAfter the include.\n\n```bash\necho \"after\"\n```\n")
+
+	scenario, err := CreateScenarioFromMarkdown(scenarioPath, []string{"bash"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, scenario.Steps, 1)
+
+	blocks := scenario.Steps[0].CodeBlocks
+	var contents []string
+	for _, block := range blocks {
+		contents = append(contents, strings.TrimSpace(block.Content))
+		assert.Equal(t, "Setup", block.Header)
+	}
+	assert.Equal(t, []string{`echo "before"`, `echo "login"`, `echo "group"`, `echo "after"`}, contents)
+	assert.Equal(t, "Log in to Azure.", blocks[1].Description)
+	assert.Equal(t, "After the include.", blocks[3].Description)
+	assert.Equal(t, scenarioPath, blocks[0].Position.File)
+	assert.Equal(t, filepath.Join(dir, "Common", "login.md"), blocks[1].Position.File)
+	assert.Equal(t, 9, blocks[1].Position.StartLine)
+	assert.Equal(t, "myGroup", scenario.Environment["GROUP_NAME"])
+	assert.Equal(t, "main", scenario.Properties["ms.author"])
+	assert.Equal(t, "fromInclude", scenario.Properties["shared.key"])
+}
+
+func TestIncludeCyclesAreSkipped(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.md")
+	second := filepath.Join(dir, "second.md")
+	assert.NoError(t, os.WriteFile(first, []byte("# First\n\nFirst block.\n\n```bash\necho \"first\"\n```\n\n<!-- include: second.md -->\n"), 0o644))
+	assert.NoError(t, os.WriteFile(second, []byte("# Second\n\nSecond block.\n\n```bash\necho \"second\"\n```\n\n<!-- include: first.md -->\n"), 0o644))
+
+	DrainMissingPrerequisites()
+	DrainIncludeErrors()
+	scenario, err := CreateScenarioFromMarkdown(first, []string{"bash"}, nil)
+	assert.NoError(t, err)
+
+	total := 0
+	for _, step := range scenario.Steps {
+		total += len(step.CodeBlocks)
+	}
+	assert.Equal(t, 2, total)
+
+	messages := DrainIncludeErrors()
+	assert.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "creates a cycle")
+	assert.Empty(t, DrainMissingPrerequisites())
+}
+
+func TestFrontMatterNormalizationAppliesToResultBlocks(t *testing.T) {
+	content := "---\nnormalize:\n  masks: [uuid]\n  replace:\n    - pattern: 'rg-[a-z0-9]+'\n      with: rg\n---\n" +
+		"# Normalized\n\n" +
+		"## Create\n\n```bash\necho created\n```\n\n" +
+		"<!-- normalize masks: [ip] -->\n<!--expected_similarity=1-->\n\n```text\ncreated\n```\n\n" +
+		"## Clean up\n\n```bash\necho done\n```\n"
+	path := filepath.Join(t.TempDir(), "normalized.md")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	scenario, err := CreateScenarioFromMarkdown(path, []string{"bash"}, nil)
+	assert.NoError(t, err)
+
+	normalization := scenario.Steps[0].CodeBlocks[0].ExpectedOutput.Normalization
+	if assert.NotNil(t, normalization) {
+		assert.Equal(t, []string{"uuid", "ip"}, normalization.Masks)
+		assert.Len(t, normalization.Replacements, 1)
+	}
+	// Code blocks without a result block have nothing to normalize.
+	assert.Nil(t, scenario.Steps[1].CodeBlocks[0].ExpectedOutput.Normalization)
+}
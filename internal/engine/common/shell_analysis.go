@@ -0,0 +1,504 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// The languages of the code blocks parsed as bash during inspection.
+var shellLanguages = map[string]bool{
+	"bash":                 true,
+	"sh":                   true,
+	"azurecli":             true,
+	"azurecli-interactive": true,
+}
+
+// Commands whose arguments are paths, so that splitting an unquoted expansion
+// in any of them names other files.
+var pathCommands = map[string]bool{
+	"cd": true, "rm": true, "cp": true, "mv": true, "mkdir": true, "rmdir": true,
+	"touch": true, "cat": true, "ls": true, "chmod": true, "chown": true,
+	"ln": true, "tar": true, "unzip": true, "source": true, ".": true,
+}
+
+// Commands that wait for the user in the terminal.
+var terminalCommands = map[string]bool{
+	"vi": true, "vim": true, "nano": true, "emacs": true,
+	"less": true, "more": true, "top": true, "htop": true, "passwd": true,
+}
+
+// Arguments of az login that sign in without a browser or a prompt.
+var nonInteractiveLoginFlags = map[string]bool{
+	"--use-device-code":   true,
+	"--service-principal": true,
+	"--identity":          true,
+	"-i":                  true,
+	"--federated-token":   true,
+	"--password":          true,
+	"-p":                  true,
+}
+
+// Parses the bash code blocks of the scenario and checks them for syntax
+// errors and for commands that behave unexpectedly when run by the engine,
+// which runs every code block with `set -e` and without a terminal to type in.
+func validateShellCode(s *Scenario, config InspectConfig) []ValidationIssue {
+	var issues []ValidationIssue
+	var analyzers []*shellAnalyzer
+	var files []*syntax.File
+	for _, step := range s.Steps {
+		for _, block := range step.CodeBlocks {
+			if !shellLanguages[strings.ToLower(block.Language)] || isSystemGeneratedBlock(block) {
+				continue
+			}
+			analyzer := &shellAnalyzer{
+				block:       block,
+				lines:       strings.Split(block.Content, "\n"),
+				destructive: DestructiveCommands(config.DestructiveCommands),
+				config:      config,
+			}
+			file, ok := analyzer.parse()
+			if !ok {
+				issues = append(issues, analyzer.issues...)
+				continue
+			}
+			analyzers = append(analyzers, analyzer)
+			files = append(files, file)
+		}
+	}
+
+	nonEmpty := nonEmptyVariables(files)
+	for index, analyzer := range analyzers {
+		analyzer.nonEmpty = nonEmpty
+		analyzer.statements(files[index].Stmts, shellContext{topLevel: true})
+		issues = append(issues, analyzer.issues...)
+	}
+	return issues
+}
+
+// Parses the code block, reporting the syntax error if it is not valid bash.
+func (a *shellAnalyzer) parse() (*syntax.File, bool) {
+	parser := syntax.NewParser(syntax.Variant(syntax.LangBash), syntax.KeepComments(false))
+	file, err := parser.Parse(strings.NewReader(a.block.Content), "")
+	if err == nil {
+		return file, true
+	}
+
+	var parseError syntax.ParseError
+	var langError syntax.LangError
+	switch {
+	case errors.As(err, &parseError):
+		a.report(parseError.Pos, RuleShellSyntax, ValidationSeverityError,
+			fmt.Sprintf("The code block is not valid bash: %s.", parseError.Text),
+			"Fix the syntax error; bash would stop at it before running any command of the block.")
+	case errors.As(err, &langError):
+		a.report(langError.Pos, RuleShellSyntax, ValidationSeverityError,
+			fmt.Sprintf("The code block uses %s, which bash does not support.", langError.Feature), "")
+	default:
+		a.report(syntax.Pos{}, RuleShellSyntax, ValidationSeverityError,
+			fmt.Sprintf("The code block is not valid bash: %s.", err), "")
+	}
+	return nil, false
+}
+
+// Returns the variables that the code blocks only ever assign values that are
+// not empty, e.g. literals or values starting with one, and the variables of
+// for loops.
+func nonEmptyVariables(files []*syntax.File) map[string]bool {
+	nonEmpty := make(map[string]bool)
+	assign := func(name string, value bool) {
+		previous, assigned := nonEmpty[name]
+		nonEmpty[name] = value && (previous || !assigned)
+	}
+	for _, file := range files {
+		syntax.Walk(file, func(node syntax.Node) bool {
+			switch node := node.(type) {
+			case *syntax.Assign:
+				if node.Name != nil && !node.Naked && !node.Append {
+					assign(node.Name.Value, node.Value != nil && isNonEmptyWord(node.Value))
+				}
+			case *syntax.WordIter:
+				if node.Name != nil {
+					assign(node.Name.Value, true)
+				}
+			}
+			return true
+		})
+	}
+	return nonEmpty
+}
+
+// Checks if a word always expands to a value that is not empty because it
+// contains literal text.
+func isNonEmptyWord(word *syntax.Word) bool {
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			if part.Value != "" {
+				return true
+			}
+		case *syntax.SglQuoted:
+			if part.Value != "" {
+				return true
+			}
+		case *syntax.DblQuoted:
+			if isNonEmptyWord(&syntax.Word{Parts: part.Parts}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Where a command runs, as far as the checks are concerned.
+type shellContext struct {
+	// Whether the exit code of the command is checked, e.g. in an if
+	// condition or on the left of &&, where set -e does not apply.
+	checked bool
+	// Whether the command reads its standard input from a file, a here
+	// document or a pipe rather than from the terminal.
+	inputRedirected bool
+	// Whether the command is run directly by the code block rather than in
+	// a function, loop or condition.
+	topLevel bool
+	// Whether the command is the last one of the code block, whose exit code
+	// is the exit code of the block.
+	last bool
+}
+
+type shellAnalyzer struct {
+	block  parsers.CodeBlock
+	lines  []string
+	issues []ValidationIssue
+	// The commands that delete resources or data.
+	destructive []DestructiveCommand
+	// The variables that are never empty, see nonEmptyVariables.
+	nonEmpty map[string]bool
+	config   InspectConfig
+}
+
+func (a *shellAnalyzer) report(pos syntax.Pos, rule string, severity ValidationSeverity, message string, suggestion string) {
+	position := a.block.Position
+	snippet := ""
+	if pos.IsValid() {
+		line := int(pos.Line())
+		position = a.block.Position.ContentLine(line - 1)
+		if position.IsKnown() {
+			position.StartColumn = int(pos.Col()) + a.block.Position.StartColumn - 1
+		}
+		if line <= len(a.lines) {
+			snippet = strings.TrimSpace(a.lines[line-1])
+		}
+	}
+	a.issues = append(a.issues, ValidationIssue{
+		RuleID:     rule,
+		Severity:   severity,
+		Message:    message,
+		Position:   position,
+		Snippet:    snippet,
+		Suggestion: suggestion,
+	})
+}
+
+func (a *shellAnalyzer) statements(stmts []*syntax.Stmt, ctx shellContext) {
+	last := ctx.last
+	for index, stmt := range stmts {
+		ctx.last = last && index == len(stmts)-1
+		if ctx.topLevel {
+			ctx.last = index == len(stmts)-1
+		}
+		a.statement(stmt, ctx)
+	}
+}
+
+func (a *shellAnalyzer) statement(stmt *syntax.Stmt, ctx shellContext) {
+	for _, redirect := range stmt.Redirs {
+		switch redirect.Op {
+		case syntax.RdrIn, syntax.RdrInOut, syntax.Hdoc, syntax.DashHdoc, syntax.WordHdoc:
+			ctx.inputRedirected = true
+		}
+		if redirect.Word != nil && redirect.Op != syntax.Hdoc && redirect.Op != syntax.DashHdoc && redirect.Op != syntax.WordHdoc {
+			a.unquotedExpansions(redirect.Word, true)
+		}
+	}
+	if stmt.Negated {
+		ctx.checked = true
+	}
+
+	switch cmd := stmt.Cmd.(type) {
+	case *syntax.CallExpr:
+		a.call(stmt, cmd, ctx)
+	case *syntax.BinaryCmd:
+		a.binary(cmd, ctx)
+	case *syntax.IfClause:
+		a.ifClause(cmd, ctx)
+	case *syntax.WhileClause:
+		a.condition(cmd.Cond, ctx)
+		a.statements(cmd.Do, nested(ctx))
+	case *syntax.ForClause:
+		a.statements(cmd.Do, nested(ctx))
+	case *syntax.CaseClause:
+		for _, item := range cmd.Items {
+			a.statements(item.Stmts, nested(ctx))
+		}
+	case *syntax.Block:
+		a.statements(cmd.Stmts, ctx)
+	case *syntax.Subshell:
+		a.statements(cmd.Stmts, ctx)
+	case *syntax.FuncDecl:
+		a.statement(cmd.Body, nested(ctx))
+	case *syntax.TimeClause:
+		if cmd.Stmt != nil {
+			a.statement(cmd.Stmt, ctx)
+		}
+	case *syntax.TestClause:
+		a.exitCodeChecks(cmd)
+	case *syntax.ArithmCmd:
+		if !ctx.checked {
+			a.report(cmd.Pos(), RuleSetErrexitPitfall, ValidationSeverityWarning,
+				"The arithmetic command fails when its result is 0, e.g. for ((count++)) when count is 0, which stops the code block as it runs with set -e.",
+				"Use an assignment such as count=$((count + 1)) instead.")
+		}
+	case *syntax.LetClause:
+		if !ctx.checked {
+			a.report(cmd.Pos(), RuleSetErrexitPitfall, ValidationSeverityWarning,
+				"let fails when its last expression is 0, which stops the code block as it runs with set -e.",
+				"Use an assignment such as count=$((count + 1)) instead.")
+		}
+	}
+}
+
+// The context of commands that do not run directly in the code block.
+func nested(ctx shellContext) shellContext {
+	ctx.topLevel = false
+	ctx.last = false
+	return ctx
+}
+
+// Checks the commands of a condition, whose exit codes are checked.
+func (a *shellAnalyzer) condition(stmts []*syntax.Stmt, ctx shellContext) {
+	ctx = nested(ctx)
+	ctx.checked = true
+	for _, stmt := range stmts {
+		if call, ok := stmt.Cmd.(*syntax.CallExpr); ok && isTestCommand(call) {
+			a.exitCodeChecks(call)
+		}
+	}
+	a.statements(stmts, ctx)
+}
+
+func (a *shellAnalyzer) ifClause(clause *syntax.IfClause, ctx shellContext) {
+	for ; clause != nil; clause = clause.Else {
+		a.condition(clause.Cond, ctx)
+		a.statements(clause.Then, nested(ctx))
+	}
+}
+
+func (a *shellAnalyzer) binary(cmd *syntax.BinaryCmd, ctx shellContext) {
+	switch cmd.Op {
+	case syntax.Pipe, syntax.PipeAll:
+		left := ctx
+		left.last = false
+		a.statement(cmd.X, left)
+		right := ctx
+		right.inputRedirected = true
+		a.statement(cmd.Y, right)
+	default:
+		if ctx.last && cmd.Op == syntax.AndStmt && !ctx.checked && isTestStatement(cmd.X) {
+			a.report(cmd.Pos(), RuleSetErrexitPitfall, ValidationSeverityWarning,
+				"The code block ends with a test followed by &&, so the block fails whenever the test is false.",
+				"Use an if statement instead, or end the block with a command that succeeds.")
+		}
+		inner := ctx
+		inner.checked = true
+		inner.last = false
+		a.statement(cmd.X, inner)
+		a.statement(cmd.Y, inner)
+	}
+}
+
+func (a *shellAnalyzer) call(stmt *syntax.Stmt, call *syntax.CallExpr, ctx shellContext) {
+	if len(call.Args) == 0 {
+		return
+	}
+	name := call.Args[0].Lit()
+	if isTestCommand(call) && !ctx.checked {
+		a.exitCodeChecks(call)
+	}
+
+	for _, arg := range call.Args[1:] {
+		a.unquotedExpansions(arg, pathCommands[name])
+	}
+	if command, ok := matchDestructiveCommand(literalArguments(call), a.destructive); ok {
+		a.destructiveExpansions(call, command)
+	}
+
+	switch name {
+	case "cd":
+		if len(call.Args) > 1 && call.Args[1].Lit() != "-" && !ctx.checked && !ctx.last {
+			a.report(stmt.Pos(), RuleUncheckedCd, ValidationSeverityWarning,
+				"The cd is not checked, so readers who copy the commands run the rest of them in the wrong directory when the directory does not exist.",
+				"Stop when cd fails, e.g. cd \"$DIRECTORY\" || exit 1.")
+		}
+	case "read":
+		if !ctx.inputRedirected && !hasArgument(call, "-t") {
+			a.report(stmt.Pos(), RuleInteractiveCommand, ValidationSeverityError,
+				"read waits for input from the terminal, so the code block hangs.",
+				"Set the value with an exported variable or --var instead, or read from a file or here string.")
+		}
+	case "az":
+		if len(call.Args) > 1 && call.Args[1].Lit() == "login" && !hasAnyArgument(call, nonInteractiveLoginFlags) {
+			a.report(stmt.Pos(), RuleInteractiveCommand, ValidationSeverityError,
+				"az login opens a browser to sign in, so the code block hangs where there is none.",
+				"Use az login --use-device-code, or sign in with a service principal or managed identity.")
+		}
+	default:
+		if terminalCommands[name] && !ctx.inputRedirected {
+			a.report(stmt.Pos(), RuleInteractiveCommand, ValidationSeverityError,
+				fmt.Sprintf("%s waits for the user in the terminal, so the code block hangs.", name),
+				"Use a command that does not need a terminal, e.g. cat instead of less or sed instead of an editor.")
+		}
+	}
+}
+
+// Reports the tests of $? in a test command. The code blocks run with
+// set -e, which stops them when a command fails before $? can be checked.
+func (a *shellAnalyzer) exitCodeChecks(node syntax.Node) {
+	reported := false
+	syntax.Walk(node, func(node syntax.Node) bool {
+		if reported {
+			return false
+		}
+		if param, ok := node.(*syntax.ParamExp); ok && param.Param != nil && param.Param.Value == "?" {
+			a.report(param.Pos(), RuleSetErrexitPitfall, ValidationSeverityWarning,
+				"The test of $? never sees a failure, as the code block runs with set -e and stops when the command before it fails.",
+				"Check the command itself instead, e.g. if ! command; then ...; fi.")
+			reported = true
+		}
+		return true
+	})
+}
+
+// Reports the expansions of a word that are not quoted if the word is a path,
+// where a value with spaces or glob characters would name other files.
+func (a *shellAnalyzer) unquotedExpansions(word *syntax.Word, isPath bool) {
+	var expansions []*syntax.ParamExp
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			if strings.Contains(part.Value, "/") {
+				isPath = true
+			}
+		case *syntax.ParamExp:
+			if part.Param != nil && !part.Length && !isSpecialParameter(part.Param.Value) {
+				expansions = append(expansions, part)
+			}
+		}
+	}
+	if !isPath || len(expansions) == 0 {
+		return
+	}
+	expansion := expansions[0]
+	a.report(expansion.Pos(), RuleUnquotedPathExpansion, ValidationSeverityWarning,
+		fmt.Sprintf("$%s is not quoted in a path, so a value with spaces or glob characters names other files.", expansion.Param.Value),
+		"Quote the path, e.g. \"$DIRECTORY/file\".")
+}
+
+// Reports the first variable that may be empty in the arguments of a
+// destructive command, which then deletes more than intended, e.g. all of /
+// for rm -rf "$DIRECTORY/".
+func (a *shellAnalyzer) destructiveExpansions(call *syntax.CallExpr, command DestructiveCommand) {
+	var expansion *syntax.ParamExp
+	for _, arg := range call.Args[1:] {
+		syntax.Walk(arg, func(node syntax.Node) bool {
+			switch node := node.(type) {
+			case *syntax.CmdSubst, *syntax.ArithmExp:
+				return false
+			case *syntax.ParamExp:
+				if expansion == nil && a.mayBeEmpty(node) {
+					expansion = node
+				}
+				return false
+			}
+			return expansion == nil
+		})
+		if expansion != nil {
+			break
+		}
+	}
+	if expansion == nil {
+		return
+	}
+	name := expansion.Param.Value
+	a.report(expansion.Pos(), RuleDestructiveEmptyVariable, ValidationSeverityWarning,
+		fmt.Sprintf("%s uses $%s, which may be empty, so the command may delete more than intended.", command.Command, name),
+		fmt.Sprintf("Use ${%s:?} to stop when the variable is empty.", name))
+}
+
+// Checks if an expansion may expand to an empty value: the variable is not
+// provided by the host and either the document never assigns it or some
+// assignment may be empty, and the expansion does not stop or substitute a
+// default for empty values.
+func (a *shellAnalyzer) mayBeEmpty(expansion *syntax.ParamExp) bool {
+	if expansion.Param == nil || expansion.Length || isSpecialParameter(expansion.Param.Value) {
+		return false
+	}
+	if expansion.Exp != nil {
+		switch expansion.Exp.Op {
+		case syntax.DefaultUnsetOrNull, syntax.ErrorUnsetOrNull, syntax.AssignUnsetOrNull:
+			return false
+		}
+	}
+	name := expansion.Param.Value
+	if nonEmpty, assigned := a.nonEmpty[name]; assigned {
+		return !nonEmpty
+	}
+	_, builtin := allowedExternalEnvVars[name]
+	return !builtin && !a.config.isExternalVariable(name)
+}
+
+func isSpecialParameter(name string) bool {
+	switch name {
+	case "?", "#", "$", "!", "-", "@", "*":
+		return true
+	}
+	return len(name) > 0 && name[0] >= '0' && name[0] <= '9'
+}
+
+func isTestCommand(call *syntax.CallExpr) bool {
+	if len(call.Args) == 0 {
+		return false
+	}
+	name := call.Args[0].Lit()
+	return name == "[" || name == "test"
+}
+
+func isTestStatement(stmt *syntax.Stmt) bool {
+	switch cmd := stmt.Cmd.(type) {
+	case *syntax.TestClause:
+		return true
+	case *syntax.CallExpr:
+		return isTestCommand(cmd)
+	}
+	return false
+}
+
+func hasArgument(call *syntax.CallExpr, argument string) bool {
+	return hasAnyArgument(call, map[string]bool{argument: true})
+}
+
+func hasAnyArgument(call *syntax.CallExpr, arguments map[string]bool) bool {
+	for _, arg := range call.Args[1:] {
+		value := arg.Lit()
+		if index := strings.Index(value, "="); index > 0 {
+			value = value[:index]
+		}
+		if arguments[value] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func analyzeBlock(t *testing.T, language string, code string) []ValidationIssue {
+	t.Helper()
+	source := "# Scenario\n\n## Step\n\nRuns the commands.\n\n```" + language + "\n" + code + "\n```\n"
+	scenario, err := CreateScenarioFromMarkdownSource([]byte(source), "scenario.md", []string{"bash", "azurecli", "text"}, nil)
+	require.NoError(t, err)
+	return validateShellCode(scenario, InspectConfig{})
+}
+
+func TestValidateShellCodeSyntax(t *testing.T) {
+	cases := map[string]int{
+		"if [ -n \"$A\" ]; then\n  echo a\n":      1,
+		"cat <<EOF\nhello\n":                      1,
+		"echo \"unterminated\n":                   1,
+		"echo ok\nfor x in 1 2; do echo $x; fi\n": 2,
+	}
+	for code, line := range cases {
+		issues := analyzeBlock(t, "bash", code)
+		require.Len(t, issues, 1, code)
+		assert.Equal(t, RuleShellSyntax, issues[0].RuleID, code)
+		assert.Equal(t, ValidationSeverityError, issues[0].Severity, code)
+		// The code block starts on line 7 of the document.
+		assert.Equal(t, 7+line, issues[0].Position.StartLine, code)
+	}
+}
+
+func TestValidateShellCodeChecks(t *testing.T) {
+	cases := []struct {
+		code   string
+		rule   string
+		line   int
+		column int
+	}{
+		{"mkdir -p $DIRECTORY\necho done", RuleUnquotedPathExpansion, 1, 10},
+		{"cp config.json $HOME/.kube/config", RuleUnquotedPathExpansion, 1, 16},
+		{"echo hi > $OUTPUT_DIR/log.txt", RuleUnquotedPathExpansion, 1, 11},
+		{"cd \"$DIRECTORY\"\nmake", RuleUncheckedCd, 1, 1},
+		{"for x in a b; do\n  cd \"$x\"\n  make\ndone", RuleUncheckedCd, 2, 3},
+		{"((count++))\necho $count", RuleSetErrexitPitfall, 1, 1},
+		{"let count=count+1", RuleSetErrexitPitfall, 1, 1},
+		{"az group create -n x\nif [ $? -ne 0 ]; then\n  exit 1\nfi", RuleSetErrexitPitfall, 2, 6},
+		{"[ -f out.txt ] && cat out.txt", RuleSetErrexitPitfall, 1, 1},
+		{"read -p \"Name: \" NAME", RuleInteractiveCommand, 1, 1},
+		{"echo start\n  az login", RuleInteractiveCommand, 2, 3},
+		{"vim config.yaml", RuleInteractiveCommand, 1, 1},
+	}
+	for _, c := range cases {
+		issues := analyzeBlock(t, "bash", c.code)
+		require.Len(t, issues, 1, c.code)
+		assert.Equal(t, c.rule, issues[0].RuleID, c.code)
+		assert.Equal(t, 7+c.line, issues[0].Position.StartLine, c.code)
+		assert.Equal(t, c.column, issues[0].Position.StartColumn, c.code)
+		assert.NotEmpty(t, issues[0].Snippet, c.code)
+	}
+}
+
+func TestValidateShellCodeAcceptsSafePatterns(t *testing.T) {
+	safe := []string{
+		"rm -rf \"${DIRECTORY:?}\"",
+		"echo $MESSAGE",
+		"az group create --name $RESOURCE_GROUP --location $REGION",
+		"echo \"${#ITEMS}\" $1 $?",
+		"cd \"$DIRECTORY\" || exit 1\nmake",
+		"cd \"$DIRECTORY\" && make",
+		"if cd \"$DIRECTORY\"; then make; fi",
+		"make\ncd \"$DIRECTORY\"",
+		"cd -",
+		"count=$((count + 1))",
+		"if ((count > 1)); then echo many; fi",
+		"[ -f out.txt ] && cat out.txt\necho done",
+		"read -t 5 NAME",
+		"read NAME < name.txt",
+		"read NAME <<< \"$VALUE\"",
+		"echo demo | read NAME",
+		"while read -r line; do echo \"$line\"; done < list.txt",
+		"az login --use-device-code",
+		"az login --service-principal -u $APP_ID -p $SECRET --tenant $TENANT",
+		"az login --identity",
+		"git diff | less",
+		"cat <<EOF\n$HOME/unquoted\nEOF",
+	}
+	for _, code := range safe {
+		assert.Empty(t, analyzeBlock(t, "bash", code), code)
+	}
+}
+
+func TestValidateShellCodeLanguages(t *testing.T) {
+	assert.Len(t, analyzeBlock(t, "azurecli", "az login"), 1)
+	assert.Empty(t, analyzeBlock(t, "text", "if then"))
+}
+
+func TestValidateShellCodeDestructiveEmptyVariables(t *testing.T) {
+	cases := map[string]int{
+		"rm -rf \"$WORK_DIR/\"":                                   9,
+		"DIR=$(mktemp -d)\nrm -rf \"$DIR\"":                       9,
+		"DIR=/tmp/demo\nDIR=\"\"\nrm -rf \"$DIR\"":                9,
+		"az group delete --name \"$MY_RESOURCE_GROUP\" --yes":     25,
+		"if true; then\n  kubectl delete ns \"${NAMESPACE}\"\nfi": 22,
+	}
+	for code, column := range cases {
+		issues := analyzeBlock(t, "bash", code)
+		var destructive []ValidationIssue
+		for _, issue := range issues {
+			if issue.RuleID == RuleDestructiveEmptyVariable {
+				destructive = append(destructive, issue)
+			}
+		}
+		if assert.Len(t, destructive, 1, code) {
+			assert.Equal(t, column, destructive[0].Position.StartColumn, code)
+			assert.Contains(t, destructive[0].Suggestion, ":?}", code)
+		}
+	}
+
+	safe := []string{
+		"export MY_RESOURCE_GROUP=rg-demo$HASH\naz group delete --name $MY_RESOURCE_GROUP --yes",
+		"rm -rf \"${WORK_DIR:?}/\"",
+		"rm -rf \"${WORK_DIR:-/tmp/demo}\"",
+		"rm -rf \"$HOME/.cache/demo\"",
+		"for dir in build out; do rm -rf \"./$dir\"; done",
+		"rm -rf out $(ls -d tmp*)",
+	}
+	for _, code := range safe {
+		for _, issue := range analyzeBlock(t, "bash", code) {
+			assert.NotEqual(t, RuleDestructiveEmptyVariable, issue.RuleID, code)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// Modes of operation that code blocks can opt out of with the skip-in
+// attribute.
+const (
+	ModeExecute     = "execute"
+	ModeTest        = "test"
+	ModeInteractive = "interactive"
+)
+
+// Removes the code blocks that declare they should be skipped in the given mode
+// or that carry one of the tags being skipped.
+func FilterSkippedCodeBlocks(steps []Step, mode string, skipTags []string) []Step {
+	filteredSteps := make([]Step, 0, len(steps))
+	for _, step := range steps {
+		newBlocks := []parsers.CodeBlock{}
+		for _, block := range step.CodeBlocks {
+			if block.Attributes.SkippedIn(mode) || block.Attributes.HasAnyTag(skipTags) {
+				logging.GlobalLogger.Infof("Skipping code block in %s mode:\n %s", mode, block.Content)
+				continue
+			}
+			newBlocks = append(newBlocks, block)
+		}
+		if len(newBlocks) == 0 && len(step.CodeBlocks) > 0 {
+			continue
+		}
+		filteredSteps = append(filteredSteps, Step{
+			Name:       step.Name,
+			CodeBlocks: newBlocks,
+			Section:    step.Section,
+		})
+	}
+	return filteredSteps
+}
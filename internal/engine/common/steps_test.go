@@ -0,0 +1,36 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterSkippedCodeBlocks(t *testing.T) {
+	steps := []Step{
+		{
+			Name: "Setup",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "echo always"},
+				{Content: "echo not in test", Attributes: parsers.CodeBlockAttributes{SkipIn: []string{"test"}}},
+				{Content: "echo slow", Attributes: parsers.CodeBlockAttributes{Tags: []string{"slow"}}},
+			},
+		},
+		{
+			Name: "Slow only",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "echo slow", Attributes: parsers.CodeBlockAttributes{Tags: []string{"slow"}}},
+			},
+		},
+	}
+
+	filtered := FilterSkippedCodeBlocks(steps, ModeTest, []string{"slow"})
+	assert.Len(t, filtered, 1)
+	assert.Len(t, filtered[0].CodeBlocks, 1)
+	assert.Equal(t, "echo always", filtered[0].CodeBlocks[0].Content)
+
+	filtered = FilterSkippedCodeBlocks(steps, ModeExecute, nil)
+	assert.Len(t, filtered, 2)
+	assert.Len(t, filtered[0].CodeBlocks, 3)
+}
@@ -0,0 +1,343 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/ui"
+	"gopkg.in/yaml.v3"
+)
+
+type structuredFormat string
+
+const (
+	formatJSON structuredFormat = "JSON"
+	formatYAML structuredFormat = "YAML"
+)
+
+// How the structured comparators match the actual document against the
+// expected document.
+const (
+	// The documents must be equal.
+	matchEqual = "equal"
+	// The actual document must contain the expected document. Objects may
+	// have extra keys and arrays extra items.
+	matchSubset = "subset"
+	// The documents must have the same keys and types of values, whatever
+	// the values are. Arrays may have any number of items, each of which must
+	// have the structure of one of the expected items.
+	matchStructure = "structure"
+)
+
+// The maximum number of differences listed when structured documents do not
+// match.
+const maxStructuredDifferences = 10
+
+// Compares JSON or YAML documents. The match option overrides the default
+// match of the comparator, and the ignore option lists comma separated paths
+// that are left out of the comparison, e.g. ignore=id,properties.etag. Paths
+// are keys separated by dots, may start with $., and go through arrays
+// without indices. A * matches any key.
+type structuredComparator struct {
+	format structuredFormat
+	match  string
+}
+
+func (c structuredComparator) Compare(actual string, expected Expectation) (float64, error) {
+	match, allDifferences, err := c.differences(actual, expected)
+	if err != nil {
+		return 0, err
+	}
+	if len(allDifferences) == 0 {
+		return 1, nil
+	}
+
+	differences := allDifferences
+	if len(differences) > maxStructuredDifferences {
+		differences = append(
+			differences[:maxStructuredDifferences:maxStructuredDifferences],
+			fmt.Sprintf("... (%d more differences)", len(allDifferences)-maxStructuredDifferences),
+		)
+	}
+	// The differences are listed by path, so there is no need for a line diff.
+	return 0, fmt.Errorf(
+		ui.ErrorMessageStyle.Render("Expected output does not match actual output: %s"),
+		fmt.Sprintf("the %s documents differ (%s match):\n  %s", c.format, match, strings.Join(differences, "\n  ")),
+	)
+}
+
+// Lists the paths at which the actual document does not match the expected
+// document, along with the match used to compare them.
+func (c structuredComparator) differences(actual string, expected Expectation) (string, []string, error) {
+	match := c.match
+	if option := strings.ToLower(strings.TrimSpace(expected.Options["match"])); option != "" {
+		match = option
+	}
+	if match == "" {
+		match = matchEqual
+	}
+	if match != matchEqual && match != matchSubset && match != matchStructure {
+		return "", nil, fmt.Errorf(
+			"unknown match %q for %s outputs (expected %s, %s or %s)",
+			match,
+			c.format,
+			matchEqual,
+			matchSubset,
+			matchStructure,
+		)
+	}
+
+	expectedDocument, err := parseStructuredDocument(c.format, expected.Output)
+	if err != nil {
+		return "", nil, fmt.Errorf("the expected output is not valid %s: %w", c.format, err)
+	}
+	actualDocument, err := parseStructuredDocument(c.format, actual)
+	if err != nil {
+		return "", nil, outputMismatchError(
+			expected.Output,
+			actual,
+			fmt.Sprintf("the actual output is not valid %s: %s", c.format, err),
+		)
+	}
+
+	comparison := structuredComparison{
+		match:  match,
+		ignore: parseIgnoredPaths(expected.Options["ignore"]),
+	}
+	comparison.compare("$", nil, expectedDocument, actualDocument)
+	return match, comparison.differences, nil
+}
+
+func parseStructuredDocument(format structuredFormat, document string) (interface{}, error) {
+	var value interface{}
+	var err error
+	if format == formatYAML {
+		err = yaml.Unmarshal([]byte(document), &value)
+	} else {
+		err = json.Unmarshal([]byte(document), &value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return normalizeStructuredValue(value), nil
+}
+
+// Converts the values decoded from YAML to the types decoded from JSON, so
+// that both formats are compared the same way.
+func normalizeStructuredValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = normalizeStructuredValue(item)
+		}
+		return typed
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			converted[fmt.Sprint(key)] = normalizeStructuredValue(item)
+		}
+		return converted
+	case []interface{}:
+		for index, item := range typed {
+			typed[index] = normalizeStructuredValue(item)
+		}
+		return typed
+	case int:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	case uint64:
+		return float64(typed)
+	default:
+		return value
+	}
+}
+
+func parseIgnoredPaths(option string) [][]string {
+	var paths [][]string
+	for _, path := range strings.Split(option, ",") {
+		path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+		path = strings.TrimPrefix(path, ".")
+		if path == "" {
+			continue
+		}
+		paths = append(paths, strings.Split(path, "."))
+	}
+	return paths
+}
+
+type structuredComparison struct {
+	match       string
+	ignore      [][]string
+	differences []string
+}
+
+func (c *structuredComparison) isIgnored(keys []string) bool {
+	for _, path := range c.ignore {
+		if len(path) != len(keys) {
+			continue
+		}
+		matches := true
+		for index, segment := range path {
+			if segment != "*" && segment != keys[index] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *structuredComparison) differ(path string, format string, args ...interface{}) {
+	c.differences = append(c.differences, path+": "+fmt.Sprintf(format, args...))
+}
+
+// Checks if two values match without recording their differences.
+func (c *structuredComparison) matches(keys []string, expected interface{}, actual interface{}) bool {
+	nested := structuredComparison{match: c.match, ignore: c.ignore}
+	nested.compare("", keys, expected, actual)
+	return len(nested.differences) == 0
+}
+
+// Records the differences between the expected and actual values found at
+// path. keys holds the object keys leading to the values, for ignored paths.
+func (c *structuredComparison) compare(path string, keys []string, expected interface{}, actual interface{}) {
+	if structuredType(expected) != structuredType(actual) {
+		c.differ(path, "expected %s, got %s", describeStructuredValue(expected), describeStructuredValue(actual))
+		return
+	}
+
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		c.compareObjects(path, keys, expectedValue, actual.(map[string]interface{}))
+	case []interface{}:
+		c.compareArrays(path, keys, expectedValue, actual.([]interface{}))
+	default:
+		if c.match != matchStructure && expected != actual {
+			c.differ(path, "expected %s, got %s", describeStructuredValue(expected), describeStructuredValue(actual))
+		}
+	}
+}
+
+func (c *structuredComparison) compareObjects(
+	path string,
+	keys []string,
+	expected map[string]interface{},
+	actual map[string]interface{},
+) {
+	names := make([]string, 0, len(expected)+len(actual))
+	for name := range expected {
+		names = append(names, name)
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		childKeys := append(append([]string{}, keys...), name)
+		if c.isIgnored(childKeys) {
+			continue
+		}
+		childPath := path + "." + name
+		expectedChild, inExpected := expected[name]
+		actualChild, inActual := actual[name]
+		switch {
+		case !inActual:
+			c.differ(childPath, "missing from the actual output")
+		case !inExpected:
+			if c.match != matchSubset {
+				c.differ(childPath, "not in the expected output")
+			}
+		default:
+			c.compare(childPath, childKeys, expectedChild, actualChild)
+		}
+	}
+}
+
+func (c *structuredComparison) compareArrays(
+	path string,
+	keys []string,
+	expected []interface{},
+	actual []interface{},
+) {
+	switch c.match {
+	case matchSubset:
+		used := make([]bool, len(actual))
+		for index, expectedItem := range expected {
+			found := false
+			for actualIndex, actualItem := range actual {
+				if !used[actualIndex] && c.matches(keys, expectedItem, actualItem) {
+					used[actualIndex] = true
+					found = true
+					break
+				}
+			}
+			if !found {
+				c.differ(fmt.Sprintf("%s[%d]", path, index), "no matching item in the actual output")
+			}
+		}
+	case matchStructure:
+		if len(expected) == 0 {
+			return
+		}
+		for index, actualItem := range actual {
+			found := false
+			for _, expectedItem := range expected {
+				if c.matches(keys, expectedItem, actualItem) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				c.differ(fmt.Sprintf("%s[%d]", path, index), "does not have the structure of any expected item")
+			}
+		}
+	default:
+		if len(expected) != len(actual) {
+			c.differ(path, "expected %d items, got %d", len(expected), len(actual))
+			return
+		}
+		for index := range expected {
+			c.compare(fmt.Sprintf("%s[%d]", path, index), keys, expected[index], actual[index])
+		}
+	}
+}
+
+func structuredType(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func describeStructuredValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return "an " + structuredType(value)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,165 @@
+package common
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/yuin/goldmark/ast"
+)
+
+// Matches the comments that suppress inspect issues, e.g.
+// `<!-- ie-disable-next undefined-variable -->`. Without rule IDs a comment
+// applies to every rule.
+var suppressionCommentRegex = regexp.MustCompile(`^\s*<!--\s*ie-(disable-next|disable|enable)\b([^>]*?)\s*-->\s*$`)
+
+// A range of lines of a document in which the issues of a rule, or of every
+// rule when the rule is empty, are suppressed.
+type suppression struct {
+	rule      string
+	startLine int
+	endLine   int
+}
+
+// Drops the issues suppressed by comments in the documents they were found in:
+//
+//   - `<!-- ie-disable [rules] -->` suppresses the rules until a matching
+//     `<!-- ie-enable [rules] -->` or the end of the document.
+//   - `<!-- ie-disable-next [rules] -->` suppresses the rules in the next code
+//     block.
+//
+// Issues that are not attributed to a line cannot be suppressed by comments.
+func suppressValidationIssues(s *Scenario, issues []ValidationIssue) []ValidationIssue {
+	suppressionsByFile := make(map[string][]suppression)
+	kept := make([]ValidationIssue, 0, len(issues))
+	for _, issue := range issues {
+		if !issue.Position.IsKnown() {
+			kept = append(kept, issue)
+			continue
+		}
+		file := issue.Position.File
+		suppressions, ok := suppressionsByFile[file]
+		if !ok {
+			suppressions = findSuppressions(documentSource(s, file))
+			suppressionsByFile[file] = suppressions
+		}
+		if !isSuppressed(suppressions, issue) {
+			kept = append(kept, issue)
+		}
+	}
+	return kept
+}
+
+// Returns the source of the scenario or of one of the prerequisites it
+// includes, which are read again as the scenario only keeps its own source.
+func documentSource(s *Scenario, file string) []byte {
+	if file == s.SourcePath {
+		return s.Source
+	}
+	source, err := resolveMarkdownSource(file)
+	if err != nil {
+		return nil
+	}
+	return source
+}
+
+func isSuppressed(suppressions []suppression, issue ValidationIssue) bool {
+	line := issue.Position.StartLine
+	for _, suppression := range suppressions {
+		if suppression.rule != "" && suppression.rule != issue.RuleID {
+			continue
+		}
+		if line >= suppression.startLine && line <= suppression.endLine {
+			return true
+		}
+	}
+	return false
+}
+
+// Finds the suppression comments of a document, ignoring the content of code
+// blocks.
+func findSuppressions(source []byte) []suppression {
+	if len(source) == 0 {
+		return nil
+	}
+	codeBlocks := fencedCodeBlockLines(source)
+	lastLine := bytes.Count(source, []byte("\n")) + 1
+
+	var suppressions []suppression
+	// Maps the rules disabled by ie-disable to the line they were disabled on.
+	disabled := make(map[string]int)
+	for index, text := range strings.Split(string(source), "\n") {
+		line := index + 1
+		if isInCodeBlock(codeBlocks, line) {
+			continue
+		}
+		matches := suppressionCommentRegex.FindStringSubmatch(text)
+		if matches == nil {
+			continue
+		}
+		rules := strings.FieldsFunc(matches[2], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(rules) == 0 {
+			rules = []string{""}
+		}
+
+		switch matches[1] {
+		case "disable-next":
+			for _, block := range codeBlocks {
+				if block.StartLine > line {
+					for _, rule := range rules {
+						suppressions = append(suppressions, suppression{rule, block.StartLine, block.EndLine})
+					}
+					break
+				}
+			}
+		case "disable":
+			for _, rule := range rules {
+				if _, ok := disabled[rule]; !ok {
+					disabled[rule] = line
+				}
+			}
+		case "enable":
+			if rules[0] == "" {
+				rules = nil
+				for rule := range disabled {
+					rules = append(rules, rule)
+				}
+			}
+			for _, rule := range rules {
+				if start, ok := disabled[rule]; ok {
+					suppressions = append(suppressions, suppression{rule, start, line})
+					delete(disabled, rule)
+				}
+			}
+		}
+	}
+	for rule, start := range disabled {
+		suppressions = append(suppressions, suppression{rule, start, lastLine})
+	}
+	return suppressions
+}
+
+// Returns the lines of the fenced code blocks of a document, from the opening
+// to the closing fence, in document order.
+func fencedCodeBlockLines(source []byte) []parsers.SourcePosition {
+	var positions []parsers.SourcePosition
+	ast.Walk(parsers.ParseMarkdownIntoAst(source), func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := node.(*ast.FencedCodeBlock); ok && entering {
+			positions = append(positions, parsers.FencedCodeBlockPosition(block, source, ""))
+		}
+		return ast.WalkContinue, nil
+	})
+	return positions
+}
+
+func isInCodeBlock(codeBlocks []parsers.SourcePosition, line int) bool {
+	for _, block := range codeBlocks {
+		if line >= block.StartLine && line <= block.EndLine {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package common
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuppressValidationIssues(t *testing.T) {
+	source := `# Scenario
+
+## Step
+
+Uses a variable of the host.
+
+<!-- ie-disable-next undefined-variable -->
+` + "```bash" + `
+echo $HOST_VARIABLE
+export UNUSED_ONE=1
+` + "```" + `
+
+<!-- ie-disable unused-export, env-prefix -->
+
+Exports variables that are not used.
+
+` + "```bash" + `
+export UNUSED_TWO=2
+export lower=3
+` + "```" + `
+
+<!-- ie-enable unused-export -->
+
+Shows that the comments in code blocks are ignored.
+
+` + "```bash" + `
+echo '<!-- ie-disable -->'
+export UNUSED_THREE=3
+export other=4
+echo $OTHER_VARIABLE
+` + "```" + `
+`
+	scenario, err := CreateScenarioFromMarkdownSource([]byte(source), "scenario.md", []string{"bash"}, nil)
+	require.NoError(t, err)
+
+	issues := ValidateScenarioForInspect(scenario, InspectConfig{})
+	issues = append(issues, ValidationIssue{RuleID: RuleParserWarning, Severity: ValidationSeverityWarning, Message: "no line"})
+
+	var remaining []string
+	for _, issue := range (InspectConfig{}).Apply(scenario, issues) {
+		remaining = append(remaining, issue.RuleID+" "+issue.Snippet)
+	}
+	sort.Strings(remaining)
+	assert.Equal(t, []string{
+		"parser-warning ",
+		"undefined-variable echo $OTHER_VARIABLE",
+		"unused-export export UNUSED_ONE=1",
+		"unused-export export UNUSED_THREE=3",
+		"unused-export export other=4",
+	}, remaining)
+}
+
+func TestFindSuppressions(t *testing.T) {
+	source := []byte("<!-- ie-disable -->\ntext\n<!-- ie-enable -->\n<!-- ie-disable-next -->\n\n```bash\necho\n```\n<!-- ie-disable missing-language -->\n")
+	assert.ElementsMatch(t, []suppression{
+		{rule: "", startLine: 1, endLine: 3},
+		{rule: "", startLine: 6, endLine: 8},
+		{rule: RuleMissingLanguage, startLine: 9, endLine: 10},
+	}, findSuppressions(source))
+}
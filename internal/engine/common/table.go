@@ -0,0 +1,188 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A table printed by a command, such as az ... -o table or kubectl get.
+type outputTable struct {
+	Header []string
+	Rows   [][]string
+}
+
+var (
+	tableSeparatorPattern = regexp.MustCompile(`^\s*-+(\s+-+)*\s*$`)
+	tableColumnGap        = regexp.MustCompile(`\s{2,}`)
+)
+
+// Parses a table printed by a command. When the header is underlined with
+// dashes, as az prints it, the columns are cut where the dashes start so that
+// empty cells are kept. Otherwise the columns are separated by two or more
+// spaces and the first line is the header.
+func parseOutputTable(output string) (outputTable, error) {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, " \t"))
+		}
+	}
+	if len(lines) == 0 {
+		return outputTable{}, fmt.Errorf("the output is empty")
+	}
+
+	if len(lines) > 1 && tableSeparatorPattern.MatchString(lines[1]) {
+		columns := tableColumnStarts(lines[1])
+		table := outputTable{Header: splitTableLine(lines[0], columns)}
+		for _, line := range lines[2:] {
+			table.Rows = append(table.Rows, splitTableLine(line, columns))
+		}
+		return table, nil
+	}
+
+	table := outputTable{Header: tableColumnGap.Split(strings.TrimSpace(lines[0]), -1)}
+	for _, line := range lines[1:] {
+		table.Rows = append(table.Rows, tableColumnGap.Split(strings.TrimSpace(line), -1))
+	}
+	return table, nil
+}
+
+// Returns the offsets, in runes, at which the dashes of each column start.
+func tableColumnStarts(separator string) []int {
+	var starts []int
+	previous := ' '
+	for offset, character := range []rune(separator) {
+		if character == '-' && previous != '-' {
+			starts = append(starts, offset)
+		}
+		previous = character
+	}
+	return starts
+}
+
+func splitTableLine(line string, columns []int) []string {
+	runes := []rune(line)
+	cells := make([]string, len(columns))
+	for index, start := range columns {
+		if start >= len(runes) {
+			continue
+		}
+		end := len(runes)
+		if index+1 < len(columns) && columns[index+1] < end {
+			end = columns[index+1]
+		}
+		cells[index] = strings.TrimSpace(string(runes[start:end]))
+	}
+	return cells
+}
+
+// Returns the index of each named column in the header of the table.
+func (table outputTable) columnIndices(names []string) ([]int, error) {
+	indices := make([]int, len(names))
+	for position, name := range names {
+		indices[position] = -1
+		for index, header := range table.Header {
+			if strings.EqualFold(header, name) {
+				indices[position] = index
+				break
+			}
+		}
+		if indices[position] == -1 {
+			return nil, fmt.Errorf("the table has no %q column (columns: %s)", name, strings.Join(table.Header, ", "))
+		}
+	}
+	return indices, nil
+}
+
+// Returns the cells of the row in the given columns, separated by " | ".
+func (table outputTable) project(row []string, indices []int) string {
+	cells := make([]string, len(indices))
+	for position, index := range indices {
+		if index < len(row) {
+			cells[position] = row[index]
+		}
+	}
+	return strings.Join(cells, " | ")
+}
+
+// Compares tables row by row, in any order. The columns option lists the
+// comma separated columns to compare, e.g. columns=Name,Location, and
+// defaults to the columns of the expected table, so that columns only the
+// actual table has are ignored. The score is the share of rows found in both
+// tables.
+func compareTables(actual string, expected Expectation) (float64, error) {
+	expectedTable, err := parseOutputTable(expected.Output)
+	if err != nil {
+		return 0, fmt.Errorf("the expected output is not a table: %w", err)
+	}
+	actualTable, err := parseOutputTable(actual)
+	if err != nil {
+		return 0, outputMismatchError(expected.Output, actual, fmt.Sprintf("the actual output is not a table: %s", err))
+	}
+
+	columns := expectedTable.Header
+	if option := strings.TrimSpace(expected.Options["columns"]); option != "" {
+		columns = nil
+		for _, column := range strings.Split(option, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				columns = append(columns, column)
+			}
+		}
+	}
+	expectedIndices, err := expectedTable.columnIndices(columns)
+	if err != nil {
+		return 0, fmt.Errorf("the expected output does not match the columns option: %w", err)
+	}
+	actualIndices, err := actualTable.columnIndices(columns)
+	if err != nil {
+		return 0, outputMismatchError(expected.Output, actual, err.Error())
+	}
+
+	unmatched := make(map[string]int)
+	for _, row := range actualTable.Rows {
+		unmatched[actualTable.project(row, actualIndices)]++
+	}
+	var missing []string
+	for _, row := range expectedTable.Rows {
+		projected := expectedTable.project(row, expectedIndices)
+		if unmatched[projected] > 0 {
+			unmatched[projected]--
+			continue
+		}
+		missing = append(missing, projected)
+	}
+	var unexpected []string
+	for _, row := range actualTable.Rows {
+		projected := actualTable.project(row, actualIndices)
+		if unmatched[projected] > 0 {
+			unmatched[projected]--
+			unexpected = append(unexpected, projected)
+		}
+	}
+
+	rows := len(expectedTable.Rows)
+	if len(actualTable.Rows) > rows {
+		rows = len(actualTable.Rows)
+	}
+	if rows == 0 {
+		return 1, nil
+	}
+	score := float64(len(expectedTable.Rows)-len(missing)) / float64(rows)
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return score, nil
+	}
+
+	var reasons []string
+	if len(missing) > 0 {
+		reasons = append(reasons, fmt.Sprintf("missing rows %q", missing))
+	}
+	if len(unexpected) > 0 {
+		reasons = append(reasons, fmt.Sprintf("unexpected rows %q", unexpected))
+	}
+	return score, outputMismatchError(
+		expected.Output,
+		actual,
+		fmt.Sprintf("the tables differ in the columns %s: %s", strings.Join(columns, ", "), strings.Join(reasons, ", ")),
+	)
+}
@@ -19,10 +19,103 @@ const (
 	ValidationSeverityWarning ValidationSeverity = "warning"
 )
 
+// Stable identifiers of the checks run by ie inspect. Machine-readable output
+// refers to checks by these IDs, so they must not change once released.
+const (
+	RuleMissingDescription          = "missing-description"
+	RuleMissingLanguage             = "missing-language"
+	RuleUnverifiedPrerequisite      = "unverified-prerequisite"
+	RuleSimilarityOutOfRange        = "similarity-out-of-range"
+	RuleEnvPrefix                   = "env-prefix"
+	RuleUnusedExport                = "unused-export"
+	RuleUndefinedVariable           = "undefined-variable"
+	RuleMissingPrerequisiteDocument = "missing-prerequisite-document"
+	RuleUnresolvedInclude           = "unresolved-include"
+	RuleParserWarning               = "parser-warning"
+	RuleShellSyntax                 = "shell-syntax"
+	RuleUnquotedPathExpansion       = "unquoted-path-expansion"
+	RuleUncheckedCd                 = "unchecked-cd"
+	RuleSetErrexitPitfall           = "set-e-pitfall"
+	RuleInteractiveCommand          = "interactive-command"
+	RuleDestructiveEmptyVariable    = "destructive-empty-variable"
+	RulePolicyViolation             = "policy-violation"
+)
+
+// ValidationRule describes a check run by ie inspect.
+type ValidationRule struct {
+	ID string `json:"id"`
+	// The severity of the issues the check reports.
+	Severity    ValidationSeverity `json:"severity"`
+	Description string             `json:"description"`
+}
+
+var validationRules = []ValidationRule{
+	{RuleMissingDescription, ValidationSeverityError, "Code blocks must be preceded by text describing what they do."},
+	{RuleMissingLanguage, ValidationSeverityError, "Code blocks must declare a language tag."},
+	{RuleUnverifiedPrerequisite, ValidationSeverityError, "Commands in the prerequisites section must have an expected_results block verifying them."},
+	{RuleSimilarityOutOfRange, ValidationSeverityWarning, "expected_similarity must be between 0 and 1."},
+	{RuleEnvPrefix, ValidationSeverityError, "Exported environment variables must start with an uppercase prefix followed by '_'."},
+	{RuleUnusedExport, ValidationSeverityWarning, "Exported environment variables should be referenced by a command."},
+	{RuleUndefinedVariable, ValidationSeverityError, "Uppercase environment variables must be exported by the document before they are referenced."},
+	{RuleMissingPrerequisiteDocument, ValidationSeverityError, "Linked prerequisite documents must exist and parse."},
+	{RuleUnresolvedInclude, ValidationSeverityError, "Included documents must exist, parse and not include themselves."},
+	{RuleParserWarning, ValidationSeverityWarning, "The document parses, but parts of it were ignored or are ambiguous."},
+	{RuleShellSyntax, ValidationSeverityError, "Bash code blocks must be valid bash."},
+	{RuleUnquotedPathExpansion, ValidationSeverityWarning, "Variables expanded in paths should be quoted."},
+	{RuleUncheckedCd, ValidationSeverityWarning, "cd should be followed by a command handling its failure."},
+	{RuleSetErrexitPitfall, ValidationSeverityWarning, "Code blocks run with set -e, so commands must not fail unexpectedly or check failures set -e stops at."},
+	{RuleInteractiveCommand, ValidationSeverityError, "Code blocks must not run commands waiting for input from the terminal."},
+	{RuleDestructiveEmptyVariable, ValidationSeverityWarning, "Destructive commands should not use variables that may be empty."},
+	{RulePolicyViolation, ValidationSeverityError, "Code blocks must only run the commands the policy given with --policy allows."},
+}
+
+// ValidationRules lists the checks run by ie inspect.
+func ValidationRules() []ValidationRule {
+	rules := make([]ValidationRule, len(validationRules))
+	copy(rules, validationRules)
+	return rules
+}
+
+func isValidationRule(id string) bool {
+	for _, rule := range validationRules {
+		if rule.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidationIssue captures a single inspection finding.
 type ValidationIssue struct {
-	Severity ValidationSeverity
-	Message  string
+	// The ID of the check that found the issue, one of the Rule* constants.
+	RuleID   string             `json:"ruleId"`
+	Severity ValidationSeverity `json:"severity"`
+	Message  string             `json:"message"`
+	// Where in the document the issue was found, when it can be attributed to
+	// a code block.
+	Position parsers.SourcePosition `json:"position"`
+	// The line of the document the issue is about, if any.
+	Snippet string `json:"snippet,omitempty"`
+	// How to resolve the issue, if there is an obvious way.
+	Suggestion string `json:"suggestion,omitempty"`
+	// Whether ie inspect --fix can resolve the issue.
+	Fixable bool `json:"fixable,omitempty"`
+
+	fix issueFixer
+}
+
+// Formats the issue, prefixed with its position when one is known so that
+// editors and CI annotations can link to it, and followed by the ID of the rule
+// that found it.
+func (issue ValidationIssue) String() string {
+	message := issue.Message
+	if issue.RuleID != "" {
+		message = fmt.Sprintf("%s [%s]", message, issue.RuleID)
+	}
+	if !issue.Position.IsKnown() {
+		return message
+	}
+	return fmt.Sprintf("%s: %s", issue.Position, message)
 }
 
 var (
@@ -31,6 +124,8 @@ var (
 	assignmentRegex      = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)=`)
 )
 
+const missingLanguageSuggestion = "Add a language after the opening fence, e.g. ```bash, or ```text for output that is not run."
+
 var allowedExternalEnvVars = map[string]struct{}{
 	"HOME":     {},
 	"PATH":     {},
@@ -50,21 +145,24 @@ var allowedExternalEnvVars = map[string]struct{}{
 }
 
 // ValidateScenarioForInspect runs static checks that help authors find structural issues
-// before executing a document.
-func ValidateScenarioForInspect(s *Scenario) []ValidationIssue {
+// before executing a document. The configuration declares the variables the host
+// provides and the prefixes variables must use; use InspectConfig.Apply to turn
+// rules off or change their severity.
+func ValidateScenarioForInspect(s *Scenario, config InspectConfig) []ValidationIssue {
 	if s == nil {
 		return nil
 	}
 
 	var issues []ValidationIssue
-	issues = append(issues, validateCodeBlockDescriptions(s)...)              // Author hygiene
-	issues = append(issues, validateLanguageTags(s.MarkdownAst, s.Source)...) // Missing language tags
-	issues = append(issues, validatePrerequisiteExpectedOutputs(s)...)        // Prerequisite verification blocks
+	issues = append(issues, validateCodeBlockDescriptions(s)...)                            // Author hygiene
+	issues = append(issues, validateLanguageTags(s.MarkdownAst, s.Source, s.SourcePath)...) // Missing language tags
+	issues = append(issues, validatePrerequisiteExpectedOutputs(s)...)                      // Prerequisite verification blocks
 	exports := collectEnvExports(s.Steps)
-	issues = append(issues, validateEnvPrefixConsistency(exports)...)      // Prefix conventions
-	issues = append(issues, validateEnvUsage(s, exports)...)               // Unused exports
-	issues = append(issues, validateUndefinedEnvReferences(s, exports)...) // Missing exports
-	issues = append(issues, validateExpectedSimilarityRanges(s)...)        // Similarity bounds
+	issues = append(issues, validateEnvPrefixConsistency(exports, config)...)      // Prefix conventions
+	issues = append(issues, validateEnvUsage(s, exports)...)                       // Unused exports
+	issues = append(issues, validateUndefinedEnvReferences(s, exports, config)...) // Missing exports
+	issues = append(issues, validateExpectedSimilarityRanges(s)...)                // Similarity bounds
+	issues = append(issues, validateShellCode(s, config)...)                       // Shell syntax and pitfalls
 	return issues
 }
 
@@ -77,22 +175,30 @@ func validateCodeBlockDescriptions(s *Scenario) []ValidationIssue {
 			}
 			if strings.TrimSpace(block.Description) == "" {
 				issues = append(issues, ValidationIssue{
-					Severity: ValidationSeverityError,
-					Message:  fmt.Sprintf("Step %q command #%d must include descriptive text before the code block.", step.Name, idx+1),
-				})
+					RuleID:     RuleMissingDescription,
+					Severity:   ValidationSeverityError,
+					Message:    fmt.Sprintf("Step %q command #%d must include descriptive text before the code block.", step.Name, idx+1),
+					Position:   block.Position,
+					Snippet:    firstContentLine(block.Content),
+					Suggestion: "Add a paragraph before the code block explaining what the command does.",
+				}.withFix(insertDescriptionPlaceholder(block.Position.StartLine)))
 			}
 			if strings.TrimSpace(block.Language) == "" {
 				issues = append(issues, ValidationIssue{
-					Severity: ValidationSeverityError,
-					Message:  fmt.Sprintf("Step %q command #%d must declare a language tag (e.g. ```bash).", step.Name, idx+1),
-				})
+					RuleID:     RuleMissingLanguage,
+					Severity:   ValidationSeverityError,
+					Message:    fmt.Sprintf("Step %q command #%d must declare a language tag (e.g. ```bash).", step.Name, idx+1),
+					Position:   block.Position,
+					Snippet:    firstContentLine(block.Content),
+					Suggestion: missingLanguageSuggestion,
+				}.withFix(insertLanguageTag(block.Position.StartLine)))
 			}
 		}
 	}
 	return issues
 }
 
-func validateLanguageTags(node ast.Node, source []byte) []ValidationIssue {
+func validateLanguageTags(node ast.Node, source []byte, sourcePath string) []ValidationIssue {
 	if node == nil {
 		return nil
 	}
@@ -102,13 +208,18 @@ func validateLanguageTags(node ast.Node, source []byte) []ValidationIssue {
 			return ast.WalkContinue, nil
 		}
 		if block, ok := n.(*ast.FencedCodeBlock); ok {
-			language := strings.TrimSpace(string(block.Language(source)))
+			language := strings.TrimSpace(parsers.FencedCodeBlockLanguage(block, source))
 			if language == "" {
-				snippet := truncateSnippet(extractFirstLine(block, source))
+				firstLine := extractFirstLine(block, source)
+				position := parsers.FencedCodeBlockPosition(block, source, sourcePath)
 				issues = append(issues, ValidationIssue{
-					Severity: ValidationSeverityError,
-					Message:  fmt.Sprintf("Code block starting with %q is missing a language tag (```bash, ```azurecli, etc.).", snippet),
-				})
+					RuleID:     RuleMissingLanguage,
+					Severity:   ValidationSeverityError,
+					Message:    fmt.Sprintf("Code block starting with %q is missing a language tag (```bash, ```azurecli, etc.).", truncateSnippet(firstLine)),
+					Position:   position,
+					Snippet:    firstLine,
+					Suggestion: missingLanguageSuggestion,
+				}.withFix(insertLanguageTag(position.StartLine)))
 			}
 		}
 		return ast.WalkContinue, nil
@@ -129,8 +240,12 @@ func validatePrerequisiteExpectedOutputs(s *Scenario) []ValidationIssue {
 			hasLiteral := strings.TrimSpace(block.ExpectedOutput.Content) != ""
 			if !hasLiteral && strings.TrimSpace(block.ExpectedOutput.ExpectedRegexPattern) == "" {
 				issues = append(issues, ValidationIssue{
-					Severity: ValidationSeverityError,
-					Message:  fmt.Sprintf("Prerequisite command %q #%d must include an expected_results block to verify success.", step.Name, idx+1),
+					RuleID:     RuleUnverifiedPrerequisite,
+					Severity:   ValidationSeverityError,
+					Message:    fmt.Sprintf("Prerequisite command %q #%d must include an expected_results block to verify success.", step.Name, idx+1),
+					Position:   block.Position,
+					Snippet:    firstContentLine(block.Content),
+					Suggestion: "Add a result block after the code block with the output that shows the prerequisite is met.",
 				})
 			}
 		}
@@ -145,8 +260,12 @@ func validateExpectedSimilarityRanges(s *Scenario) []ValidationIssue {
 			sim := block.ExpectedOutput.ExpectedSimilarity
 			if sim < 0 || sim > 1 {
 				issues = append(issues, ValidationIssue{
-					Severity: ValidationSeverityWarning,
-					Message:  fmt.Sprintf("Step %q command #%d declares expected_similarity %.2f which is outside the 0-1 range.", step.Name, idx+1, sim),
+					RuleID:     RuleSimilarityOutOfRange,
+					Severity:   ValidationSeverityWarning,
+					Message:    fmt.Sprintf("Step %q command #%d declares expected_similarity %.2f which is outside the 0-1 range.", step.Name, idx+1, sim),
+					Position:   block.Position,
+					Snippet:    firstContentLine(block.Content),
+					Suggestion: "Use an expected_similarity between 0 (any output) and 1 (identical output).",
 				})
 			}
 		}
@@ -154,7 +273,7 @@ func validateExpectedSimilarityRanges(s *Scenario) []ValidationIssue {
 	return issues
 }
 
-func validateEnvPrefixConsistency(exports []envExport) []ValidationIssue {
+func validateEnvPrefixConsistency(exports []envExport, config InspectConfig) []ValidationIssue {
 	if len(exports) == 0 {
 		return nil
 	}
@@ -163,13 +282,35 @@ func validateEnvPrefixConsistency(exports []envExport) []ValidationIssue {
 		if export.Name == "HASH" {
 			continue // HASH is a special helper variable and does not require a prefix.
 		}
-		_, ok := extractEnvPrefix(export.Name)
+		prefix, ok := extractEnvPrefix(export.Name)
+		newName, derived := suggestPrefixedName(export.Name, config)
+		var issue ValidationIssue
 		if !ok {
-			issues = append(issues, ValidationIssue{
-				Severity: ValidationSeverityError,
-				Message:  fmt.Sprintf("Environment variable %s (%s) must use an uppercase prefix followed by '_' (e.g. PREFIX_value).", export.Name, export.Location),
-			})
+			issue = ValidationIssue{
+				RuleID:     RuleEnvPrefix,
+				Severity:   ValidationSeverityError,
+				Message:    fmt.Sprintf("Environment variable %s (%s) must use an uppercase prefix followed by '_' (e.g. PREFIX_value).", export.Name, export.Location),
+				Position:   export.Position,
+				Snippet:    export.Line,
+				Suggestion: fmt.Sprintf("Rename the variable to %s.", newName),
+			}
+		} else if !config.isAllowedPrefix(prefix) {
+			issue = ValidationIssue{
+				RuleID:     RuleEnvPrefix,
+				Severity:   ValidationSeverityError,
+				Message:    fmt.Sprintf("Environment variable %s (%s) must use one of the allowed prefixes %s_.", export.Name, export.Location, strings.Join(config.AllowedPrefixes, "_, ")),
+				Position:   export.Position,
+				Snippet:    export.Line,
+				Suggestion: fmt.Sprintf("Rename the variable to %s.", newName),
+			}
+		} else {
+			continue
+		}
+		// A placeholder prefix is for the author to replace, not a fix.
+		if derived {
+			issue = issue.withFix(renameVariable(export.Name, newName))
 		}
+		issues = append(issues, issue)
 	}
 	return issues
 }
@@ -230,14 +371,18 @@ func validateEnvUsage(s *Scenario, exports []envExport) []ValidationIssue {
 			continue
 		}
 		issues = append(issues, ValidationIssue{
-			Severity: ValidationSeverityWarning,
-			Message:  fmt.Sprintf("Environment variable %s (%s) is exported but never referenced outside echo/printf statements.", export.Name, export.Location),
+			RuleID:     RuleUnusedExport,
+			Severity:   ValidationSeverityWarning,
+			Message:    fmt.Sprintf("Environment variable %s (%s) is exported but never referenced outside echo/printf statements.", export.Name, export.Location),
+			Position:   export.Position,
+			Snippet:    export.Line,
+			Suggestion: fmt.Sprintf("Reference $%s in a later command or remove the export.", export.Name),
 		})
 	}
 	return issues
 }
 
-func validateUndefinedEnvReferences(s *Scenario, exports []envExport) []ValidationIssue {
+func validateUndefinedEnvReferences(s *Scenario, exports []envExport, config InspectConfig) []ValidationIssue {
 	if s == nil {
 		return nil
 	}
@@ -245,7 +390,8 @@ func validateUndefinedEnvReferences(s *Scenario, exports []envExport) []Validati
 	for _, export := range exports {
 		defined[export.Name] = struct{}{}
 	}
-	missing := make(map[string]string)
+	missing := make(map[string]envExport)
+	var missingOrder []string
 	for _, step := range s.Steps {
 		for blockIdx, block := range step.CodeBlocks {
 			if isSystemGeneratedBlock(block) {
@@ -267,13 +413,19 @@ func validateUndefinedEnvReferences(s *Scenario, exports []envExport) []Validati
 					if _, ok := defined[ref]; ok {
 						continue
 					}
-					if _, ok := allowedExternalEnvVars[ref]; ok {
+					if _, ok := allowedExternalEnvVars[ref]; ok || config.isExternalVariable(ref) {
 						continue
 					}
 					if _, recorded := missing[ref]; recorded {
 						continue
 					}
-					missing[ref] = fmt.Sprintf("step %q block %d line %d", step.Name, blockIdx+1, lineIdx+1)
+					missing[ref] = envExport{
+						Name:     ref,
+						Location: fmt.Sprintf("step %q block %d line %d", step.Name, blockIdx+1, lineIdx+1),
+						Position: block.Position.ContentLine(lineIdx),
+						Line:     trimmed,
+					}
+					missingOrder = append(missingOrder, ref)
 				}
 			}
 		}
@@ -282,10 +434,15 @@ func validateUndefinedEnvReferences(s *Scenario, exports []envExport) []Validati
 		return nil
 	}
 	issues := make([]ValidationIssue, 0, len(missing))
-	for name, location := range missing {
+	for _, name := range missingOrder {
+		reference := missing[name]
 		issues = append(issues, ValidationIssue{
-			Severity: ValidationSeverityError,
-			Message:  fmt.Sprintf("Environment variable %s (%s) is referenced but never exported in this document.", name, location),
+			RuleID:     RuleUndefinedVariable,
+			Severity:   ValidationSeverityError,
+			Message:    fmt.Sprintf("Environment variable %s (%s) is referenced but never exported in this document.", name, reference.Location),
+			Position:   reference.Position,
+			Snippet:    reference.Line,
+			Suggestion: fmt.Sprintf("Export %s in an earlier code block or pass it with --var %s=<value>.", name, name),
 		})
 	}
 	return issues
@@ -294,6 +451,9 @@ func validateUndefinedEnvReferences(s *Scenario, exports []envExport) []Validati
 type envExport struct {
 	Name     string
 	Location string
+	Position parsers.SourcePosition
+	// The trimmed line the variable is exported or referenced on.
+	Line string
 }
 
 func collectEnvExports(steps []Step) []envExport {
@@ -319,7 +479,7 @@ func collectEnvExports(steps []Step) []envExport {
 					continue
 				}
 				location := fmt.Sprintf("step %q block %d line %d", step.Name, blockIdx+1, lineIdx+1)
-				export := envExport{Name: name, Location: location}
+				export := envExport{Name: name, Location: location, Position: block.Position.ContentLine(lineIdx), Line: trimmed}
 				seen[name] = export
 				order = append(order, export)
 			}
@@ -328,6 +488,23 @@ func collectEnvExports(steps []Step) []envExport {
 	return order
 }
 
+// Suggests an uppercase name with an allowed prefix for a variable rejected by
+// validateEnvPrefixConsistency, e.g. APP_NAME for app_name and PREFIX_NAME for
+// NAME. The first allowed prefix is used when the name has none of them.
+// Returns false if the name has the placeholder prefix PREFIX_, which cannot
+// be applied as a fix.
+func suggestPrefixedName(name string, config InspectConfig) (string, bool) {
+	name = strings.ToUpper(name)
+	prefix, ok := extractEnvPrefix(name)
+	if ok && config.isAllowedPrefix(prefix) {
+		return name, true
+	}
+	if len(config.AllowedPrefixes) > 0 {
+		return config.AllowedPrefixes[0] + "_" + strings.TrimLeft(name, "_"), true
+	}
+	return "PREFIX_" + strings.TrimLeft(name, "_"), false
+}
+
 func extractEnvPrefix(name string) (string, bool) {
 	parts := strings.SplitN(name, "_", 2)
 	if len(parts) < 2 || parts[0] == "" {
@@ -439,6 +616,16 @@ func extractFirstLine(block *ast.FencedCodeBlock, source []byte) string {
 	return strings.TrimSpace(string(line.Value(source)))
 }
 
+// Returns the first non-blank line of a code block, trimmed.
+func firstContentLine(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
+}
+
 func truncateSnippet(snippet string) string {
 	snippet = strings.TrimSpace(snippet)
 	if snippet == "" {
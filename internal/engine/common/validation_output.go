@@ -0,0 +1,235 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// InspectFormat identifies how ie inspect reports the issues it finds.
+type InspectFormat string
+
+const (
+	// Styled messages on stderr, for people.
+	InspectFormatText InspectFormat = "text"
+	// A JSON document on stdout, for scripts and editor integrations.
+	InspectFormatJSON InspectFormat = "json"
+	// A SARIF 2.1.0 log on stdout, for GitHub code scanning and other tools
+	// that annotate pull requests.
+	InspectFormatSARIF InspectFormat = "sarif"
+)
+
+// ParseInspectFormat converts a raw string into a typed InspectFormat. An empty
+// string selects text.
+func ParseInspectFormat(format string) (InspectFormat, error) {
+	switch InspectFormat(format) {
+	case "", InspectFormatText:
+		return InspectFormatText, nil
+	case InspectFormatJSON:
+		return InspectFormatJSON, nil
+	case InspectFormatSARIF:
+		return InspectFormatSARIF, nil
+	default:
+		return "", fmt.Errorf(
+			"invalid inspect format %q (expected %q, %q or %q)",
+			format,
+			InspectFormatText,
+			InspectFormatJSON,
+			InspectFormatSARIF,
+		)
+	}
+}
+
+// The JSON document written by ie inspect --format json.
+type validationReport struct {
+	Issues   []ValidationIssue `json:"issues"`
+	Errors   int               `json:"errors"`
+	Warnings int               `json:"warnings"`
+}
+
+// Writes the issues as a JSON document listing them along with the number of
+// errors and warnings.
+func WriteValidationIssuesJSON(writer io.Writer, issues []ValidationIssue) error {
+	report := validationReport{Issues: issues}
+	if report.Issues == nil {
+		report.Issues = []ValidationIssue{}
+	}
+	for _, issue := range issues {
+		switch issue.Severity {
+		case ValidationSeverityError:
+			report.Errors++
+		case ValidationSeverityWarning:
+			report.Warnings++
+		}
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// The subset of SARIF 2.1.0 written by ie inspect, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int           `json:"startLine"`
+	StartColumn int           `json:"startColumn,omitempty"`
+	EndLine     int           `json:"endLine,omitempty"`
+	Snippet     *sarifMessage `json:"snippet,omitempty"`
+}
+
+// Writes the issues as a SARIF log with a single run of ie inspect, the given
+// version of which found them.
+func WriteValidationIssuesSARIF(writer io.Writer, issues []ValidationIssue, toolVersion string) error {
+	rules := ValidationRules()
+	ruleIndices := make(map[string]int, len(rules))
+	driver := sarifDriver{
+		Name:           "ie",
+		Version:        toolVersion,
+		InformationURI: "https://github.com/Azure/InnovationEngine",
+	}
+	for index, rule := range rules {
+		ruleIndices[rule.ID] = index
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(rule.Severity)},
+		})
+	}
+
+	results := make([]sarifResult, 0, len(issues))
+	for _, issue := range issues {
+		ruleID := issue.RuleID
+		if _, ok := ruleIndices[ruleID]; !ok {
+			ruleID = RuleParserWarning
+		}
+		// SARIF fixes must change the document, so suggestions are part of
+		// the message instead.
+		message := issue.Message
+		if issue.Suggestion != "" {
+			message = fmt.Sprintf("%s %s", message, issue.Suggestion)
+		}
+		result := sarifResult{
+			RuleID:    ruleID,
+			RuleIndex: ruleIndices[ruleID],
+			Level:     sarifLevel(issue.Severity),
+			Message:   sarifMessage{Text: message},
+		}
+		if issue.Position.File != "" {
+			location := sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: sarifArtifactURI(issue.Position.File)},
+			}
+			if issue.Position.IsKnown() {
+				location.Region = &sarifRegion{
+					StartLine:   issue.Position.StartLine,
+					StartColumn: issue.Position.StartColumn,
+					EndLine:     issue.Position.EndLine,
+				}
+				if issue.Snippet != "" {
+					location.Region.Snippet = &sarifMessage{Text: issue.Snippet}
+				}
+			}
+			result.Locations = []sarifLocation{{PhysicalLocation: location}}
+		}
+		results = append(results, result)
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+func sarifLevel(severity ValidationSeverity) string {
+	if severity == ValidationSeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Converts the path of a document into the URI of a SARIF artifact. Relative
+// paths stay relative, so that code scanning resolves them against the root of
+// the repository, and URLs are kept as they are.
+func sarifArtifactURI(path string) string {
+	if isRemotePath(path) {
+		return path
+	}
+	if filepath.IsAbs(path) {
+		slashed := filepath.ToSlash(path)
+		if !strings.HasPrefix(slashed, "/") {
+			slashed = "/" + slashed
+		}
+		return (&url.URL{Scheme: "file", Path: slashed}).String()
+	}
+	return (&url.URL{Path: filepath.ToSlash(filepath.Clean(path))}).String()
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInspectFormat(t *testing.T) {
+	format, err := ParseInspectFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, InspectFormatText, format)
+
+	format, err = ParseInspectFormat("sarif")
+	assert.NoError(t, err)
+	assert.Equal(t, InspectFormatSARIF, format)
+
+	_, err = ParseInspectFormat("xml")
+	assert.ErrorContains(t, err, `invalid inspect format "xml"`)
+}
+
+var testValidationIssues = []ValidationIssue{
+	{
+		RuleID:     RuleUndefinedVariable,
+		Severity:   ValidationSeverityError,
+		Message:    "Environment variable MY_RG is referenced but never exported in this document.",
+		Position:   parsers.SourcePosition{File: "docs/aks.md", StartLine: 12, StartColumn: 1, EndLine: 12},
+		Snippet:    "az group show --name $MY_RG",
+		Suggestion: "Export MY_RG in an earlier code block or pass it with --var MY_RG=<value>.",
+	},
+	{
+		RuleID:   RuleParserWarning,
+		Severity: ValidationSeverityWarning,
+		Message:  "Ignoring unknown code block attribute 'colour'",
+		Position: parsers.SourcePosition{File: "docs/aks.md"},
+	},
+}
+
+func TestWriteValidationIssuesJSON(t *testing.T) {
+	var output bytes.Buffer
+	require.NoError(t, WriteValidationIssuesJSON(&output, testValidationIssues))
+
+	var report struct {
+		Issues []map[string]interface{} `json:"issues"`
+		Errors int                      `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &report))
+	assert.Equal(t, 1, report.Errors)
+	require.Len(t, report.Issues, 2)
+	assert.Equal(t, "undefined-variable", report.Issues[0]["ruleId"])
+	assert.Equal(t, "az group show --name $MY_RG", report.Issues[0]["snippet"])
+	assert.Equal(t, map[string]interface{}{"file": "docs/aks.md", "startLine": 12.0, "startColumn": 1.0, "endLine": 12.0}, report.Issues[0]["position"])
+
+	output.Reset()
+	require.NoError(t, WriteValidationIssuesJSON(&output, nil))
+	assert.Contains(t, output.String(), `"issues": []`)
+}
+
+func TestWriteValidationIssuesSARIF(t *testing.T) {
+	var output bytes.Buffer
+	require.NoError(t, WriteValidationIssuesSARIF(&output, testValidationIssues, "1.2.3"))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(output.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+	assert.Equal(t, "1.2.3", run.Tool.Driver.Version)
+	assert.Len(t, run.Tool.Driver.Rules, len(ValidationRules()))
+
+	require.Len(t, run.Results, 2)
+	result := run.Results[0]
+	assert.Equal(t, RuleUndefinedVariable, result.RuleID)
+	assert.Equal(t, RuleUndefinedVariable, run.Tool.Driver.Rules[result.RuleIndex].ID)
+	assert.Equal(t, "error", result.Level)
+	assert.Contains(t, result.Message.Text, "--var MY_RG=<value>")
+	require.Len(t, result.Locations, 1)
+	location := result.Locations[0].PhysicalLocation
+	assert.Equal(t, "docs/aks.md", location.ArtifactLocation.URI)
+	assert.Equal(t, 12, location.Region.StartLine)
+	assert.Equal(t, "az group show --name $MY_RG", location.Region.Snippet.Text)
+
+	// Issues without a line still point at the document.
+	assert.Equal(t, "warning", run.Results[1].Level)
+	assert.Nil(t, run.Results[1].Locations[0].PhysicalLocation.Region)
+}
+
+func TestSarifArtifactURI(t *testing.T) {
+	assert.Equal(t, "docs/my%20doc.md", sarifArtifactURI("./docs/my doc.md"))
+	assert.Equal(t, "file:///tmp/doc.md", sarifArtifactURI("/tmp/doc.md"))
+	assert.Equal(t, "https://example.com/doc.md", sarifArtifactURI("https://example.com/doc.md"))
+}
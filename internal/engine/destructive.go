@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/ui"
+)
+
+// The answers to whether a destructive code block should run.
+type destructiveConfirmation int
+
+const (
+	runDestructiveCodeBlock destructiveConfirmation = iota
+	skipDestructiveCodeBlock
+	runAllDestructiveCodeBlocks
+	stopBeforeDestructiveCodeBlock
+)
+
+// Shows the destructive commands of a code block and asks whether to run it.
+// The end of the input stops the scenario, so nothing is deleted unless it
+// was confirmed.
+func confirmDestructiveCodeBlock(
+	matches []common.DestructiveMatch,
+	reader *bufio.Reader,
+	out io.Writer,
+) destructiveConfirmation {
+	fmt.Fprintf(out, "    %s\n", ui.WarningStyle.Render("This code block runs destructive commands:"))
+	for _, match := range matches {
+		line := fmt.Sprintf("      %d: %s", match.Line, match.Text)
+		if match.Command.Description != "" {
+			line += " (" + match.Command.Description + ")"
+		}
+		fmt.Fprintln(out, ui.WarningStyle.Render(line))
+	}
+
+	for {
+		fmt.Fprint(out, "    Run it? [y]es, [n]o, [a]ll remaining, [q]uit: ")
+		answer, err := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return runDestructiveCodeBlock
+		case "n", "no":
+			return skipDestructiveCodeBlock
+		case "a", "all":
+			return runAllDestructiveCodeBlocks
+		case "q", "quit":
+			return stopBeforeDestructiveCodeBlock
+		default:
+			if err != nil {
+				fmt.Fprintln(out)
+				return stopBeforeDestructiveCodeBlock
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmDestructiveCodeBlock(t *testing.T) {
+	matches := common.FindDestructiveCommands("echo cleaning\naz group delete --name $RG --yes", common.DestructiveCommands(nil))
+	confirm := func(input string) (destructiveConfirmation, string) {
+		var out bytes.Buffer
+		confirmation := confirmDestructiveCodeBlock(matches, bufio.NewReader(strings.NewReader(input)), &out)
+		return confirmation, out.String()
+	}
+
+	confirmation, out := confirm("y\n")
+	assert.Equal(t, runDestructiveCodeBlock, confirmation)
+	assert.Contains(t, out, "2: az group delete --name $RG --yes (Deletes a resource group and every resource in it.)")
+
+	answers := map[string]destructiveConfirmation{
+		"no\n":        skipDestructiveCodeBlock,
+		"A\n":         runAllDestructiveCodeBlocks,
+		"q\n":         stopBeforeDestructiveCodeBlock,
+		"maybe\nn\n":  skipDestructiveCodeBlock,
+		"":            stopBeforeDestructiveCodeBlock,
+		"maybe\nyes":  runDestructiveCodeBlock,
+		"maybe\nmore": stopBeforeDestructiveCodeBlock,
+	}
+	for input, expected := range answers {
+		confirmation, _ := confirm(input)
+		assert.Equal(t, expected, confirmation, input)
+	}
+}
@@ -1,19 +1,25 @@
 package engine
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
 	"github.com/Azure/InnovationEngine/internal/engine/interactive"
 	"github.com/Azure/InnovationEngine/internal/engine/test"
+	"github.com/Azure/InnovationEngine/internal/engine/tui"
+	"github.com/Azure/InnovationEngine/internal/events"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/lib/fs"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/Azure/InnovationEngine/internal/ui"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -29,19 +35,154 @@ type EngineConfiguration struct {
 	WorkingDirectory string
 	RenderValues     bool
 	ReportFile       string
+	// The format the report is written in.
+	ReportFormat common.ReportFormat
+	// Code blocks carrying any of these tags are not run.
+	SkipTags []string
+	// How code blocks are run, see shells.Backend.
+	ShellBackend shells.Backend
+	// Maximum amount of time the whole scenario may run for. Zero disables
+	// the timeout.
+	Timeout time.Duration
+	// Continue from the checkpoint left behind by the last failed run.
+	Resume bool
+	// Where the event stream of the scenario is written, see events.Open.
+	// Empty disables the event stream.
+	Events string
+	// Replace the expected outputs that the actual outputs no longer match
+	// instead of failing the test.
+	UpdateExpected bool
+	// Commands classified as destructive on top of the built-in ones.
+	DestructiveCommands []common.DestructiveCommand
+	// The commands code blocks may run, checked before the first code block
+	// runs. Nil allows every command.
+	Policy *common.CommandPolicy
 }
 
 type Engine struct {
 	Configuration EngineConfiguration
+	// The code blocks run by the last call to ExecuteAndRenderSteps.
+	codeBlocks []common.StatefulCodeBlock
 }
 
-func captureEnvironmentBaseline() {
+// Returns the commands that delete resources or data, which --do-not-delete
+// skips.
+func (e *Engine) destructiveCommands() []common.DestructiveCommand {
+	return common.DestructiveCommands(e.Configuration.DestructiveCommands)
+}
+
+// Checks that the policy, if any, allows every command of the steps.
+func (e *Engine) checkPolicy(steps []common.Step) error {
+	if e.Configuration.Policy == nil {
+		return nil
+	}
+	return e.Configuration.Policy.CheckSteps(steps)
+}
+
+// Records the environment the scenario starts in, returning its variables.
+func captureEnvironmentBaseline() map[string]string {
+	environmentVariables := lib.GetEnvironmentVariables()
 	if err := lib.SaveEnvironmentBaselineFile(
 		lib.DefaultEnvironmentStateFile,
-		lib.GetEnvironmentVariables(),
+		environmentVariables,
 	); err != nil {
 		logging.GlobalLogger.Warnf("Failed to capture environment baseline: %v", err)
 	}
+	return environmentVariables
+}
+
+// Writes the report of a scenario to the configured report file, listing the
+// environment variables the scenario declared on top of the initial ones.
+func (e *Engine) writeReport(
+	scenario *common.Scenario,
+	initialEnvironmentVariables map[string]string,
+	failure error,
+	failedCodeBlock *common.StatefulCodeBlock,
+	codeBlocks []common.StatefulCodeBlock,
+) error {
+	allEnvironmentVariables, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	if err != nil {
+		logging.GlobalLogger.Errorf("Failed to load environment state file: %s", err)
+		return fmt.Errorf("failed to load environment state file: %s", err)
+	}
+
+	variablesDeclaredByScenario := lib.DiffMapsAgainstBaseline(
+		allEnvironmentVariables,
+		initialEnvironmentVariables,
+	)
+
+	report := common.BuildReport(scenario.Name)
+	err = report.
+		WithProperties(scenario.Properties).
+		WithIntroduction(scenario.IntroText).
+		WithEnvironmentVariables(variablesDeclaredByScenario).
+		WithError(failure).
+		WithFailedCodeBlock(failedCodeBlock).
+		WithCodeBlocks(codeBlocks).
+		WriteToFile(e.Configuration.ReportFile, e.Configuration.ReportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to write report to file: %s", err)
+	}
+	return nil
+}
+
+// Creates the context that bounds the execution of a scenario.
+func (e *Engine) scenarioContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if e.Configuration.Timeout > 0 {
+		return context.WithTimeout(parent, e.Configuration.Timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// Creates the checkpointer that records the progress of a scenario, restoring
+// the state of the previous run when resuming. Must be called before changing
+// to the working directory of the scenario, as the document is identified by
+// its absolute path.
+func (e *Engine) scenarioCheckpoints(scenario *common.Scenario) (*common.Checkpointer, error) {
+	filters := common.NewCodeBlockFilters(e.Configuration.DoNotDelete, e.destructiveCommands(), e.Configuration.SkipTags)
+	checkpoints := common.NewCheckpointer(lib.DefaultCheckpointFile, scenario, filters)
+	if e.Configuration.Resume {
+		if _, err := checkpoints.Resume(); err != nil {
+			return nil, err
+		}
+	}
+	return checkpoints, nil
+}
+
+// Opens the event stream configured for the engine, if any, and emits the
+// start of the scenario. The returned function emits the end of the scenario
+// with its outcome and closes the stream. Must be called before changing to
+// the working directory of the scenario, as relative paths are resolved
+// against the current directory.
+func (e *Engine) scenarioEvents(scenario *common.Scenario, mode string) (func(error), error) {
+	var stream io.WriteCloser
+	restore := func() {}
+	if e.Configuration.Events != "" {
+		var err error
+		stream, err = events.Open(e.Configuration.Events)
+		if err != nil {
+			return nil, err
+		}
+		restore = events.Use(events.NewEmitter(stream))
+	}
+
+	endScenario := events.StartScenario(events.Scenario{
+		Name:           scenario.Name,
+		Document:       scenario.SourcePath,
+		Mode:           mode,
+		StateDirectory: lib.StateDirectory(),
+	})
+
+	return func(err error) {
+		endScenario(err)
+		restore()
+		if stream == nil {
+			return
+		}
+		if err := stream.Close(); err != nil {
+			logging.GlobalLogger.Warnf("Failed to close the event stream: %v", err)
+		}
+	}, nil
 }
 
 // / Create a new engine instance.
@@ -52,10 +193,22 @@ func NewEngine(configuration EngineConfiguration) (*Engine, error) {
 }
 
 // Executes a markdown scenario.
-func (e *Engine) ExecuteScenario(scenario *common.Scenario) error {
+func (e *Engine) ExecuteScenario(scenario *common.Scenario) (err error) {
+	endScenario, err := e.scenarioEvents(scenario, common.ModeExecute)
+	if err != nil {
+		return err
+	}
+	defer func() { endScenario(err) }()
+
+	checkpoints, err := e.scenarioCheckpoints(scenario)
+	if err != nil {
+		return err
+	}
+
 	return fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
 		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
-		captureEnvironmentBaseline()
+		initialEnvironmentVariables := captureEnvironmentBaseline()
+		defer shells.UseBackend(e.Configuration.ShellBackend)()
 
 		// Execute the steps
 		fmt.Println(ui.ScenarioTitleStyle.Render(scenario.Name))
@@ -67,7 +220,25 @@ func (e *Engine) ExecuteScenario(scenario *common.Scenario) error {
 			}
 			fmt.Println()
 		}
-		err := e.ExecuteAndRenderSteps(scenario.Steps, lib.CopyMap(scenario.Environment))
+		ctx, cancel := e.scenarioContext(context.Background())
+		defer cancel()
+
+		err := e.ExecuteAndRenderSteps(ctx, scenario.Steps, lib.CopyMap(scenario.Environment), checkpoints)
+		if err == nil {
+			checkpoints.Clear()
+		}
+
+		if e.Configuration.ReportFile != "" {
+			var failedCodeBlock *common.StatefulCodeBlock
+			if last := len(e.codeBlocks) - 1; last >= 0 && !e.codeBlocks[last].Success {
+				failedCodeBlock = &e.codeBlocks[last]
+			}
+			if reportErr := e.writeReport(scenario, initialEnvironmentVariables, err, failedCodeBlock, e.codeBlocks); reportErr != nil {
+				err = errors.Join(err, reportErr)
+			} else {
+				fmt.Println("Report written to " + e.Configuration.ReportFile)
+			}
+		}
 		// Always print a consolidated summary of missing prerequisites at the end of scenario execution.
 		common.SummarizeMissingPrerequisites()
 		return err
@@ -76,15 +247,38 @@ func (e *Engine) ExecuteScenario(scenario *common.Scenario) error {
 
 // Executes a scenario in testing moe. This mode goes over each code block
 // and executes it without user interaction.
-func (e *Engine) TestScenario(scenario *common.Scenario) error {
+func (e *Engine) TestScenario(scenario *common.Scenario) (err error) {
+	if e.Configuration.UpdateExpected {
+		return e.updateExpectedOutputs(scenario)
+	}
+
+	endScenario, err := e.scenarioEvents(scenario, common.ModeTest)
+	if err != nil {
+		return err
+	}
+	defer func() { endScenario(err) }()
+
+	checkpoints, err := e.scenarioCheckpoints(scenario)
+	if err != nil {
+		return err
+	}
+
 	return fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
 		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
-		stepsToExecute := filterDeletionCommands(scenario.Steps, e.Configuration.DoNotDelete)
+		stepsToExecute := common.FilterSkippedCodeBlocks(
+			common.FilterDestructiveCodeBlocks(scenario.Steps, e.Configuration.DoNotDelete, e.destructiveCommands()),
+			common.ModeTest,
+			e.Configuration.SkipTags,
+		)
+		if err := e.checkPolicy(stepsToExecute); err != nil {
+			return err
+		}
 
 		initialEnvironmentVariables := lib.GetEnvironmentVariables()
 		if err := lib.SaveEnvironmentBaselineFile(lib.DefaultEnvironmentStateFile, initialEnvironmentVariables); err != nil {
 			logging.GlobalLogger.Warnf("Failed to capture environment baseline: %v", err)
 		}
+		defer shells.UseBackend(e.Configuration.ShellBackend)()
 
 		model, err := test.NewTestModeModel(
 			scenario.Name,
@@ -97,6 +291,10 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 			return err
 		}
 
+		ctx, cancel := e.scenarioContext(context.Background())
+		defer cancel()
+		model = model.WithContext(ctx).WithCheckpoints(checkpoints)
+
 		var flags []tea.ProgramOption
 		if e.Configuration.Environment.IsGithubAction() {
 			flags = append(
@@ -109,10 +307,10 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 			flags = append(flags, tea.WithAltScreen(), tea.WithMouseCellMotion())
 		}
 
-		common.Program = tea.NewProgram(model, flags...)
+		tui.Program = tea.NewProgram(model, flags...)
 
 		var finalModel tea.Model
-		finalModel, err = common.Program.Run()
+		finalModel, err = tui.Program.Run()
 
 		// TODO(vmarcella): After testing is complete, we should generate a report.
 
@@ -123,29 +321,15 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 		}
 
 		if e.Configuration.ReportFile != "" {
-			allEnvironmentVariables, envErr := lib.LoadEnvironmentStateFile(
-				lib.DefaultEnvironmentStateFile,
-			)
-			if envErr != nil {
-				logging.GlobalLogger.Errorf("Failed to load environment state file: %s", err)
-				err = errors.Join(err, fmt.Errorf("failed to load environment state file: %s", err))
-				return err
-			}
-
-			variablesDeclaredByScenario := lib.DiffMapsByKey(
-				allEnvironmentVariables,
+			reportErr := e.writeReport(
+				scenario,
 				initialEnvironmentVariables,
+				model.GetFailure(),
+				model.GetFailedCodeBlock(),
+				model.GetCodeBlocks(),
 			)
-
-			report := common.BuildReport(scenario.Name)
-			err = report.
-				WithProperties(scenario.Properties).
-				WithEnvironmentVariables(variablesDeclaredByScenario).
-				WithError(model.GetFailure()).
-				WithCodeBlocks(model.GetCodeBlocks()).
-				WriteToJSONFile(e.Configuration.ReportFile)
-			if err != nil {
-				err = errors.Join(err, fmt.Errorf("failed to write report to file: %s", err))
+			if reportErr != nil {
+				err = errors.Join(err, reportErr)
 				return err
 			}
 
@@ -157,6 +341,9 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 
 		fmt.Println(strings.Join(model.CommandLines, "\n"))
 
+		if model.GetFailure() == nil {
+			checkpoints.Clear()
+		}
 		err = errors.Join(err, model.GetFailure())
 		if err != nil {
 			logging.GlobalLogger.Errorf("Failed to run ie test %s", err)
@@ -169,12 +356,26 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 
 // Executes a Scenario in interactive mode. This mode goes over each codeblock
 // step by step and allows the user to interact with the codeblock.
-func (e *Engine) InteractWithScenario(scenario *common.Scenario) error {
+func (e *Engine) InteractWithScenario(scenario *common.Scenario) (err error) {
+	endScenario, err := e.scenarioEvents(scenario, common.ModeInteractive)
+	if err != nil {
+		return err
+	}
+	defer func() { endScenario(err) }()
+
 	return fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
 		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
 		captureEnvironmentBaseline()
+		defer shells.UseBackend(e.Configuration.ShellBackend)()
 
-		stepsToExecute := filterDeletionCommands(scenario.Steps, e.Configuration.DoNotDelete)
+		stepsToExecute := common.FilterSkippedCodeBlocks(
+			common.FilterDestructiveCodeBlocks(scenario.Steps, e.Configuration.DoNotDelete, e.destructiveCommands()),
+			common.ModeInteractive,
+			e.Configuration.SkipTags,
+		)
+		if err := e.checkPolicy(stepsToExecute); err != nil {
+			return err
+		}
 
 		model, err := interactive.NewInteractiveModeModel(
 			scenario.Name,
@@ -183,16 +384,21 @@ func (e *Engine) InteractWithScenario(scenario *common.Scenario) error {
 			stepsToExecute,
 			lib.CopyMap(scenario.Environment),
 			scenario.GetSourceAsString(),
+			e.destructiveCommands(),
 		)
 		if err != nil {
 			return err
 		}
 
-		common.Program = tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
+		ctx, cancel := e.scenarioContext(context.Background())
+		defer cancel()
+		model = model.WithContext(ctx)
+
+		tui.Program = tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
 
 		var finalModel tea.Model
 		var ok bool
-		finalModel, err = common.Program.Run()
+		finalModel, err = tui.Program.Run()
 
 		model, ok = finalModel.(interactive.InteractiveModeModel)
 
@@ -208,8 +414,9 @@ func (e *Engine) InteractWithScenario(scenario *common.Scenario) error {
 		switch e.Configuration.Environment {
 		case environments.EnvironmentsAzure, environments.EnvironmentsOCD:
 
-			logging.GlobalLogger.Info(
-				"Cleaning environment variable file located at /tmp/ie-env-vars",
+			logging.GlobalLogger.Infof(
+				"Cleaning environment variable file located at %s",
+				lib.DefaultEnvironmentStateFile,
 			)
 
 			err := lib.CleanEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
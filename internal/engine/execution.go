@@ -1,6 +1,9 @@
 package engine
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -10,6 +13,7 @@ import (
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/events"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/parsers"
@@ -33,34 +37,6 @@ type stepTiming struct {
 	segments []childTiming
 }
 
-// If a scenario has an `az group delete` command and the `--do-not-delete`
-// flag is set, we remove it from the steps.
-func filterDeletionCommands(steps []common.Step, preserveResources bool) []common.Step {
-	filteredSteps := []common.Step{}
-	if preserveResources {
-		for _, step := range steps {
-			newBlocks := []parsers.CodeBlock{}
-			for _, block := range step.CodeBlocks {
-				if patterns.AzGroupDelete.MatchString(block.Content) {
-					continue
-				} else {
-					newBlocks = append(newBlocks, block)
-				}
-			}
-			if len(newBlocks) > -1 {
-				filteredSteps = append(filteredSteps, common.Step{
-					Name:       step.Name,
-					CodeBlocks: newBlocks,
-					Section:    step.Section,
-				})
-			}
-		}
-	} else {
-		filteredSteps = steps
-	}
-	return filteredSteps
-}
-
 func renderCommand(blockContent string) (shells.CommandOutput, error) {
 	escapedCommand := blockContent
 	if !patterns.MultilineQuotedStringCommand.MatchString(blockContent) {
@@ -79,8 +55,16 @@ func renderCommand(blockContent string) (shells.CommandOutput, error) {
 }
 
 // Executes the steps from a scenario and renders the output to the terminal.
-func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]string) error {
+// Code blocks are stopped once ctx is done. Progress is recorded with
+// checkpoints, and code blocks completed by a resumed run are skipped.
+func (e *Engine) ExecuteAndRenderSteps(
+	ctx context.Context,
+	steps []common.Step,
+	env map[string]string,
+	checkpoints *common.Checkpointer,
+) error {
 	var resourceGroupName string = ""
+	e.codeBlocks = nil
 	azureStatus := environments.NewAzureDeploymentStatus()
 	failedVerificationMarkers := make(map[string]bool)
 
@@ -92,7 +76,22 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 		return err
 	}
 
-	stepsToExecute := filterDeletionCommands(steps, e.Configuration.DoNotDelete)
+	stepsToExecute := common.FilterSkippedCodeBlocks(
+		common.FilterDestructiveCodeBlocks(steps, e.Configuration.DoNotDelete, e.destructiveCommands()),
+		common.ModeExecute,
+		e.Configuration.SkipTags,
+	)
+	if err := e.checkPolicy(stepsToExecute); err != nil {
+		logging.GlobalLogger.Errorf("The scenario violates the policy: %s", err)
+		azureStatus.SetError(err)
+		environments.ReportAzureStatus(azureStatus, string(e.Configuration.Environment))
+		return err
+	}
+	// Destructive code blocks are confirmed when someone is there to answer.
+	var destructiveConfirmations *bufio.Reader
+	if stdinIsTerminal() && !e.Configuration.Environment.IsAzureLike() {
+		destructiveConfirmations = bufio.NewReader(os.Stdin)
+	}
 	stepTimings := make([]stepTiming, 0, len(stepsToExecute))
 	defer func() {
 		if len(stepTimings) == 0 {
@@ -119,6 +118,10 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 	environments.ReportAzureStatus(azureStatus, string(e.Configuration.Environment))
 
 	for stepNumber, step := range stepsToExecute {
+		if len(step.CodeBlocks) > 0 && checkpoints.Completed(stepNumber, len(step.CodeBlocks)-1) {
+			continue
+		}
+
 		stepStart := time.Now()
 		segmentOrder := make([]string, 0)
 		segmentAccumulators := make(map[string]*segmentAccumulator)
@@ -172,7 +175,12 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 			})
 		}
 
-		for _, block := range step.CodeBlocks {
+		for blockNumber, block := range step.CodeBlocks {
+			if checkpoints.Completed(stepNumber, blockNumber) {
+				continue
+			}
+			checkpoints.Record(stepNumber, blockNumber)
+
 			blockType, autoMeta, hasAutoMeta := common.ParseAutoPrereqMetadata(block.Content)
 			isBannerBlock := hasAutoMeta && blockType == "banner"
 			isVerificationBlock := hasAutoMeta && blockType == "verification"
@@ -237,6 +245,14 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 			}
 
 			blockStart := time.Now()
+			// The outcome of the code block, recorded for reports once it ran.
+			blockState := common.StatefulCodeBlock{
+				StepName:        step.Name,
+				CodeBlock:       block,
+				StepNumber:      stepNumber,
+				CodeBlockNumber: blockNumber,
+			}
+			blockRan := false
 			segmentRecorded := false
 			recordBlockDuration := func() {
 				if segmentRecorded {
@@ -246,6 +262,22 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				if prereqSegmentName != "" {
 					recordPrereqSegment(prereqSegmentName, time.Since(blockStart), prereqSegmentType, prereqSegmentSource, prereqSegmentHeading)
 				}
+				if blockRan {
+					blockState.Duration = time.Since(blockStart)
+					e.codeBlocks = append(e.codeBlocks, blockState)
+				}
+			}
+			recordBlockOutcome := func(output shells.CommandOutput, err error) {
+				blockRan = true
+				blockState.StdOut = output.StdOut
+				blockState.StdErr = output.StdErr
+				blockState.ExitCode = output.ExitCode
+				// Failed verifications only mean the prerequisite has to run.
+				blockState.Success = err == nil || isVerificationBlock
+				if !blockState.Success {
+					blockState.Error = err
+					blockState.TimedOut = errors.Is(err, shells.ErrTimeout)
+				}
 			}
 
 			commandContent := block.Content
@@ -279,7 +311,7 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 			displayContent := commandContent
 			renderContent := commandContent
 			if isBodyBlock {
-				trimmed := stripPrereqBodyWrapper(commandContent)
+				trimmed := common.StripPrereqBodyWrapper(commandContent)
 				displayContent = trimmed
 				renderContent = trimmed
 			}
@@ -317,6 +349,26 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				fmt.Println()
 			}
 
+			if destructiveConfirmations != nil && !isBannerBlock {
+				if matches := common.FindDestructiveCommands(commandContent, e.destructiveCommands()); len(matches) > 0 {
+					switch confirmDestructiveCodeBlock(matches, destructiveConfirmations, os.Stdout) {
+					case skipDestructiveCodeBlock:
+						fmt.Printf("    %s\n\n", ui.VerboseStyle.Render("Skipped the code block."))
+						recordBlockDuration()
+						continue
+					case runAllDestructiveCodeBlocks:
+						destructiveConfirmations = nil
+					case stopBeforeDestructiveCodeBlock:
+						err := errors.New("stopped before running a destructive code block")
+						azureStatus.SetError(err)
+						environments.ReportAzureStatus(azureStatus, string(e.Configuration.Environment))
+						recordBlockDuration()
+						recordStepDuration()
+						return err
+					}
+				}
+			}
+
 			suppressOutput := isBannerBlock
 			var finalCommandOutput string
 			if e.Configuration.RenderValues {
@@ -360,10 +412,13 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				fmt.Print("    " + finalCommandOutput)
 			}
 
+			blockCtx := events.WithCodeBlock(ctx, events.Step{Number: stepNumber, Name: step.Name}, blockNumber)
+
 			// execute the command as a goroutine to allow for the spinner to be
 			// rendered while the command is executing.
 			done := make(chan error)
 			var commandOutput shells.CommandOutput
+			var commandAttempts []common.CodeBlockAttempt
 
 			// If the command is an SSH command, we need to forward the input and
 			// output
@@ -400,19 +455,24 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				}
 
 				go func(block parsers.CodeBlock) {
-					output, err := shells.ExecuteBashCommand(
-						block.Content,
+					output, attempts, err := common.ExecuteCodeBlockWithAttributes(
+						block,
 						shells.BashCommandConfiguration{
 							EnvironmentVariables: lib.CopyMap(env),
 							InheritEnvironment:   true,
 							InteractiveCommand:   false,
 							WriteToHistory:       true,
 							StreamOutput:         streamOutput,
+							Context:              blockCtx,
 						},
 					)
+					if len(attempts) > 1 {
+						logging.GlobalLogger.Infof("Command finished after %d attempts", len(attempts))
+					}
 					logging.GlobalLogger.Infof("Command output to stdout:\n %s", output.StdOut)
 					logging.GlobalLogger.Infof("Command output to stderr:\n %s", output.StdErr)
 					commandOutput = output
+					commandAttempts = attempts
 					done <- err
 				}(blockToExecute)
 			renderingLoop:
@@ -420,6 +480,8 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				for {
 					select {
 					case commandErr = <-done:
+						recordBlockOutcome(commandOutput, commandErr)
+						blockState.Attempts = commandAttempts
 						// Show the cursor, check the result of the command, and display the
 						// final status.
 						if !streamOutput {
@@ -428,13 +490,9 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 
 						if commandErr == nil {
 
-							actualOutput := commandOutput.StdOut
-							expectedOutput := block.ExpectedOutput.Content
-							expectedSimilarity := block.ExpectedOutput.ExpectedSimilarity
-							expectedRegexPattern := block.ExpectedOutput.ExpectedRegexPattern
-							expectedOutputLanguage := block.ExpectedOutput.Language
-
-							_, outputComparisonError := common.CompareCommandOutputs(actualOutput, expectedOutput, expectedSimilarity, expectedRegexPattern, expectedOutputLanguage)
+							score, outputComparisonError := common.CompareCodeBlockOutputs(block, commandOutput)
+							blockState.SimilarityScore = score
+							recordBlockOutcome(commandOutput, outputComparisonError)
 
 							if outputComparisonError != nil {
 								if isVerificationBlock {
@@ -445,13 +503,7 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 										fmt.Print("\r    \n")
 										terminal.MoveCursorPositionDown(lines)
 									}
-									renderExpectedActual(
-										block.ExpectedOutput.Content,
-										commandOutput.StdOut,
-										expectedSimilarity,
-										expectedRegexPattern,
-										true,
-									)
+									renderOutputMismatch(block, commandOutput, outputComparisonError, true)
 									// Suppress noisy warning log for expected verification failure; body will execute.
 									// Failure means body should execute; marker stays absent.
 									break renderingLoop
@@ -462,13 +514,7 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 									fmt.Print("\r    \n")
 									terminal.MoveCursorPositionDown(lines)
 								}
-								renderExpectedActual(
-									block.ExpectedOutput.Content,
-									commandOutput.StdOut,
-									expectedSimilarity,
-									expectedRegexPattern,
-									false,
-								)
+								renderOutputMismatch(block, commandOutput, outputComparisonError, false)
 
 								azureStatus.SetError(outputComparisonError)
 								environments.AttachResourceURIsToAzureStatus(
@@ -570,15 +616,17 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 					environments.ReportAzureStatus(azureStatus, string(e.Configuration.Environment))
 				}
 
-				output, commandExecutionError := shells.ExecuteBashCommand(
-					blockToExecute.Content,
+				output, attempts, commandExecutionError := common.ExecuteInteractiveCodeBlock(
+					blockToExecute,
 					shells.BashCommandConfiguration{
 						EnvironmentVariables: lib.CopyMap(env),
 						InheritEnvironment:   true,
-						InteractiveCommand:   true,
 						WriteToHistory:       false,
+						Context:              blockCtx,
 					},
 				)
+				recordBlockOutcome(output, commandExecutionError)
+				blockState.Attempts = attempts
 
 				terminal.ShowCursor()
 
@@ -629,8 +677,9 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 
 	switch {
 	case e.Configuration.Environment.IsAzureLike():
-		logging.GlobalLogger.Info(
-			"Cleaning environment variable file located at /tmp/ie-env-vars",
+		logging.GlobalLogger.Infof(
+			"Cleaning environment variable file located at %s",
+			lib.DefaultEnvironmentStateFile,
 		)
 		err := lib.CleanEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
 		if err != nil {
@@ -638,8 +687,9 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 			return err
 		}
 
-		logging.GlobalLogger.Info(
-			"Cleaning working directory file located at /tmp/working-dir",
+		logging.GlobalLogger.Infof(
+			"Cleaning working directory file located at %s",
+			lib.DefaultWorkingDirectoryStateFile,
 		)
 		err = lib.DeleteWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile)
 		if err != nil {
@@ -657,26 +707,30 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 	return nil
 }
 
-func stripPrereqBodyWrapper(content string) string {
-	trimmedContent := strings.TrimSuffix(content, "\n")
-	lines := strings.Split(trimmedContent, "\n")
-	if len(lines) < 3 {
-		return content
-	}
-
-	first := strings.TrimSpace(lines[0])
-	last := strings.TrimSpace(lines[len(lines)-1])
-	if !strings.HasPrefix(first, "if [ ! -f ") || !strings.HasSuffix(first, "]; then") || last != "fi" {
-		return content
+// Shows why the output of a code block did not meet its expectations.
+func renderOutputMismatch(block parsers.CodeBlock, output shells.CommandOutput, err error, isVerification bool) {
+	if block.Attributes.ExpectedStdErr != "" {
+		if _, stdoutErr := common.CompareExpectedOutput(output.StdOut, block.ExpectedOutput); stdoutErr == nil {
+			// Only the stderr expectation failed.
+			fmt.Printf("  %s\n", err.Error())
+			return
+		}
 	}
-
-	inner := strings.Join(lines[1:len(lines)-1], "\n")
-	return inner
+	renderExpectedActual(block.ExpectedOutput, output.StdOut, isVerification)
 }
 
-func renderExpectedActual(expected string, actual string, expectedSimilarity float64, expectedRegexPattern string, isVerification bool) {
+func renderExpectedActual(expected parsers.ExpectedOutputBlock, actual string, isVerification bool) {
+	expectedSimilarity := expected.ExpectedSimilarity
+	expectedRegexPattern := expected.ExpectedRegexPattern
+	expectedContent := expected.Content
+	diff := ""
+	if strings.TrimSpace(expectedRegexPattern) == "" {
+		// Show the outputs the way they were compared.
+		diff = common.OutputDiff(expected, actual)
+		actual, expectedContent = common.NormalizeOutputs(actual, expected)
+	}
 	trimmedActual := strings.TrimRight(actual, "\n")
-	trimmedExpected := strings.TrimRight(expected, "\n")
+	trimmedExpected := strings.TrimRight(expectedContent, "\n")
 
 	if isVerification {
 		fmt.Println("  " + ui.WarningStyle.Render("Prerequisite verification failed, prereq needs to be run:"))
@@ -696,7 +750,27 @@ func renderExpectedActual(expected string, actual string, expectedSimilarity flo
 		}
 	}
 
-	if showSimilarity {
+	comparator := expected.Comparator
+	if comparator == common.ComparatorSimilarity || comparator == common.ComparatorJSONSimilarity {
+		comparator = ""
+	}
+
+	if diff != "" {
+		if comparator != "" {
+			fmt.Printf("    Compared with %s.\n", comparator)
+		} else {
+			fmt.Printf("    Expected similarity level of %s.\n", formatSimilarityValue(expectedSimilarity))
+		}
+		for _, line := range strings.Split(common.FormatOutputDiff(diff), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+		return
+	}
+
+	if regexPattern == "" && comparator != "" {
+		fmt.Printf("    Expected output, compared with %s:\n", comparator)
+		renderIndentedBlock(trimmedExpected, "      ")
+	} else if showSimilarity {
 		threshold := formatSimilarityValue(expectedSimilarity)
 		fmt.Printf("    Expected similarity level of %s to:\n", threshold)
 		renderIndentedBlock(trimmedExpected, "      ")
@@ -1,6 +1,7 @@
 package interactive
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/engine/tui"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/patterns"
@@ -41,6 +43,7 @@ type interactiveModeComponents struct {
 }
 
 type InteractiveModeModel struct {
+	ctx               context.Context
 	azureStatus       environments.AzureDeploymentStatus
 	codeBlockState    map[int]common.StatefulCodeBlock
 	commands          InteractiveModeCommands
@@ -62,12 +65,20 @@ type InteractiveModeModel struct {
 	ready             bool
 	markdownSource    string
 	CommandLines      []string
+	// The destructive commands of each code block, if it runs any.
+	destructiveCommands map[int][]common.DestructiveMatch
+}
+
+// Returns a copy of the model whose code blocks are stopped once ctx is done.
+func (model InteractiveModeModel) WithContext(ctx context.Context) InteractiveModeModel {
+	model.ctx = ctx
+	return model
 }
 
 // Initialize the intractive mode model
 func (model InteractiveModeModel) Init() tea.Cmd {
 	environments.ReportAzureStatus(model.azureStatus, model.environment)
-	return tea.Batch(common.ClearScreen(), tea.Tick(time.Millisecond*10, func(t time.Time) tea.Msg {
+	return tea.Batch(tui.ClearScreen(), tea.Tick(time.Millisecond*10, func(t time.Time) tea.Msg {
 		return tea.KeyMsg{Type: tea.KeyCtrlL} // This is to force a repaint
 	}))
 }
@@ -176,6 +187,7 @@ func handleUserInput(
 		}
 
 		codeBlock := codeBlockState.CodeBlock
+		ctx := codeBlockState.EventContext(model.ctx)
 
 		model.executingCommand = true
 
@@ -206,13 +218,14 @@ func handleUserInput(
 			)
 
 			commands = append(commands, tea.Sequence(
-				common.UpdateAzureStatus(model.azureStatus, model.environment),
+				tui.UpdateAzureStatus(model.azureStatus, model.environment),
 				func() tea.Msg {
-					return common.ExecuteCodeBlockSync(codeBlock, lib.CopyMap(model.env))
+					return tui.ExecuteCodeBlockSync(ctx, codeBlock, lib.CopyMap(model.env))
 				}))
 
 		} else {
-			commands = append(commands, common.ExecuteCodeBlockAsync(
+			commands = append(commands, tui.ExecuteCodeBlockAsync(
+				ctx,
 				codeBlock,
 				lib.CopyMap(model.env),
 			))
@@ -309,7 +322,9 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState := model.codeBlockState[step]
 		codeBlockState.StdOut = message.StdOut
 		codeBlockState.StdErr = message.StdErr
+		codeBlockState.ExitCode = message.ExitCode
 		codeBlockState.Success = true
+		codeBlockState.Attempts = message.Attempts
 		model.codeBlockState[step] = codeBlockState
 
 		logging.GlobalLogger.Infof("Finished executing:\n %s", codeBlockState.CodeBlock.Content)
@@ -377,7 +392,7 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			commands = append(
 				commands,
 				tea.Sequence(
-					common.UpdateAzureStatus(model.azureStatus, model.environment),
+					tui.UpdateAzureStatus(model.azureStatus, model.environment),
 					tea.Quit,
 				),
 			)
@@ -385,7 +400,7 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			commands = append(
 				commands,
 				tea.Sequence(
-					common.UpdateAzureStatus(model.azureStatus, model.environment),
+					tui.UpdateAzureStatus(model.azureStatus, model.environment),
 					// Send a key event to trigger
 					func() tea.Msg {
 						if model.stepsToBeExecuted <= 0 {
@@ -405,7 +420,9 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState := model.codeBlockState[step]
 		codeBlockState.StdOut = message.StdOut
 		codeBlockState.StdErr = message.StdErr
+		codeBlockState.ExitCode = message.ExitCode
 		codeBlockState.Success = false
+		codeBlockState.Attempts = message.Attempts
 
 		model.codeBlockState[step] = codeBlockState
 		model.CommandLines = append(model.CommandLines, codeBlockState.StdErr)
@@ -423,12 +440,12 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		commands = append(
 			commands,
 			tea.Sequence(
-				common.UpdateAzureStatus(model.azureStatus, model.environment),
+				tui.UpdateAzureStatus(model.azureStatus, model.environment),
 				tea.Quit,
 			),
 		)
 
-	case common.AzureStatusUpdatedMessage:
+	case tui.AzureStatusUpdatedMessage:
 		// After the status has been updated, we force a window resize to
 		// render over the status update. For some reason, clearing the screen
 		// manually seems to cause the text produced by View() to not render
@@ -487,6 +504,10 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		)
 	}
 
+	if matches := model.destructiveCommands[model.currentCodeBlock]; len(matches) > 0 {
+		renderedStepSection = renderDestructiveWarning(matches) + "\n" + renderedStepSection
+	}
+
 	model.components.stepViewport.SetContent(
 		renderedStepSection,
 	)
@@ -516,6 +537,19 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 	return model, tea.Batch(commands...)
 }
 
+// Highlights that the current code block deletes resources or data.
+func renderDestructiveWarning(matches []common.DestructiveMatch) string {
+	lines := []string{"⚠ This code block runs destructive commands:"}
+	for _, match := range matches {
+		line := "  " + match.Text
+		if match.Command.Description != "" {
+			line += " (" + match.Command.Description + ")"
+		}
+		lines = append(lines, line)
+	}
+	return ui.WarningStyle.Bold(true).Render(strings.Join(lines, "\n"))
+}
+
 // Shows the commands that the user can use to interact with the interactive
 // mode model.
 func (model InteractiveModeModel) helpView() string {
@@ -600,6 +634,7 @@ func NewInteractiveModeModel(
 	steps []common.Step,
 	env map[string]string,
 	markdownSource string,
+	destructiveCommands []common.DestructiveCommand,
 ) (InteractiveModeModel, error) {
 	// TODO: In the future we should just set the current step for the azure status
 	// to one as the default.
@@ -607,6 +642,7 @@ func NewInteractiveModeModel(
 	azureStatus.CurrentStep = 1
 	totalCodeBlocks := 0
 	codeBlockState := make(map[int]common.StatefulCodeBlock)
+	destructiveMatches := make(map[int][]common.DestructiveMatch)
 
 	err := az.SetSubscription(subscription)
 	if err != nil {
@@ -634,6 +670,9 @@ func NewInteractiveModeModel(
 				Error:           nil,
 				Success:         false,
 			}
+			if matches := common.FindDestructiveCommands(block.Content, destructiveCommands); len(matches) > 0 {
+				destructiveMatches[totalCodeBlocks] = matches
+			}
 
 			totalCodeBlocks += 1
 		}
@@ -660,6 +699,7 @@ func NewInteractiveModeModel(
 	)
 
 	return InteractiveModeModel{
+		ctx:           context.Background(),
 		scenarioTitle: title,
 		commands: InteractiveModeCommands{
 			execute: key.NewBinding(
@@ -698,5 +738,7 @@ func NewInteractiveModeModel(
 		ready:             false,
 		markdownSource:    markdownSource,
 		CommandLines:      commandLines,
+
+		destructiveCommands: destructiveMatches,
 	}, nil
 }
@@ -1,11 +1,14 @@
 package test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/engine/tui"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/patterns"
@@ -23,6 +26,8 @@ type TestModeCommands struct {
 
 // The state required for testing scenarios.
 type TestModeModel struct {
+	ctx                  context.Context
+	checkpoints          *common.Checkpointer
 	codeBlockState       map[int]common.StatefulCodeBlock
 	commands             TestModeCommands
 	currentCodeBlock     int
@@ -45,15 +50,34 @@ func (model TestModeModel) GetFailure() error {
 	}
 
 	failedCodeBlock := model.codeBlockState[model.currentCodeBlock]
+	location := ""
+	if position := failedCodeBlock.CodeBlock.Position; position.IsKnown() {
+		location = fmt.Sprintf(" (%s)", position)
+	}
 	return fmt.Errorf(
-		"failed to execute code block %d on step %d.\nError: %s\nStdErr: %s",
+		"failed to execute code block %d on step %d%s.\nError: %w\nStdErr: %s",
 		failedCodeBlock.CodeBlockNumber,
 		failedCodeBlock.StepNumber,
+		location,
 		failedCodeBlock.Error,
 		failedCodeBlock.StdErr,
 	)
 }
 
+// Obtains the code block that the scenario failed on. If the scenario was
+// completed successfully, then it returns nil.
+func (model TestModeModel) GetFailedCodeBlock() *common.StatefulCodeBlock {
+	if model.scenarioCompleted {
+		return nil
+	}
+
+	failedCodeBlock, ok := model.codeBlockState[model.currentCodeBlock]
+	if !ok {
+		return nil
+	}
+	return &failedCodeBlock
+}
+
 func (model TestModeModel) GetScenarioTitle() string {
 	return model.scenarioTitle
 }
@@ -80,10 +104,49 @@ func (model TestModeModel) GetDeclaredEnvironmentVariables() map[string]string {
 	return model.environmentVariables
 }
 
+// Returns a copy of the model whose code blocks are stopped once ctx is done.
+func (model TestModeModel) WithContext(ctx context.Context) TestModeModel {
+	model.ctx = ctx
+	return model
+}
+
+// Returns a copy of the model that records its progress with checkpoints and
+// starts at the first code block not completed by the run being resumed.
+func (model TestModeModel) WithCheckpoints(checkpoints *common.Checkpointer) TestModeModel {
+	model.checkpoints = checkpoints
+
+	for model.currentCodeBlock < len(model.codeBlockState) {
+		state := model.codeBlockState[model.currentCodeBlock]
+		if !checkpoints.Completed(state.StepNumber, state.CodeBlockNumber) {
+			break
+		}
+		model.currentCodeBlock++
+	}
+
+	if model.currentCodeBlock > 0 && model.currentCodeBlock < len(model.codeBlockState) {
+		state := model.codeBlockState[model.currentCodeBlock]
+		model.CommandLines = []string{
+			model.CommandLines[0],
+			ui.StepTitleStyle.Render(
+				fmt.Sprintf("Step %d: %s", model.currentCodeBlock+1, state.StepName),
+			) + "\n",
+			ui.CommandPrompt(state.CodeBlock.Language) + state.CodeBlock.Content,
+		}
+	}
+	return model
+}
+
 // Init the test mode model by executing the first code block.
 func (model TestModeModel) Init() tea.Cmd {
-	return common.ExecuteCodeBlockAsync(
-		model.codeBlockState[model.currentCodeBlock].CodeBlock,
+	if model.currentCodeBlock >= len(model.codeBlockState) {
+		return tui.Exit(false)
+	}
+
+	state := model.codeBlockState[model.currentCodeBlock]
+	model.checkpoints.Record(state.StepNumber, state.CodeBlockNumber)
+	return tui.ExecuteCodeBlockAsync(
+		state.EventContext(model.ctx),
+		state.CodeBlock,
 		model.environmentVariables,
 	)
 }
@@ -116,8 +179,11 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState := model.codeBlockState[step]
 		codeBlockState.StdOut = message.StdOut
 		codeBlockState.StdErr = message.StdErr
+		codeBlockState.ExitCode = message.ExitCode
 		codeBlockState.Success = true
 		codeBlockState.SimilarityScore = message.SimilarityScore
+		codeBlockState.Attempts = message.Attempts
+		codeBlockState.Duration = message.Duration
 		model.codeBlockState[step] = codeBlockState
 
 		logging.GlobalLogger.Infof("Finished executing:\n %s", codeBlockState.CodeBlock.Content)
@@ -171,14 +237,19 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			logging.GlobalLogger.Infof("The last codeblock was executed. Requesting to exit test mode...")
 			commands = append(
 				commands,
-				common.Exit(false),
+				tui.Exit(false),
 			)
 
 		} else {
 			// If the scenario has not been completed, we need to execute the next command
+			model.checkpoints.Record(nextCodeBlockState.StepNumber, nextCodeBlockState.CodeBlockNumber)
 			commands = append(
 				commands,
-				common.ExecuteCodeBlockAsync(nextCodeBlockState.CodeBlock, model.environmentVariables),
+				tui.ExecuteCodeBlockAsync(
+					nextCodeBlockState.EventContext(model.ctx),
+					nextCodeBlockState.CodeBlock,
+					model.environmentVariables,
+				),
 			)
 		}
 
@@ -190,17 +261,21 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState := model.codeBlockState[step]
 		codeBlockState.StdOut = message.StdOut
 		codeBlockState.StdErr = message.StdErr
+		codeBlockState.ExitCode = message.ExitCode
 		codeBlockState.Error = message.Error
 		codeBlockState.Success = false
 		codeBlockState.SimilarityScore = message.SimilarityScore
+		codeBlockState.TimedOut = errors.Is(message.Error, shells.ErrTimeout)
+		codeBlockState.Attempts = message.Attempts
+		codeBlockState.Duration = message.Duration
 
 		model.codeBlockState[step] = codeBlockState
 		model.CommandLines = append(model.CommandLines, renderFailureOutput(codeBlockState.StdErr, message.Error))
 		viewportContentUpdated = true
 
-		commands = append(commands, common.Exit(true))
+		commands = append(commands, tui.Exit(true))
 
-	case common.ExitMessage:
+	case tui.ExitMessage:
 		// TODO: Generate test report
 
 		// Delete any found resource groups.
@@ -310,6 +385,7 @@ func NewTestModeModel(
 	}
 
 	return TestModeModel{
+		ctx:           context.Background(),
 		scenarioTitle: title,
 		commands: TestModeCommands{
 			quit: key.NewBinding(
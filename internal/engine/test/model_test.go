@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/engine/tui"
 	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/stretchr/testify/assert"
@@ -131,7 +132,7 @@ func TestTestModeModel(t *testing.T) {
 
 			// Assert that the model doesn't try to delete the resource group when
 			// the resource group name is empty.
-			m, _ = model.Update(common.Exit(false)())
+			m, _ = model.Update(tui.Exit(false)())
 			counter := 0
 
 			// We create a mock function to replace the shells.ExecuteBashCommand function
@@ -213,7 +214,7 @@ func TestTestModeModel(t *testing.T) {
 				return shells.CommandOutput{}, nil
 			}
 
-			m, _ = model.Update(common.Exit(false)())
+			m, _ = model.Update(tui.Exit(false)())
 
 			if model, ok = m.(TestModeModel); ok {
 				assert.Equal(t, 1, counter)
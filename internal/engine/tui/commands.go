@@ -0,0 +1,109 @@
+// Package tui holds the Bubble Tea program, commands and messages shared by
+// the terminal UIs of test and interactive mode.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// TODO: Ideally we won't need a global program variable. We should
+// refactor this in the future such that each tea program is localized to the
+// function that creates it and ExecuteCodeBlockSync doesn't mutate the global
+// program variable.
+var Program *tea.Program = nil
+
+type ExitMessage struct {
+	EncounteredFailure bool
+}
+
+func Exit(encounteredFailure bool) tea.Cmd {
+	return func() tea.Msg {
+		return ExitMessage{EncounteredFailure: encounteredFailure}
+	}
+}
+
+// Executes a bash command and returns a tea message with the output. This function
+// will be executed asycnhronously. The command is stopped when ctx is done.
+func ExecuteCodeBlockAsync(ctx context.Context, codeBlock parsers.CodeBlock, env map[string]string) tea.Cmd {
+	return func() tea.Msg {
+		return common.ExecuteCodeBlock(ctx, codeBlock, env)
+	}
+}
+
+// Executes a bash command syncrhonously. This function will block until the command
+// finishes executing or ctx is done. The output of the command goes to the
+// terminal, so only the exit code expectation and retry policy of the code
+// block are checked.
+func ExecuteCodeBlockSync(ctx context.Context, codeBlock parsers.CodeBlock, env map[string]string) tea.Msg {
+	logging.GlobalLogger.Info("Executing command synchronously: ", codeBlock.Content)
+	Program.ReleaseTerminal()
+
+	start := time.Now()
+	output, attempts, err := common.ExecuteInteractiveCodeBlock(
+		codeBlock,
+		shells.BashCommandConfiguration{
+			EnvironmentVariables: env,
+			InheritEnvironment:   true,
+			WriteToHistory:       true,
+			Context:              ctx,
+		},
+	)
+
+	Program.RestoreTerminal()
+
+	if err != nil {
+		return common.FailedCommandMessage{
+			StdOut:   output.StdOut,
+			StdErr:   output.StdErr,
+			ExitCode: output.ExitCode,
+			Error:    err,
+			Attempts: attempts,
+			Duration: time.Since(start),
+		}
+	}
+
+	logging.GlobalLogger.Infof("Command output to stdout:\n %s", output.StdOut)
+	return common.SuccessfulCommandMessage{
+		StdOut:   output.StdOut,
+		StdErr:   output.StdErr,
+		ExitCode: output.ExitCode,
+		Attempts: attempts,
+		Duration: time.Since(start),
+	}
+}
+
+// clearScreen returns a command that clears the terminal screen and positions the cursor at the top-left corner
+func ClearScreen() tea.Cmd {
+	return func() tea.Msg {
+		fmt.Print(
+			"\033[H\033[2J",
+		) // ANSI escape codes for clearing the screen and repositioning the cursor
+		return nil
+	}
+}
+
+// Updates the azure status with the current state of the interactive mode
+// model.
+func UpdateAzureStatus(azureStatus environments.AzureDeploymentStatus, environment string) tea.Cmd {
+	return func() tea.Msg {
+		logging.GlobalLogger.Tracef(
+			"Attempting to update the azure status: %+v",
+			azureStatus,
+		)
+		environments.ReportAzureStatus(azureStatus, environment)
+		return AzureStatusUpdatedMessage{}
+	}
+}
+
+// Empty struct used to indicate that the azure status has been updated so
+// that we can respond to it within the Update() function.
+type AzureStatusUpdatedMessage struct{}
@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/az"
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/Azure/InnovationEngine/internal/ui"
+	"github.com/mattn/go-isatty"
+)
+
+// Tests a scenario without the terminal UI and replaces the expected outputs
+// that the actual outputs no longer match in the markdown of the scenario.
+// Expected outputs are not compared while the scenario runs, so a mismatch
+// does not stop it. Each replacement is confirmed when stdin is a terminal.
+func (e *Engine) updateExpectedOutputs(scenario *common.Scenario) (err error) {
+	endScenario, err := e.scenarioEvents(scenario, common.ModeTest)
+	if err != nil {
+		return err
+	}
+	defer func() { endScenario(err) }()
+
+	checkpoints, err := e.scenarioCheckpoints(scenario)
+	if err != nil {
+		return err
+	}
+
+	steps := common.FilterSkippedCodeBlocks(
+		common.FilterDestructiveCodeBlocks(scenario.Steps, e.Configuration.DoNotDelete, e.destructiveCommands()),
+		common.ModeTest,
+		e.Configuration.SkipTags,
+	)
+	if err := e.checkPolicy(steps); err != nil {
+		return err
+	}
+
+	var codeBlocks []common.StatefulCodeBlock
+	runErr := fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
+		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
+		captureEnvironmentBaseline()
+		defer shells.UseBackend(e.Configuration.ShellBackend)()
+
+		fmt.Println(ui.ScenarioTitleStyle.Render(scenario.Name))
+		ctx, cancel := e.scenarioContext(context.Background())
+		defer cancel()
+
+		var err error
+		codeBlocks, err = common.RunCodeBlocks(
+			ctx,
+			common.WithoutReplaceableExpectedOutputs(steps),
+			lib.CopyMap(scenario.Environment),
+			checkpoints,
+		)
+		if err == nil {
+			checkpoints.Clear()
+		}
+		return err
+	})
+	if runErr != nil {
+		fmt.Println(ui.ErrorStyle.Render(runErr.Error()))
+	}
+
+	// The code blocks that ran before a failure may still have outdated
+	// expected outputs.
+	updates := common.FindOutdatedExpectedOutputs(steps, codeBlocks)
+	if len(updates) == 0 {
+		fmt.Println("All expected outputs match the actual outputs.")
+		return runErr
+	}
+
+	if stdinIsTerminal() {
+		updates = confirmExpectedOutputUpdates(updates, os.Stdin, os.Stdout)
+	}
+	updated, updateErr := common.ApplyExpectedOutputUpdates(updates)
+	printExpectedOutputUpdates(os.Stdout, updated)
+	return errors.Join(runErr, updateErr)
+}
+
+func stdinIsTerminal() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+// Shows how each actual output differs from its expected output and asks
+// whether to replace it. Returns the updates that were accepted.
+func confirmExpectedOutputUpdates(
+	updates []common.ExpectedOutputUpdate,
+	in io.Reader,
+	out io.Writer,
+) []common.ExpectedOutputUpdate {
+	reader := bufio.NewReader(in)
+	var accepted []common.ExpectedOutputUpdate
+	for index, update := range updates {
+		fmt.Fprintf(
+			out,
+			"\n%s\n%s\n%s\n",
+			ui.StepTitleStyle.Render(fmt.Sprintf(
+				"Step %d (%s), code block %d",
+				update.StepNumber+1,
+				update.StepName,
+				update.CodeBlockNumber+1,
+			)),
+			ui.VerboseStyle.Render(update.Expected.Position.String()),
+			common.RenderDiff(update.Diff()),
+		)
+
+		for {
+			fmt.Fprint(out, "Replace the expected output? [y]es, [n]o, [a]ll remaining, [q]uit: ")
+			answer, err := reader.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				accepted = append(accepted, update)
+			case "n", "no":
+			case "a", "all":
+				return append(accepted, updates[index:]...)
+			case "q", "quit":
+				return accepted
+			default:
+				if err != nil {
+					fmt.Fprintln(out)
+					return accepted
+				}
+				continue
+			}
+			break
+		}
+	}
+	return accepted
+}
+
+func printExpectedOutputUpdates(out io.Writer, updated map[string]int) {
+	files := make([]string, 0, len(updated))
+	for file := range updated {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		fmt.Fprintln(out, "No expected outputs were replaced.")
+		return
+	}
+	for _, file := range files {
+		fmt.Fprintln(out, ui.CheckStyle.Render(fmt.Sprintf(
+			"Replaced %d expected output(s) in %s",
+			updated[file],
+			file,
+		)))
+	}
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmExpectedOutputUpdates(t *testing.T) {
+	updates := []common.ExpectedOutputUpdate{
+		{StepName: "First", Actual: "one\n"},
+		{StepName: "Second", CodeBlockNumber: 1, Actual: "two\n"},
+		{StepNumber: 1, StepName: "Third", Actual: "three\n"},
+	}
+	confirm := func(input string) ([]string, string) {
+		var out bytes.Buffer
+		var accepted []string
+		for _, update := range confirmExpectedOutputUpdates(updates, strings.NewReader(input), &out) {
+			accepted = append(accepted, update.StepName)
+		}
+		return accepted, out.String()
+	}
+
+	t.Run("Each update is accepted or rejected", func(t *testing.T) {
+		accepted, out := confirm("y\nno\nY\n")
+		assert.Equal(t, []string{"First", "Third"}, accepted)
+		assert.Contains(t, out, "Step 1 (Second), code block 2")
+		assert.Contains(t, out, "+two\n")
+	})
+
+	t.Run("All remaining updates are accepted", func(t *testing.T) {
+		accepted, _ := confirm("n\na\n")
+		assert.Equal(t, []string{"Second", "Third"}, accepted)
+	})
+
+	t.Run("Quitting rejects the remaining updates", func(t *testing.T) {
+		accepted, _ := confirm("y\nq\n")
+		assert.Equal(t, []string{"First"}, accepted)
+	})
+
+	t.Run("Unknown answers are asked again", func(t *testing.T) {
+		accepted, out := confirm("maybe\n\ny\nn\nn\n")
+		assert.Equal(t, []string{"First"}, accepted)
+		assert.Equal(t, 5, strings.Count(out, "Replace the expected output?"))
+	})
+
+	t.Run("The end of the input rejects the remaining updates", func(t *testing.T) {
+		accepted, _ := confirm("y")
+		assert.Equal(t, []string{"First"}, accepted)
+	})
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"strings"
 	"testing"
@@ -45,7 +46,7 @@ func TestWorkingDirectoryDebugLine(t *testing.T) {
 	}
 	os.Stdout = w
 
-	execErr := e.ExecuteAndRenderSteps([]common.Step{step}, map[string]string{})
+	execErr := e.ExecuteAndRenderSteps(context.Background(), []common.Step{step}, map[string]string{}, nil)
 
 	// Restore stdout
 	w.Close()
@@ -0,0 +1,106 @@
+package events
+
+import (
+	"context"
+	"time"
+)
+
+type codeBlockKey struct{}
+
+type codeBlockLocation struct {
+	step   Step
+	number int
+}
+
+// Returns a copy of ctx that identifies the code block run under it, so that
+// the events of the code block say where it is in the scenario.
+func WithCodeBlock(ctx context.Context, step Step, codeBlockNumber int) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, codeBlockKey{}, codeBlockLocation{step: step, number: codeBlockNumber})
+}
+
+// Reports the events of a single run of a code block.
+type BlockRun struct {
+	step      *Step
+	codeBlock CodeBlock
+	start     time.Time
+}
+
+// Emits the block.start event of a code block that runs under ctx, which
+// should have been prepared with WithCodeBlock.
+func StartBlock(ctx context.Context, language string, command string) *BlockRun {
+	run := &BlockRun{start: time.Now()}
+	if ctx != nil {
+		if location, ok := ctx.Value(codeBlockKey{}).(codeBlockLocation); ok {
+			step := location.step
+			run.step = &step
+			run.codeBlock.Number = location.number
+		}
+	}
+
+	codeBlock := run.codeBlock
+	codeBlock.Language = language
+	codeBlock.Command = command
+	Emit(Event{Type: BlockStart, Step: run.step, CodeBlock: &codeBlock})
+	return run
+}
+
+// Emits a chunk of output written to the given stream. It matches the
+// signature of shells.BashCommandConfiguration.OutputObserver.
+func (run *BlockRun) Output(stream string, chunk []byte) {
+	run.emit(Event{Type: BlockOutput, Output: &Output{Stream: stream, Data: string(chunk)}})
+}
+
+// Emits the result of comparing the output of an attempt with the expected
+// output.
+func (run *BlockRun) Compared(attempt int, similarityScore float64, err error) {
+	run.emit(Event{
+		Type: BlockCompare,
+		Comparison: &Comparison{
+			Attempt:         attempt,
+			Success:         err == nil,
+			SimilarityScore: similarityScore,
+			Error:           errorMessage(err),
+		},
+	})
+}
+
+// Emits the block.end event, timed from when the code block started.
+func (run *BlockRun) End(err error, attempts int) {
+	run.emit(Event{
+		Type: BlockEnd,
+		Result: &Result{
+			Success:    err == nil,
+			Error:      errorMessage(err),
+			DurationMs: time.Since(run.start).Milliseconds(),
+			Attempts:   attempts,
+		},
+	})
+}
+
+func (run *BlockRun) emit(event Event) {
+	codeBlock := run.codeBlock
+	event.Step = run.step
+	event.CodeBlock = &codeBlock
+	Emit(event)
+}
+
+// Emits the scenario.start event of a scenario. The returned function emits
+// its scenario.end event with the outcome of the scenario, timed from now.
+func StartScenario(scenario Scenario) func(err error) {
+	start := time.Now()
+	Emit(Event{Type: ScenarioStart, Scenario: &scenario})
+	return func(err error) {
+		Emit(Event{
+			Type:     ScenarioEnd,
+			Scenario: &scenario,
+			Result: &Result{
+				Success:    err == nil,
+				Error:      errorMessage(err),
+				DurationMs: time.Since(start).Milliseconds(),
+			},
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Package events publishes a machine-readable stream of what the engine is
+// doing, one JSON object per line, so that other tools can follow a run
+// without parsing its terminal output. The schema is documented in
+// docs/specs/event-stream.md.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// Version of the event schema. It is bumped whenever a field is removed or
+// changes meaning, adding fields does not change the version.
+const SchemaVersion = 1
+
+// The type of an event.
+type Type string
+
+const (
+	ScenarioStart Type = "scenario.start"
+	StepStart     Type = "step.start"
+	BlockStart    Type = "block.start"
+	BlockOutput   Type = "block.output"
+	BlockCompare  Type = "block.compare"
+	BlockEnd      Type = "block.end"
+	ScenarioEnd   Type = "scenario.end"
+)
+
+// Names of the output streams reported by block.output events.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// A single event of the stream. Which of the optional fields are set depends
+// on the type of the event.
+type Event struct {
+	Version    int         `json:"version"`
+	Type       Type        `json:"type"`
+	Time       time.Time   `json:"time"`
+	Scenario   *Scenario   `json:"scenario,omitempty"`
+	Step       *Step       `json:"step,omitempty"`
+	CodeBlock  *CodeBlock  `json:"codeBlock,omitempty"`
+	Output     *Output     `json:"output,omitempty"`
+	Comparison *Comparison `json:"comparison,omitempty"`
+	Result     *Result     `json:"result,omitempty"`
+}
+
+// The scenario being run, set on scenario events.
+type Scenario struct {
+	Name     string `json:"name"`
+	Document string `json:"document,omitempty"`
+	// The mode the scenario runs in: execute, test or interactive.
+	Mode string `json:"mode"`
+	// The directory holding the state of the run.
+	StateDirectory string `json:"stateDirectory,omitempty"`
+}
+
+// The step a code block belongs to. Steps are numbered from zero, the same
+// way as in test reports.
+type Step struct {
+	Number int    `json:"number"`
+	Name   string `json:"name"`
+}
+
+// A code block, numbered from zero within its step. The command is only set
+// on block.start events.
+type CodeBlock struct {
+	Number   int    `json:"number"`
+	Language string `json:"language,omitempty"`
+	Command  string `json:"command,omitempty"`
+}
+
+// A chunk of output written by a code block.
+type Output struct {
+	Stream string `json:"stream"`
+	Data   string `json:"data"`
+}
+
+// The result of comparing the output of an attempt with the expected output.
+type Comparison struct {
+	Attempt         int     `json:"attempt"`
+	Success         bool    `json:"success"`
+	SimilarityScore float64 `json:"similarityScore"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// How a code block or scenario ended.
+type Result struct {
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	// The number of times a code block ran, including retries.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Delivers events to a writer or a handler. It is safe for concurrent use.
+type Emitter struct {
+	mutex   sync.Mutex
+	deliver func(Event) error
+	// The step of the last step.start event, used to start steps as their
+	// first code block starts.
+	step *Step
+	// Set once writing fails, after which events are dropped.
+	broken bool
+}
+
+// Creates an emitter that writes events to w as JSON Lines.
+func NewEmitter(w io.Writer) *Emitter {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &Emitter{deliver: func(event Event) error {
+		return encoder.Encode(event)
+	}}
+}
+
+// Creates an emitter that passes events to a handler, one at a time and in
+// the order they happen.
+func NewHandlerEmitter(handler func(Event)) *Emitter {
+	return &Emitter{deliver: func(event Event) error {
+		handler(event)
+		return nil
+	}}
+}
+
+// Writes an event, filling in its version and time. A step.start event is
+// written before the first block.start event of every step. Failing to write
+// never stops the scenario, the stream is abandoned instead.
+func (e *Emitter) Emit(event Event) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	switch event.Type {
+	case ScenarioStart:
+		e.step = nil
+	case BlockStart:
+		if event.Step != nil && (e.step == nil || *e.step != *event.Step) {
+			step := *event.Step
+			e.step = &step
+			e.write(Event{Type: StepStart, Time: event.Time, Step: &step})
+		}
+	}
+	e.write(event)
+}
+
+func (e *Emitter) write(event Event) {
+	if e.broken {
+		return
+	}
+	event.Version = SchemaVersion
+	if err := e.deliver(event); err != nil {
+		e.broken = true
+		logging.GlobalLogger.Warnf("Failed to write to the event stream, no more events will be written: %v", err)
+	}
+}
+
+var current atomic.Pointer[Emitter]
+
+// Sends the events of the process to the given emitter until the returned
+// function is called. A nil emitter disables the stream.
+func Use(emitter *Emitter) func() {
+	previous := current.Swap(emitter)
+	return func() {
+		current.Store(previous)
+	}
+}
+
+// Checks if events are being written anywhere.
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Emits an event to the stream in use, if any.
+func Emit(event Event) {
+	if emitter := current.Load(); emitter != nil {
+		emitter.Emit(event)
+	}
+}
+
+// Describes an error for an event.
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,160 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeEvents(t *testing.T, data []byte) []Event {
+	t.Helper()
+	var decoded []Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		decoded = append(decoded, event)
+	}
+	return decoded
+}
+
+func TestEmitter(t *testing.T) {
+	var buffer bytes.Buffer
+	defer Use(NewEmitter(&buffer))()
+
+	Emit(Event{Type: ScenarioStart, Scenario: &Scenario{Name: "Scenario", Mode: "test"}})
+	setup := WithCodeBlock(context.Background(), Step{Number: 0, Name: "Setup"}, 0)
+	run := StartBlock(setup, "bash", "echo hello")
+	run.Output(StreamStdout, []byte("hello\n"))
+	run.Compared(1, 1, nil)
+	run.End(nil, 1)
+	run = StartBlock(WithCodeBlock(context.Background(), Step{Number: 0, Name: "Setup"}, 1), "bash", "false")
+	run.End(errors.New("exit status 1"), 2)
+	run = StartBlock(WithCodeBlock(context.Background(), Step{Number: 1, Name: "Deploy"}, 0), "bash", "true")
+	run.End(nil, 1)
+	Emit(Event{Type: ScenarioEnd, Result: &Result{Success: true}})
+
+	decoded := decodeEvents(t, buffer.Bytes())
+	var types []Type
+	for _, event := range decoded {
+		assert.Equal(t, SchemaVersion, event.Version)
+		assert.False(t, event.Time.IsZero())
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []Type{
+		ScenarioStart,
+		StepStart, BlockStart, BlockOutput, BlockCompare, BlockEnd,
+		BlockStart, BlockEnd,
+		StepStart, BlockStart, BlockEnd,
+		ScenarioEnd,
+	}, types)
+
+	assert.Equal(t, &Step{Number: 0, Name: "Setup"}, decoded[1].Step)
+	assert.Equal(t, "echo hello", decoded[2].CodeBlock.Command)
+	assert.Equal(t, "hello\n", decoded[3].Output.Data)
+	assert.Equal(t, 0, decoded[3].CodeBlock.Number)
+	assert.Empty(t, decoded[3].CodeBlock.Command)
+	assert.True(t, decoded[4].Comparison.Success)
+	assert.Equal(t, 1, decoded[6].CodeBlock.Number)
+	assert.False(t, decoded[7].Result.Success)
+	assert.Equal(t, "exit status 1", decoded[7].Result.Error)
+	assert.Equal(t, 2, decoded[7].Result.Attempts)
+	assert.Equal(t, "Deploy", decoded[8].Step.Name)
+}
+
+func TestEmittingWithoutAStream(t *testing.T) {
+	assert.False(t, Enabled())
+	run := StartBlock(nil, "bash", "true")
+	run.Output(StreamStdout, []byte("ignored"))
+	run.End(nil, 1)
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("Files are appended to", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "events.jsonl")
+		for i := 0; i < 2; i++ {
+			stream, err := Open("file:" + path)
+			require.NoError(t, err)
+			NewEmitter(stream).Emit(Event{Type: ScenarioStart})
+			require.NoError(t, stream.Close())
+		}
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Len(t, decodeEvents(t, content), 2)
+	})
+
+	t.Run("Events are sent to unix sockets", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "events.sock")
+		listener, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		defer listener.Close()
+
+		received := make(chan []Event)
+		go func() {
+			connection, err := listener.Accept()
+			if err != nil {
+				close(received)
+				return
+			}
+			defer connection.Close()
+			var buffer bytes.Buffer
+			buffer.ReadFrom(connection)
+			received <- decodeEvents(t, buffer.Bytes())
+		}()
+
+		stream, err := Open("unix:" + path)
+		require.NoError(t, err)
+		NewEmitter(stream).Emit(Event{Type: ScenarioEnd})
+		require.NoError(t, stream.Close())
+
+		decoded := <-received
+		require.Len(t, decoded, 1)
+		assert.Equal(t, ScenarioEnd, decoded[0].Type)
+	})
+
+	t.Run("File descriptors must be open", func(t *testing.T) {
+		reader, writer, err := os.Pipe()
+		require.NoError(t, err)
+		defer reader.Close()
+		defer writer.Close()
+
+		stream, err := Open("fd:" + strconv.Itoa(int(writer.Fd())))
+		require.NoError(t, err)
+		NewEmitter(stream).Emit(Event{Type: BlockStart})
+
+		require.NoError(t, stream.Close())
+
+		lines := bufio.NewReader(reader)
+		line, err := lines.ReadBytes('\n')
+		require.NoError(t, err)
+		assert.Equal(t, BlockStart, decodeEvents(t, line)[0].Type)
+
+		// Closing the stream leaves the descriptor of the caller open.
+		NewEmitter(writer).Emit(Event{Type: BlockEnd})
+		line, err = lines.ReadBytes('\n')
+		require.NoError(t, err)
+		assert.Equal(t, BlockEnd, decodeEvents(t, line)[0].Type)
+
+		stream, err = Open("fd:2")
+		require.NoError(t, err)
+		require.NoError(t, stream.Close())
+		_, err = os.Stderr.Stat()
+		assert.NoError(t, err)
+
+		_, err = Open("fd:999")
+		assert.ErrorContains(t, err, "not open")
+		_, err = Open("fd:stdout")
+		assert.ErrorContains(t, err, "invalid file descriptor")
+	})
+}
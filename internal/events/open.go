@@ -0,0 +1,52 @@
+package events
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Opens the destination of an event stream, which is one of:
+//
+//   - fd:N, an open file descriptor inherited from the parent process, which
+//     stays open when the stream is closed.
+//   - unix:PATH, a unix socket that is listening for connections.
+//   - file:PATH or just PATH, a file that events are appended to.
+func Open(destination string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasPrefix(destination, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(destination, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid file descriptor in '%s'", destination)
+		}
+		// The descriptor belongs to the parent process, which may have passed
+		// stdout or stderr, so events are written to a duplicate of it that
+		// closing the stream closes.
+		duplicate, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+		if err != nil {
+			return nil, fmt.Errorf("file descriptor %d is not open: %w", fd, err)
+		}
+		return os.NewFile(uintptr(duplicate), destination), nil
+	case strings.HasPrefix(destination, "unix:"):
+		connection, err := net.Dial("unix", strings.TrimPrefix(destination, "unix:"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to the event socket: %w", err)
+		}
+		return connection, nil
+	default:
+		path := strings.TrimPrefix(destination, "file:")
+		if path == "" {
+			return nil, fmt.Errorf("no path given for the event stream")
+		}
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the event stream file: %w", err)
+		}
+		return file, nil
+	}
+}
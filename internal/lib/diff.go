@@ -1,6 +1,9 @@
 package lib
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
@@ -10,3 +13,167 @@ func GetDifferenceBetweenStrings(a, b string) string {
 	diffs := dmp.DiffMain(a, b, false)
 	return dmp.DiffPrettyText(diffs)
 }
+
+// A line of a diff, prefixed with ' ' when both texts have it, '-' when only
+// the old text has it and '+' when only the new text has it.
+type diffLine struct {
+	prefix byte
+	text   string
+}
+
+// Computes a line oriented unified diff between two texts, showing
+// contextLines unchanged lines around every change. The diff starts with
+// ---/+++ headers naming the texts and is empty when the texts have the same
+// lines.
+func UnifiedDiff(oldName string, newName string, oldText string, newText string, contextLines int) string {
+	lines := diffLines(oldText, newText)
+
+	var hunks strings.Builder
+	oldLine, newLine := 1, 1
+	for start := 0; start < len(lines); {
+		if lines[start].prefix == ' ' {
+			oldLine++
+			newLine++
+			start++
+			continue
+		}
+
+		// Widen the hunk to the context before the change, then extend it
+		// until more than twice the context separates the changes.
+		hunkStart := start - contextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := start
+		for index := start; index < len(lines) && index-hunkEnd <= 2*contextLines+1; index++ {
+			if lines[index].prefix != ' ' {
+				hunkEnd = index
+			}
+		}
+		hunkEnd += contextLines + 1
+		if hunkEnd > len(lines) {
+			hunkEnd = len(lines)
+		}
+
+		oldStart, newStart := oldLine-(start-hunkStart), newLine-(start-hunkStart)
+		oldCount, newCount := 0, 0
+		var body strings.Builder
+		for _, line := range lines[hunkStart:hunkEnd] {
+			if line.prefix != '+' {
+				oldCount++
+			}
+			if line.prefix != '-' {
+				newCount++
+			}
+			body.WriteByte(line.prefix)
+			body.WriteString(line.text)
+			body.WriteByte('\n')
+		}
+		fmt.Fprintf(
+			&hunks,
+			"@@ -%s +%s @@\n%s",
+			hunkRange(oldStart, oldCount),
+			hunkRange(newStart, newCount),
+			body.String(),
+		)
+
+		for _, line := range lines[start:hunkEnd] {
+			if line.prefix != '+' {
+				oldLine++
+			}
+			if line.prefix != '-' {
+				newLine++
+			}
+		}
+		start = hunkEnd
+	}
+
+	if hunks.Len() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n%s", oldName, newName, hunks.String())
+}
+
+// Formats the range of a hunk the way diff -u does, where an empty range
+// starts at the line before it.
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// Diffs the texts line by line. Every distinct line is encoded as a rune so
+// that the diff runs on whole lines.
+func diffLines(oldText string, newText string) []diffLine {
+	var lineArray []string
+	lineIndices := make(map[string]rune)
+	encode := func(text string) []rune {
+		var runes []rune
+		for _, line := range strings.SplitAfter(terminateLastLine(text), "\n") {
+			if line == "" {
+				continue
+			}
+			encoded, ok := lineIndices[line]
+			if !ok {
+				encoded = lineRune(len(lineArray))
+				lineIndices[line] = encoded
+				lineArray = append(lineArray, line)
+			}
+			runes = append(runes, encoded)
+		}
+		return runes
+	}
+	oldRunes := encode(oldText)
+	newRunes := encode(newText)
+
+	dmp := diffmatchpatch.New()
+	var lines []diffLine
+	for _, diff := range dmp.DiffMainRunes(oldRunes, newRunes, false) {
+		prefix := byte(' ')
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = '-'
+		case diffmatchpatch.DiffInsert:
+			prefix = '+'
+		}
+		for _, encoded := range diff.Text {
+			line := lineArray[lineIndex(encoded)]
+			lines = append(lines, diffLine{prefix: prefix, text: strings.TrimSuffix(line, "\n")})
+		}
+	}
+	return lines
+}
+
+// Surrogates are not valid runes, so line indices skip over them.
+const (
+	surrogateStart = 0xD800
+	surrogateCount = 0x800
+)
+
+func lineRune(index int) rune {
+	encoded := rune(index + 1)
+	if encoded >= surrogateStart {
+		encoded += surrogateCount
+	}
+	return encoded
+}
+
+func lineIndex(encoded rune) int {
+	if encoded >= surrogateStart+surrogateCount {
+		encoded -= surrogateCount
+	}
+	return int(encoded) - 1
+}
+
+// Ends the text with a newline, so that its last line compares equal to the
+// same line followed by others.
+func terminateLastLine(text string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		return text + "\n"
+	}
+	return text
+}
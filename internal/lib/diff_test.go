@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func numberedLines(from int, to int) []string {
+	var lines []string
+	for i := from; i <= to; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	return lines
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Run("Identical texts", func(t *testing.T) {
+		if diff := UnifiedDiff("expected", "actual", "one\ntwo\n", "one\ntwo", 3); diff != "" {
+			t.Errorf("Expected no difference, got:\n%s", diff)
+		}
+	})
+
+	t.Run("Changes far apart get their own hunks", func(t *testing.T) {
+		old := numberedLines(1, 20)
+		changed := append([]string{}, old...)
+		changed[1] = "line two"
+		changed[17] = "line eighteen"
+		changed = append(changed, "line 21")
+
+		expected := strings.Join([]string{
+			"--- expected",
+			"+++ actual",
+			"@@ -1,3 +1,3 @@",
+			" line 1",
+			"-line 2",
+			"+line two",
+			" line 3",
+			"@@ -17,4 +17,5 @@",
+			" line 17",
+			"-line 18",
+			"+line eighteen",
+			" line 19",
+			" line 20",
+			"+line 21",
+			"",
+		}, "\n")
+		diff := UnifiedDiff("expected", "actual", strings.Join(old, "\n"), strings.Join(changed, "\n"), 1)
+		if diff != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, diff)
+		}
+	})
+
+	t.Run("Changes close together share a hunk", func(t *testing.T) {
+		old := numberedLines(1, 6)
+		changed := []string{"line 1", "line 3", "line 4", "line 5", "line six"}
+
+		expected := strings.Join([]string{
+			"--- a",
+			"+++ b",
+			"@@ -1,6 +1,5 @@",
+			" line 1",
+			"-line 2",
+			" line 3",
+			" line 4",
+			" line 5",
+			"-line 6",
+			"+line six",
+			"",
+		}, "\n")
+		diff := UnifiedDiff("a", "b", strings.Join(old, "\n"), strings.Join(changed, "\n"), 2)
+		if diff != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, diff)
+		}
+	})
+
+	t.Run("Empty texts", func(t *testing.T) {
+		expected := "--- a\n+++ b\n@@ -0,0 +1 @@\n+added\n"
+		if diff := UnifiedDiff("a", "b", "", "added\n", 3); diff != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, diff)
+		}
+	})
+}
@@ -24,6 +24,21 @@ func GetEnvironmentVariables() map[string]string {
 	return envMap
 }
 
+// Get the environment inherited by the commands of a scenario: the environment
+// of the current process without IE_STATE_DIR, so that an ie run by a code
+// block gets its own state directory instead of overwriting the state of the
+// run it is part of.
+func InheritedEnvironment() []string {
+	prefix := StateDirectoryEnvironmentVariable + "="
+	environment := make([]string, 0, len(os.Environ()))
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, prefix) {
+			environment = append(environment, env)
+		}
+	}
+	return environment
+}
+
 // ParseEnvironmentVariableAssignments converts CLI-provided KEY=VALUE strings into a
 // map. It returns an error if any entry is not in the expected KEY=VALUE
 // format. This helper is intended for use by commands that accept repeated
@@ -133,6 +148,12 @@ func LoadEnvironmentStateFile(path string) (map[string]string, error) {
 	return env, nil
 }
 
+// Writes the given environment variables to a state file, replacing its
+// contents.
+func SaveEnvironmentStateFile(path string, env map[string]string) error {
+	return writeEnvironmentStateFile(path, filterInvalidKeys(env))
+}
+
 func CleanEnvironmentStateFile(path string) error {
 	env, err := LoadEnvironmentStateFile(path)
 	if err != nil {
@@ -42,6 +42,18 @@ func DiffMapsByKey(a, b map[string]string) map[string]string {
 	return diff
 }
 
+// Returns the entries of current that are missing from baseline or hold a
+// different value, e.g. the environment variables a scenario declared.
+func DiffMapsAgainstBaseline(current, baseline map[string]string) map[string]string {
+	diff := make(map[string]string)
+	for k, v := range current {
+		if value, exists := baseline[k]; !exists || value != v {
+			diff[k] = v
+		}
+	}
+	return diff
+}
+
 // Compares two maps by key and returns the difference between the two based
 // on the value of the key.
 func DiffMapsByValue(a, b map[string]string) map[string]string {
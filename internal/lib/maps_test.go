@@ -43,4 +43,18 @@ func TestMapUtilities(t *testing.T) {
 		}
 	})
 
+	t.Run("Diffing maps against a baseline", func(t *testing.T) {
+		baseline := map[string]string{"HOME": "/root", "REGION": "westus"}
+		current := map[string]string{"HOME": "/root", "REGION": "eastus", "MY_RG": "rg-1"}
+
+		diff := DiffMapsAgainstBaseline(current, baseline)
+
+		if len(diff) != 2 {
+			t.Errorf("Diff length is wrong: %d", len(diff))
+		}
+
+		if diff["REGION"] != "eastus" || diff["MY_RG"] != "rg-1" {
+			t.Errorf("Diff is wrong: %v", diff)
+		}
+	})
 }
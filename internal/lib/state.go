@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// The environment variable that selects the state directory of a run. It is
+// not passed on to the commands of a run, see InheritedEnvironment.
+const StateDirectoryEnvironmentVariable = "IE_STATE_DIR"
+
+// Name of the checkpoint file within a state directory.
+const CheckpointFileName = "checkpoint.json"
+
+// Directory under which every run gets its own state directory, named after
+// its run ID.
+var StateRoot = filepath.Join(os.TempDir(), "ie-runs")
+
+// Run directories that have not been used for this long are removed when a
+// new run starts.
+var StateDirectoryMaxAge = 7 * 24 * time.Hour
+
+// Where the progress of a run is checkpointed so that it can be resumed.
+var DefaultCheckpointFile = "/tmp/ie-checkpoint.json"
+
+// The directory holding the state of the current run. Until a run selects its
+// own directory, state is kept directly in /tmp.
+var stateDirectory = "/tmp"
+
+var runIDRegex = regexp.MustCompile(`^\d{8}T\d{6}-[0-9a-f]{6}$`)
+
+// Generates a new run ID, which sorts by the time the run started.
+func NewRunID() string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		// Fall back to the clock, run IDs only need to be unique per second.
+		suffix = []byte{byte(time.Now().Nanosecond()), byte(os.Getpid()), byte(os.Getpid() >> 8)}
+	}
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// Returns the state directory of the run with the given ID.
+func RunStateDirectory(runID string) string {
+	return filepath.Join(StateRoot, runID)
+}
+
+// Returns the directory holding the state of the current run.
+func StateDirectory() string {
+	return stateDirectory
+}
+
+// Keeps the state of the current run (environment variables, working
+// directory, checkpoints and prerequisite markers) in the given directory,
+// creating it if needed.
+func UseStateDirectory(directory string) error {
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return fmt.Errorf("failed to resolve state directory: %w", err)
+	}
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory '%s': %w", directory, err)
+	}
+
+	stateDirectory = directory
+	DefaultEnvironmentStateFile = filepath.Join(directory, "env-vars")
+	DefaultWorkingDirectoryStateFile = filepath.Join(directory, "working-dir")
+	DefaultCheckpointFile = filepath.Join(directory, CheckpointFileName)
+	return nil
+}
+
+// Lists the run state directories under StateRoot, most recently used first.
+func ListRunStateDirectories() ([]string, error) {
+	entries, err := os.ReadDir(StateRoot)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list run state directories: %w", err)
+	}
+
+	lastUsed := make(map[string]time.Time)
+	var directories []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !runIDRegex.MatchString(entry.Name()) {
+			continue
+		}
+		directory := filepath.Join(StateRoot, entry.Name())
+		directories = append(directories, directory)
+		lastUsed[directory] = stateDirectoryLastUsed(directory)
+	}
+
+	sort.SliceStable(directories, func(i, j int) bool {
+		return lastUsed[directories[i]].After(lastUsed[directories[j]])
+	})
+	return directories, nil
+}
+
+// Returns the most recently used run state directory, or an empty string if
+// there is none.
+func LatestRunStateDirectory() (string, error) {
+	directories, err := ListRunStateDirectories()
+	if err != nil || len(directories) == 0 {
+		return "", err
+	}
+	return directories[0], nil
+}
+
+// Removes the run state directories that have not been used for longer than
+// maxAge, except for the directory of the current run.
+func RemoveStaleStateDirectories(maxAge time.Duration) ([]string, error) {
+	directories, err := ListRunStateDirectories()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, directory := range directories {
+		if directory == stateDirectory || time.Since(stateDirectoryLastUsed(directory)) < maxAge {
+			continue
+		}
+		if err := os.RemoveAll(directory); err != nil {
+			return removed, fmt.Errorf("failed to remove state directory '%s': %w", directory, err)
+		}
+		removed = append(removed, directory)
+	}
+	return removed, nil
+}
+
+// Files are rewritten in place, which does not update the modification time
+// of the directory itself, so the newest file decides when it was last used.
+func stateDirectoryLastUsed(directory string) time.Time {
+	var lastUsed time.Time
+	if info, err := os.Stat(directory); err == nil {
+		lastUsed = info.ModTime()
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return lastUsed
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.ModTime().After(lastUsed) {
+			lastUsed = info.ModTime()
+		}
+	}
+	return lastUsed
+}
@@ -0,0 +1,103 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func useTemporaryStateRoot(t *testing.T) {
+	t.Helper()
+	originalRoot, originalDirectory := StateRoot, stateDirectory
+	originalEnv, originalWD, originalCheckpoint := DefaultEnvironmentStateFile, DefaultWorkingDirectoryStateFile, DefaultCheckpointFile
+	StateRoot = filepath.Join(t.TempDir(), "ie-runs")
+	t.Setenv(StateDirectoryEnvironmentVariable, "")
+	t.Cleanup(func() {
+		StateRoot, stateDirectory = originalRoot, originalDirectory
+		DefaultEnvironmentStateFile = originalEnv
+		DefaultWorkingDirectoryStateFile = originalWD
+		DefaultCheckpointFile = originalCheckpoint
+	})
+}
+
+func TestRunStateDirectories(t *testing.T) {
+	t.Run("Using a state directory moves the state files", func(t *testing.T) {
+		useTemporaryStateRoot(t)
+		directory := RunStateDirectory(NewRunID())
+		if err := UseStateDirectory(directory); err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		if StateDirectory() != directory {
+			t.Errorf("Expected state directory %s, got %s", directory, StateDirectory())
+		}
+		if DefaultEnvironmentStateFile != filepath.Join(directory, "env-vars") {
+			t.Errorf("Unexpected environment state file %s", DefaultEnvironmentStateFile)
+		}
+		if DefaultWorkingDirectoryStateFile != filepath.Join(directory, "working-dir") {
+			t.Errorf("Unexpected working directory state file %s", DefaultWorkingDirectoryStateFile)
+		}
+		if os.Getenv(StateDirectoryEnvironmentVariable) != "" {
+			t.Errorf("Expected %s not to be exported", StateDirectoryEnvironmentVariable)
+		}
+	})
+
+	t.Run("Runs are listed by when they were last used", func(t *testing.T) {
+		useTemporaryStateRoot(t)
+		older := RunStateDirectory("20240101T000000-aaaaaa")
+		newer := RunStateDirectory("20240101T000000-bbbbbb")
+		for _, directory := range []string{newer, older, filepath.Join(StateRoot, "not-a-run")} {
+			if err := os.MkdirAll(directory, 0o700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stale := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(older, stale, stale); err != nil {
+			t.Fatal(err)
+		}
+
+		latest, err := LatestRunStateDirectory()
+		if err != nil || latest != newer {
+			t.Errorf("Expected %s to be the latest run, got %s (%v)", newer, latest, err)
+		}
+		runs, _ := ListRunStateDirectories()
+		if len(runs) != 2 {
+			t.Errorf("Expected directories that are not runs to be ignored, got %v", runs)
+		}
+	})
+
+	t.Run("Stale runs are removed", func(t *testing.T) {
+		useTemporaryStateRoot(t)
+		stale := time.Now().Add(-48 * time.Hour)
+		current := RunStateDirectory("20240101T000000-cccccc")
+		old := RunStateDirectory("20240101T000000-dddddd")
+		recent := RunStateDirectory("20240101T000000-eeeeee")
+		for _, directory := range []string{current, old, recent} {
+			if err := os.MkdirAll(directory, 0o700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := UseStateDirectory(current); err != nil {
+			t.Fatal(err)
+		}
+		for _, directory := range []string{current, old} {
+			if err := os.Chtimes(directory, stale, stale); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		removed, err := RemoveStaleStateDirectories(24 * time.Hour)
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+		if len(removed) != 1 || removed[0] != old {
+			t.Errorf("Expected only %s to be removed, got %v", old, removed)
+		}
+		for _, directory := range []string{current, recent} {
+			if _, err := os.Stat(directory); err != nil {
+				t.Errorf("Expected %s to be kept: %v", directory, err)
+			}
+		}
+	})
+}
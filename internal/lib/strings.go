@@ -1,5 +1,7 @@
 package lib
 
+import "strings"
+
 // Checks if a given string is a number.
 func IsNumber(str string) bool {
 	for _, r := range str {
@@ -9,3 +11,8 @@ func IsNumber(str string) bool {
 	}
 	return true
 }
+
+// Quotes a value so that bash treats it as a single literal word.
+func QuoteForShell(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
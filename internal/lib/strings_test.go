@@ -1 +1,18 @@
 package lib
+
+import "testing"
+
+func TestQuoteForShell(t *testing.T) {
+	cases := map[string]string{
+		"":             "''",
+		"rg-1234":      "'rg-1234'",
+		"two words":    "'two words'",
+		"it's $HOME":   `'it'\''s $HOME'`,
+		"line\nbreaks": "'line\nbreaks'",
+	}
+	for value, expected := range cases {
+		if quoted := QuoteForShell(value); quoted != expected {
+			t.Errorf("QuoteForShell(%q) = %q, expected %q", value, quoted, expected)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package parsers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// Attribute keys that are understood by the engine. Unknown keys are kept in
+// CodeBlockAttributes.Values so that they remain visible in reports.
+const (
+	AttributeTimeout     = "timeout"
+	AttributeRetries     = "retries"
+	AttributeMaxAttempts = "max-attempts"
+	AttributeRetryDelay  = "retry-delay"
+	AttributeBackoff     = "backoff"
+	AttributeRetryOn     = "retry-on"
+	AttributeSkipIn      = "skip-in"
+	AttributeTags        = "tags"
+	// Selects how the output of a code block is compared with its result
+	// block, declared on the result block, e.g. ```json {compare=json-subset}
+	AttributeCompare = "compare"
+	AttributeCapture = "capture"
+	// The exit code a code block is expected to exit with, a number,
+	// non-zero or any.
+	AttributeExpectExit = "expect-exit"
+	// A regex the stderr of a code block is expected to match.
+	AttributeExpectStdErr = "expect-stderr"
+)
+
+// Backoff strategies for retry policies.
+const (
+	BackoffFixed       = "fixed"
+	BackoffExponential = "exponential"
+)
+
+// Conditions that can trigger a retry.
+const (
+	RetryOnExitCode = "exit-code"
+	RetryOnOutput   = "output"
+)
+
+// The longest delay exponential backoff grows to.
+const maxRetryDelay = 10 * time.Minute
+
+// Describes how a code block is retried when it fails, e.g.
+// ```bash {max-attempts=10 retry-delay=15s backoff=exponential retry-on=output}
+type RetryPolicy struct {
+	// Total number of times the code block is run before giving up. Values
+	// below 2 disable retries.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// Delay before the second attempt.
+	Delay time.Duration `json:"delay,omitempty"`
+	// Either fixed (the default) or exponential, which doubles the delay
+	// after every attempt.
+	Backoff string `json:"backoff,omitempty"`
+	// The failures that trigger a retry (exit-code, output). Empty retries on
+	// both.
+	RetryOn []string `json:"retryOn,omitempty"`
+}
+
+// Returns the total number of attempts allowed by the policy.
+func (p RetryPolicy) Attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// Returns how long to wait after the given (1 based) attempt failed.
+func (p RetryPolicy) DelayAfter(attempt int) time.Duration {
+	if p.Backoff != BackoffExponential {
+		return p.Delay
+	}
+	delay := p.Delay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// Checks if a failure of the given kind (exit-code or output) is retried.
+func (p RetryPolicy) RetriesOn(reason string) bool {
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	for _, candidate := range p.RetryOn {
+		if strings.EqualFold(candidate, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// Exit code expectations that are not a specific exit code.
+const (
+	ExitCodeNonZero = "non-zero"
+	ExitCodeAny     = "any"
+)
+
+// The exit code a code block is expected to exit with: a number, non-zero or
+// any. Empty expects the code block to succeed.
+type ExitCodeExpectation string
+
+// Checks if a command that exited with the given code met the expectation.
+func (e ExitCodeExpectation) Matches(exitCode int) bool {
+	switch e {
+	case "":
+		return exitCode == 0
+	case ExitCodeNonZero:
+		return exitCode != 0
+	case ExitCodeAny:
+		return true
+	default:
+		expected, err := strconv.Atoi(string(e))
+		return err == nil && expected == exitCode
+	}
+}
+
+func parseExitCodeExpectation(value string) (ExitCodeExpectation, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case ExitCodeNonZero, ExitCodeAny:
+		return ExitCodeExpectation(value), nil
+	}
+	exitCode, err := strconv.Atoi(value)
+	if err != nil || exitCode < 0 || exitCode > 255 {
+		return "", fmt.Errorf("expected an exit code between 0 and 255, %s or %s", ExitCodeNonZero, ExitCodeAny)
+	}
+	return ExitCodeExpectation(strconv.Itoa(exitCode)), nil
+}
+
+// Where a capture reads its value from in the output of a code block.
+const (
+	// A JSON path such as $.network.publicIps[0], read from JSON output.
+	CaptureJSON = "json"
+	// A named group of the regex of the result block.
+	CaptureRegex = "regex"
+	// A line of the output, counted from 1. Negative lines count from the
+	// end, -1 being the last line.
+	CaptureLine = "line"
+)
+
+// Stores a value from the output of a code block in an environment variable
+// for the code blocks that follow, e.g.
+// ```bash {capture=IP=$.publicIps,ID=regex:id,LAST=line:-1}
+type OutputCapture struct {
+	Variable string `json:"variable"`
+	// Either json, regex or line.
+	Source string `json:"source"`
+	// The JSON path, the name of the regex group or the line number.
+	Query string `json:"query"`
+}
+
+// Per code block settings declared in the fenced code block info string, e.g.
+// ```bash {timeout=300 retries=3 skip-in=test tags=slow,aks}
+type CodeBlockAttributes struct {
+	// Maximum amount of time the code block is allowed to run for. Zero means
+	// the code block can run indefinitely.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// How the code block is retried when it fails.
+	Retry RetryPolicy `json:"retry,omitempty"`
+	// Modes (execute, test, interactive) in which the code block is skipped.
+	SkipIn []string `json:"skipIn,omitempty"`
+	// Free form labels that can be used to select or skip code blocks.
+	Tags []string `json:"tags,omitempty"`
+	// Values stored in environment variables after the code block succeeds.
+	Captures []OutputCapture `json:"captures,omitempty"`
+	// The exit code the code block is expected to exit with, e.g.
+	// ```bash {expect-exit=1 expect-stderr="AuthorizationFailed"}
+	ExpectedExitCode ExitCodeExpectation `json:"expectedExitCode,omitempty"`
+	// A regex the stderr of the code block is expected to match.
+	ExpectedStdErr string `json:"expectedStdErr,omitempty"`
+	// Every attribute declared on the code block, including those listed above.
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// Checks if the code block should be skipped when running in the given mode.
+func (a CodeBlockAttributes) SkippedIn(mode string) bool {
+	for _, skipped := range a.SkipIn {
+		if strings.EqualFold(skipped, mode) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the code block carries any of the given tags.
+func (a CodeBlockAttributes) HasAnyTag(tags []string) bool {
+	for _, tag := range a.Tags {
+		for _, candidate := range tags {
+			if strings.EqualFold(tag, strings.TrimSpace(candidate)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Splits the info string of a fenced code block into the language and the
+// attributes declared within curly braces after it. Attributes that cannot be
+// understood are logged and ignored so that a typo never prevents a document
+// from being parsed.
+func parseFenceInfo(info string, sourceName string) (string, CodeBlockAttributes) {
+	info = strings.TrimSpace(info)
+	language := info
+	attributeText := ""
+
+	if open := strings.Index(info, "{"); open != -1 {
+		language = strings.TrimSpace(info[:open])
+		attributeText = info[open+1:]
+		if close := strings.LastIndex(attributeText, "}"); close != -1 {
+			attributeText = attributeText[:close]
+		} else {
+			logging.GlobalLogger.Warnf("In %s the attributes of the code block `%s` are missing a closing brace", sourceName, info)
+		}
+	}
+
+	// Match goldmark's behaviour of treating the first word as the language.
+	if fields := strings.Fields(language); len(fields) > 0 {
+		language = fields[0]
+	}
+
+	attributes := CodeBlockAttributes{}
+	values, err := splitAttributes(attributeText)
+	if err != nil {
+		logging.GlobalLogger.Warnf("In %s failed to parse the attributes of the code block `%s`: %s", sourceName, info, err)
+		return language, attributes
+	}
+	if len(values) == 0 {
+		return language, attributes
+	}
+
+	attributes.Values = values
+	for key, value := range values {
+		switch key {
+		case AttributeTimeout:
+			timeout, err := parseAttributeDuration(value)
+			if err != nil {
+				logging.GlobalLogger.Warnf("In %s the code block `%s` has an invalid timeout: %s", sourceName, info, err)
+				continue
+			}
+			attributes.Timeout = timeout
+		case AttributeRetries:
+			// Shorthand for the number of attempts after the first one.
+			retries, err := strconv.Atoi(value)
+			if err != nil || retries < 0 {
+				logging.GlobalLogger.Warnf("In %s the code block `%s` has an invalid retries value %q", sourceName, info, value)
+				continue
+			}
+			if _, ok := values[AttributeMaxAttempts]; !ok {
+				attributes.Retry.MaxAttempts = retries + 1
+			}
+		case AttributeMaxAttempts:
+			attempts, err := strconv.Atoi(value)
+			if err != nil || attempts < 1 {
+				logging.GlobalLogger.Warnf("In %s the code block `%s` has an invalid max-attempts value %q", sourceName, info, value)
+				continue
+			}
+			attributes.Retry.MaxAttempts = attempts
+		case AttributeRetryDelay:
+			delay, err := parseAttributeDuration(value)
+			if err != nil {
+				logging.GlobalLogger.Warnf("In %s the code block `%s` has an invalid retry-delay: %s", sourceName, info, err)
+				continue
+			}
+			attributes.Retry.Delay = delay
+		case AttributeBackoff:
+			backoff := strings.ToLower(value)
+			if backoff != BackoffFixed && backoff != BackoffExponential {
+				logging.GlobalLogger.Warnf("In %s the code block `%s` has an invalid backoff %q (expected %s or %s)", sourceName, info, value, BackoffFixed, BackoffExponential)
+				continue
+			}
+			attributes.Retry.Backoff = backoff
+		case AttributeRetryOn:
+			var retryOn []string
+			for _, reason := range splitAttributeList(value) {
+				reason = strings.ToLower(reason)
+				if reason != RetryOnExitCode && reason != RetryOnOutput {
+					logging.GlobalLogger.Warnf("In %s the code block `%s` has an invalid retry-on value %q (expected %s or %s)", sourceName, info, reason, RetryOnExitCode, RetryOnOutput)
+					continue
+				}
+				retryOn = append(retryOn, reason)
+			}
+			attributes.Retry.RetryOn = retryOn
+		case AttributeSkipIn:
+			attributes.SkipIn = splitAttributeList(value)
+		case AttributeTags:
+			attributes.Tags = splitAttributeList(value)
+		case AttributeCapture:
+			for _, item := range splitAttributeList(value) {
+				capture, err := parseOutputCapture(item)
+				if err != nil {
+					logging.GlobalLogger.Warnf("In %s the code block `%s` has an invalid capture %q: %s", sourceName, info, item, err)
+					continue
+				}
+				attributes.Captures = append(attributes.Captures, capture)
+			}
+		case AttributeExpectExit:
+			expectation, err := parseExitCodeExpectation(value)
+			if err != nil {
+				logging.GlobalLogger.Warnf("In %s the code block `%s` has an invalid expect-exit value %q: %s", sourceName, info, value, err)
+				continue
+			}
+			attributes.ExpectedExitCode = expectation
+		case AttributeExpectStdErr:
+			if _, err := regexp.Compile(value); err != nil {
+				logging.GlobalLogger.Warnf("In %s the code block `%s` has an invalid expect-stderr regex: %s", sourceName, info, err)
+				continue
+			}
+			attributes.ExpectedStdErr = value
+		}
+	}
+
+	return language, attributes
+}
+
+// Splits `key=value key2="quoted value" flag` into a map. Flags without a
+// value are stored as "true".
+func splitAttributes(text string) (map[string]string, error) {
+	values := make(map[string]string)
+	i := 0
+	for i < len(text) {
+		for i < len(text) && (text[i] == ' ' || text[i] == '\t' || text[i] == ',') {
+			i++
+		}
+		if i >= len(text) {
+			break
+		}
+
+		start := i
+		for i < len(text) && text[i] != '=' && text[i] != ' ' && text[i] != '\t' {
+			i++
+		}
+		key := strings.ToLower(text[start:i])
+		if key == "" {
+			return nil, fmt.Errorf("attribute without a name at offset %d", start)
+		}
+
+		if i >= len(text) || text[i] != '=' {
+			values[key] = "true"
+			continue
+		}
+		i++
+
+		if i < len(text) && (text[i] == '"' || text[i] == '\'') {
+			quote := text[i]
+			end := strings.IndexByte(text[i+1:], quote)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated quote in the value of %q", key)
+			}
+			values[key] = text[i+1 : i+1+end]
+			i += end + 2
+			continue
+		}
+
+		start = i
+		for i < len(text) && text[i] != ' ' && text[i] != '\t' {
+			i++
+		}
+		values[key] = text[start:i]
+	}
+	return values, nil
+}
+
+func splitAttributeList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
+
+var captureVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Parses a capture such as IP=$.publicIps, ID=regex:id or LAST=line:-1.
+func parseOutputCapture(item string) (OutputCapture, error) {
+	variable, query, found := strings.Cut(item, "=")
+	variable = strings.TrimSpace(variable)
+	query = strings.TrimSpace(query)
+	if !found || query == "" {
+		return OutputCapture{}, fmt.Errorf("expected VARIABLE=query")
+	}
+	if !captureVariableName.MatchString(variable) {
+		return OutputCapture{}, fmt.Errorf("%q is not a valid environment variable name", variable)
+	}
+
+	capture := OutputCapture{Variable: variable}
+	switch {
+	case strings.HasPrefix(query, "$"):
+		capture.Source, capture.Query = CaptureJSON, query
+	case strings.HasPrefix(query, CaptureRegex+":"):
+		capture.Source, capture.Query = CaptureRegex, strings.TrimPrefix(query, CaptureRegex+":")
+		if capture.Query == "" {
+			return OutputCapture{}, fmt.Errorf("the regex group has no name")
+		}
+	case strings.HasPrefix(query, CaptureLine+":"):
+		capture.Source, capture.Query = CaptureLine, strings.TrimPrefix(query, CaptureLine+":")
+		if line, err := strconv.Atoi(capture.Query); err != nil || line == 0 {
+			return OutputCapture{}, fmt.Errorf("%q is not a line number", capture.Query)
+		}
+	default:
+		return OutputCapture{}, fmt.Errorf("expected a JSON path starting with $, regex:<group> or line:<number>")
+	}
+	return capture, nil
+}
+
+// Parses a duration attribute. Plain numbers are interpreted as seconds,
+// otherwise Go duration syntax (e.g. 90s, 5m, 1h30m) is expected.
+func parseAttributeDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("duration %q must not be negative", value)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("duration %q must not be negative", value)
+	}
+	return duration, nil
+}
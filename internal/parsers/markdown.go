@@ -1,6 +1,7 @@
 package parsers
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"regexp"
@@ -34,6 +35,15 @@ func ParseMarkdownIntoAst(source []byte) ast.Node {
 	return document
 }
 
+// Renders markdown as HTML. Raw HTML found in the markdown is left out.
+func RenderMarkdownToHTML(source []byte) (string, error) {
+	var buffer bytes.Buffer
+	if err := markdownParser.Convert(source, &buffer); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
 // Extract the metadata from the AST of a markdown document.
 func ExtractYamlMetadataFromAst(node ast.Node) map[string]interface{} {
 	return node.OwnerDocument().Meta()
@@ -43,10 +53,18 @@ func ExtractYamlMetadataFromAst(node ast.Node) map[string]interface{} {
 // for scenarios that have expected output that should be validated against the
 // actual output.
 type ExpectedOutputBlock struct {
-	Language             string  `json:"language"`
-	Content              string  `json:"content"`
-	ExpectedSimilarity   float64 `json:"expectedSimilarityScore"`
-	ExpectedRegexPattern string  `json:"expectedRegexPattern"`
+	Language             string         `json:"language"`
+	Content              string         `json:"content"`
+	ExpectedSimilarity   float64        `json:"expectedSimilarityScore"`
+	ExpectedRegexPattern string         `json:"expectedRegexPattern"`
+	Position             SourcePosition `json:"position"`
+	// The comparator selected with the compare attribute of the result block.
+	// Empty selects the default comparison for the language.
+	Comparator string `json:"comparator,omitempty"`
+	// The other attributes of the result block, passed to the comparator.
+	Options map[string]string `json:"options,omitempty"`
+	// Rewrites volatile values in both outputs before they are compared.
+	Normalization *OutputNormalization `json:"normalization,omitempty"`
 }
 
 // The representation of a code block in a markdown file.
@@ -58,6 +76,8 @@ type CodeBlock struct {
 	ExpectedOutput        ExpectedOutputBlock `json:"resultBlock"`
 	InPrerequisiteSection bool                `json:"inPrerequisiteSection"`
 	Section               string              `json:"section"`
+	Attributes            CodeBlockAttributes `json:"attributes"`
+	Position              SourcePosition      `json:"position"`
 }
 
 // Assumes the title of the scenario is the first h1 header in the
@@ -88,6 +108,26 @@ var expectedSimilarityRegex = regexp.MustCompile(
 	`<!--\s*expected_similarity=\s*(\d+\.?\d*)|"(.*)"\s*-->`,
 )
 
+// Matches include directives such as `<!-- include: Common/login.md -->`. The
+// path may optionally be wrapped in double quotes.
+var includeDirectiveRegex = regexp.MustCompile(
+	`^\s*<!--\s*include:\s*"?([^"\s]+)"?\s*-->\s*$`,
+)
+
+// The representation of an include directive in a markdown file. Includes
+// splice the code blocks of another document into the current document at the
+// position the directive appears.
+type IncludeDirective struct {
+	// The path or URL of the included document, exactly as written.
+	Path string
+	// The index within the extracted code blocks at which the included blocks
+	// should be inserted.
+	Position              int
+	Header                string
+	Section               string
+	InPrerequisiteSection bool
+}
+
 // Extracts the code blocks from a provided markdown AST that match the
 // languagesToExtract.
 func ExtractCodeBlocksFromAst(
@@ -96,11 +136,27 @@ func ExtractCodeBlocksFromAst(
 	languagesToExtract []string,
 	sourceName string,
 ) []CodeBlock {
+	commands, _ := ExtractCodeBlocksAndIncludesFromAst(node, source, languagesToExtract, sourceName)
+	return commands
+}
+
+// Extracts the code blocks from a provided markdown AST that match the
+// languagesToExtract along with any include directives found in the document.
+// Include directives are returned in document order and record the position
+// within the code blocks where the included document should be spliced in.
+func ExtractCodeBlocksAndIncludesFromAst(
+	node ast.Node,
+	source []byte,
+	languagesToExtract []string,
+	sourceName string,
+) ([]CodeBlock, []IncludeDirective) {
 	var lastHeader string
 	var commands []CodeBlock
+	var includes []IncludeDirective
 	var nextBlockIsExpectedOutput bool
 	var lastExpectedSimilarityScore float64
 	var lastExpectedRegexPattern string
+	var lastNormalization *OutputNormalization
 	var lastNode ast.Node
 	var currentParagraphs string
 	var inPrerequisitesSection bool
@@ -135,6 +191,32 @@ func ExtractCodeBlocksFromAst(
 			// Extract the code block if it matches the language.
 			case *ast.HTMLBlock:
 				content := extractTextFromMarkdown(&n.BaseBlock, source)
+				if include := includeDirectiveRegex.FindStringSubmatch(content); len(include) == 2 {
+					logging.GlobalLogger.Debugf("Include directive for %q found in %s", include[1], sourceName)
+					includes = append(includes, IncludeDirective{
+						Path:                  include[1],
+						Position:              len(commands),
+						Header:                lastHeader,
+						Section:               currentSection,
+						InPrerequisiteSection: inPrerequisitesSection,
+					})
+					// Paragraphs before an include describe the included
+					// document, not the next code block in this document.
+					currentParagraphs = ""
+					lastNode = node
+					break
+				}
+
+				if normalize := normalizeCommentRegex.FindStringSubmatch(content); len(normalize) == 3 {
+					normalization, err := parseOutputNormalizationYAML(normalize[1])
+					if err != nil {
+						logging.GlobalLogger.Warnf("In %s the normalize comment `%s` is invalid: %s", sourceName, strings.TrimSpace(content), err)
+						break
+					}
+					lastNormalization = lastNormalization.Merge(normalization)
+					break
+				}
+
 				matches := expectedSimilarityRegex.FindStringSubmatch(content)
 
 				if len(matches) < 3 {
@@ -162,7 +244,7 @@ func ExtractCodeBlocksFromAst(
 
 				nextBlockIsExpectedOutput = true
 			case *ast.FencedCodeBlock:
-				language := string(n.Language((source)))
+				language, attributes := extractFenceInfo(n, source, sourceName)
 				content := extractTextFromMarkdown(&n.BaseBlock, source)
 				description := ""
 
@@ -188,18 +270,37 @@ func ExtractCodeBlocksFromAst(
 							Description:           description,
 							InPrerequisiteSection: inPrerequisitesSection,
 							Section:               currentSection,
+							Attributes:            attributes,
+							Position:              FencedCodeBlockPosition(n, source, sourceName),
 						}
 						commands = append(commands, command)
+						// Normalization comments only apply to the result block
+						// of the command right before them.
+						lastNormalization = nil
 						break
-					} else if nextBlockIsExpectedOutput {
+					} else if nextBlockIsExpectedOutput || attributes.Values[AttributeCompare] != "" {
 						// Map the expected output to the last command. If there
 						// are no commands, then we ignore the expected output.
+						// Result blocks that select a comparator do not need an
+						// expected_similarity comment.
 						if len(commands) > 0 {
 							expectedOutputBlock := ExpectedOutputBlock{
 								Language:             language,
 								Content:              extractTextFromMarkdown(&n.BaseBlock, source),
 								ExpectedSimilarity:   lastExpectedSimilarityScore,
 								ExpectedRegexPattern: lastExpectedRegexPattern,
+								Position:             FencedCodeBlockPosition(n, source, sourceName),
+								Normalization:        lastNormalization,
+							}
+							for key, value := range attributes.Values {
+								if key == AttributeCompare {
+									expectedOutputBlock.Comparator = strings.ToLower(value)
+									continue
+								}
+								if expectedOutputBlock.Options == nil {
+									expectedOutputBlock.Options = make(map[string]string)
+								}
+								expectedOutputBlock.Options[key] = value
 							}
 							commands[len(commands)-1].ExpectedOutput = expectedOutputBlock
 
@@ -207,6 +308,7 @@ func ExtractCodeBlocksFromAst(
 							nextBlockIsExpectedOutput = false
 							lastExpectedSimilarityScore = 0
 							lastExpectedRegexPattern = ""
+							lastNormalization = nil
 						}
 						break
 					}
@@ -216,7 +318,7 @@ func ExtractCodeBlocksFromAst(
 		return ast.WalkContinue, nil
 	})
 
-	return commands
+	return commands, includes
 }
 
 // ExtractSectionTextFromMarkdown returns the textual markdown content that immediately follows
@@ -353,6 +455,22 @@ func convertScenarioVariablesToMap(variableBlock string) map[string]string {
 	return variableMap
 }
 
+// Extract the language and attributes from the info string of a fenced code
+// block.
+func extractFenceInfo(block *ast.FencedCodeBlock, source []byte, sourceName string) (string, CodeBlockAttributes) {
+	if block.Info == nil {
+		return "", CodeBlockAttributes{}
+	}
+	return parseFenceInfo(string(block.Info.Segment.Value(source)), sourceName)
+}
+
+// Returns the language of a fenced code block, ignoring any attributes declared
+// after it in the info string.
+func FencedCodeBlockLanguage(block *ast.FencedCodeBlock, source []byte) string {
+	language, _ := extractFenceInfo(block, source, "")
+	return language
+}
+
 // Extract the text from a code blocks base block and return it as a string.
 func extractTextFromMarkdown(baseBlock *ast.BaseBlock, source []byte) string {
 	lines := baseBlock.Lines()
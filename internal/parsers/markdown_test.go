@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"testing"
+	"time"
 )
 
 func TestParsingMarkdownHeaders(t *testing.T) {
@@ -179,6 +180,42 @@ func TestParsingMarkdownExpectedRegex(t *testing.T) {
 	})
 }
 
+func TestParsingMarkdownExpectedOutputComparator(t *testing.T) {
+	markdown := []byte(
+		"```bash\necho '{}'\n```\n<!--expected_similarity=1-->\n```json {compare=JSON-Subset ignore=id,etag}\n{}\n```\n",
+	)
+
+	document := ParseMarkdownIntoAst(markdown)
+	codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"}, "test.md")
+
+	if len(codeBlocks) != 1 {
+		t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+	}
+
+	block := codeBlocks[0].ExpectedOutput
+	if block.Language != "json" {
+		t.Errorf("Language is wrong, got %q, expected %q", block.Language, "json")
+	}
+	if block.Comparator != "json-subset" {
+		t.Errorf("Comparator is wrong, got %q, expected %q", block.Comparator, "json-subset")
+	}
+	if len(block.Options) != 1 || block.Options["ignore"] != "id,etag" {
+		t.Errorf("Options are wrong, got %v", block.Options)
+	}
+
+	t.Run("Result blocks selecting a comparator need no comment", func(t *testing.T) {
+		markdown := []byte("```bash\necho hello\n```\n\n```text {compare=contains}\nhello\n```\n")
+		codeBlocks := ExtractCodeBlocksFromAst(ParseMarkdownIntoAst(markdown), markdown, []string{"bash"}, "test.md")
+
+		if len(codeBlocks) != 1 {
+			t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+		}
+		if codeBlocks[0].ExpectedOutput.Comparator != "contains" || codeBlocks[0].ExpectedOutput.Content != "hello\n" {
+			t.Errorf("Expected output is wrong, got %+v", codeBlocks[0].ExpectedOutput)
+		}
+	})
+}
+
 func TestExtractSectionTextFromMarkdown(t *testing.T) {
 	markdown := []byte(`# Title
 
@@ -235,3 +272,159 @@ func TestExtractPrerequisiteUrlsHandlesSingularHeading(t *testing.T) {
 		t.Fatalf("urls not preserved in order: %#v", urls)
 	}
 }
+
+func TestExtractIncludeDirectives(t *testing.T) {
+	markdown := []byte("# Title\n\n## Setup\n\nFirst step.\n\n```bash\necho \"first\"\n```\n\n<!-- include: Common/login.md -->\n\nSecond step.\n\n```bash\necho \"second\"\n```\n\n<!-- include: \"Common/rg.md\" -->\n")
+
+	document := ParseMarkdownIntoAst(markdown)
+	blocks, includes := ExtractCodeBlocksAndIncludesFromAst(document, markdown, []string{"bash"}, "test.md")
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 code blocks, got %d", len(blocks))
+	}
+	if len(includes) != 2 {
+		t.Fatalf("expected 2 include directives, got %d", len(includes))
+	}
+	if includes[0].Path != "Common/login.md" || includes[0].Position != 1 || includes[0].Header != "Setup" {
+		t.Fatalf("unexpected first include: %+v", includes[0])
+	}
+	if includes[1].Path != "Common/rg.md" || includes[1].Position != 2 {
+		t.Fatalf("unexpected second include: %+v", includes[1])
+	}
+	if blocks[1].ExpectedOutput.Content != "" {
+		t.Fatalf("include directive should not be treated as an expected output marker")
+	}
+}
+
+func TestParsingCodeBlockAttributes(t *testing.T) {
+	t.Run("Attributes declared after the language", func(t *testing.T) {
+		markdown := []byte("# Title\n\n```bash {timeout=300 retries=3 skip-in=test tags=slow,aks}\necho Hello\n```\n")
+
+		document := ParseMarkdownIntoAst(markdown)
+		codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"}, "test.md")
+		if len(codeBlocks) != 1 {
+			t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+		}
+
+		attributes := codeBlocks[0].Attributes
+		if codeBlocks[0].Language != "bash" {
+			t.Errorf("Code block language is wrong: %s", codeBlocks[0].Language)
+		}
+		if attributes.Timeout != 300*time.Second {
+			t.Errorf("Timeout is wrong: %s", attributes.Timeout)
+		}
+		if attributes.Retry.Attempts() != 4 {
+			t.Errorf("Attempts is wrong: %d", attributes.Retry.Attempts())
+		}
+		if !attributes.SkippedIn("test") || attributes.SkippedIn("execute") {
+			t.Errorf("Skip modes are wrong: %v", attributes.SkipIn)
+		}
+		if !attributes.HasAnyTag([]string{"aks"}) || attributes.HasAnyTag([]string{"fast"}) {
+			t.Errorf("Tags are wrong: %v", attributes.Tags)
+		}
+	})
+
+	t.Run("Quoted values and durations", func(t *testing.T) {
+		_, attributes := parseFenceInfo(`bash {timeout=1m30s note="two words"}`, "test.md")
+		if attributes.Timeout != 90*time.Second {
+			t.Errorf("Timeout is wrong: %s", attributes.Timeout)
+		}
+		if attributes.Values["note"] != "two words" {
+			t.Errorf("Quoted value is wrong: %q", attributes.Values["note"])
+		}
+	})
+
+	t.Run("Retry policy", func(t *testing.T) {
+		_, attributes := parseFenceInfo("bash {max-attempts=5 retry-delay=10s backoff=exponential retry-on=output}", "test.md")
+		policy := attributes.Retry
+		if policy.Attempts() != 5 {
+			t.Errorf("Attempts is wrong: %d", policy.Attempts())
+		}
+		if policy.DelayAfter(1) != 10*time.Second || policy.DelayAfter(3) != 40*time.Second {
+			t.Errorf("Exponential backoff is wrong: %s, %s", policy.DelayAfter(1), policy.DelayAfter(3))
+		}
+		if !policy.RetriesOn(RetryOnOutput) || policy.RetriesOn(RetryOnExitCode) {
+			t.Errorf("Retry conditions are wrong: %v", policy.RetryOn)
+		}
+		if policy.DelayAfter(100) != maxRetryDelay {
+			t.Errorf("Backoff should be capped, got %s", policy.DelayAfter(100))
+		}
+	})
+
+	t.Run("Captures", func(t *testing.T) {
+		_, attributes := parseFenceInfo(`bash {capture="IP=$.network['public ip'],ID=regex:id,LAST=line:-1,bad-name=line:1,ZERO=line:0,X=jq:.a"}`, "test.md")
+		expected := []OutputCapture{
+			{Variable: "IP", Source: CaptureJSON, Query: "$.network['public ip']"},
+			{Variable: "ID", Source: CaptureRegex, Query: "id"},
+			{Variable: "LAST", Source: CaptureLine, Query: "-1"},
+		}
+		if fmt.Sprint(attributes.Captures) != fmt.Sprint(expected) {
+			t.Errorf("Captures are wrong, got %+v, expected %+v", attributes.Captures, expected)
+		}
+	})
+
+	t.Run("Exit code and stderr expectations", func(t *testing.T) {
+		_, attributes := parseFenceInfo(`bash {expect-exit=Non-Zero expect-stderr="(Forbidden|403)"}`, "test.md")
+		if attributes.ExpectedExitCode != ExitCodeNonZero {
+			t.Errorf("Expected exit code is wrong: %q", attributes.ExpectedExitCode)
+		}
+		if attributes.ExpectedStdErr != "(Forbidden|403)" {
+			t.Errorf("Expected stderr is wrong: %q", attributes.ExpectedStdErr)
+		}
+
+		_, attributes = parseFenceInfo(`bash {expect-exit=256 expect-stderr="(403"}`, "test.md")
+		if attributes.ExpectedExitCode != "" || attributes.ExpectedStdErr != "" {
+			t.Errorf("Invalid expectations should be ignored: %+v", attributes)
+		}
+
+		for expectation, matches := range map[ExitCodeExpectation][]bool{
+			"":              {true, false, false},
+			"3":             {false, false, true},
+			ExitCodeNonZero: {false, true, true},
+			ExitCodeAny:     {true, true, true},
+		} {
+			for i, exitCode := range []int{0, 1, 3} {
+				if expectation.Matches(exitCode) != matches[i] {
+					t.Errorf("Expected %q matching exit code %d to be %t", expectation, exitCode, matches[i])
+				}
+			}
+		}
+	})
+
+	t.Run("Invalid values are ignored", func(t *testing.T) {
+		language, attributes := parseFenceInfo("bash {timeout=soon retries=-1}", "test.md")
+		if language != "bash" {
+			t.Errorf("Code block language is wrong: %s", language)
+		}
+		if attributes.Timeout != 0 || attributes.Retry.MaxAttempts != 0 {
+			t.Errorf("Invalid attributes should be ignored: %+v", attributes)
+		}
+	})
+}
+
+func TestCodeBlockSourcePositions(t *testing.T) {
+	markdown := []byte("# Title\n\nRun it.\n\n```bash\necho one\necho two\n```\n\n<!-- expected_similarity=1.0 -->\n  ```text\n  one\n  ```\n")
+
+	document := ParseMarkdownIntoAst(markdown)
+	codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"}, "docs/test.md")
+	if len(codeBlocks) != 1 {
+		t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+	}
+
+	position := codeBlocks[0].Position
+	expected := SourcePosition{File: "docs/test.md", StartLine: 5, StartColumn: 1, EndLine: 8}
+	if position != expected {
+		t.Errorf("Code block position is wrong. Expected: %+v, Got %+v", expected, position)
+	}
+	if position.String() != "docs/test.md:5:1" {
+		t.Errorf("Formatted position is wrong: %s", position)
+	}
+	if line := position.ContentLine(1); line.StartLine != 7 {
+		t.Errorf("Content line position is wrong: %+v", line)
+	}
+
+	expectedOutput := codeBlocks[0].ExpectedOutput.Position
+	expected = SourcePosition{File: "docs/test.md", StartLine: 11, StartColumn: 3, EndLine: 13}
+	if expectedOutput != expected {
+		t.Errorf("Expected output position is wrong. Expected: %+v, Got %+v", expected, expectedOutput)
+	}
+}
@@ -0,0 +1,224 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Built-in masks for values that change every time a scenario runs.
+const (
+	MaskUUID       = "uuid"
+	MaskTimestamp  = "timestamp"
+	MaskIPv4       = "ipv4"
+	MaskIPv6       = "ipv6"
+	MaskIP         = "ip"
+	MaskResourceID = "resource-id"
+)
+
+// The masks in the order they are applied. Resource IDs come first as they
+// contain GUIDs, and timestamps before IPv6 addresses as both contain colons.
+var outputMasks = []struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+	// Whether matches next to a word character are kept, for boundaries the
+	// pattern cannot express as Go regexps have no lookarounds.
+	standalone bool
+}{
+	{
+		MaskResourceID,
+		regexp.MustCompile(`(?i)/subscriptions/[0-9a-f-]{36}(/[^\s"',/]+/[^\s"',/]+)*`),
+		"<resource-id>",
+		false,
+	},
+	{
+		MaskTimestamp,
+		regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:?\d{2})?\b`),
+		"<timestamp>",
+		false,
+	},
+	{
+		MaskUUID,
+		regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`),
+		"<uuid>",
+		false,
+	},
+	{
+		MaskIPv6,
+		// Either side of :: is a group of hex digits or not a word, so that
+		// Microsoft.Network::Subnet is kept, and :: alone is not masked.
+		regexp.MustCompile(`(?i)(\b([0-9a-f]{1,4}:){7}[0-9a-f]{1,4}\b|\b([0-9a-f]{1,4}:){1,7}:([0-9a-f]{1,4}(:[0-9a-f]{1,4}){0,6}\b)?|::[0-9a-f]{1,4}(:[0-9a-f]{1,4}){0,6}\b)`),
+		"<ip>",
+		true,
+	},
+	{
+		MaskIPv4,
+		regexp.MustCompile(`\b((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`),
+		"<ip>",
+		false,
+	},
+}
+
+// Rewrites volatile values, such as GUIDs and timestamps, in both the actual
+// and the expected output before they are compared, e.g.
+//
+//	normalize:
+//	  masks: [uuid, timestamp]
+//	  replace:
+//	    - pattern: 'rg-[a-z0-9]{6}'
+//	      with: rg-random
+//
+// in the front matter of a document, or in a <!-- normalize ... --> comment
+// before a result block.
+type OutputNormalization struct {
+	// The built-in masks to apply: uuid, timestamp, ipv4, ipv6, ip (both
+	// IPv4 and IPv6) and resource-id.
+	Masks []string `json:"masks,omitempty" yaml:"masks"`
+	// Regex replacements applied after the masks, in order.
+	Replacements []OutputReplacement `json:"replace,omitempty" yaml:"replace"`
+}
+
+// Replaces the matches of a regex. The replacement may refer to groups of the
+// regex, e.g. $1.
+type OutputReplacement struct {
+	Pattern string `json:"pattern" yaml:"pattern"`
+	With    string `json:"with" yaml:"with"`
+}
+
+// Matches <!-- normalize ... --> comments, whose body is YAML. The closing
+// line of multi-line comments is not part of the text of their HTML block.
+var normalizeCommentRegex = regexp.MustCompile(`(?s)^\s*<!--\s*normalize\b:?(.*?)(-->)?\s*$`)
+
+// Parses the normalize key of the front matter of a document.
+func ParseOutputNormalization(value interface{}) (*OutputNormalization, error) {
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return parseOutputNormalizationYAML(string(encoded))
+}
+
+func parseOutputNormalizationYAML(text string) (*OutputNormalization, error) {
+	normalization := &OutputNormalization{}
+	decoder := yaml.NewDecoder(strings.NewReader(text))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(normalization); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	for index, mask := range normalization.Masks {
+		mask = strings.ToLower(strings.TrimSpace(mask))
+		if !isOutputMask(mask) {
+			return nil, fmt.Errorf(
+				"unknown mask %q (expected %s, %s, %s, %s, %s or %s)",
+				mask,
+				MaskUUID,
+				MaskTimestamp,
+				MaskIPv4,
+				MaskIPv6,
+				MaskIP,
+				MaskResourceID,
+			)
+		}
+		normalization.Masks[index] = mask
+	}
+	for _, replacement := range normalization.Replacements {
+		if replacement.Pattern == "" {
+			return nil, fmt.Errorf("replacements must have a pattern")
+		}
+		if _, err := regexp.Compile(replacement.Pattern); err != nil {
+			return nil, fmt.Errorf("cannot compile the replacement pattern %q: %w", replacement.Pattern, err)
+		}
+	}
+	return normalization, nil
+}
+
+func isOutputMask(name string) bool {
+	if name == MaskIP {
+		return true
+	}
+	for _, mask := range outputMasks {
+		if mask.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the normalization applying the masks and replacements of both,
+// those of n first. Either may be nil.
+func (n *OutputNormalization) Merge(other *OutputNormalization) *OutputNormalization {
+	if n == nil {
+		return other
+	}
+	if other == nil {
+		return n
+	}
+	return &OutputNormalization{
+		Masks:        append(append([]string{}, n.Masks...), other.Masks...),
+		Replacements: append(append([]OutputReplacement{}, n.Replacements...), other.Replacements...),
+	}
+}
+
+// Applies the masks, then the replacements, to output.
+func (n *OutputNormalization) Apply(output string) string {
+	if n == nil {
+		return output
+	}
+
+	enabled := make(map[string]bool)
+	for _, mask := range n.Masks {
+		if mask == MaskIP {
+			enabled[MaskIPv4] = true
+			enabled[MaskIPv6] = true
+		}
+		enabled[mask] = true
+	}
+	for _, mask := range outputMasks {
+		if enabled[mask.name] {
+			if mask.standalone {
+				output = replaceStandalone(mask.pattern, output, mask.replacement)
+			} else {
+				output = mask.pattern.ReplaceAllLiteralString(output, mask.replacement)
+			}
+		}
+	}
+
+	for _, replacement := range n.Replacements {
+		// Patterns are validated when they are parsed.
+		if pattern, err := regexp.Compile(replacement.Pattern); err == nil {
+			output = pattern.ReplaceAllString(output, replacement.With)
+		}
+	}
+	return output
+}
+
+// Replaces the matches of pattern that are neither preceded nor followed by a
+// word character.
+func replaceStandalone(pattern *regexp.Regexp, output string, replacement string) string {
+	var replaced strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(output, -1) {
+		if isWordByte(output, match[0]-1) || isWordByte(output, match[1]) {
+			continue
+		}
+		replaced.WriteString(output[last:match[0]])
+		replaced.WriteString(replacement)
+		last = match[1]
+	}
+	replaced.WriteString(output[last:])
+	return replaced.String()
+}
+
+func isWordByte(text string, index int) bool {
+	if index < 0 || index >= len(text) {
+		return false
+	}
+	c := text[index]
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
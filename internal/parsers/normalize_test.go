@@ -0,0 +1,192 @@
+package parsers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputNormalizationMasks(t *testing.T) {
+	output := strings.Join([]string{
+		`"id": "/subscriptions/0b1f6471-1bf0-4dda-aec3-111122223333/resourceGroups/rg-abc123/providers/Microsoft.Compute/virtualMachines/vm1",`,
+		`"principalId": "8E2B4C1A-9F3D-4A6B-8C7E-0123456789AB",`,
+		`"createdAt": "2024-05-01T12:34:56.789Z", "updated": "2024-05-01 12:34",`,
+		`"publicIp": "20.81.111.7", "privateIp": "10.0.0.4", "ipv6": "2001:db8::ff00:42:8329",`,
+		`"version": "1.2.3", "time": "12:34:56"`,
+	}, "\n")
+
+	t.Run("Only the selected masks are applied", func(t *testing.T) {
+		normalization := &OutputNormalization{Masks: []string{MaskUUID}}
+		normalized := normalization.Apply(output)
+
+		if !strings.Contains(normalized, `"principalId": "<uuid>"`) {
+			t.Errorf("Expected the GUID to be masked, got:\n%s", normalized)
+		}
+		if !strings.Contains(normalized, `/subscriptions/<uuid>/resourceGroups/rg-abc123`) {
+			t.Errorf("Expected the GUID of the resource ID to be masked, got:\n%s", normalized)
+		}
+		if !strings.Contains(normalized, "20.81.111.7") {
+			t.Errorf("Expected IP addresses to be kept, got:\n%s", normalized)
+		}
+	})
+
+	t.Run("Every mask", func(t *testing.T) {
+		normalization := &OutputNormalization{Masks: []string{MaskResourceID, MaskUUID, MaskTimestamp, MaskIP}}
+		expected := strings.Join([]string{
+			`"id": "<resource-id>",`,
+			`"principalId": "<uuid>",`,
+			`"createdAt": "<timestamp>", "updated": "<timestamp>",`,
+			`"publicIp": "<ip>", "privateIp": "<ip>", "ipv6": "<ip>",`,
+			`"version": "1.2.3", "time": "12:34:56"`,
+		}, "\n")
+
+		if normalized := normalization.Apply(output); normalized != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, normalized)
+		}
+	})
+
+	t.Run("IPv6 addresses are not masked within words", func(t *testing.T) {
+		normalization := &OutputNormalization{Masks: []string{MaskIP}}
+		cases := map[string]string{
+			"Microsoft.Network::Subnet": "Microsoft.Network::Subnet",
+			"ClassName::method":         "ClassName::method",
+			"Class::add, dead::Subnet":  "Class::add, dead::Subnet",
+			"a :: b":                    "a :: b",
+			"fe80::1%eth0 and ::1":      "<ip>%eth0 and <ip>",
+			"[2001:db8::]:443":          "[<ip>]:443",
+			"2001:db8:0:0:0:0:0:1":      "<ip>",
+		}
+		for output, expected := range cases {
+			if normalized := normalization.Apply(output); normalized != expected {
+				t.Errorf("Expected %q to be normalized to %q, got %q", output, expected, normalized)
+			}
+		}
+	})
+
+	t.Run("Replacements run after the masks", func(t *testing.T) {
+		normalization := &OutputNormalization{
+			Masks:        []string{MaskIPv4},
+			Replacements: []OutputReplacement{{Pattern: `rg-[a-z0-9]{6}`, With: "rg-random"}, {Pattern: `"(\w+)Ip": "<ip>"`, With: `"${1}Ip": "masked"`}},
+		}
+		normalized := normalization.Apply(output)
+
+		if !strings.Contains(normalized, "/resourceGroups/rg-random/") {
+			t.Errorf("Expected the resource group to be replaced, got:\n%s", normalized)
+		}
+		if !strings.Contains(normalized, `"publicIp": "masked", "privateIp": "masked"`) {
+			t.Errorf("Expected the masked IP addresses to be replaced, got:\n%s", normalized)
+		}
+	})
+
+	t.Run("Nil normalizations leave the output alone", func(t *testing.T) {
+		var normalization *OutputNormalization
+		if normalized := normalization.Apply(output); normalized != output {
+			t.Errorf("Expected the output to be unchanged, got:\n%s", normalized)
+		}
+	})
+}
+
+func TestParseOutputNormalization(t *testing.T) {
+	normalization, err := ParseOutputNormalization(map[interface{}]interface{}{
+		"masks":   []interface{}{"UUID", "ip"},
+		"replace": []interface{}{map[interface{}]interface{}{"pattern": "rg-[0-9]+", "with": "rg"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if strings.Join(normalization.Masks, ",") != "uuid,ip" {
+		t.Errorf("Masks are wrong, got %v", normalization.Masks)
+	}
+	if len(normalization.Replacements) != 1 || normalization.Replacements[0].With != "rg" {
+		t.Errorf("Replacements are wrong, got %v", normalization.Replacements)
+	}
+
+	for name, value := range map[string]interface{}{
+		"unknown masks":         map[string]interface{}{"masks": []string{"guid"}},
+		"invalid patterns":      map[string]interface{}{"replace": []interface{}{map[string]string{"pattern": "("}}},
+		"missing patterns":      map[string]interface{}{"replace": []interface{}{map[string]string{"with": "x"}}},
+		"unknown keys":          map[string]interface{}{"mask": []string{"uuid"}},
+		"values that are lists": []string{"uuid"},
+	} {
+		if _, err := ParseOutputNormalization(value); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestParsingMarkdownNormalizeComments(t *testing.T) {
+	markdown := []byte(strings.Join([]string{
+		"```bash",
+		"az group show -n $RG",
+		"```",
+		"",
+		"<!-- normalize",
+		"masks: [uuid]",
+		"replace:",
+		`  - pattern: "rg-[a-z0-9]+"`,
+		"    with: rg",
+		"-->",
+		"<!--expected_similarity=1-->",
+		"",
+		"```text",
+		"rg-abc",
+		"```",
+		"",
+		"```bash",
+		"echo done",
+		"```",
+		"",
+		"<!--expected_similarity=1-->",
+		"",
+		"```text",
+		"done",
+		"```",
+		"",
+	}, "\n"))
+
+	codeBlocks := ExtractCodeBlocksFromAst(ParseMarkdownIntoAst(markdown), markdown, []string{"bash"}, "test.md")
+	if len(codeBlocks) != 2 {
+		t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+	}
+
+	expected := codeBlocks[0].ExpectedOutput
+	if expected.ExpectedRegexPattern != "" || expected.ExpectedSimilarity != 1 {
+		t.Errorf("The normalize comment changed the expected similarity: %+v", expected)
+	}
+	if expected.Normalization == nil ||
+		strings.Join(expected.Normalization.Masks, ",") != "uuid" ||
+		len(expected.Normalization.Replacements) != 1 {
+		t.Fatalf("Normalization is wrong, got %+v", expected.Normalization)
+	}
+	if codeBlocks[1].ExpectedOutput.Normalization != nil {
+		t.Errorf("Normalize comments only apply to the next result block, got %+v", codeBlocks[1].ExpectedOutput.Normalization)
+	}
+}
+
+func TestNormalizeCommentsWithoutResultBlockAreDropped(t *testing.T) {
+	markdown := []byte(strings.Join([]string{
+		"```bash",
+		"echo setup",
+		"```",
+		"",
+		"<!-- normalize masks: [uuid] -->",
+		"",
+		"```bash",
+		"echo created",
+		"```",
+		"",
+		"<!--expected_similarity=1-->",
+		"",
+		"```text",
+		"created",
+		"```",
+		"",
+	}, "\n"))
+
+	codeBlocks := ExtractCodeBlocksFromAst(ParseMarkdownIntoAst(markdown), markdown, []string{"bash"}, "test.md")
+	if len(codeBlocks) != 2 {
+		t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+	}
+	if codeBlocks[1].ExpectedOutput.Normalization != nil {
+		t.Errorf("The normalize comment carried over to another command, got %+v", codeBlocks[1].ExpectedOutput.Normalization)
+	}
+}
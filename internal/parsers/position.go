@@ -0,0 +1,108 @@
+package parsers
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// The location of a fenced code block within the markdown file it was
+// extracted from. Lines and columns start at 1, a zero StartLine means the
+// position is unknown (e.g. for code blocks generated by the engine).
+type SourcePosition struct {
+	File        string `json:"file,omitempty"`
+	StartLine   int    `json:"startLine,omitempty"`
+	StartColumn int    `json:"startColumn,omitempty"`
+	EndLine     int    `json:"endLine,omitempty"`
+}
+
+// Checks if the position points at a line in a source file.
+func (p SourcePosition) IsKnown() bool {
+	return p.StartLine > 0
+}
+
+// Returns the position of a line within the content of the code block, where
+// index 0 is the first line after the opening fence.
+func (p SourcePosition) ContentLine(index int) SourcePosition {
+	if !p.IsKnown() {
+		return p
+	}
+	line := p.StartLine + 1 + index
+	return SourcePosition{File: p.File, StartLine: line, StartColumn: 1, EndLine: line}
+}
+
+// Formats the position as file:line:column, the format understood by most
+// editors and CI annotations.
+func (p SourcePosition) String() string {
+	if !p.IsKnown() {
+		return p.File
+	}
+	location := fmt.Sprintf("%d", p.StartLine)
+	if p.StartColumn > 0 {
+		location = fmt.Sprintf("%d:%d", p.StartLine, p.StartColumn)
+	}
+	if p.File == "" {
+		return location
+	}
+	return p.File + ":" + location
+}
+
+// Computes the position of a fenced code block, spanning from the opening to
+// the closing fence.
+func FencedCodeBlockPosition(block *ast.FencedCodeBlock, source []byte, sourceName string) SourcePosition {
+	position := SourcePosition{File: sourceName}
+
+	// Goldmark does not record where the fence itself starts, so it is derived
+	// from the info string or, failing that, the first line of content.
+	fenceOffset := -1
+	if block.Info != nil {
+		fenceOffset = block.Info.Segment.Start
+	} else if block.Lines().Len() > 0 {
+		contentStart := lineStart(source, block.Lines().At(0).Start)
+		if contentStart > 0 {
+			fenceOffset = lineStart(source, contentStart-1)
+		}
+	}
+	if fenceOffset < 0 || fenceOffset > len(source) {
+		return position
+	}
+
+	fenceStart := lineStart(source, fenceOffset)
+	position.StartLine = lineNumber(source, fenceStart)
+	position.StartColumn = 1
+	for i := fenceStart; i < len(source) && (source[i] == ' ' || source[i] == '\t'); i++ {
+		position.StartColumn++
+	}
+
+	position.EndLine = position.StartLine + 1
+	if lines := block.Lines(); lines.Len() > 0 {
+		position.EndLine = lineNumber(source, lines.At(lines.Len()-1).Start) + 1
+	}
+	// Unterminated code blocks run until the end of the document.
+	last := bytes.Count(source, []byte("\n"))
+	if !bytes.HasSuffix(source, []byte("\n")) {
+		last++
+	}
+	if position.EndLine > last {
+		position.EndLine = last
+	}
+
+	return position
+}
+
+// Returns the offset of the first byte of the line containing offset.
+func lineStart(source []byte, offset int) int {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	return bytes.LastIndexByte(source[:offset], '\n') + 1
+}
+
+// Returns the 1 based line number of the given offset.
+func lineNumber(source []byte, offset int) int {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	return bytes.Count(source[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,74 @@
+package parsers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Returns the fence opening a fenced code block on the given line, or an empty
+// string if the line does not open one.
+func openingFence(line string) string {
+	trimmed := strings.TrimLeft(line, " \t")
+	if trimmed == "" || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return ""
+	}
+	fence := trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+	if len(fence) < 3 {
+		return ""
+	}
+	return fence
+}
+
+// Checks if the line closes a code block opened with fence.
+func isClosingFence(line string, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// Replaces the content of the fenced code block at position, keeping its
+// fences, info string and indentation. The rest of the source is left as is.
+func ReplaceFencedCodeBlockContent(source []byte, position SourcePosition, content string) ([]byte, error) {
+	if !position.IsKnown() {
+		return nil, fmt.Errorf("the position of the code block is unknown")
+	}
+
+	lines := strings.SplitAfter(string(source), "\n")
+	if position.EndLine <= position.StartLine || position.EndLine > len(lines) {
+		return nil, fmt.Errorf("lines %d to %d are not in the document", position.StartLine, position.EndLine)
+	}
+
+	opening := lines[position.StartLine-1]
+	fence := openingFence(opening)
+	if fence == "" {
+		return nil, fmt.Errorf("line %d does not open a fenced code block", position.StartLine)
+	}
+	if !isClosingFence(lines[position.EndLine-1], fence) {
+		return nil, fmt.Errorf(
+			"the code block opened on line %d is not closed on line %d",
+			position.StartLine,
+			position.EndLine,
+		)
+	}
+	indentation := opening[:len(opening)-len(strings.TrimLeft(opening, " \t"))]
+
+	var replacement strings.Builder
+	content = strings.TrimRight(content, "\n")
+	if content != "" {
+		for _, line := range strings.Split(content, "\n") {
+			if isClosingFence(line, fence) {
+				return nil, fmt.Errorf("the content would close the code block opened on line %d", position.StartLine)
+			}
+			if line != "" {
+				replacement.WriteString(indentation)
+			}
+			replacement.WriteString(line)
+			replacement.WriteString("\n")
+		}
+	}
+
+	var result strings.Builder
+	result.WriteString(strings.Join(lines[:position.StartLine], ""))
+	result.WriteString(replacement.String())
+	result.WriteString(strings.Join(lines[position.EndLine-1:], ""))
+	return []byte(result.String()), nil
+}
@@ -0,0 +1,102 @@
+package parsers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplaceFencedCodeBlockContent(t *testing.T) {
+	markdown := strings.Join([]string{
+		"# Scenario",
+		"",
+		"```bash",
+		"echo hello",
+		"```",
+		"",
+		"<!--expected_similarity=0.8-->",
+		"",
+		"```text",
+		"goodbye",
+		"```",
+		"",
+		"The end.",
+		"",
+	}, "\n")
+
+	expectedOutputPosition := func(t *testing.T, source string) SourcePosition {
+		t.Helper()
+		codeBlocks := ExtractCodeBlocksFromAst(ParseMarkdownIntoAst([]byte(source)), []byte(source), []string{"bash"}, "test.md")
+		if len(codeBlocks) != 1 {
+			t.Fatalf("Expected 1 code block, got %d", len(codeBlocks))
+		}
+		return codeBlocks[0].ExpectedOutput.Position
+	}
+
+	t.Run("Content between the fences is replaced", func(t *testing.T) {
+		updated, err := ReplaceFencedCodeBlockContent([]byte(markdown), expectedOutputPosition(t, markdown), "hello\nworld\n")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		expected := strings.Replace(markdown, "```text\ngoodbye\n```", "```text\nhello\nworld\n```", 1)
+		if string(updated) != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, updated)
+		}
+	})
+
+	t.Run("Empty code blocks", func(t *testing.T) {
+		source := strings.Replace(markdown, "```text\ngoodbye\n```", "```text\n```", 1)
+		updated, err := ReplaceFencedCodeBlockContent([]byte(source), expectedOutputPosition(t, source), "goodbye")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if string(updated) != markdown {
+			t.Errorf("Expected:\n%s\ngot:\n%s", markdown, updated)
+		}
+
+		cleared, err := ReplaceFencedCodeBlockContent([]byte(markdown), expectedOutputPosition(t, markdown), "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if string(cleared) != source {
+			t.Errorf("Expected:\n%s\ngot:\n%s", source, cleared)
+		}
+	})
+
+	t.Run("Indented code blocks keep their indentation", func(t *testing.T) {
+		source := "# Scenario\n\n1. Step\n\n   ```bash\n   echo hello\n   ```\n\n   <!--expected_similarity=1-->\n\n   ```text\n   goodbye\n   ```\n"
+		updated, err := ReplaceFencedCodeBlockContent([]byte(source), expectedOutputPosition(t, source), "hello\n\nworld")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		expected := strings.Replace(source, "   goodbye\n", "   hello\n\n   world\n", 1)
+		if string(updated) != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, updated)
+		}
+	})
+
+	t.Run("Content that would close the code block", func(t *testing.T) {
+		_, err := ReplaceFencedCodeBlockContent([]byte(markdown), expectedOutputPosition(t, markdown), "```\n")
+		if err == nil {
+			t.Errorf("Expected an error for content containing the closing fence")
+		}
+	})
+
+	t.Run("Positions that are not a fenced code block", func(t *testing.T) {
+		position := SourcePosition{File: "test.md", StartLine: 1, EndLine: 3}
+		if _, err := ReplaceFencedCodeBlockContent([]byte(markdown), position, "hello"); err == nil {
+			t.Errorf("Expected an error for a heading")
+		}
+
+		position = SourcePosition{File: "test.md", StartLine: 9, EndLine: 10}
+		if _, err := ReplaceFencedCodeBlockContent([]byte(markdown), position, "hello"); err == nil {
+			t.Errorf("Expected an error for a code block that is not closed on the given line")
+		}
+
+		if _, err := ReplaceFencedCodeBlockContent([]byte(markdown), SourcePosition{}, "hello"); err == nil {
+			t.Errorf("Expected an error for an unknown position")
+		}
+	})
+}
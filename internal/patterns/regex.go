@@ -15,8 +15,7 @@ var (
 	MultilineQuotedStringCommand = regexp.MustCompile(`\"(.*\\\n.*)+\"`)
 
 	// Az cli command regex
-	AzCommand     = regexp.MustCompile(`az\s+([a-z]+)\s+([a-z]+)`)
-	AzGroupDelete = regexp.MustCompile(`az group delete`)
+	AzCommand = regexp.MustCompile(`az\s+([a-z]+)\s+([a-z]+)`)
 
 	// ARM regex
 	AzResourceURI       = regexp.MustCompile(`\"id\": \"(/subscriptions/[^\"]+)\"`)
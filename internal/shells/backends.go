@@ -0,0 +1,98 @@
+package shells
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+)
+
+// Backend identifies how ExecuteBashCommand runs commands.
+type Backend string
+
+const (
+	// Every command runs in a fresh `bash -c` process. Environment variables
+	// and the working directory are carried between commands through state
+	// files.
+	BackendProcess Backend = "process"
+	// Every command runs in one long lived bash process, so shell functions,
+	// aliases, options and traps defined by one command are available to the
+	// next.
+	BackendSession Backend = "session"
+)
+
+// ParseBackend converts a raw string into a typed Backend. An empty string
+// selects the process backend.
+func ParseBackend(backend string) (Backend, error) {
+	switch Backend(backend) {
+	case "", BackendProcess:
+		return BackendProcess, nil
+	case BackendSession:
+		return BackendSession, nil
+	default:
+		return "", fmt.Errorf(
+			"invalid shell backend %q (expected %q or %q)",
+			backend,
+			BackendProcess,
+			BackendSession,
+		)
+	}
+}
+
+// UseBackend routes ExecuteBashCommand through the given backend until the
+// returned function is called, which also releases any resources held by the
+// backend. The process backend leaves ExecuteBashCommand untouched.
+func UseBackend(backend Backend) func() {
+	if backend != BackendSession {
+		return func() {}
+	}
+
+	previous := ExecuteBashCommand
+	session := NewSession()
+	ExecuteBashCommand = session.Execute
+	setActiveSession(session)
+	return func() {
+		setActiveSession(nil)
+		session.Close()
+		ExecuteBashCommand = previous
+	}
+}
+
+var activeSession struct {
+	sync.Mutex
+	session *Session
+}
+
+func setActiveSession(session *Session) {
+	activeSession.Lock()
+	defer activeSession.Unlock()
+	activeSession.session = session
+}
+
+// Exports environment variables to the commands that follow, as if the last
+// command had exported them. The variables are written to the environment
+// state file, and with the session backend they are also exported into the
+// session before its next command.
+func ExportEnvironmentVariables(variables map[string]string) error {
+	if len(variables) == 0 {
+		return nil
+	}
+
+	env, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	if err != nil {
+		env = make(map[string]string)
+	}
+	for key, value := range variables {
+		env[key] = value
+	}
+	if err := lib.SaveEnvironmentStateFile(lib.DefaultEnvironmentStateFile, env); err != nil {
+		return fmt.Errorf("failed to save the environment variables: %w", err)
+	}
+
+	activeSession.Lock()
+	defer activeSession.Unlock()
+	if activeSession.session != nil {
+		activeSession.session.queueExports(variables)
+	}
+	return nil
+}
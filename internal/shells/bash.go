@@ -2,11 +2,15 @@ package shells
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 
@@ -40,6 +44,9 @@ func appendToBashHistory(command string, filePath string) error {
 type CommandOutput struct {
 	StdOut string
 	StdErr string
+	// The exit code of the command, or -1 if it did not run to completion
+	// because it was stopped, timed out or could not be started.
+	ExitCode int
 }
 
 type BashCommandConfiguration struct {
@@ -48,6 +55,89 @@ type BashCommandConfiguration struct {
 	InteractiveCommand   bool
 	WriteToHistory       bool
 	StreamOutput         bool // New: stream output to stdout in real-time
+	// Maximum amount of time the command may run before it is killed. Zero
+	// disables the timeout.
+	Timeout time.Duration
+	// Stops the command when cancelled, e.g. once the scenario timeout
+	// expires. A nil context never cancels the command.
+	Context context.Context
+	// Called with every chunk of output as the command writes it, with the
+	// stream being "stdout" or "stderr". It may be called concurrently for
+	// both streams. Not called for interactive commands.
+	OutputObserver func(stream string, chunk []byte)
+}
+
+// Adapts an output observer to the output stream of a command.
+type observerWriter struct {
+	stream  string
+	observe func(stream string, chunk []byte)
+}
+
+func (w observerWriter) Write(chunk []byte) (int, error) {
+	w.observe(w.stream, chunk)
+	return len(chunk), nil
+}
+
+// Combines the writers that are not nil, returning nil if there are none.
+func combineWriters(writers ...io.Writer) io.Writer {
+	var combined []io.Writer
+	for _, writer := range writers {
+		if writer != nil {
+			combined = append(combined, writer)
+		}
+	}
+	switch len(combined) {
+	case 0:
+		return nil
+	case 1:
+		return combined[0]
+	default:
+		return io.MultiWriter(combined...)
+	}
+}
+
+// Returns the writers, besides the output buffers, that the stdout and stderr
+// of a command are copied to as it runs.
+func outputWriters(config BashCommandConfiguration) (io.Writer, io.Writer) {
+	var stdout, stderr io.Writer
+	if config.StreamOutput {
+		stdout, stderr = os.Stdout, os.Stderr
+	}
+	if config.OutputObserver != nil {
+		stdout = combineWriters(stdout, observerWriter{"stdout", config.OutputObserver})
+		stderr = combineWriters(stderr, observerWriter{"stderr", config.OutputObserver})
+	}
+	return stdout, stderr
+}
+
+// Wrapped by the errors of commands that were stopped because their timeout,
+// or the timeout of the scenario they belong to, expired.
+var ErrTimeout = errors.New("timed out")
+
+// Derives the context a command runs under from its configuration.
+func commandContext(config BashCommandConfiguration) (context.Context, context.CancelFunc) {
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if config.Timeout > 0 {
+		return context.WithTimeout(ctx, config.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Describes why a command was stopped once its context is done.
+func stoppedCommandError(ctx context.Context, config BashCommandConfiguration) error {
+	if config.Context != nil && config.Context.Err() != nil {
+		if errors.Is(config.Context.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("the scenario %w", ErrTimeout)
+		}
+		return fmt.Errorf("the scenario was cancelled: %w", config.Context.Err())
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", ErrTimeout, config.Timeout)
+	}
+	return ctx.Err()
 }
 
 var ExecuteBashCommand = executeBashCommandImpl
@@ -71,7 +161,22 @@ func executeBashCommandImpl(
 		"exit $IE_LAST_COMMAND_EXIT_CODE",
 	}
 
-	commandToExecute := exec.Command("bash", "-c", strings.Join(commandWithStateSaved, "\n"))
+	ctx, cancel := commandContext(config)
+	defer cancel()
+
+	commandToExecute := exec.CommandContext(ctx, "bash", "-c", strings.Join(commandWithStateSaved, "\n"))
+	if !config.InteractiveCommand {
+		// Run the command in its own process group so that everything it
+		// started is killed along with it. Interactive commands stay in the
+		// foreground process group as they need to read from the terminal.
+		commandToExecute.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		commandToExecute.Cancel = func() error {
+			return syscall.Kill(-commandToExecute.Process.Pid, syscall.SIGKILL)
+		}
+	}
+	// Processes that escaped the process group can keep the output pipes
+	// open, so stop waiting for them shortly after the command is cancelled.
+	commandToExecute.WaitDelay = time.Second
 
 	var stdoutBuffer, stderrBuffer bytes.Buffer
 
@@ -82,17 +187,15 @@ func executeBashCommandImpl(
 		commandToExecute.Stdout = os.Stdout
 		commandToExecute.Stderr = os.Stderr
 		commandToExecute.Stdin = os.Stdin
-	} else if config.StreamOutput {
-		// Stream output in real-time while also capturing to buffer
-		commandToExecute.Stdout = io.MultiWriter(&stdoutBuffer, os.Stdout)
-		commandToExecute.Stderr = io.MultiWriter(&stderrBuffer, os.Stderr)
 	} else {
-		commandToExecute.Stdout = &stdoutBuffer
-		commandToExecute.Stderr = &stderrBuffer
+		// Capture the output while streaming it in real-time.
+		stdout, stderr := outputWriters(config)
+		commandToExecute.Stdout = combineWriters(&stdoutBuffer, stdout)
+		commandToExecute.Stderr = combineWriters(&stderrBuffer, stderr)
 	}
 
 	if config.InheritEnvironment {
-		commandToExecute.Env = os.Environ()
+		commandToExecute.Env = lib.InheritedEnvironment()
 	}
 
 	// Sharing environment variables and the working directory between isolated
@@ -125,16 +228,29 @@ func executeBashCommandImpl(
 
 		homeDir, err := lib.GetHomeDirectory()
 		if err != nil {
-			return CommandOutput{}, fmt.Errorf("failed to get home directory: %w", err)
+			return CommandOutput{ExitCode: -1}, fmt.Errorf("failed to get home directory: %w", err)
 		}
 
 		err = appendToBashHistory(command, homeDir+"/.bash_history")
 		if err != nil {
-			return CommandOutput{}, fmt.Errorf("failed to write command to history: %w", err)
+			return CommandOutput{ExitCode: -1}, fmt.Errorf("failed to write command to history: %w", err)
 		}
 	}
 
 	err = commandToExecute.Run()
+	exitCode := -1
+	if commandToExecute.ProcessState != nil {
+		exitCode = commandToExecute.ProcessState.ExitCode()
+	}
+	if err != nil && ctx.Err() != nil {
+		err = stoppedCommandError(ctx, config)
+		exitCode = -1
+	} else if errors.Is(err, exec.ErrWaitDelay) {
+		// The command succeeded but left a background process holding on to
+		// its output.
+		logging.GlobalLogger.Debugf("Stopped waiting for the output of background processes")
+		err = nil
+	}
 
 	if filterErr := lib.FilterEnvironmentStateFile(
 		lib.DefaultEnvironmentStateFile,
@@ -145,24 +261,26 @@ func executeBashCommandImpl(
 
 	// TODO(vmarcella): Find a better way to handle this.
 	if config.InteractiveCommand {
-		return CommandOutput{}, err
+		return CommandOutput{ExitCode: exitCode}, err
 	}
 
 	standardOutput, standardError := stdoutBuffer.String(), stderrBuffer.String()
 
 	if err != nil {
 		return CommandOutput{
-				StdOut: standardOutput,
-				StdErr: standardError,
-			}, fmt.Errorf(
-				"command exited with '%w' and the message '%s'",
-				err,
-				standardError,
-			)
+			StdOut:   standardOutput,
+			StdErr:   standardError,
+			ExitCode: exitCode,
+		}, fmt.Errorf(
+			"command exited with '%w' and the message '%s'",
+			err,
+			standardError,
+		)
 	}
 
 	return CommandOutput{
-		StdOut: standardOutput,
-		StdErr: standardError,
+		StdOut:   standardOutput,
+		StdErr:   standardError,
+		ExitCode: exitCode,
 	}, nil
 }
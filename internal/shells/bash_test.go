@@ -1,7 +1,18 @@
 package shells
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestBashCommandExecution(t *testing.T) {
@@ -25,6 +36,26 @@ func TestBashCommandExecution(t *testing.T) {
 		}
 	})
 
+	// Ensures that a nested ie does not share the state directory of the run.
+	t.Run("State directory is not inherited", func(t *testing.T) {
+		t.Setenv("IE_STATE_DIR", "/tmp/ie-runs/parent")
+		result, err := ExecuteBashCommand(
+			"printf \"${IE_STATE_DIR-unset}\"",
+			BashCommandConfiguration{
+				EnvironmentVariables: nil,
+				InheritEnvironment:   true,
+				InteractiveCommand:   false,
+				WriteToHistory:       false,
+			},
+		)
+		if err != nil {
+			t.Errorf("Expected err to be nil, got %v", err)
+		}
+		if result.StdOut != "unset" {
+			t.Errorf("Expected IE_STATE_DIR to be unset, got '%s'", result.StdOut)
+		}
+	})
+
 	// Ensures that if a command fails, an error is returned.
 	t.Run("Invalid command execution", func(t *testing.T) {
 		cmd := "not_real_command"
@@ -105,4 +136,111 @@ func TestBashCommandExecution(t *testing.T) {
 			t.Errorf("Expected result to be non-empty, got '%s'", result.StdOut)
 		}
 	})
+
+	// Ensures that the output is passed to the observer as it is written.
+	t.Run("Command output is observed", func(t *testing.T) {
+		observed := observeOutput()
+		result, err := ExecuteBashCommand(
+			"printf out; printf err >&2",
+			BashCommandConfiguration{InheritEnvironment: true, OutputObserver: observed.observe},
+		)
+		if err != nil {
+			t.Errorf("Expected err to be nil, got %v", err)
+		}
+		if result.StdOut != "out" || observed.get("stdout") != "out" {
+			t.Errorf("Expected stdout to be observed, got '%s'", observed.get("stdout"))
+		}
+		if result.StdErr != "err" || observed.get("stderr") != "err" {
+			t.Errorf("Expected stderr to be observed, got '%s'", observed.get("stderr"))
+		}
+	})
+}
+
+// Collects the output passed to an output observer.
+type observedOutput struct {
+	mutex   sync.Mutex
+	streams map[string]*bytes.Buffer
+}
+
+func observeOutput() *observedOutput {
+	return &observedOutput{streams: map[string]*bytes.Buffer{}}
+}
+
+func (o *observedOutput) observe(stream string, chunk []byte) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.streams[stream] == nil {
+		o.streams[stream] = &bytes.Buffer{}
+	}
+	o.streams[stream].Write(chunk)
+}
+
+func (o *observedOutput) get(stream string) string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.streams[stream] == nil {
+		return ""
+	}
+	return o.streams[stream].String()
+}
+
+func TestBashCommandCancellation(t *testing.T) {
+	// Ensures that the whole process group is killed when a command times
+	// out, not only the bash process running it.
+	t.Run("Timeout kills the process group", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "pid")
+		start := time.Now()
+		_, err := ExecuteBashCommand(
+			fmt.Sprintf("sleep 30 &\necho $! > %s\nwait", pidFile),
+			BashCommandConfiguration{
+				InheritEnvironment: true,
+				Timeout:            500 * time.Millisecond,
+			},
+		)
+		if !errors.Is(err, ErrTimeout) {
+			t.Fatalf("Expected a timeout error, got %v", err)
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Errorf("Expected the command to be stopped promptly")
+		}
+
+		data, readErr := os.ReadFile(pidFile)
+		if readErr != nil {
+			t.Fatalf("Expected the background process pid to be recorded: %v", readErr)
+		}
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		deadline := time.Now().Add(2 * time.Second)
+		for processIsRunning(pid) && time.Now().Before(deadline) {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if processIsRunning(pid) {
+			t.Errorf("Expected background process %d to be killed", pid)
+		}
+	})
+
+	// Ensures that the scenario context stops commands and is reported
+	// differently from a code block timeout.
+	t.Run("Scenario context stops the command", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		_, err := ExecuteBashCommand(
+			"sleep 30",
+			BashCommandConfiguration{InheritEnvironment: true, Context: ctx},
+		)
+		if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), "scenario") {
+			t.Fatalf("Expected a scenario timeout error, got %v", err)
+		}
+	})
+}
+
+// Checks if a process is running. Killed processes linger as zombies until
+// they are reaped, which may never happen when the init process of a
+// container does not reap orphans, so zombies are not considered running.
+func processIsRunning(pid int) bool {
+	if stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		return len(fields) > 0 && fields[0] != "Z"
+	}
+	return syscall.Kill(pid, 0) == nil
 }
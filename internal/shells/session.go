@@ -0,0 +1,473 @@
+package shells
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+var errSessionExited = errors.New("the shell session exited")
+
+var environmentVariableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// The helpers installed into every session. Commands are written to a file
+// and sourced so that multi-line constructs behave as they do in a script.
+//
+// `set -e` would terminate the session on the first failure, so an ERR trap
+// emulates it instead: while a command file is being sourced (BASH_SOURCE is
+// not empty) a failure returns from the innermost function or sourced file,
+// which fails its caller in turn until the source itself returns. At the top
+// level of the session the trap does nothing so that __ie_end always runs.
+//
+// __ie_end persists the environment and working directory for the rest of
+// the engine and then prints the command boundary on stdout (with the exit
+// code) and on stderr. The terminal echoes this script back before echo is
+// turned off, so the boundary is split in two to keep it out of the echo.
+const sessionInitScript = `stty -echo -onlcr 2>/dev/null
+__ie_begin() {
+  set -E
+  trap '__ie_status=$?; if [ ${#BASH_SOURCE[@]} -gt 0 ]; then return $__ie_status; fi' ERR
+}
+__ie_end() {
+  local __ie_exit_code="$1"
+  trap - ERR
+  env > %[1]s 2>/dev/null
+  pwd > %[2]s 2>/dev/null
+  printf '%%s%%d\n' "$2" "$__ie_exit_code"
+  printf '%%s\n' "$2" >&2
+}
+printf '%%s%%s0\n' '%[3]s' '%[4]s'
+printf '%%s%%s\n' '%[3]s' '%[4]s' >&2
+`
+
+// A long lived bash process that commands are sent to over a pseudo terminal.
+// Unlike the process backend, everything a command defines (functions,
+// aliases, options, traps, background jobs and variables with multi-line
+// values) is visible to the commands that follow it.
+type Session struct {
+	mutex    sync.Mutex
+	command  *exec.Cmd
+	terminal *os.File
+	stdout   chan []byte
+	stderr   chan []byte
+	exited   chan struct{}
+	boundary string
+	// Matches the boundary printed on stdout along with the exit code.
+	boundaryRegex *regexp.Regexp
+
+	// The values of the configured environment variables that have already
+	// been exported into the session.
+	exported map[string]string
+	// Shell code to run before the next command, used to carry over state
+	// changed outside of the session.
+	pending string
+}
+
+// Creates a session. The bash process is started when the first command is
+// executed.
+func NewSession() *Session {
+	return &Session{}
+}
+
+// Executes a command within the session. Interactive commands need direct
+// access to the user's terminal and are executed by the process backend, any
+// environment and working directory changes they make are carried back into
+// the session afterwards.
+func (s *Session) Execute(command string, config BashCommandConfiguration) (CommandOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	command = strings.ReplaceAll(command, "\r\n", "\n")
+	command = strings.ReplaceAll(command, "\r", "\n")
+
+	if config.InteractiveCommand {
+		return s.executeOutsideSession(command, config)
+	}
+
+	if !s.running() {
+		if s.command != nil {
+			logging.GlobalLogger.Warnf("The shell session exited, starting a new one. State defined by previous commands is lost.")
+		}
+		if err := s.start(config); err != nil {
+			return CommandOutput{ExitCode: -1}, fmt.Errorf("failed to start the shell session: %w", err)
+		}
+	}
+
+	if config.WriteToHistory {
+		homeDir, err := lib.GetHomeDirectory()
+		if err != nil {
+			return CommandOutput{ExitCode: -1}, fmt.Errorf("failed to get home directory: %w", err)
+		}
+
+		err = appendToBashHistory(command, homeDir+"/.bash_history")
+		if err != nil {
+			return CommandOutput{ExitCode: -1}, fmt.Errorf("failed to write command to history: %w", err)
+		}
+	}
+
+	script, err := os.CreateTemp("", "ie-session-*.sh")
+	if err != nil {
+		return CommandOutput{ExitCode: -1}, fmt.Errorf("failed to create the command file: %w", err)
+	}
+	defer os.Remove(script.Name())
+
+	_, err = script.WriteString(s.pending + s.exportsFor(config.EnvironmentVariables) + command + "\n")
+	if closeErr := script.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return CommandOutput{ExitCode: -1}, fmt.Errorf("failed to write the command file: %w", err)
+	}
+	s.pending = ""
+
+	_, err = fmt.Fprintf(
+		s.terminal,
+		"__ie_begin; source %s; __ie_end $? %s\n",
+		lib.QuoteForShell(script.Name()),
+		lib.QuoteForShell(s.boundary),
+	)
+	if err != nil {
+		s.kill()
+		return CommandOutput{ExitCode: -1}, fmt.Errorf("failed to send the command to the shell session: %w", err)
+	}
+
+	var stdoutStream, stderrStream io.Writer
+	if config.StreamOutput {
+		stdoutStream = os.Stdout
+	}
+	if config.OutputObserver != nil {
+		stdoutStream = combineWriters(stdoutStream, observerWriter{"stdout", config.OutputObserver})
+		stderrStream = observerWriter{"stderr", config.OutputObserver}
+	}
+	ctx, cancel := commandContext(config)
+	defer cancel()
+	output, exitCode, err := s.collect(ctx, stdoutStream, stderrStream)
+	output.ExitCode = exitCode
+	if err != nil {
+		output.ExitCode = -1
+	}
+	if err != nil && ctx.Err() != nil {
+		err = stoppedCommandError(ctx, config)
+	}
+
+	if filterErr := lib.FilterEnvironmentStateFile(
+		lib.DefaultEnvironmentStateFile,
+		lib.BaselineEnvironmentStateFile(lib.DefaultEnvironmentStateFile),
+	); filterErr != nil {
+		logging.GlobalLogger.Warnf("Failed to filter persisted environment variables: %v", filterErr)
+	}
+
+	if err != nil {
+		return output, fmt.Errorf(
+			"command exited with '%w' and the message '%s'",
+			err,
+			output.StdErr,
+		)
+	}
+	if exitCode != 0 {
+		return output, fmt.Errorf(
+			"command exited with 'exit status %d' and the message '%s'",
+			exitCode,
+			output.StdErr,
+		)
+	}
+
+	return output, nil
+}
+
+// Ends the session and every process started by it.
+func (s *Session) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running() {
+		return
+	}
+
+	fmt.Fprint(s.terminal, "exit\n")
+	select {
+	case <-s.exited:
+	case <-time.After(time.Second):
+	}
+	s.kill()
+}
+
+func (s *Session) running() bool {
+	if s.command == nil {
+		return false
+	}
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *Session) start(config BashCommandConfiguration) error {
+	boundary, err := newSessionBoundary()
+	if err != nil {
+		return err
+	}
+
+	terminal, tty, err := pty.Open()
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+
+	command := exec.Command("bash", "--noprofile", "--norc")
+	command.Stdin = tty
+	command.Stdout = tty
+	stderr, err := command.StderrPipe()
+	if err != nil {
+		terminal.Close()
+		return err
+	}
+	// Run the session in its own process group with the pseudo terminal as
+	// its controlling terminal so that it can be killed as a whole.
+	command.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+
+	if config.InheritEnvironment {
+		command.Env = lib.InheritedEnvironment()
+	}
+	environment := lib.CopyMap(config.EnvironmentVariables)
+	if envFromPreviousStep, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile); err == nil {
+		environment = lib.MergeMaps(environment, envFromPreviousStep)
+	}
+	for k, v := range environment {
+		command.Env = append(command.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	if workingDir, err := lib.LoadWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile); err == nil {
+		command.Dir = workingDir
+	}
+
+	if err := command.Start(); err != nil {
+		terminal.Close()
+		return err
+	}
+
+	s.command = command
+	s.terminal = terminal
+	s.boundary = boundary
+	s.boundaryRegex = regexp.MustCompile(regexp.QuoteMeta(boundary) + `(-?[0-9]+)\n`)
+	s.stdout = readChunks(terminal)
+	s.stderr = readChunks(stderr)
+	s.exited = make(chan struct{})
+	s.exported = lib.CopyMap(config.EnvironmentVariables)
+	s.pending = ""
+	go func(exited chan struct{}) {
+		command.Wait()
+		close(exited)
+	}(s.exited)
+
+	_, err = fmt.Fprintf(
+		terminal,
+		sessionInitScript,
+		lib.QuoteForShell(lib.DefaultEnvironmentStateFile),
+		lib.QuoteForShell(lib.DefaultWorkingDirectoryStateFile),
+		boundary[:len(boundary)/2],
+		boundary[len(boundary)/2:],
+	)
+	if err != nil {
+		s.kill()
+		return err
+	}
+
+	// Discard everything echoed back before the terminal was configured.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, _, err := s.collect(ctx, nil, nil); err != nil {
+		s.kill()
+		return err
+	}
+
+	logging.GlobalLogger.Infof("Started shell session with pid %d", command.Process.Pid)
+	return nil
+}
+
+// Reads the output of the current command from the session until the command
+// boundary is seen on both stdout and stderr, copying it to the given streams
+// as it arrives. The session is killed if ctx is done first.
+func (s *Session) collect(ctx context.Context, stdoutStream, stderrStream io.Writer) (CommandOutput, int, error) {
+	var stdout, stderr bytes.Buffer
+	stderrMarker := []byte(s.boundary + "\n")
+	stdoutEnd, stderrEnd := -1, -1
+	exitCode := 0
+	stdoutStreamed, stderrStreamed := 0, 0
+
+	// Copies the output to its stream, holding back anything that could be
+	// the start of the boundary.
+	flush := func(stream io.Writer, buffer *bytes.Buffer, end int, streamed *int) {
+		if stream == nil {
+			return
+		}
+		limit := buffer.Len() - len(s.boundary) - 1
+		if end >= 0 {
+			limit = end
+		}
+		if limit > *streamed {
+			stream.Write(buffer.Bytes()[*streamed:limit])
+			*streamed = limit
+		}
+	}
+
+	output := func() CommandOutput {
+		out, errOut := stdout.Bytes(), stderr.Bytes()
+		if stdoutEnd >= 0 {
+			out = out[:stdoutEnd]
+		}
+		if stderrEnd >= 0 {
+			errOut = errOut[:stderrEnd]
+		}
+		return CommandOutput{StdOut: string(out), StdErr: string(errOut)}
+	}
+
+	for stdoutEnd < 0 || stderrEnd < 0 {
+		select {
+		case chunk, ok := <-s.stdout:
+			if !ok {
+				s.kill()
+				return output(), 0, errSessionExited
+			}
+			stdout.Write(chunk)
+			if match := s.boundaryRegex.FindSubmatchIndex(stdout.Bytes()); match != nil {
+				exitCode, _ = strconv.Atoi(string(stdout.Bytes()[match[2]:match[3]]))
+				stdoutEnd = match[0]
+			}
+			flush(stdoutStream, &stdout, stdoutEnd, &stdoutStreamed)
+		case chunk, ok := <-s.stderr:
+			if !ok {
+				s.kill()
+				return output(), 0, errSessionExited
+			}
+			stderr.Write(chunk)
+			if index := bytes.Index(stderr.Bytes(), stderrMarker); index >= 0 {
+				stderrEnd = index
+			}
+			flush(stderrStream, &stderr, stderrEnd, &stderrStreamed)
+		case <-s.exited:
+			// Drain whatever the shell wrote before exiting.
+			time.Sleep(50 * time.Millisecond)
+			s.kill()
+			return output(), 0, errSessionExited
+		case <-ctx.Done():
+			s.kill()
+			return output(), 0, ctx.Err()
+		}
+	}
+
+	return output(), exitCode, nil
+}
+
+// Runs an interactive command with the process backend and carries the
+// environment variables and working directory it leaves behind back into the
+// session.
+func (s *Session) executeOutsideSession(command string, config BashCommandConfiguration) (CommandOutput, error) {
+	before, _ := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	output, err := executeBashCommandImpl(command, config)
+
+	after, loadErr := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	if loadErr == nil {
+		var pending strings.Builder
+		for k, v := range after {
+			if previous, ok := before[k]; ok && previous == v {
+				continue
+			}
+			if environmentVariableNameRegex.MatchString(k) {
+				pending.WriteString(fmt.Sprintf("export %s=%s\n", k, lib.QuoteForShell(v)))
+			}
+		}
+		if workingDir, err := lib.LoadWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile); err == nil {
+			pending.WriteString(fmt.Sprintf("cd %s\n", lib.QuoteForShell(workingDir)))
+		}
+		s.pending += pending.String()
+	}
+
+	return output, err
+}
+
+// Exports the variables into the session before the next command.
+func (s *Session) queueExports(variables map[string]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for k, v := range variables {
+		if environmentVariableNameRegex.MatchString(k) {
+			s.pending += fmt.Sprintf("export %s=%s\n", k, lib.QuoteForShell(v))
+		}
+	}
+}
+
+// Returns the shell code that exports the configured environment variables
+// that are new or have changed since they were last exported.
+func (s *Session) exportsFor(environmentVariables map[string]string) string {
+	var exports strings.Builder
+	for k, v := range environmentVariables {
+		if previous, ok := s.exported[k]; ok && previous == v {
+			continue
+		}
+		if !environmentVariableNameRegex.MatchString(k) {
+			logging.GlobalLogger.Warnf("Skipping invalid environment variable name %q", k)
+			continue
+		}
+		exports.WriteString(fmt.Sprintf("export %s=%s\n", k, lib.QuoteForShell(v)))
+		s.exported[k] = v
+	}
+	return exports.String()
+}
+
+// Kills the session along with every process it started.
+func (s *Session) kill() {
+	if s.command == nil || s.command.Process == nil {
+		return
+	}
+	syscall.Kill(-s.command.Process.Pid, syscall.SIGKILL)
+	s.terminal.Close()
+	<-s.exited
+}
+
+// Reads from r into a channel of chunks that is closed once r is exhausted.
+func readChunks(r io.Reader) chan []byte {
+	chunks := make(chan []byte, 64)
+	go func() {
+		defer close(chunks)
+		buffer := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buffer)
+			if n > 0 {
+				chunk := make([]byte, n)
+				copy(chunk, buffer[:n])
+				chunks <- chunk
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return chunks
+}
+
+func newSessionBoundary() (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return "__IE_SESSION_" + hex.EncodeToString(nonce) + "__", nil
+}
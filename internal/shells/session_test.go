@@ -0,0 +1,169 @@
+package shells
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+)
+
+func useTemporaryStateFiles(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	originalEnv, originalDir := lib.DefaultEnvironmentStateFile, lib.DefaultWorkingDirectoryStateFile
+	lib.DefaultEnvironmentStateFile = filepath.Join(dir, "env-vars")
+	lib.DefaultWorkingDirectoryStateFile = filepath.Join(dir, "working-dir")
+	t.Cleanup(func() {
+		lib.DefaultEnvironmentStateFile = originalEnv
+		lib.DefaultWorkingDirectoryStateFile = originalDir
+	})
+}
+
+func TestSessionExecution(t *testing.T) {
+	useTemporaryStateFiles(t)
+	session := NewSession()
+	defer session.Close()
+
+	execute := func(command string) (CommandOutput, error) {
+		return session.Execute(command, BashCommandConfiguration{InheritEnvironment: true})
+	}
+
+	// Ensures that shell state is kept between commands.
+	t.Run("State is shared between commands", func(t *testing.T) {
+		_, err := execute("greet() { printf \"hello %s\" \"$1\"; }\nshopt -s expand_aliases\nalias shout='printf LOUD'\nexport MULTI_LINE=$'first\\nsecond'\ncd /tmp")
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		result, err := execute("greet world; shout; printf '|%s|' \"$MULTI_LINE\"; printf '|%s' \"$PWD\"")
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+		if result.StdOut != "hello worldLOUD|first\nsecond||/tmp" {
+			t.Errorf("Expected state to persist, got '%s'", result.StdOut)
+		}
+	})
+
+	// Ensures that a failure stops the command like `set -e` without ending
+	// the session.
+	t.Run("Failures stop the command", func(t *testing.T) {
+		result, err := execute("fail() { false; echo 'not reached'; }\necho before\nfail\necho after")
+		if err == nil || !strings.Contains(err.Error(), "exit status 1") {
+			t.Fatalf("Expected the command to fail with exit status 1, got %v", err)
+		}
+		if result.StdOut != "before\n" {
+			t.Errorf("Expected output to stop at the failure, got '%s'", result.StdOut)
+		}
+
+		result, err = execute("echo still running >&2; printf ok")
+		if err != nil {
+			t.Fatalf("Expected the session to survive the failure, got %v", err)
+		}
+		if result.StdOut != "ok" || result.StdErr != "still running\n" {
+			t.Errorf("Unexpected output after failure: %+v", result)
+		}
+	})
+
+	// Ensures that the session recovers from commands that exit the shell.
+	t.Run("Session restarts after exit", func(t *testing.T) {
+		if _, err := execute("exit 3"); err == nil {
+			t.Fatalf("Expected exiting the session to be reported as an error")
+		}
+
+		result, err := execute("printf restarted")
+		if err != nil || result.StdOut != "restarted" {
+			t.Fatalf("Expected a new session to be started, got '%s' (%v)", result.StdOut, err)
+		}
+	})
+
+	// Ensures that commands running past their timeout are killed.
+	t.Run("Output is observed without the boundary", func(t *testing.T) {
+		observed := observeOutput()
+		_, err := session.Execute(
+			"printf out; printf err >&2",
+			BashCommandConfiguration{OutputObserver: observed.observe},
+		)
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+		if observed.get("stdout") != "out" || observed.get("stderr") != "err" {
+			t.Errorf("Expected 'out' and 'err' to be observed, got %q and %q", observed.get("stdout"), observed.get("stderr"))
+		}
+	})
+
+	t.Run("Timeouts kill the command", func(t *testing.T) {
+		start := time.Now()
+		_, err := session.Execute("sleep 10", BashCommandConfiguration{Timeout: 200 * time.Millisecond})
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("Expected a timeout error, got %v", err)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("Expected the command to be killed promptly")
+		}
+	})
+}
+
+func TestExportEnvironmentVariables(t *testing.T) {
+	for _, backend := range []Backend{BackendProcess, BackendSession} {
+		t.Run(string(backend), func(t *testing.T) {
+			useTemporaryStateFiles(t)
+			defer UseBackend(backend)()
+
+			config := BashCommandConfiguration{InheritEnvironment: true}
+			if _, err := ExecuteBashCommand("export FIRST=1", config); err != nil {
+				t.Fatalf("Expected err to be nil, got %v", err)
+			}
+			if err := ExportEnvironmentVariables(map[string]string{"CAPTURED": "it's here"}); err != nil {
+				t.Fatalf("Expected err to be nil, got %v", err)
+			}
+
+			env, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+			if err != nil {
+				t.Fatalf("Expected err to be nil, got %v", err)
+			}
+			if env["CAPTURED"] != "it's here" || env["FIRST"] != "1" {
+				t.Errorf("Expected the state file to hold both variables, got %v", env)
+			}
+
+			result, err := ExecuteBashCommand(`printf '%s|%s' "$FIRST" "$CAPTURED"`, config)
+			if err != nil {
+				t.Fatalf("Expected err to be nil, got %v", err)
+			}
+			if result.StdOut != "1|it's here" {
+				t.Errorf("Expected the captured variable to be exported, got '%s'", result.StdOut)
+			}
+		})
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	for _, backend := range []Backend{BackendProcess, BackendSession} {
+		t.Run(string(backend), func(t *testing.T) {
+			useTemporaryStateFiles(t)
+			defer UseBackend(backend)()
+
+			config := BashCommandConfiguration{InheritEnvironment: true}
+			result, err := ExecuteBashCommand("echo ok", config)
+			if err != nil || result.ExitCode != 0 {
+				t.Errorf("Expected exit code 0 without an error, got %d and %v", result.ExitCode, err)
+			}
+
+			result, err = ExecuteBashCommand("bash -c 'echo denied >&2; exit 3'", config)
+			if err == nil || result.ExitCode != 3 {
+				t.Errorf("Expected exit code 3 with an error, got %d and %v", result.ExitCode, err)
+			}
+			if result.StdErr != "denied\n" {
+				t.Errorf("Expected the stderr to be kept, got '%s'", result.StdErr)
+			}
+
+			config.Timeout = 100 * time.Millisecond
+			result, err = ExecuteBashCommand("sleep 5", config)
+			if !errors.Is(err, ErrTimeout) || result.ExitCode != -1 {
+				t.Errorf("Expected exit code -1 for a timed out command, got %d and %v", result.ExitCode, err)
+			}
+		})
+	}
+}
@@ -26,6 +26,10 @@ var (
 	ErrorMessageStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5733"))
 	WarningStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500"))
 	OcdStatusUpdateStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#000000"))
+	DiffHeaderStyle      = lipgloss.NewStyle().Bold(true)
+	DiffHunkStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("#6CB6FF"))
+	DiffRemovedStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5733"))
+	DiffAddedStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("#32CD32"))
 )
 
 var (
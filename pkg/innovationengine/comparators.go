@@ -0,0 +1,26 @@
+package innovationengine
+
+import "github.com/Azure/InnovationEngine/internal/engine/common"
+
+// Compares the actual output of a code block with its expected output. Result
+// blocks select a comparator by name with the compare attribute, e.g.
+// ```json {compare=json-subset ignore=id}
+type Comparator = common.Comparator
+
+// Adapts a function to the Comparator interface.
+type ComparatorFunc = common.ComparatorFunc
+
+// The expected output of a code block, as given to comparators.
+type Expectation = common.Expectation
+
+// Registers a comparator under a name that result blocks can select with the
+// compare attribute. Names are case insensitive and cannot be registered
+// twice, including the names of the built-in comparators.
+func RegisterComparator(name string, comparator Comparator) error {
+	return common.RegisterComparator(name, comparator)
+}
+
+// Returns the names of the registered comparators in alphabetical order.
+func ComparatorNames() []string {
+	return common.ComparatorNames()
+}
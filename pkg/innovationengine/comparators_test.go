@@ -0,0 +1,41 @@
+package innovationengine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterComparator(t *testing.T) {
+	caseInsensitive := ComparatorFunc(func(actual string, expected Expectation) (float64, error) {
+		if !strings.EqualFold(strings.TrimSpace(actual), strings.TrimSpace(expected.Output)) {
+			return 0, fmt.Errorf("expected %q, got %q", expected.Output, actual)
+		}
+		return 1, nil
+	})
+	require.NoError(t, RegisterComparator("Case-Insensitive", caseInsensitive))
+	assert.Contains(t, ComparatorNames(), "case-insensitive")
+	assert.ErrorContains(t, RegisterComparator("case-insensitive", caseInsensitive), "already registered")
+	assert.ErrorContains(t, RegisterComparator("exact", caseInsensitive), "already registered")
+
+	markdown := "# Shouting\n\n" +
+		"```bash\necho HELLO\n```\n\n" +
+		"```text {compare=case-insensitive}\nhello\n```\n"
+	scenario, err := LoadScenario([]byte(markdown), LoadOptions{})
+	require.NoError(t, err)
+
+	result, err := Run(context.Background(), scenario, Options{StateDirectory: t.TempDir()})
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	scenario, err = LoadScenario([]byte(strings.Replace(markdown, "echo HELLO", "echo GOODBYE", 1)), LoadOptions{})
+	require.NoError(t, err)
+
+	result, err = Run(context.Background(), scenario, Options{StateDirectory: t.TempDir()})
+	assert.ErrorContains(t, err, `expected "hello\n", got "GOODBYE\n"`)
+	assert.False(t, result.Success)
+}
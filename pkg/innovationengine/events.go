@@ -0,0 +1,33 @@
+package innovationengine
+
+import "github.com/Azure/InnovationEngine/internal/events"
+
+// An event describing the progress of a run, the same events written by
+// `ie test --events`. See docs/specs/event-stream.md for the schema.
+type Event = events.Event
+
+// The type of an event.
+type EventType = events.Type
+
+// Details carried by events.
+type (
+	EventScenario   = events.Scenario
+	EventStep       = events.Step
+	EventCodeBlock  = events.CodeBlock
+	EventOutput     = events.Output
+	EventComparison = events.Comparison
+	EventResult     = events.Result
+)
+
+const (
+	EventScenarioStart = events.ScenarioStart
+	EventStepStart     = events.StepStart
+	EventBlockStart    = events.BlockStart
+	EventBlockOutput   = events.BlockOutput
+	EventBlockCompare  = events.BlockCompare
+	EventBlockEnd      = events.BlockEnd
+	EventScenarioEnd   = events.ScenarioEnd
+)
+
+// The version of the event schema.
+const EventSchemaVersion = events.SchemaVersion
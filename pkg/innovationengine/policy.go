@@ -0,0 +1,22 @@
+package innovationengine
+
+import "github.com/Azure/InnovationEngine/internal/engine/common"
+
+// Restricts the executables, commands and network hosts code blocks may use,
+// for scenarios that are not trusted. Deny rules win over allow rules.
+type CommandPolicy = common.CommandPolicy
+
+// Lists what a CommandPolicy allows and denies.
+type PolicyRules = common.PolicyRules
+
+// Restricts the hosts that curl and wget may connect to.
+type NetworkPolicy = common.NetworkPolicy
+
+// Returned by Run when a code block violates the policy of the run, before
+// any code block runs.
+type PolicyViolationError = common.PolicyViolationError
+
+// Reads a command policy from a YAML file, in the format of ie --policy.
+func LoadCommandPolicy(path string) (*CommandPolicy, error) {
+	return common.LoadCommandPolicy(path)
+}
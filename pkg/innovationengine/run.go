@@ -0,0 +1,247 @@
+package innovationengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/az"
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/events"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// A command that makes the code blocks running it destructive, e.g.
+// `az storage account delete`. Destructive code blocks are not run with
+// Options.DoNotDelete.
+type DestructiveCommand = common.DestructiveCommand
+
+// Options for running a scenario.
+type Options struct {
+	// The directory the scenario runs in. Defaults to the current directory.
+	WorkingDirectory string
+	// How code blocks are run: "process" (the default) starts a new bash
+	// process per code block, "session" runs every code block in one long
+	// lived bash session.
+	ShellBackend string
+	// Maximum amount of time the whole scenario may run for. Zero disables
+	// the timeout.
+	Timeout time.Duration
+	// Code blocks carrying any of these tags are not run.
+	SkipTags []string
+	// Do not run the code blocks running destructive commands, like
+	// `az group delete` or `rm -rf`.
+	DoNotDelete bool
+	// Commands that are destructive in addition to the built-in ones.
+	DestructiveCommands []DestructiveCommand
+	// Stops the scenario before any code block runs if one of them violates
+	// the policy, with a *PolicyViolationError. Policies built in code are
+	// validated by Run.
+	Policy *CommandPolicy
+	// Adds a correlation ID to the user agent of azure-cli commands.
+	CorrelationID string
+	// The directory holding the state of the run. Defaults to a new
+	// directory per run, as with the command line.
+	StateDirectory string
+	// Continue from the checkpoint left behind in StateDirectory by the last
+	// failed run.
+	Resume bool
+
+	// Called with every event of the run, one at a time.
+	OnEvent func(Event)
+	// Receives every event of the run. Events are sent as they happen, so
+	// the channel must be drained while the scenario runs. It is not closed.
+	Events chan<- Event
+}
+
+// The outcome of running a scenario.
+type Result struct {
+	Success  bool
+	Duration time.Duration
+	// The directory that held the state of the run.
+	StateDirectory string
+	// The environment variables declared by the code blocks that ran.
+	EnvironmentVariables map[string]string
+	// The code blocks that ran, in order. When the scenario fails, the last
+	// one is the code block that failed.
+	CodeBlocks []CodeBlockResult
+}
+
+// The outcome of running a code block.
+type CodeBlockResult struct {
+	StepNumber      int
+	StepName        string
+	CodeBlockNumber int
+	Language        string
+	Command         string
+	StdOut          string
+	StdErr          string
+	// The exit code of the last attempt, -1 if it did not run to completion.
+	ExitCode        int
+	Success         bool
+	Error           error
+	TimedOut        bool
+	SimilarityScore float64
+	// The number of times the code block ran, including retries.
+	Attempts int
+	Duration time.Duration
+}
+
+// The engine keeps the state of a run in process wide settings (the state
+// directory, the working directory and the shell backend), so runs take
+// turns.
+var runMutex sync.Mutex
+
+// Runs a scenario, stopping at the first code block that fails or once ctx
+// is done. The result is returned even when the scenario fails, in which case
+// err describes the failure. Runs within the same process do not overlap,
+// concurrent calls wait for the previous run to finish.
+func Run(ctx context.Context, scenario *Scenario, options Options) (*Result, error) {
+	if scenario == nil || scenario.scenario == nil {
+		return nil, errors.New("no scenario to run, load one with LoadScenario")
+	}
+	shellBackend, err := shells.ParseBackend(options.ShellBackend)
+	if err != nil {
+		return nil, err
+	}
+	for _, command := range options.DestructiveCommands {
+		if err := command.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	runMutex.Lock()
+	defer runMutex.Unlock()
+
+	// Validating prepares the patterns of the policy, which runs may share.
+	if options.Policy != nil {
+		if err := options.Policy.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid policy: %w", err)
+		}
+	}
+
+	stateDirectory := options.StateDirectory
+	if stateDirectory == "" {
+		stateDirectory = lib.RunStateDirectory(lib.NewRunID())
+	}
+	if err := lib.UseStateDirectory(stateDirectory); err != nil {
+		return nil, fmt.Errorf("failed to prepare the state directory: %w", err)
+	}
+
+	if options.OnEvent != nil || options.Events != nil {
+		defer events.Use(events.NewHandlerEmitter(func(event Event) {
+			if options.OnEvent != nil {
+				options.OnEvent(event)
+			}
+			if options.Events != nil {
+				options.Events <- event
+			}
+		}))()
+	}
+
+	workingDirectory := options.WorkingDirectory
+	if workingDirectory == "" {
+		workingDirectory = "."
+	}
+
+	start := time.Now()
+	var codeBlocks []common.StatefulCodeBlock
+	var initialEnvironmentVariables map[string]string
+	err = func() (err error) {
+		endScenario := events.StartScenario(events.Scenario{
+			Name:           scenario.Name,
+			Document:       scenario.scenario.SourcePath,
+			Mode:           common.ModeTest,
+			StateDirectory: lib.StateDirectory(),
+		})
+		defer func() { endScenario(err) }()
+
+		destructiveCommands := common.DestructiveCommands(options.DestructiveCommands)
+		filters := common.NewCodeBlockFilters(options.DoNotDelete, destructiveCommands, options.SkipTags)
+		checkpoints := common.NewCheckpointer(lib.DefaultCheckpointFile, scenario.scenario, filters)
+		if options.Resume {
+			if _, err := checkpoints.Resume(); err != nil {
+				return err
+			}
+		}
+
+		return fs.UsingDirectory(workingDirectory, func() error {
+			environment := lib.CopyMap(scenario.scenario.Environment)
+			az.SetCorrelationId(options.CorrelationID, environment)
+			initialEnvironmentVariables = lib.GetEnvironmentVariables()
+			if err := lib.SaveEnvironmentBaselineFile(lib.DefaultEnvironmentStateFile, initialEnvironmentVariables); err != nil {
+				logging.GlobalLogger.Warnf("Failed to capture environment baseline: %v", err)
+			}
+			defer shells.UseBackend(shellBackend)()
+
+			steps := common.FilterSkippedCodeBlocks(
+				common.FilterDestructiveCodeBlocks(scenario.scenario.Steps, options.DoNotDelete, destructiveCommands),
+				common.ModeTest,
+				options.SkipTags,
+			)
+			if options.Policy != nil {
+				if err := options.Policy.CheckSteps(steps); err != nil {
+					return err
+				}
+			}
+
+			ctx, cancel := scenarioContext(ctx, options.Timeout)
+			defer cancel()
+
+			var err error
+			codeBlocks, err = common.RunCodeBlocks(ctx, steps, environment, checkpoints)
+			if err == nil {
+				checkpoints.Clear()
+			}
+			return err
+		})
+	}()
+
+	result := &Result{
+		Success:        err == nil,
+		Duration:       time.Since(start),
+		StateDirectory: lib.StateDirectory(),
+		CodeBlocks:     make([]CodeBlockResult, 0, len(codeBlocks)),
+	}
+	if environmentVariables, envErr := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile); envErr == nil {
+		result.EnvironmentVariables = lib.DiffMapsAgainstBaseline(environmentVariables, initialEnvironmentVariables)
+	}
+	for _, codeBlock := range codeBlocks {
+		result.CodeBlocks = append(result.CodeBlocks, newCodeBlockResult(codeBlock))
+	}
+	return result, err
+}
+
+func scenarioContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+func newCodeBlockResult(codeBlock common.StatefulCodeBlock) CodeBlockResult {
+	return CodeBlockResult{
+		StepNumber:      codeBlock.StepNumber,
+		StepName:        codeBlock.StepName,
+		CodeBlockNumber: codeBlock.CodeBlockNumber,
+		Language:        codeBlock.CodeBlock.Language,
+		Command:         codeBlock.CodeBlock.Content,
+		StdOut:          codeBlock.StdOut,
+		StdErr:          codeBlock.StdErr,
+		ExitCode:        codeBlock.ExitCode,
+		Success:         codeBlock.Success,
+		Error:           codeBlock.Error,
+		TimedOut:        codeBlock.TimedOut,
+		SimilarityScore: codeBlock.SimilarityScore,
+		Attempts:        len(codeBlock.Attempts),
+		Duration:        codeBlock.Duration,
+	}
+}
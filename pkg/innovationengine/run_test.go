@@ -0,0 +1,123 @@
+package innovationengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const greetingScenario = "# Greeting\n\n" +
+	"## Set the name\n\n" +
+	"```bash\nexport NAME=world\n```\n\n" +
+	"## Greet\n\n" +
+	"```bash\necho \"hello $NAME\"\n```\n\n" +
+	"<!-- expected_similarity=1.0 -->\n\n" +
+	"```text\nhello world\n```\n"
+
+func TestLoadScenario(t *testing.T) {
+	scenario, err := LoadScenario([]byte(greetingScenario), LoadOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Greeting", scenario.Name)
+	require.Len(t, scenario.Steps, 2)
+	assert.Equal(t, "Set the name", scenario.Steps[0].Name)
+	require.Len(t, scenario.Steps[1].CodeBlocks, 1)
+	assert.Equal(t, "bash", scenario.Steps[1].CodeBlocks[0].Language)
+	assert.Equal(t, "hello world\n", scenario.Steps[1].CodeBlocks[0].ExpectedOutput)
+
+	_, err = LoadScenarioFile("https://example.com/scenario.md", LoadOptions{})
+	assert.ErrorContains(t, err, "use LoadScenarioURL")
+	_, err = LoadScenarioURL("scenario.md", LoadOptions{})
+	assert.ErrorContains(t, err, "not an http or https URL")
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Successful scenarios report their code blocks and events", func(t *testing.T) {
+		scenario, err := LoadScenario([]byte(greetingScenario), LoadOptions{})
+		require.NoError(t, err)
+
+		var types []EventType
+		stream := make(chan Event, 64)
+		result, err := Run(context.Background(), scenario, Options{
+			StateDirectory: t.TempDir(),
+			OnEvent:        func(event Event) { types = append(types, event.Type) },
+			Events:         stream,
+		})
+		require.NoError(t, err)
+
+		assert.True(t, result.Success)
+		require.Len(t, result.CodeBlocks, 2)
+		assert.Equal(t, "hello world\n", result.CodeBlocks[1].StdOut)
+		assert.Equal(t, 1, result.CodeBlocks[1].StepNumber)
+		assert.Equal(t, 1, result.CodeBlocks[1].Attempts)
+		assert.Equal(t, "world", result.EnvironmentVariables["NAME"])
+
+		assert.Equal(t, EventScenarioStart, types[0])
+		assert.Equal(t, EventScenarioEnd, types[len(types)-1])
+		assert.Contains(t, types, EventBlockCompare)
+		assert.Len(t, stream, len(types))
+	})
+
+	t.Run("Failing scenarios stop at the failed code block", func(t *testing.T) {
+		source := "# Failing\n\n## Fail\n\n```bash\necho before\nexit 3\n```\n\n## Never run\n\n```bash\necho after\n```\n"
+		scenario, err := LoadScenario([]byte(source), LoadOptions{})
+		require.NoError(t, err)
+
+		result, err := Run(context.Background(), scenario, Options{StateDirectory: t.TempDir()})
+		assert.ErrorContains(t, err, "failed to execute code block 0 on step 0")
+
+		assert.False(t, result.Success)
+		require.Len(t, result.CodeBlocks, 1)
+		assert.False(t, result.CodeBlocks[0].Success)
+		assert.Error(t, result.CodeBlocks[0].Error)
+	})
+
+	t.Run("Destructive commands can be extended", func(t *testing.T) {
+		source := "# Cleanup\n\n## Keep\n\n```bash\necho kept\n```\n\n## Purge\n\n```bash\npurge-everything --yes\n```\n"
+		scenario, err := LoadScenario([]byte(source), LoadOptions{})
+		require.NoError(t, err)
+
+		result, err := Run(context.Background(), scenario, Options{
+			StateDirectory:      t.TempDir(),
+			DoNotDelete:         true,
+			DestructiveCommands: []DestructiveCommand{{Command: "purge-everything"}},
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		require.Len(t, result.CodeBlocks, 1)
+		assert.Equal(t, "kept\n", result.CodeBlocks[0].StdOut)
+
+		_, err = Run(context.Background(), scenario, Options{
+			DestructiveCommands: []DestructiveCommand{{Command: "purge-everything", Flags: []string{"yes"}}},
+		})
+		assert.ErrorContains(t, err, `flag "yes" of destructive command "purge-everything"`)
+	})
+
+	t.Run("Policies stop scenarios before any code block runs", func(t *testing.T) {
+		scenario, err := LoadScenario([]byte(greetingScenario), LoadOptions{})
+		require.NoError(t, err)
+
+		result, err := Run(context.Background(), scenario, Options{
+			StateDirectory: t.TempDir(),
+			Policy:         &CommandPolicy{Commands: PolicyRules{Deny: []string{`^echo "hello`}}},
+		})
+		var violation *PolicyViolationError
+		require.ErrorAs(t, err, &violation)
+		assert.Equal(t, 1, violation.StepNumber)
+		assert.Equal(t, "commands.deny", violation.Violation.Rule)
+		assert.False(t, result.Success)
+		assert.Empty(t, result.CodeBlocks)
+
+		_, err = Run(context.Background(), scenario, Options{
+			Policy: &CommandPolicy{Commands: PolicyRules{Allow: []string{"(echo"}}},
+		})
+		assert.ErrorContains(t, err, `invalid policy: invalid command pattern "(echo"`)
+	})
+
+	t.Run("A scenario is required", func(t *testing.T) {
+		_, err := Run(context.Background(), &Scenario{}, Options{})
+		assert.ErrorContains(t, err, "no scenario to run")
+	})
+}
@@ -0,0 +1,130 @@
+// Package innovationengine runs executable documentation from Go programs.
+//
+// Scenarios are loaded from markdown with LoadScenario, LoadScenarioFile or
+// LoadScenarioURL and run with Run, which reports its progress through
+// events and returns a structured result. Nothing is written to stdout and no
+// terminal UI is started, scenarios run the way `ie test` runs them.
+package innovationengine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+)
+
+// Options for loading a scenario.
+type LoadOptions struct {
+	// Values for environment variables of the scenario, overriding the values
+	// declared by the document. Same as `--var` on the command line.
+	Variables map[string]string
+	// The languages of the code blocks to run. Defaults to the languages run
+	// by `ie test`.
+	Languages []string
+}
+
+// A scenario loaded from markdown.
+type Scenario struct {
+	Name string
+	// The yaml metadata of the document.
+	Properties map[string]interface{}
+	// The environment variables declared by the document and its INI file.
+	Environment map[string]string
+	Steps       []Step
+
+	scenario *common.Scenario
+}
+
+// A step of a scenario, i.e. the code blocks under one heading.
+type Step struct {
+	Name       string
+	CodeBlocks []CodeBlock
+}
+
+// A code block of a scenario.
+type CodeBlock struct {
+	Language    string
+	Content     string
+	Description string
+	// The output the code block is expected to produce, if any.
+	ExpectedOutput string
+}
+
+// Loads a scenario from markdown. Documents linked from the markdown with
+// relative paths are resolved against the current directory.
+func LoadScenario(source []byte, options LoadOptions) (*Scenario, error) {
+	scenario, err := common.CreateScenarioFromMarkdownSource(
+		source,
+		"",
+		options.languages(),
+		lib.CopyMap(options.Variables),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return newScenario(scenario), nil
+}
+
+// Loads a scenario from a markdown file.
+func LoadScenarioFile(path string, options LoadOptions) (*Scenario, error) {
+	if isURL(path) {
+		return nil, fmt.Errorf("'%s' is a URL, use LoadScenarioURL to load it", path)
+	}
+	return loadScenario(path, options)
+}
+
+// Loads a scenario from a markdown document served over http or https.
+func LoadScenarioURL(url string, options LoadOptions) (*Scenario, error) {
+	if !isURL(url) {
+		return nil, fmt.Errorf("'%s' is not an http or https URL", url)
+	}
+	return loadScenario(url, options)
+}
+
+func loadScenario(path string, options LoadOptions) (*Scenario, error) {
+	scenario, err := common.CreateScenarioFromMarkdown(
+		path,
+		options.languages(),
+		lib.CopyMap(options.Variables),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return newScenario(scenario), nil
+}
+
+func (options LoadOptions) languages() []string {
+	if len(options.Languages) == 0 {
+		return common.ExecutableLanguages
+	}
+	return options.Languages
+}
+
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+func newScenario(scenario *common.Scenario) *Scenario {
+	steps := make([]Step, 0, len(scenario.Steps))
+	for _, step := range scenario.Steps {
+		codeBlocks := make([]CodeBlock, 0, len(step.CodeBlocks))
+		for _, codeBlock := range step.CodeBlocks {
+			codeBlocks = append(codeBlocks, CodeBlock{
+				Language:       codeBlock.Language,
+				Content:        codeBlock.Content,
+				Description:    codeBlock.Description,
+				ExpectedOutput: codeBlock.ExpectedOutput.Content,
+			})
+		}
+		steps = append(steps, Step{Name: step.Name, CodeBlocks: codeBlocks})
+	}
+
+	return &Scenario{
+		Name:        scenario.Name,
+		Properties:  scenario.Properties,
+		Environment: lib.CopyMap(scenario.Environment),
+		Steps:       steps,
+		scenario:    scenario,
+	}
+}
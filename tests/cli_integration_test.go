@@ -44,7 +44,7 @@ func TestCLIIntegrationExecuteCommand(t *testing.T) {
 		"execute", scenarioPath,
 	)
 	runCmd.Dir = binDir
-	runCmd.Env = append(os.Environ(), "IE_LOG_PATH="+logPath)
+	runCmd.Env = append(os.Environ(), "IE_LOG_PATH="+logPath, "IE_STATE_DIR="+filepath.Join(binDir, "state"))
 	output, err := runCmd.CombinedOutput()
 	if err != nil {
 		t.Fatalf("ie execute failed: %v\nOutput: %s", err, string(output))